@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"diet-bot/config"
+	"diet-bot/internal/db"
+	"diet-bot/internal/models"
+	"diet-bot/internal/nutrition"
+	"diet-bot/pkg/logger"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+const foodsUsage = "usage: diet-bot foods [import [-source name] [-batch n] file.csv | search query]"
+
+// runFoods implements the "foods" subcommand, which fills and checks the food
+// composition database
+func runFoods(cfg *config.Config, l *logger.Logger, args []string) {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, foodsUsage)
+		os.Exit(2)
+	}
+
+	switch args[0] {
+	case "import":
+		flags := flag.NewFlagSet("foods import", flag.ExitOnError)
+		source := flags.String("source", "custom", "dataset name stored with each food; re-importing a source updates it")
+		batchSize := flags.Int("batch", 500, "foods saved per transaction")
+		flags.Parse(args[1:])
+		if flags.NArg() != 1 || *batchSize < 1 {
+			fmt.Fprintln(os.Stderr, foodsUsage)
+			os.Exit(2)
+		}
+
+		file, err := os.Open(flags.Arg(0))
+		if err != nil {
+			l.Fatal("Failed to open food table", err)
+		}
+		defer file.Close()
+
+		database := connectDB(cfg, l)
+		defer database.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Hour)
+		defer cancel()
+
+		started := time.Now()
+		stats, err := nutrition.ImportFoods(file, *source, *batchSize, func(batch []*models.Food) error {
+			return database.WithTx(ctx, func(tx db.Store) error {
+				return tx.UpsertFoods(ctx, batch)
+			})
+		})
+		if err != nil {
+			l.Fatal(fmt.Sprintf("Food import failed after %d food(s)", stats.Imported), err)
+		}
+		fmt.Printf("Imported %d food(s), skipped %d row(s) in %s\n", stats.Imported, stats.Skipped, time.Since(started).Round(time.Second))
+
+	case "search":
+		if len(args) < 2 {
+			fmt.Fprintln(os.Stderr, foodsUsage)
+			os.Exit(2)
+		}
+
+		database := connectDB(cfg, l)
+		defer database.Close()
+
+		matches, err := database.SearchFoods(context.Background(), strings.Join(args[1:], " "), 10)
+		if err != nil {
+			l.Fatal("Food search failed", err)
+		}
+		for _, m := range matches {
+			fmt.Printf("%.2f  %-50s  %6.1f kcal  P %5.1f  F %5.1f  C %5.1f  (%s:%s)\n",
+				m.Score, m.Name, m.Calories, m.Protein, m.Fat, m.Carbs, m.Source, m.ExternalID)
+		}
+
+	default:
+		fmt.Fprintln(os.Stderr, foodsUsage)
+		os.Exit(2)
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"diet-bot/internal/gpt"
 	"diet-bot/internal/payment"
 	"diet-bot/internal/server"
+	"diet-bot/internal/stt"
 	"diet-bot/pkg/logger"
 	"errors"
 	"net/http"
@@ -16,11 +17,13 @@ import (
 	"os/signal"
 	"syscall"
 	"time"
+
+	// User time zones must resolve even in images without zoneinfo
+	_ "time/tzdata"
 )
 
 func main() {
 	l := logger.New()
-	l.Info("Starting Fitness Diet Bot...")
 
 	// Load configuration
 	cfg, err := config.Load()
@@ -28,6 +31,20 @@ func main() {
 		l.Fatal("Failed to load config", err)
 	}
 
+	// "diet-bot migrate ..." manages the schema and exits
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		runMigrate(cfg, l, os.Args[2:])
+		return
+	}
+
+	// "diet-bot foods ..." imports and searches the food database
+	if len(os.Args) > 1 && os.Args[1] == "foods" {
+		runFoods(cfg, l, os.Args[2:])
+		return
+	}
+
+	l.Info("Starting Fitness Diet Bot...")
+
 	// Validate critical configuration
 	if cfg.Telegram.Token == "" {
 		l.Fatal("Telegram token is not configured")
@@ -39,41 +56,59 @@ func main() {
 		l.Fatal("GPT API key is not configured")
 	}
 
-	// Initialize database connection with retry
-	var database *db.PostgresDB
-	maxRetries := 5
-	for i := 0; i < maxRetries; i++ {
-		database, err = db.NewPostgresDB(cfg.DB)
-		if err == nil {
-			break
+	database := connectDB(cfg, l)
+	defer database.Close()
+
+	// Bring the schema up to date before anything touches it
+	if cfg.AutoMigrate {
+		applied, err := migrateUp(database)
+		if err != nil {
+			l.Fatal("Failed to apply database migrations", err)
 		}
-		l.Error("Failed to connect to database, retrying...", err)
-		time.Sleep(time.Duration(i+1) * time.Second)
+		l.Info("Database schema is up to date", "applied", applied)
 	}
-	if database == nil {
-		l.Fatal("Failed to connect to database after multiple attempts", err)
-	}
-	defer database.Close()
 
 	// Initialize Stripe client
 	stripeClient := payment.NewStripeClient(cfg.Stripe)
 
 	// Initialize GPT client
-	gptClient := gpt.NewClient(cfg.GPT.APIKey).WithModel(cfg.GPT.Model)
+	gptClient := gpt.NewClient(cfg.GPT.APIKey)
+	if cfg.GPT.BaseURL != "" {
+		gptClient = gpt.NewClientWithBaseURL(cfg.GPT.APIKey, cfg.GPT.BaseURL)
+	}
+	gptClient = gptClient.WithModel(cfg.GPT.Model).WithVisionModel(cfg.GPT.VisionModel)
 
 	// Create and start bot
-	telegramBot, err := bot.NewTelegramBot(cfg.Telegram.Token, database, stripeClient, gptClient, l)
+	telegramBot, err := bot.NewTelegramBot(cfg.Telegram, database, stripeClient, gptClient, l)
 	if err != nil {
 		l.Fatal("Failed to create Telegram bot", err)
 	}
 
+	// Voice messages need a speech-to-text provider
+	transcriber, err := stt.New(cfg.STT)
+	if err != nil {
+		l.Fatal("Failed to configure speech-to-text", err)
+	}
+	telegramBot.WithTranscriber(transcriber).WithFreeRevisions(cfg.Plans.FreeRevisions).
+		WithCalendarFeed(cfg.Server.PublicURL, cfg.Server.FeedSecret)
+
+	// Background jobs run until shutdown
+	jobsCtx, stopJobs := context.WithCancel(context.Background())
+	defer stopJobs()
+
 	// Start the bot to receive updates - this is the critical part that was missing!
 	l.Info("Starting Telegram bot...")
-	if err := telegramBot.Start(context.Background()); err != nil {
+	if err := telegramBot.Start(jobsCtx); err != nil {
 		l.Fatal("Failed to start Telegram bot", err)
 	}
 	l.Info("Telegram bot started successfully")
 
+	// Catch payments whose webhook never arrived
+	telegramBot.StartReconciler(jobsCtx, cfg.Reconciler.Interval, cfg.Reconciler.Lookback, cfg.Reconciler.AbandonAfter)
+	telegramBot.StartOutboxDispatcher(jobsCtx, 30*time.Second)
+	telegramBot.StartReminderScheduler(jobsCtx, cfg.Reminders.Interval, cfg.Reminders.MaxJitter)
+	telegramBot.StartWeeklyReports(jobsCtx, cfg.Reports.Interval)
+
 	// Start webhook server
 	httpServer := server.NewServer(cfg.Server.Port, telegramBot, l)
 	go func() {
@@ -89,6 +124,7 @@ func main() {
 	<-quit
 
 	l.Info("Shutting down bot...")
+	stopJobs()
 
 	// Create context for graceful shutdown
 	ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
@@ -106,3 +142,22 @@ func main() {
 
 	l.Info("Bot stopped successfully")
 }
+
+// connectDB opens the database connection, retrying while Postgres starts up
+func connectDB(cfg *config.Config, l *logger.Logger) *db.PostgresDB {
+	var database *db.PostgresDB
+	var err error
+	maxRetries := 5
+	for i := 0; i < maxRetries; i++ {
+		database, err = db.NewPostgresDB(cfg.DB)
+		if err == nil {
+			break
+		}
+		l.Error("Failed to connect to database, retrying...", err)
+		time.Sleep(time.Duration(i+1) * time.Second)
+	}
+	if database == nil {
+		l.Fatal("Failed to connect to database after multiple attempts", err)
+	}
+	return database
+}
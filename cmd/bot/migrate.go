@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"diet-bot/config"
+	"diet-bot/internal/db"
+	"diet-bot/migrations"
+	"diet-bot/pkg/logger"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+const migrateUsage = "usage: diet-bot migrate [up | down [steps] | status]"
+
+// runMigrate implements the "migrate" subcommand
+func runMigrate(cfg *config.Config, l *logger.Logger, args []string) {
+	command := "up"
+	if len(args) > 0 {
+		command = args[0]
+	}
+
+	database := connectDB(cfg, l)
+	defer database.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+
+	all, err := db.LoadMigrations(migrations.FS)
+	if err != nil {
+		l.Fatal("Failed to load migrations", err)
+	}
+
+	switch command {
+	case "up":
+		applied, err := database.Migrate(ctx, all)
+		if err != nil {
+			l.Fatal("Migration failed", err)
+		}
+		fmt.Printf("Applied %d migration(s) %v\n", len(applied), applied)
+
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			steps, err = strconv.Atoi(args[1])
+			if err != nil || steps < 1 {
+				fmt.Fprintln(os.Stderr, migrateUsage)
+				os.Exit(2)
+			}
+		}
+		reverted, err := database.Rollback(ctx, all, steps)
+		if err != nil {
+			l.Fatal("Rollback failed", err)
+		}
+		fmt.Printf("Reverted %d migration(s) %v\n", len(reverted), reverted)
+
+	case "status":
+		states, err := database.MigrationStatus(ctx, all)
+		if err != nil {
+			l.Fatal("Failed to read migration status", err)
+		}
+		for _, state := range states {
+			applied := "pending"
+			if state.AppliedAt != nil {
+				applied = state.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Printf("%04d  %-30s  %s\n", state.Version, state.Name, applied)
+		}
+
+	default:
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		os.Exit(2)
+	}
+}
+
+// migrateUp applies all pending embedded migrations
+func migrateUp(database *db.PostgresDB) ([]int64, error) {
+	all, err := db.LoadMigrations(migrations.FS)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	return database.Migrate(ctx, all)
+}
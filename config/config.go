@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"github.com/joho/godotenv"
 	"os"
+	"strconv"
 	"strings"
 	"time"
 
@@ -12,7 +13,9 @@ import (
 
 type Config struct {
 	Telegram struct {
-		Token string
+		Token       string
+		AdminIDs    []int64
+		APIEndpoint string
 	}
 	DB struct {
 		Host         string
@@ -31,15 +34,50 @@ type Config struct {
 		WebhookKey string
 		ProductID  string
 		PriceID    string
+		APIBase    string
 	}
 	GPT struct {
-		APIKey string
-		Model  string
+		APIKey      string
+		Model       string
+		VisionModel string // reads meal photos
+		BaseURL     string
+	}
+	// STT transcribes voice messages; the provider is "openai" (any
+	// OpenAI-compatible API), "whisper" (a whisper.cpp server) or "none"
+	STT struct {
+		Provider string
+		BaseURL  string
+		APIKey   string
+		Model    string
+		Language string
 	}
 	Server struct {
 		Port string
+		// PublicURL is where users reach the server, for calendar feed links
+		PublicURL string
+		// FeedSecret signs calendar feed links; feeds are off without it
+		FeedSecret string
+	}
+	Reconciler struct {
+		Interval     time.Duration
+		Lookback     time.Duration
+		AbandonAfter time.Duration
+	}
+	Reminders struct {
+		Interval  time.Duration
+		MaxJitter time.Duration
+	}
+	Reports struct {
+		// Interval is how often the weekly report job looks for due reports
+		Interval time.Duration
+	}
+	Plans struct {
+		// FreeRevisions is how many times /regenerate may change a paid plan
+		FreeRevisions int
 	}
 	ShutdownTimeout time.Duration
+	// AutoMigrate applies pending schema migrations on startup
+	AutoMigrate bool
 }
 
 // Load loads the configuration
@@ -68,11 +106,23 @@ func Load() (*Config, error) {
 
 	// Set default values
 	v.SetDefault("ShutdownTimeout", 10*time.Second)
-	v.SetDefault("GPT.Model", "gpt-4")
+	v.SetDefault("AutoMigrate", true)
+	v.SetDefault("GPT.Model", "gpt-4o")
+	v.SetDefault("GPT.VisionModel", "gpt-4o")
+	v.SetDefault("STT.Provider", "openai")
+	v.SetDefault("STT.Model", "whisper-1")
+	v.SetDefault("STT.Language", "ru")
 	v.SetDefault("Server.Port", "8080")
 	v.SetDefault("DB.MaxOpenConns", 20)
 	v.SetDefault("DB.MaxIdleConns", 10)
 	v.SetDefault("DB.ConnLifetime", 5*time.Minute)
+	v.SetDefault("Reconciler.Interval", 15*time.Minute)
+	v.SetDefault("Reconciler.Lookback", 72*time.Hour)
+	v.SetDefault("Reconciler.AbandonAfter", 24*time.Hour)
+	v.SetDefault("Reminders.Interval", 30*time.Second)
+	v.SetDefault("Reminders.MaxJitter", 2*time.Minute)
+	v.SetDefault("Reports.Interval", time.Hour)
+	v.SetDefault("Plans.FreeRevisions", 3)
 
 	// Enable environment variables to override config values
 	v.AutomaticEnv()
@@ -101,10 +151,40 @@ func Load() (*Config, error) {
 		cfg.Stripe.WebhookKey = os.Getenv("STRIPE_WEBHOOK_KEY")
 		cfg.Stripe.ProductID = os.Getenv("STRIPE_PRODUCT_ID")
 		cfg.Stripe.PriceID = os.Getenv("STRIPE_PRICE_ID")
+		cfg.Stripe.APIBase = os.Getenv("STRIPE_API_BASE")
 		cfg.GPT.APIKey = os.Getenv("GPT_API_KEY")
-		cfg.GPT.Model = getEnvOr("GPT_MODEL", "gpt-4")
+		cfg.GPT.Model = getEnvOr("GPT_MODEL", "gpt-4o")
+		cfg.GPT.VisionModel = getEnvOr("GPT_VISION_MODEL", "gpt-4o")
+		cfg.GPT.BaseURL = os.Getenv("GPT_BASE_URL")
+		cfg.STT.Provider = getEnvOr("STT_PROVIDER", "openai")
+		cfg.STT.BaseURL = os.Getenv("STT_BASE_URL")
+		cfg.STT.APIKey = os.Getenv("STT_API_KEY")
+		cfg.STT.Model = getEnvOr("STT_MODEL", "whisper-1")
+		cfg.STT.Language = getEnvOr("STT_LANGUAGE", "ru")
 		cfg.Server.Port = getEnvOr("SERVER_PORT", "8080")
+		cfg.Server.PublicURL = os.Getenv("SERVER_PUBLIC_URL")
+		cfg.Server.FeedSecret = os.Getenv("CALENDAR_FEED_SECRET")
+		cfg.Telegram.AdminIDs = parseIDList(os.Getenv("TELEGRAM_ADMIN_IDS"))
+		cfg.Telegram.APIEndpoint = os.Getenv("TELEGRAM_API_ENDPOINT")
 
+		cfg.Reconciler.Interval = 15 * time.Minute
+		cfg.Reconciler.Lookback = 72 * time.Hour
+		cfg.Reconciler.AbandonAfter = 24 * time.Hour
+		cfg.Reminders.Interval = 30 * time.Second
+		cfg.Reminders.MaxJitter = 2 * time.Minute
+		cfg.Reports.Interval = time.Hour
+		freeRevisions, err := strconv.Atoi(getEnvOr("PLAN_FREE_REVISIONS", "3"))
+		if err != nil {
+			return nil, fmt.Errorf("invalid PLAN_FREE_REVISIONS: %w", err)
+		}
+		cfg.Plans.FreeRevisions = freeRevisions
+		cfg.ShutdownTimeout = 10 * time.Second
+		cfg.AutoMigrate = getEnvOr("AUTO_MIGRATE", "true") == "true"
+		cfg.defaultSTT()
+
+		if err := cfg.validate(); err != nil {
+			return nil, err
+		}
 		return cfg, nil
 	}
 
@@ -126,9 +206,73 @@ func Load() (*Config, error) {
 		return nil, fmt.Errorf("error unmarshaling config: %w", err)
 	}
 
+	// Admin IDs are a comma-separated list that viper cannot expand from ${...}
+	cfg.Telegram.AdminIDs = parseIDList(os.Getenv("TELEGRAM_ADMIN_IDS"))
+
+	// Optional overrides that must stay empty unless set, so they are not in config.yaml
+	if cfg.Stripe.APIBase == "" {
+		cfg.Stripe.APIBase = os.Getenv("STRIPE_API_BASE")
+	}
+	if cfg.Telegram.APIEndpoint == "" {
+		cfg.Telegram.APIEndpoint = os.Getenv("TELEGRAM_API_ENDPOINT")
+	}
+	if cfg.GPT.BaseURL == "" {
+		cfg.GPT.BaseURL = os.Getenv("GPT_BASE_URL")
+	}
+	if cfg.Server.PublicURL == "" {
+		cfg.Server.PublicURL = os.Getenv("SERVER_PUBLIC_URL")
+	}
+	if cfg.Server.FeedSecret == "" {
+		cfg.Server.FeedSecret = os.Getenv("CALENDAR_FEED_SECRET")
+	}
+	if model := os.Getenv("GPT_VISION_MODEL"); model != "" {
+		cfg.GPT.VisionModel = model
+	}
+	for env, field := range map[string]*string{
+		"STT_PROVIDER": &cfg.STT.Provider,
+		"STT_MODEL":    &cfg.STT.Model,
+		"STT_LANGUAGE": &cfg.STT.Language,
+	} {
+		if value := os.Getenv(env); value != "" {
+			*field = value
+		}
+	}
+	if cfg.STT.BaseURL == "" {
+		cfg.STT.BaseURL = os.Getenv("STT_BASE_URL")
+	}
+	if cfg.STT.APIKey == "" {
+		cfg.STT.APIKey = os.Getenv("STT_API_KEY")
+	}
+	cfg.defaultSTT()
+
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
 	return &cfg, nil
 }
 
+// validate rejects values the bot cannot run with.
+func (cfg *Config) validate() error {
+	if cfg.Plans.FreeRevisions < 0 {
+		return fmt.Errorf("free plan revisions must not be negative, got %d", cfg.Plans.FreeRevisions)
+	}
+	return nil
+}
+
+// defaultSTT points the OpenAI transcriber at the GPT account unless it has
+// its own.
+func (cfg *Config) defaultSTT() {
+	if cfg.STT.Provider != "openai" {
+		return
+	}
+	if cfg.STT.APIKey == "" {
+		cfg.STT.APIKey = cfg.GPT.APIKey
+	}
+	if cfg.STT.BaseURL == "" {
+		cfg.STT.BaseURL = cfg.GPT.BaseURL
+	}
+}
+
 // Helper function to get environment variable with default value
 func getEnvOr(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
@@ -136,3 +280,15 @@ func getEnvOr(key, defaultValue string) string {
 	}
 	return defaultValue
 }
+
+// parseIDList parses a comma-separated list of Telegram user IDs, skipping invalid entries
+func parseIDList(value string) []int64 {
+	var ids []int64
+	for _, part := range strings.Split(value, ",") {
+		id, err := strconv.ParseInt(strings.TrimSpace(part), 10, 64)
+		if err == nil {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
@@ -0,0 +1,121 @@
+package bot
+
+import (
+	"context"
+	"diet-bot/internal/calendar"
+	"diet-bot/internal/db"
+	"diet-bot/internal/models"
+	"errors"
+	"fmt"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// calendarCycles is how many times the plan repeats in a sent .ics file; the
+// feed repeats it for as long as it is subscribed.
+const calendarCycles = 4
+
+// WithCalendarFeed enables per-user calendar feed links on the server at
+// baseURL, signed with secret. Without it /calendar only sends the file.
+func (t *TelegramBot) WithCalendarFeed(baseURL, secret string) *TelegramBot {
+	if baseURL != "" && secret != "" {
+		t.feedBaseURL, t.feedSecret = baseURL, secret
+	}
+	return t
+}
+
+// handleCalendarCommand sends the meal times of the latest plan as an .ics file.
+func (t *TelegramBot) handleCalendarCommand(message *tgbotapi.Message) {
+	chatID := message.Chat.ID
+
+	user, plan, ok := t.loadPlanForRevision(context.Background(), chatID, message.From.ID)
+	if !ok {
+		return
+	}
+	if plan.Data == nil || len(plan.Data.Days) == 0 {
+		t.bot.Send(tgbotapi.NewMessage(chatID, "Этот план составлен в старом формате без времени приёмов пищи, поэтому добавить его в календарь не получится. "+
+			"Обновите план через /regenerate — и календарь станет доступен."))
+		return
+	}
+
+	now := time.Now()
+	ics := calendar.Build(plan.Data, calendar.Options{
+		PlanID:   plan.ID,
+		Location: user.Location(),
+		Start:    currentCycleStart(planStart(user, plan), len(plan.Data.Days), now.In(user.Location())),
+		Cycles:   calendarCycles,
+		Now:      now,
+	})
+
+	caption := fmt.Sprintf("📅 Приёмы пищи по плану на %d дн. Откройте файл, чтобы добавить их в календарь.", len(plan.Data.Days)*calendarCycles)
+	if t.feedSecret != "" {
+		caption += "\n\nЧтобы календарь сам обновлялся вместе с планом, подпишитесь на него по ссылке (в Google Календаре: «Добавить календарь» → «По URL»):\n" +
+			calendar.FeedURL(t.feedBaseURL, t.feedSecret, user.ID)
+	}
+	doc := tgbotapi.NewDocument(chatID, tgbotapi.FileBytes{Name: "diet-plan.ics", Bytes: ics})
+	doc.Caption = caption
+	if _, err := t.bot.Send(doc); err != nil {
+		t.logger.Error("Failed to send calendar", "error", err, "userID", user.ID)
+	}
+}
+
+// HandleCalendarFeed serves the latest plan of the user a feed link was
+// signed for.
+func (t *TelegramBot) HandleCalendarFeed(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	token, ok := strings.CutSuffix(strings.TrimPrefix(r.URL.Path, calendar.FeedPath), ".ics")
+	if !ok || t.feedSecret == "" {
+		http.NotFound(w, r)
+		return
+	}
+	userID, ok := calendar.ParseFeedToken(t.feedSecret, token)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	ctx := r.Context()
+	user, err := t.db.GetUserByID(ctx, userID)
+	var plan *models.DietPlan
+	if err == nil {
+		plan, err = t.db.GetDietPlan(ctx, user.ID)
+	}
+	if errors.Is(err, db.ErrNotFound) || (err == nil && (plan.Data == nil || len(plan.Data.Days) == 0)) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		t.logger.Error("Failed to load plan for calendar feed", "error", err, "userID", userID)
+		http.Error(w, "Internal error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Write(calendar.Build(plan.Data, calendar.Options{
+		PlanID:   plan.ID,
+		Location: user.Location(),
+		Start:    planStart(user, plan),
+		Now:      time.Now(),
+	}))
+}
+
+// planStart is the date of the plan's day 1: the day it was made, in the
+// user's time zone. It stays put, so the feed does not shift between fetches.
+func planStart(user *models.User, plan *models.DietPlan) time.Time {
+	return models.Day(plan.CreatedAt.In(user.Location()))
+}
+
+// currentCycleStart moves start forward by whole runs of the plan to the run
+// that includes now, so a sent file keeps the feed's day numbering.
+func currentCycleStart(start time.Time, days int, now time.Time) time.Time {
+	elapsed := int(models.Day(now).Sub(start).Hours()/24) / days
+	if elapsed <= 0 {
+		return start
+	}
+	return start.AddDate(0, 0, elapsed*days)
+}
@@ -0,0 +1,1176 @@
+package bot
+
+import (
+	"bytes"
+	"context"
+	"diet-bot/internal/bot/telegramtest"
+	"diet-bot/internal/calendar"
+	"diet-bot/internal/gpt"
+	"diet-bot/internal/models"
+	"diet-bot/internal/safety"
+	"fmt"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestOnboardingConversation(t *testing.T) {
+	h := newHarness(t)
+	const user = int64(101)
+
+	start := h.say(user, "/start", 1)[0]
+	assertContains(t, start.Text(), "укажите ваш пол")
+	assertButtons(t, start, "Мужской", "Женский")
+
+	assertContains(t, h.say(user, "Не скажу", 1)[0].Text(), "выберите пол")
+	assertContains(t, h.say(user, "Женский", 1)[0].Text(), "рост в сантиметрах")
+	assertContains(t, h.say(user, "сто семьдесят", 1)[0].Text(), "корректный рост")
+	assertContains(t, h.say(user, "170", 1)[0].Text(), "вес в килограммах")
+	assertContains(t, h.say(user, "20", 1)[0].Text(), "корректный вес")
+
+	goal := h.say(user, "65", 1)[0]
+	assertContains(t, goal.Text(), "Какая у вас цель")
+	assertButtons(t, goal, "Снизить вес", "Поддерживать вес", "Набрать вес")
+
+	where := h.say(user, "Поддерживать вес", 1)[0]
+	assertContains(t, where.Text(), "В каком городе вы живёте")
+	assertButtons(t, where, "📍 Отправить местоположение", "Москва", "Новосибирск", "Екатеринбург")
+	assertContains(t, h.say(user, "Атлантида", 1)[0].Text(), "Не нашёл такой город")
+
+	assertContains(t, h.say(user, "г. Новосибирск", 1)[0].Text(), "Сколько вам полных лет")
+	assertContains(t, h.say(user, "тридцать", 1)[0].Text(), "введите возраст числом")
+
+	health := h.say(user, "34", 1)[0]
+	assertContains(t, health.Text(), "Отметьте всё, что к вам относится")
+	assertButtons(t, health, "⬜️ 🤰 Беременность или кормление грудью", "⬜️ 🩸 Сахарный диабет",
+		"⬜️ 🍽 Расстройство пищевого поведения", "⬜️ 🫘 Болезни почек", "Ничего из этого")
+	assertContains(t, h.say(user, "нет", 1)[0].Text(), "кнопками под вопросом о здоровье")
+
+	checked := h.press(user, health.CallbackData("⬜️ 🩸 Сахарный диабет"), 1)[0]
+	assertButtons(t, checked, "⬜️ 🤰 Беременность или кормление грудью", "✅ 🩸 Сахарный диабет",
+		"⬜️ 🍽 Расстройство пищевого поведения", "⬜️ 🫘 Болезни почек", "Готово")
+
+	calls := h.press(user, checked.CallbackData("Готово"), 2)
+	assertContains(t, calls[0].Text(), "Здоровье: сахарный диабет")
+	summary := calls[1]
+	assertContains(t, summary.Text(), "Пол: Женский\nРост: 170 см\nВес: 65 кг\nЦель: Поддерживать вес\nЧасовой пояс: Asia/Novosibirsk, UTC+7 (Новосибирск)\nВозраст: 34\nЗдоровье: сахарный диабет")
+	assertButtons(t, summary, "Да, всё верно", "Нет, изменить")
+
+	restart := h.say(user, "Нет, изменить", 1)[0]
+	assertContains(t, restart.Text(), "Давайте начнем заново")
+	assertButtons(t, restart, "Мужской", "Женский")
+}
+
+func TestMessageWithoutDialogAsksToStart(t *testing.T) {
+	h := newHarness(t)
+
+	reply := h.say(202, "привет", 1)[0]
+	assertContains(t, reply.Text(), "используйте /start")
+
+	reply = h.say(202, "/nonsense", 1)[0]
+	assertContains(t, reply.Text(), "Неизвестная команда")
+}
+
+func TestPaymentConversation(t *testing.T) {
+	h := newHarness(t)
+	const user = int64(303)
+
+	h.onboard(user)
+	replies := h.say(user, "Да, всё верно", 2)
+	assertContains(t, replies[0].Text(), "требуется оплата")
+	assertButtons(t, replies[1], "Оплатить")
+
+	sessions := h.stripe.Sessions()
+	if len(sessions) != 1 || sessions[0].ClientReferenceID != fmt.Sprint(user) {
+		t.Fatalf("unexpected checkout sessions: %+v", sessions)
+	}
+	if url := replies[1].CallbackData("Оплатить"); url != "https://checkout.stripe.test/pay/"+sessions[0].ID {
+		t.Fatalf("payment button points to %q", url)
+	}
+
+	ctx := context.Background()
+	p, err := h.store.GetPaymentByStripeID(ctx, sessions[0].ID)
+	if err != nil || p.Status != models.PaymentStatusPending {
+		t.Fatalf("payment before webhook: %+v, %v", p, err)
+	}
+
+	payload, signature, err := h.stripe.CompleteSession(sessions[0].ID)
+	if err != nil {
+		t.Fatalf("CompleteSession: %v", err)
+	}
+	if code := h.deliverWebhook(payload, strings.Replace(signature, "v1=", "v1=00", 1)); code != http.StatusBadRequest {
+		t.Fatalf("webhook with bad signature: status %d", code)
+	}
+	if code := h.deliverWebhook(payload, signature); code != http.StatusOK {
+		t.Fatalf("webhook status = %d", code)
+	}
+
+	plan := h.expect(user, 1)[0]
+	assertContains(t, plan.Text(), "план питания готов")
+	assertContains(t, plan.Text(), testPlanDish)
+	assertContains(t, plan.Text(), "не заменяет консультацию врача")
+
+	p, err = h.store.GetPaymentByStripeID(ctx, sessions[0].ID)
+	if err != nil || p.Status != models.PaymentStatusCompleted || p.StripePaymentIntentID == "" {
+		t.Fatalf("payment after webhook: %+v, %v", p, err)
+	}
+
+	// A redelivered event must not produce a second plan
+	if code := h.deliverWebhook(payload, signature); code != http.StatusOK {
+		t.Fatalf("redelivered webhook status = %d", code)
+	}
+	isPlan := func(c telegramtest.Call) bool {
+		return telegramtest.IsSend(c) && c.ChatID() == user && strings.Contains(c.Text(), "план питания готов")
+	}
+	if plans, err := h.telegram.WaitForCalls(1, 1, isPlan, 300*time.Millisecond); err == nil {
+		t.Fatalf("redelivered event sent a second plan: %q", plans[0].Text())
+	}
+	help := h.say(user, "/help", 1)[0].Text()
+	assertContains(t, help, "Я бот для создания")
+	assertContains(t, help, "\n/measure — записать обхваты и следить за процентом жира\n")
+	if lines := strings.Count(help, "\n/"); lines != len(helpCommands) {
+		t.Fatalf("/help lists %d commands, want %d", lines, len(helpCommands))
+	}
+}
+
+func TestRefundConversation(t *testing.T) {
+	h := newHarness(t)
+	const user = int64(404)
+
+	p := h.purchase(user)
+
+	denied := h.say(user, fmt.Sprintf("/refund %d", p.ID), 1)[0]
+	assertContains(t, denied.Text(), "Неизвестная команда")
+
+	reply := h.say(testAdminID, fmt.Sprintf("/refund %d", p.ID), 1)[0]
+	assertContains(t, reply.Text(), "создан")
+	if refunds := h.stripe.Refunds(); len(refunds) != 1 || refunds[0].PaymentIntentID != p.StripePaymentIntentID {
+		t.Fatalf("unexpected refunds: %+v", refunds)
+	}
+
+	payload, signature, err := h.stripe.ChargeRefundedEvent(p.StripePaymentIntentID, h.stripe.AmountTotal)
+	if err != nil {
+		t.Fatalf("ChargeRefundedEvent: %v", err)
+	}
+	if code := h.deliverWebhook(payload, signature); code != http.StatusOK {
+		t.Fatalf("refund webhook status = %d", code)
+	}
+
+	assertContains(t, h.expect(user, 1)[0].Text(), "Оплата возвращена")
+	assertContains(t, h.expect(testAdminID, 1)[0].Text(), "refunded")
+
+	ctx := context.Background()
+	p, err = h.store.GetPaymentByID(ctx, p.ID)
+	if err != nil || p.Status != models.PaymentStatusRefunded {
+		t.Fatalf("payment after refund: %+v, %v", p, err)
+	}
+	if _, err := h.store.GetDietPlan(ctx, p.UserID); err == nil {
+		t.Fatal("plan of a refunded payment is still returned")
+	}
+}
+
+func TestDisputeConversation(t *testing.T) {
+	h := newHarness(t)
+	const user = int64(414)
+	ctx := context.Background()
+
+	p := h.purchase(user)
+	dispute := func(eventType, status string) {
+		t.Helper()
+		payload, signature, err := h.stripe.SignedEvent(eventType, map[string]interface{}{
+			"id": "dp_test", "object": "dispute", "payment_intent": p.StripePaymentIntentID,
+			"reason": "fraudulent", "status": status,
+		})
+		if err != nil {
+			t.Fatalf("SignedEvent: %v", err)
+		}
+		if code := h.deliverWebhook(payload, signature); code != http.StatusOK {
+			t.Fatalf("%s webhook status = %d", eventType, code)
+		}
+	}
+	status := func(want string, refunded int64) {
+		t.Helper()
+		got, err := h.store.GetPaymentByID(ctx, p.ID)
+		if err != nil || got.Status != want || got.RefundedAmount != refunded {
+			t.Fatalf("payment = %+v, %v; want %s with %d refunded", got, err, want, refunded)
+		}
+	}
+
+	dispute("charge.dispute.created", "needs_response")
+	assertContains(t, h.expect(testAdminID, 1)[0].Text(), "Открыт спор")
+	status(models.PaymentStatusDisputed, 0)
+
+	// A partial refund during the dispute keeps it open
+	payload, signature, err := h.stripe.ChargeRefundedEvent(p.StripePaymentIntentID, 30000)
+	if err != nil {
+		t.Fatalf("ChargeRefundedEvent: %v", err)
+	}
+	if code := h.deliverWebhook(payload, signature); code != http.StatusOK {
+		t.Fatalf("refund webhook status = %d", code)
+	}
+	assertContains(t, h.expect(user, 1)[0].Text(), "частичный возврат")
+	h.expect(testAdminID, 1)
+	status(models.PaymentStatusDisputed, 30000)
+
+	// Winning the dispute leaves the partial refund in place
+	dispute("charge.dispute.closed", "won")
+	assertContains(t, h.expect(testAdminID, 1)[0].Text(), "закрыт: won")
+	status(models.PaymentStatusPartiallyRefunded, 30000)
+}
+
+func TestPlanHistoryConversation(t *testing.T) {
+	h := newHarness(t)
+	const user = int64(505)
+
+	assertContains(t, h.say(user, "/plans", 1)[0].Text(), "нет планов")
+
+	p := h.purchase(user)
+
+	history := h.say(user, "/plans", 1)[0].Text()
+	assertContains(t, history, "Пол: Мужской, рост: 180 см, вес: 80 кг, цель: Снизить")
+	assertContains(t, history, "Модель: gpt-4, промпт diet-plan-v3, токенов: 150")
+
+	plans, err := h.store.ListDietPlans(context.Background(), p.UserID, 10)
+	if err != nil || len(plans) != 1 {
+		t.Fatalf("ListDietPlans: %+v, %v", plans, err)
+	}
+
+	full := h.say(user, fmt.Sprintf("/plans %d", plans[0].ID), 1)[0].Text()
+	assertContains(t, full, testPlanDish)
+	assertContains(t, h.say(user, "/plans 999", 1)[0].Text(), "не найден")
+}
+
+func TestWeightConversation(t *testing.T) {
+	h := newHarness(t)
+	const user = int64(606)
+
+	assertContains(t, h.say(user, "/weight 80", 1)[0].Text(), "заполните анкету")
+
+	p := h.purchase(user)
+
+	assertContains(t, h.say(user, "/weight 12", 1)[0].Text(), "от 30 до 300")
+	assertContains(t, h.say(user, "/weight 79 31.12.2999", 1)[0].Text(), "в будущем")
+
+	reply := h.say(user, "/weight 79,4 вчера", 1)[0].Text()
+	assertContains(t, reply, "Записал 79.4 кг")
+
+	// An entry older than the questionnaire weight of today does not replace it
+	u, err := h.store.GetUserByID(context.Background(), p.UserID)
+	if err != nil || u.Weight != 80 {
+		t.Fatalf("profile weight after backdated log: %+v, %v", u, err)
+	}
+
+	reply = h.say(user, "/weight 78.6", 1)[0].Text()
+	assertContains(t, reply, "Записал 78.6 кг")
+	assertContains(t, reply, "Среднее за 7 дней: 79.0 кг")
+	assertContains(t, reply, "Темп: −5.6 кг в неделю")
+
+	u, err = h.store.GetUserByID(context.Background(), p.UserID)
+	if err != nil || u.Weight != 78.6 {
+		t.Fatalf("profile weight after latest log: %+v, %v", u, err)
+	}
+
+	history := h.say(user, "/weight", 1)[0].Text()
+	assertContains(t, history, "История веса")
+	assertContains(t, history, "78.6 кг")
+	assertContains(t, history, "79.4 кг")
+}
+
+func TestProgressChart(t *testing.T) {
+	h := newHarness(t)
+	const user = int64(707)
+
+	h.purchase(user)
+	h.say(user, "/weight 80.4 вчера", 1)
+
+	chart := h.say(user, "/progress", 1)[0]
+	if chart.Method != "sendPhoto" {
+		t.Fatalf("progress sent %s", chart.Method)
+	}
+	assertContains(t, chart.Text(), "цель: −0.5 кг в неделю")
+	assertContains(t, chart.Text(), "Среднее за 7 дней")
+
+	img, err := png.Decode(bytes.NewReader(chart.Files["photo"]))
+	if err != nil {
+		t.Fatalf("chart is not a PNG: %v", err)
+	}
+	if img.Bounds().Dx() == 0 {
+		t.Fatal("empty chart")
+	}
+}
+
+func TestRemindersConversation(t *testing.T) {
+	h := newHarness(t)
+	const user = int64(808)
+
+	h.purchase(user)
+
+	menu := h.say(user, "/reminders", 1)[0]
+	assertContains(t, menu.Text(), "💧 Вода: выключено")
+	assertButtons(t, menu, "Включить: еда", "Включить: вода", "Включить: взвешивание")
+
+	toggled := h.press(user, "reminders:water", 1)[0]
+	if toggled.Method != "editMessageText" {
+		t.Fatalf("toggle sent %s", toggled.Method)
+	}
+	assertContains(t, toggled.Text(), "💧 Вода: каждые 2 часа с 10:00 до 20:00")
+	assertButtons(t, toggled, "Включить: еда", "Выключить: вода", "Включить: взвешивание")
+
+	custom := h.say(user, "/reminders вес 07:45 пн,чт", 1)[0]
+	assertContains(t, custom.Text(), "⚖️ Взвешивание: 07:45 по дням: пн, чт")
+	assertContains(t, h.say(user, "/reminders вода 25:00", 1)[0].Text(), "Не понял расписание")
+
+	ctx := context.Background()
+	u, _ := h.store.GetUser(ctx, user)
+	reminders, err := h.store.ListReminders(ctx, u.ID)
+	if err != nil || len(reminders) != 2 {
+		t.Fatalf("ListReminders: %+v, %v", reminders, err)
+	}
+	due := reminders[0].NextRunAt
+	if reminders[1].NextRunAt.Before(due) {
+		due = reminders[1].NextRunAt
+	}
+
+	if sent, err := h.bot.runDueReminders(ctx, due, 0); err != nil || sent != 1 {
+		t.Fatalf("runDueReminders = %d, %v", sent, err)
+	}
+	nudge := h.expect(user, 1)[0].Text()
+	if !strings.Contains(nudge, "стакан воды") && !strings.Contains(nudge, "взвеситься") {
+		t.Fatalf("unexpected reminder %q", nudge)
+	}
+
+	// Runs missed while the bot was down are skipped, not sent late
+	reminders, _ = h.store.ListReminders(ctx, u.ID)
+	late := reminders[0].NextRunAt
+	if reminders[1].NextRunAt.After(late) {
+		late = reminders[1].NextRunAt
+	}
+	if sent, err := h.bot.runDueReminders(ctx, late.Add(2*time.Hour), 0); err != nil || sent != 0 {
+		t.Fatalf("stale runDueReminders = %d, %v", sent, err)
+	}
+
+	// A user who blocked the bot is marked and skipped from then on
+	h.telegram.Block(user)
+	reminders, _ = h.store.ListReminders(ctx, u.ID)
+	if sent, err := h.bot.runDueReminders(ctx, reminders[1].NextRunAt.Add(time.Minute), 0); err != nil || sent != 0 {
+		t.Fatalf("runDueReminders for blocked user = %d, %v", sent, err)
+	}
+	if u, err := h.store.GetUser(ctx, user); err != nil || u.BlockedAt == nil {
+		t.Fatalf("user not marked as blocked: %+v, %v", u, err)
+	}
+	if due, _ := h.store.ClaimDueReminders(ctx, time.Now().AddDate(1, 0, 0), 10); len(due) != 0 {
+		t.Fatalf("reminders of a blocked user are still due: %+v", due)
+	}
+}
+
+func TestTimezoneConversation(t *testing.T) {
+	h := newHarness(t)
+	const user = int64(909)
+	ctx := context.Background()
+
+	h.purchase(user)
+	u, _ := h.store.GetUser(ctx, user)
+	if u.Timezone != "Europe/Moscow" {
+		t.Fatalf("questionnaire timezone = %q", u.Timezone)
+	}
+
+	h.say(user, "/reminders вес 08:00", 1)
+
+	current := h.say(user, "/timezone", 1)[0]
+	assertContains(t, current.Text(), "Ваш часовой пояс: Europe/Moscow, UTC+3")
+	assertContains(t, h.say(user, "/timezone Атлантида", 1)[0].Text(), "Не нашёл такой город")
+
+	// A shared location resolves to the nearest listed city
+	h.telegram.SendMessage(user, map[string]interface{}{
+		"location": map[string]float64{"latitude": 43.12, "longitude": 131.89},
+	})
+	changed := h.expect(user, 1)[0]
+	assertContains(t, changed.Text(), "Asia/Vladivostok, UTC+10 (рядом с городом Владивосток)")
+
+	// Reminders keep their local time in the new zone
+	u, _ = h.store.GetUser(ctx, user)
+	reminders, err := h.store.ListReminders(ctx, u.ID)
+	if err != nil || len(reminders) != 1 {
+		t.Fatalf("ListReminders: %+v, %v", reminders, err)
+	}
+	r := reminders[0]
+	local := r.NextRunAt.In(u.Location())
+	if r.Timezone != "Asia/Vladivostok" || local.Hour() != 8 || local.Minute() != 0 {
+		t.Fatalf("reminder after timezone change: %s at %s", r.Timezone, local)
+	}
+
+	assertContains(t, h.say(user, "/timezone Europe/Berlin", 1)[0].Text(), "Часовой пояс: Europe/Berlin")
+}
+
+func TestFoodDiaryConversation(t *testing.T) {
+	h := newHarness(t)
+	const user = int64(1010)
+
+	h.purchase(user)
+
+	assertContains(t, h.say(user, "/eat", 1)[0].Text(), "Сегодня записей пока нет")
+
+	logged := h.say(user, "/eat овсянка 60г, банан", 1)[0].Text()
+	assertContains(t, logged, "• овсянка, 60 г — 213 ккал\n• банан, 120 г — 107 ккал\nИтого: 320 ккал (Б 9 / Ж 4 / У 64 г)")
+	// 180 cm, 80 kg man losing weight: 2080 kcal
+	assertContains(t, logged, "Сегодня: 320 из 2080 ккал, осталось 1760.")
+
+	// A plain message after the purchase is logged the same way
+	assertContains(t, h.say(user, "овсянка 60г, банан", 1)[0].Text(), "Сегодня: 640 из 2080 ккал")
+	assertContains(t, h.say(user, "привет", 1)[0].Text(), "Не нашёл в сообщении еды")
+
+	diary := h.say(user, "/eat", 1)[0].Text()
+	assertContains(t, diary, "Дневник питания за сегодня")
+	if strings.Count(diary, "• овсянка") != 2 {
+		t.Fatalf("diary %q does not list both meals", diary)
+	}
+
+	// The progress command now adds the calorie chart
+	charts := h.say(user, "/progress", 2)
+	if charts[1].Method != "sendPhoto" {
+		t.Fatalf("calorie chart sent with %s", charts[1].Method)
+	}
+	assertContains(t, charts[1].Text(), "Калории за 14 дней")
+	assertContains(t, charts[1].Text(), "цель 2080 ккал")
+
+	// Like the weekly report, the chart follows the latest plan's target
+	ctx := context.Background()
+	u, _ := h.store.GetUser(ctx, user)
+	plan, err := h.store.GetDietPlan(ctx, u.ID)
+	if err != nil {
+		t.Fatalf("GetDietPlan: %v", err)
+	}
+	data := *plan.Data
+	data.DailyCalories = 2300
+	adapted := &models.DietPlan{UserID: u.ID, PaymentID: plan.PaymentID, PlanText: plan.PlanText, Data: &data, ParentID: plan.ID, Revision: models.RevisionAdapt}
+	if err := h.store.SaveDietPlan(ctx, adapted); err != nil {
+		t.Fatalf("SaveDietPlan: %v", err)
+	}
+	assertContains(t, h.say(user, "/progress", 2)[1].Text(), "цель 2300 ккал")
+}
+
+func TestFoodDatabaseLookup(t *testing.T) {
+	h := newHarness(t)
+	const user = int64(1111)
+	ctx := context.Background()
+
+	h.purchase(user)
+	err := h.store.UpsertFoods(ctx, []*models.Food{
+		{Source: "test", ExternalID: "1", Name: "Творог 5%", Calories: 121, Protein: 17.2, Fat: 5, Carbs: 1.8},
+		{Source: "test", ExternalID: "2", Name: "Бананы", Calories: 96, Protein: 1.5, Fat: 0.2, Carbs: 21},
+	})
+	if err != nil {
+		t.Fatalf("UpsertFoods: %v", err)
+	}
+
+	// Every item has a weight and is known: no LLM estimate is involved
+	local := h.say(user, "/eat творог 200 г, банан 150г", 1)[0].Text()
+	assertContains(t, local, "• Творог 5%, 200 г — 242 ккал\n• Бананы, 150 г — 144 ккал")
+
+	// Without a weight the LLM splits the meal, but known foods keep database values
+	mixed := h.say(user, "/eat овсянка 60г, банан", 1)[0].Text()
+	assertContains(t, mixed, "• овсянка, 60 г — 213 ккал\n• Бананы, 120 г — 115 ккал")
+
+	u, _ := h.store.GetUser(ctx, user)
+	logs, err := h.store.ListFoodLogs(ctx, u.ID, u.Today(), u.Today())
+	if err != nil || len(logs) != 4 {
+		t.Fatalf("ListFoodLogs: %+v, %v", logs, err)
+	}
+	sources := []string{logs[0].Source, logs[1].Source, logs[2].Source, logs[3].Source}
+	if strings.Join(sources, ",") != "db,db,llm,db" {
+		t.Fatalf("sources = %v", sources)
+	}
+}
+
+func TestMealPhotoConversation(t *testing.T) {
+	h := newHarness(t)
+	const user = int64(1212)
+	ctx := context.Background()
+
+	h.purchase(user)
+	h.telegram.AddFile("photo-big", []byte("\xff\xd8\xff\xe0 jpeg"))
+	h.telegram.SendMessage(user, map[string]interface{}{
+		"caption": "обед",
+		"photo": []map[string]interface{}{
+			{"file_id": "photo-small", "file_unique_id": "s", "width": 90, "height": 90},
+			{"file_id": "photo-big", "file_unique_id": "b", "width": 1280, "height": 1280},
+		},
+	})
+	confirm := h.expect(user, 1)[0]
+	assertContains(t, confirm.Text(), "• овсянка, 60 г — 213 ккал")
+	assertContains(t, confirm.Text(), "Записать в дневник?")
+
+	u, _ := h.store.GetUser(ctx, user)
+	if logs, _ := h.store.ListFoodLogs(ctx, u.ID, u.Today(), u.Today()); len(logs) != 0 {
+		t.Fatalf("logged before confirmation: %+v", logs)
+	}
+
+	saved := h.press(user, confirm.CallbackData("✅ Записать"), 1)[0]
+	if saved.Method != "editMessageText" {
+		t.Fatalf("method = %s, want editMessageText", saved.Method)
+	}
+	assertContains(t, saved.Text(), "🍽 Записал:")
+	assertContains(t, saved.Text(), "Сегодня: 320 из 2080 ккал")
+
+	logs, err := h.store.ListFoodLogs(ctx, u.ID, u.Today(), u.Today())
+	if err != nil || len(logs) != 2 {
+		t.Fatalf("ListFoodLogs: %+v, %v", logs, err)
+	}
+
+	// The draft is gone once used
+	stale := h.press(user, confirm.CallbackData("✅ Записать"), 1)[0]
+	assertContains(t, stale.Text(), "устарела")
+}
+
+// fakeEstimator answers meal estimates without a model and remembers the
+// photo it was given.
+type fakeEstimator struct {
+	mu       sync.Mutex
+	photo    []byte
+	caption  string
+	estimate *gpt.MealEstimate
+	err      error
+}
+
+func (f *fakeEstimator) EstimateMeal(ctx context.Context, text string) (*gpt.MealEstimate, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.estimate, f.err
+}
+
+func (f *fakeEstimator) EstimateMealPhoto(ctx context.Context, photo []byte, caption string) (*gpt.MealEstimate, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.photo, f.caption = photo, caption
+	return f.estimate, f.err
+}
+
+func TestMealPhotoEstimator(t *testing.T) {
+	h := newHarness(t)
+	const user = int64(1214)
+
+	estimator := &fakeEstimator{estimate: &gpt.MealEstimate{Items: []gpt.MealItem{
+		{Name: "борщ", Grams: 300, Calories: 150, Protein: 5, Fat: 6, Carbs: 18},
+	}}}
+	h.bot.WithMealEstimator(estimator)
+
+	h.purchase(user)
+	h.telegram.AddFile("photo-soup", []byte("\xff\xd8\xff\xe0 soup"))
+	sendPhoto := func() {
+		h.telegram.SendMessage(user, map[string]interface{}{
+			"caption": " суп ",
+			"photo":   []map[string]interface{}{{"file_id": "photo-soup", "file_unique_id": "s", "width": 800, "height": 800}},
+		})
+	}
+
+	sendPhoto()
+	assertContains(t, h.expect(user, 1)[0].Text(), "• борщ, 300 г — 150 ккал")
+	estimator.mu.Lock()
+	if string(estimator.photo) != "\xff\xd8\xff\xe0 soup" || estimator.caption != "суп" {
+		t.Fatalf("estimator got photo %q, caption %q", estimator.photo, estimator.caption)
+	}
+	estimator.err = fmt.Errorf("model unavailable")
+	estimator.mu.Unlock()
+
+	sendPhoto()
+	assertContains(t, h.expect(user, 1)[0].Text(), "не удалось распознать фото")
+}
+
+func TestVoiceMealConversation(t *testing.T) {
+	h := newHarness(t)
+	const user = int64(1313)
+	ctx := context.Background()
+
+	h.purchase(user)
+	h.telegram.AddFile("voice-1", []byte("OggS voice"))
+	h.telegram.SendMessage(user, map[string]interface{}{
+		"voice": map[string]interface{}{"file_id": "voice-1", "file_unique_id": "v1", "duration": 4, "mime_type": "audio/ogg"},
+	})
+	confirm := h.expect(user, 1)[0]
+	assertContains(t, confirm.Text(), "🎙 Распознал: «овсянка и банан»")
+	assertContains(t, confirm.Text(), "• банан, 120 г — 107 ккал")
+
+	// A misheard meal is dropped and typed instead
+	cancelled := h.press(user, confirm.CallbackData("❌ Отмена"), 1)[0]
+	assertContains(t, cancelled.Text(), "Запись отменена.")
+	u, _ := h.store.GetUser(ctx, user)
+	if logs, _ := h.store.ListFoodLogs(ctx, u.ID, u.Today(), u.Today()); len(logs) != 0 {
+		t.Fatalf("cancelled meal was logged: %+v", logs)
+	}
+
+	h.telegram.SendMessage(user, map[string]interface{}{
+		"voice": map[string]interface{}{"file_id": "voice-1", "file_unique_id": "v1", "duration": 600},
+	})
+	assertContains(t, h.expect(user, 1)[0].Text(), "Голосовое слишком длинное")
+}
+
+func TestQuestionConversation(t *testing.T) {
+	h := newHarness(t)
+	const user = int64(1414)
+	ctx := context.Background()
+
+	h.purchase(user)
+
+	// The plan and the earlier turns go along with every question
+	first := h.say(user, "чем заменить творог", 1)[0].Text()
+	assertContains(t, first, "Ответ на вопрос №1")
+	assertContains(t, first, "План учтён: true")
+	second := h.say(user, "/ask а на ужин?", 1)[0].Text()
+	assertContains(t, second, "Ответ на вопрос №2")
+
+	// A meal is still a meal
+	assertContains(t, h.say(user, "овсянка 60г, банан", 1)[0].Text(), "🍽 Записал:")
+
+	// Medical questions are refused without asking the model
+	refusal := h.say(user, "можно ли мне этот план при диабете?", 1)[0].Text()
+	assertContains(t, refusal, "только врач")
+
+	u, _ := h.store.GetUser(ctx, user)
+	messages, _ := h.store.ListChatMessages(ctx, u.ID, 10)
+	if len(messages) != 4 || messages[0].Content != "чем заменить творог" || messages[3].Role != models.ChatRoleAssistant {
+		t.Fatalf("chat messages: %+v", messages)
+	}
+
+	// The quota runs out; /forget clears the memory but not the count
+	for i := 3; i <= dailyQuestionQuota[tierPlan]; i++ {
+		h.say(user, "что ещё?", 1)
+	}
+	assertContains(t, h.say(user, "а ещё?", 1)[0].Text(), "На сегодня вопросы закончились")
+	assertContains(t, h.say(user, "/forget", 1)[0].Text(), "Начинаем разговор заново")
+	if messages, _ := h.store.ListChatMessages(ctx, u.ID, 10); len(messages) != 0 {
+		t.Fatalf("messages left after /forget: %d", len(messages))
+	}
+	assertContains(t, h.say(user, "а теперь?", 1)[0].Text(), "На сегодня вопросы закончились")
+	assertContains(t, h.say(user, "/ask", 1)[0].Text(), fmt.Sprintf("Вопросов сегодня: %d из %d", dailyQuestionQuota[tierPlan], dailyQuestionQuota[tierPlan]))
+}
+
+func TestQuestionWithoutPlan(t *testing.T) {
+	h := newHarness(t)
+	const user = int64(1515)
+
+	h.onboard(user)
+	h.say(user, "Да, всё верно", 2)
+
+	// Waiting for payment, the user gets the free tier and no plan context
+	answer := h.say(user, "сколько воды пить?", 1)[0].Text()
+	assertContains(t, answer, "План учтён: false")
+	assertContains(t, answer, "Осталось вопросов на сегодня: 2.")
+
+	// A question the model failed to answer still counts
+	h.gptDown.Store(true)
+	assertContains(t, h.say(user, "а кофе можно?", 1)[0].Text(), "не удалось ответить")
+	h.gptDown.Store(false)
+	assertContains(t, h.say(user, "/ask", 1)[0].Text(), "Вопросов сегодня: 2 из 3")
+	assertContains(t, h.say(user, "а чай?", 1)[0].Text(), "Осталось вопросов на сегодня: 0.")
+	assertContains(t, h.say(user, "а сок?", 1)[0].Text(), "На сегодня вопросы закончились: 3 из 3")
+}
+
+func TestRegenerateConversation(t *testing.T) {
+	h := newHarness(t)
+	const user = int64(1616)
+	ctx := context.Background()
+
+	h.bot.WithFreeRevisions(2)
+	h.purchase(user)
+
+	// One meal: pick the day, then the dish
+	menu := h.say(user, "/regenerate", 1)[0]
+	assertContains(t, menu.Text(), "Бесплатных изменений осталось: 2.")
+	days := h.press(user, menu.CallbackData("🍽 Заменить блюдо"), 1)[0]
+	assertContains(t, days.Text(), "Какой день изменить?")
+	meals := h.press(user, days.CallbackData("2"), 1)[0]
+	assertContains(t, meals.Text(), "Какое блюдо дня 2 заменить?")
+	calls := h.press(user, meals.CallbackData("13:00 Обед — Рыба с рисом"), 3)
+	assertContains(t, calls[0].Text(), "Меняю план")
+	assertContains(t, calls[1].Text(), "замена блюда")
+	revised := calls[2].Text()
+	assertContains(t, revised, "Бесплатных изменений осталось: 1.")
+	assertContains(t, revised, "13:00 Обед — Рыба с рисом"+testRevisionMark)
+	if strings.Count(revised, testRevisionMark) != 1 {
+		t.Fatalf("more than one dish replaced:\n%s", revised)
+	}
+
+	u, _ := h.store.GetUser(ctx, user)
+	plans, _ := h.store.ListDietPlans(ctx, u.ID, 10)
+	if len(plans) != 2 || plans[0].ParentID != plans[1].ID || plans[0].Revision != models.RevisionMeal || plans[0].PaymentID != plans[1].PaymentID {
+		t.Fatalf("plans: %+v", plans)
+	}
+
+	// A stale keyboard no longer applies
+	assertContains(t, h.press(user, menu.CallbackData("🔄 Весь план"), 1)[0].Text(), "уже изменился")
+
+	// The whole plan uses up the last free revision
+	menu = h.say(user, "/regenerate", 1)[0]
+	calls = h.press(user, menu.CallbackData("💰 Дешевле"), 3)
+	assertContains(t, calls[2].Text(), "Бесплатных изменений осталось: 0.")
+	if strings.Count(calls[2].Text(), testRevisionMark) != 6 {
+		t.Fatalf("cheaper plan did not replace every dish:\n%s", calls[2].Text())
+	}
+	assertContains(t, h.say(user, "/regenerate", 1)[0].Text(), "Бесплатные изменения этого плана закончились (2 из 2)")
+
+	history := h.say(user, "/plans", 1)[0].Text()
+	assertContains(t, history, fmt.Sprintf("Изменение: дешевле (из плана #%d)", plans[0].ID))
+}
+
+func TestShoppingConversation(t *testing.T) {
+	h := newHarness(t)
+	const user = int64(1717)
+	ctx := context.Background()
+
+	h.purchase(user)
+
+	menu := h.say(user, "/shopping", 1)[0]
+	assertButtons(t, menu, "🛒 Весь план (Дни 1–2)", "🛒 День 1", "🛒 День 2")
+	list := h.press(user, menu.CallbackData("🛒 Весь план (Дни 1–2)"), 1)[0]
+	text := list.Text()
+	assertContains(t, text, "Список покупок: дни 1–2")
+	assertContains(t, text, "🥦 Овощи, фрукты и зелень\n⬜ Банан — 1 шт\n⬜ Огурцы — 150 г")
+	assertContains(t, text, "⬜ Овсяные хлопья — 60 г")
+	assertContains(t, text, "Куплено: 0 из 13.")
+
+	// Ticking an item off is kept in the store
+	tick := list.CallbackData("⬜ Банан — 1 шт")
+	list = h.press(user, tick, 1)[0]
+	assertContains(t, list.Text(), "✅ Банан — 1 шт")
+	assertContains(t, list.Text(), "Куплено: 1 из 13.")
+	var listID int64
+	fmt.Sscanf(tick, "shop:tick:%d:", &listID)
+	stored, err := h.store.GetShoppingList(ctx, listID)
+	if err != nil || !stored.Items[0].Checked || stored.Items[1].Checked {
+		t.Fatalf("stored list: %+v, %v", stored, err)
+	}
+
+	// Days can be given right away; one day lists only its ingredients
+	day := h.say(user, "/shopping 2", 1)[0].Text()
+	assertContains(t, day, "Список покупок: день 2")
+	if strings.Contains(day, "Банан") {
+		t.Fatalf("day 2 list has day 1 ingredients:\n%s", day)
+	}
+	assertContains(t, h.say(user, "/shopping 3-5", 1)[0].Text(), "Укажите дни плана")
+}
+
+func TestRecipeConversation(t *testing.T) {
+	h := newHarness(t)
+	const user = int64(1818)
+	ctx := context.Background()
+
+	h.purchase(user)
+
+	days := h.say(user, "/recipes", 1)[0]
+	assertButtons(t, days, "📖 Рецепт · день 1", "📖 Рецепт · день 2")
+	meals := h.press(user, days.CallbackData("📖 Рецепт · день 1"), 1)[0]
+	assertContains(t, meals.Text(), "День 1: рецепт какого блюда")
+
+	// The first request generates the recipe and caches it
+	calls := h.press(user, meals.CallbackData("13:00 Обед — Курица с гречкой"), 2)
+	assertContains(t, calls[0].Text(), "Готовлю рецепт «Курица с гречкой»")
+	card := calls[1].Text()
+	assertContains(t, card, "👨‍🍳 Курица с гречкой\n⏱ 25 мин · 520 ккал")
+	assertContains(t, card, "• Куриное филе — 150 г")
+	assertContains(t, card, "2. Запеките курицу.")
+	if _, err := h.store.GetRecipe(ctx, models.RecipeCacheKey("курица с гречкой", nil)); err != nil {
+		t.Fatalf("recipe not cached: %v", err)
+	}
+
+	// A cached recipe is sent as is, without asking the model
+	err := h.store.SaveRecipe(ctx, &models.Recipe{
+		CacheKey: models.RecipeCacheKey("Рыба с рисом", nil),
+		Dish:     "Рыба с рисом",
+		Data:     models.RecipeData{PrepMinutes: 30, Steps: []string{"Рецепт из кэша."}},
+	})
+	if err != nil {
+		t.Fatalf("SaveRecipe: %v", err)
+	}
+	meals = h.press(user, days.CallbackData("📖 Рецепт · день 2"), 1)[0]
+	assertContains(t, h.press(user, meals.CallbackData("13:00 Обед — Рыба с рисом"), 1)[0].Text(), "1. Рецепт из кэша.")
+
+	// Somebody else's plan stays private
+	h.onboard(1819)
+	assertContains(t, h.press(1819, meals.CallbackData("08:00 Завтрак — Омлет с овощами"), 1)[0].Text(), "больше недоступен")
+
+	// A cheaper plan gets recipes of cheap products, cached apart
+	menu := h.say(user, "/regenerate", 1)[0]
+	h.press(user, menu.CallbackData("💰 Дешевле"), 3)
+	days = h.say(user, "/recipes", 1)[0]
+	meals = h.press(user, days.CallbackData("📖 Рецепт · день 1"), 1)[0]
+	h.press(user, meals.CallbackData("13:00 Обед — Курица с гречкой"+testRevisionMark), 2)
+	key := models.RecipeCacheKey("Курица с гречкой"+testRevisionMark, []string{revisionRestrictions[models.RevisionCheaper]})
+	if _, err := h.store.GetRecipe(ctx, key); err != nil {
+		t.Fatalf("cheaper recipe not cached with its restriction: %v", err)
+	}
+}
+
+func TestWeeklyReportConversation(t *testing.T) {
+	h := newHarness(t)
+	const user = int64(1919)
+	ctx := context.Background()
+
+	h.purchase(user)
+	u, _ := h.store.GetUser(ctx, user)
+
+	// Weight has stood still for three weeks; the diary has too few days to blame
+	for day, weight := range map[string]float64{"2024-02-19": 80, "2024-02-26": 80.1, "2024-03-04": 79.9, "2024-03-10": 80} {
+		on, _ := time.Parse("2006-01-02", day)
+		if err := h.store.SaveWeightLog(ctx, &models.WeightLog{UserID: u.ID, Weight: weight, LoggedOn: on}); err != nil {
+			t.Fatalf("SaveWeightLog: %v", err)
+		}
+	}
+	var foods []*models.FoodLog
+	for day := 5; day <= 7; day++ {
+		foods = append(foods, &models.FoodLog{UserID: u.ID, LoggedOn: time.Date(2024, 3, day, 0, 0, 0, 0, time.UTC), Name: "обед", Calories: 2000})
+	}
+	if err := h.store.SaveFoodLogs(ctx, foods); err != nil {
+		t.Fatalf("SaveFoodLogs: %v", err)
+	}
+
+	// Reports go out on Monday from 10:00 Moscow time
+	monday := time.Date(2024, 3, 11, 6, 30, 0, 0, time.UTC)
+	if sent, err := h.bot.runWeeklyReports(ctx, monday); err != nil || sent != 0 {
+		t.Fatalf("runWeeklyReports before 10:00 = %d, %v", sent, err)
+	}
+	monday = monday.Add(2 * time.Hour)
+	if sent, err := h.bot.runWeeklyReports(ctx, monday); err != nil || sent != 1 {
+		t.Fatalf("runWeeklyReports = %d, %v", sent, err)
+	}
+	report := h.expect(user, 1)[0]
+	text := report.Text()
+	assertContains(t, text, "Итоги недели 04.03 — 10.03")
+	assertContains(t, text, "Вес: 79.9 → 80.0 кг (+0.1 кг)")
+	assertContains(t, text, "Дневник: 3 из 7 дней, в среднем 2000 ккал при цели 2080 ккал")
+	assertContains(t, text, "Вес почти не меняется")
+	assertContains(t, text, "с 2080 до 1960 ккал")
+	assertButtons(t, report, "🔄 Обновить план: 1960 ккал", "Оставить как есть")
+
+	// One report a week
+	if sent, _ := h.bot.runWeeklyReports(ctx, monday.Add(3*time.Hour)); sent != 0 {
+		t.Fatalf("second report in a week: %d", sent)
+	}
+
+	// Adapting the plan is free and keeps the proposed target
+	calls := h.press(user, report.CallbackData("🔄 Обновить план: 1960 ккал"), 3)
+	assertContains(t, calls[0].Text(), "Меняю план")
+	assertContains(t, calls[1].Text(), "новая цель по калориям")
+	assertContains(t, calls[2].Text(), "План на следующую неделю: 1960 ккал в день.")
+	plans, _ := h.store.ListDietPlans(ctx, u.ID, 10)
+	if len(plans) != 2 || plans[0].Revision != models.RevisionAdapt || plans[0].ParentID != plans[1].ID {
+		t.Fatalf("plans: %+v", plans)
+	}
+	assertContains(t, h.say(user, "/regenerate", 1)[0].Text(), "Бесплатных изменений осталось: 3.")
+	assertContains(t, h.press(user, report.CallbackData("🔄 Обновить план: 1960 ккал"), 1)[0].Text(), "уже изменился")
+}
+
+func TestCalendarConversation(t *testing.T) {
+	h := newHarness(t)
+	const user = int64(2020)
+	ctx := context.Background()
+
+	h.bot.WithCalendarFeed("https://bot.example.com", "feed-secret")
+	h.purchase(user)
+
+	doc := h.say(user, "/calendar", 1)[0]
+	if doc.Method != "sendDocument" {
+		t.Fatalf("expected a document, got %s", doc.Method)
+	}
+	ics := string(doc.Files["document"])
+	assertContains(t, ics, "BEGIN:VCALENDAR")
+	assertContains(t, ics, "DTSTART;TZID=Europe/Moscow:")
+	assertContains(t, ics, "RRULE:FREQ=DAILY;INTERVAL=2;COUNT=4")
+	assertContains(t, ics, "SUMMARY:Обед — Курица с гречкой")
+	if n := strings.Count(ics, "BEGIN:VEVENT"); n != 6 {
+		t.Errorf("events: %d", n)
+	}
+
+	caption := doc.Params.Get("caption")
+	u, _ := h.store.GetUser(ctx, user)
+	feedURL := calendar.FeedURL("https://bot.example.com", "feed-secret", u.ID)
+	assertContains(t, caption, feedURL)
+
+	// The feed serves the same plan without an end
+	rec := httptest.NewRecorder()
+	h.bot.HandleCalendarFeed(rec, httptest.NewRequest(http.MethodGet, strings.TrimPrefix(feedURL, "https://bot.example.com"), nil))
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "text/calendar; charset=utf-8" {
+		t.Fatalf("feed: %d %s", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	assertContains(t, rec.Body.String(), "RRULE:FREQ=DAILY;INTERVAL=2\r\n")
+
+	// A tampered link shows nothing
+	rec = httptest.NewRecorder()
+	h.bot.HandleCalendarFeed(rec, httptest.NewRequest(http.MethodGet, calendar.FeedPath+fmt.Sprintf("%d-0123456789abcdef0123456789abcdef.ics", u.ID), nil))
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("tampered feed: %d", rec.Code)
+	}
+}
+
+func TestWaterConversation(t *testing.T) {
+	h := newHarness(t)
+	const user = int64(2121)
+	ctx := context.Background()
+
+	h.purchase(user)
+
+	status := h.say(user, "/water", 1)[0]
+	assertContains(t, status.Text(), "💧 Вода сегодня: 0 из 2400 мл")
+	assertButtons(t, status, "🥛 +250 мл", "🍶 +500 мл", "↩️ −250 мл")
+
+	added := h.press(user, status.CallbackData("🍶 +500 мл"), 1)[0]
+	if added.Method != "editMessageText" {
+		t.Fatalf("quick-add sent %s", added.Method)
+	}
+	assertContains(t, added.Text(), "500 из 2400 мл")
+	assertButtons(t, added, "🥛 +250 мл", "🍶 +500 мл", "↩️ −250 мл")
+	assertContains(t, h.press(user, status.CallbackData("↩️ −250 мл"), 1)[0].Text(), "250 из 2400 мл")
+	assertContains(t, h.say(user, "/water 300", 1)[0].Text(), "550 из 2400 мл")
+	assertContains(t, h.say(user, "/water стакан", 1)[0].Text(), "Укажите, сколько миллилитров")
+
+	// Water reminders only go out to users behind the day's schedule
+	h.say(user, "/reminders вода 20:00", 1)
+	u, _ := h.store.GetUser(ctx, user)
+	reminders, _ := h.store.ListReminders(ctx, u.ID)
+	first := reminders[0].NextRunAt
+	if _, err := h.store.AddWater(ctx, u.ID, models.Day(first.In(u.Location())), 2300); err != nil {
+		t.Fatalf("AddWater: %v", err)
+	}
+	if sent, err := h.bot.runDueReminders(ctx, first, 0); err != nil || sent != 0 {
+		t.Fatalf("runDueReminders on schedule = %d, %v", sent, err)
+	}
+
+	reminders, _ = h.store.ListReminders(ctx, u.ID)
+	if sent, err := h.bot.runDueReminders(ctx, reminders[0].NextRunAt, 0); err != nil || sent != 1 {
+		t.Fatalf("runDueReminders behind schedule = %d, %v", sent, err)
+	}
+	nudge := h.expect(user, 1)[0]
+	assertContains(t, nudge.Text(), "Пора выпить стакан воды")
+	assertContains(t, nudge.Text(), "0 из 2400 мл")
+	assertContains(t, nudge.Text(), "не хватает 2215 мл")
+	assertButtons(t, nudge, "🥛 +250 мл", "🍶 +500 мл", "↩️ −250 мл")
+}
+
+func TestMeasureConversation(t *testing.T) {
+	h := newHarness(t)
+	const user = int64(2222)
+	ctx := context.Background()
+
+	h.purchase(user)
+	u, _ := h.store.GetUser(ctx, user)
+
+	// A week ago the waist was bigger
+	earlier := &models.Measurement{UserID: u.ID, Waist: 87, Neck: 38, Weight: 80, BodyFat: 17.3, LoggedOn: u.Today().AddDate(0, 0, -7)}
+	if err := h.store.SaveMeasurement(ctx, earlier); err != nil {
+		t.Fatalf("SaveMeasurement: %v", err)
+	}
+
+	intro := h.say(user, "/measure", 2)
+	assertContains(t, intro[1].Text(), "Обхват талии")
+	assertContains(t, h.say(user, "восемьдесят", 1)[0].Text(), "введите обхват в сантиметрах")
+	assertContains(t, h.say(user, "85", 1)[0].Text(), "Обхват шеи")
+	assertContains(t, h.say(user, "38", 1)[0].Text(), "Обхват бёдер")
+	assertContains(t, h.say(user, "Пропустить", 1)[0].Text(), "Обхват груди")
+
+	result := h.say(user, "100,5", 1)[0].Text()
+	since := earlier.LoggedOn.Format("02.01")
+	assertContains(t, result, "Талия: 85.0 см (−2.0 см с "+since+")")
+	assertContains(t, result, "Шея: 38.0 см (+0.0 см с "+since+")")
+	assertContains(t, result, "Грудь: 100.5 см\n")
+	assertContains(t, result, "🔥 Жир: 16.1% (−1.2 п.п. с "+since+")")
+	assertContains(t, result, "💪 Сухая масса: 67.1 кг (+1.0 кг с "+since+")")
+	assertContains(t, result, "по сухой массе: 2130 ккал")
+
+	if u, _ := h.store.GetUser(ctx, user); u.BodyFat != 16.1 {
+		t.Fatalf("body fat on user = %v", u.BodyFat)
+	}
+
+	// Measuring again the same day updates the set; the neck measured earlier
+	// still counts towards the estimate
+	result = h.say(user, "/measure талия 84", 1)[0].Text()
+	assertContains(t, result, "Талия: 84.0 см (−3.0 см")
+	assertContains(t, result, "Шея: 38.0 см")
+	assertContains(t, result, "Грудь: 100.5 см")
+	assertContains(t, result, "🔥 Жир: 15.3% (−2.0 п.п. с "+since+")")
+	if u, _ := h.store.GetUser(ctx, user); u.BodyFat != 15.3 {
+		t.Fatalf("body fat after updating the waist = %v", u.BodyFat)
+	}
+
+	assertContains(t, h.say(user, "/measure рост 180", 1)[0].Text(), "Использование")
+
+	// Cancelling puts the user back where they were
+	h.say(user, "/measure", 2)
+	assertContains(t, h.say(user, "Отмена", 1)[0].Text(), "Замеры отменены")
+	h.bot.stateMutex.RLock()
+	defer h.bot.stateMutex.RUnlock()
+	state := h.bot.userStates[user]
+	if state.CurrentState != StateComplete || state.TemporaryData[measureStepKey] != nil || state.TemporaryData[measureReturnKey] != nil {
+		t.Fatalf("state after cancel: %+v", state)
+	}
+}
+
+func TestPlanBelowMinimum(t *testing.T) {
+	h := newHarness(t)
+	const user = int64(5101)
+	ctx := context.Background()
+
+	// At 150 kg the fake model's 2080 kcal is far below the safe minimum
+	h.say(user, "/start", 1)
+	h.say(user, "Мужской", 1)
+	h.say(user, "180", 1)
+	h.say(user, "150", 1)
+	h.say(user, "Снизить вес", 1)
+	h.say(user, "Москва", 1)
+	h.say(user, "30", 1)
+	h.press(user, healthCallbackPrefix+healthDone, 2)
+	h.say(user, "Да, всё верно", 2)
+
+	sessions := h.stripe.Sessions()
+	payload, signature, err := h.stripe.CompleteSession(sessions[len(sessions)-1].ID)
+	if err != nil {
+		t.Fatalf("CompleteSession: %v", err)
+	}
+	if code := h.deliverWebhook(payload, signature); code != http.StatusOK {
+		t.Fatalf("webhook status = %d", code)
+	}
+	assertContains(t, h.expect(user, 1)[0].Text(), "Мы вернём оплату")
+
+	u, _ := h.store.GetUser(ctx, user)
+	if plan, err := h.store.GetDietPlan(ctx, u.ID); err == nil {
+		t.Fatalf("plan below the minimum was saved: %+v", plan.Data)
+	}
+
+	// The payment is not completed; admins are asked to refund it
+	p, err := h.store.GetPaymentByStripeID(ctx, sessions[len(sessions)-1].ID)
+	if err != nil || p.Status != models.PaymentStatusPending {
+		t.Fatalf("payment after rejected plan: %+v, %v", p, err)
+	}
+	assertContains(t, h.expect(testAdminID, 1)[0].Text(), fmt.Sprintf("/refund %d", p.ID))
+
+	assertContains(t, h.say(testAdminID, fmt.Sprintf("/refund %d", p.ID), 1)[0].Text(), "создан")
+	if refunds := h.stripe.Refunds(); len(refunds) != 1 || refunds[0].PaymentIntentID != p.StripePaymentIntentID {
+		t.Fatalf("unexpected refunds: %+v", refunds)
+	}
+
+	payload, signature, err = h.stripe.ChargeRefundedEvent(p.StripePaymentIntentID, h.stripe.AmountTotal)
+	if err != nil {
+		t.Fatalf("ChargeRefundedEvent: %v", err)
+	}
+	if code := h.deliverWebhook(payload, signature); code != http.StatusOK {
+		t.Fatalf("refund webhook status = %d", code)
+	}
+	refunded := h.expect(user, 1)[0].Text()
+	if refunded != "💸 Оплата возвращена." {
+		t.Fatalf("refund message: %q", refunded)
+	}
+	if p, err = h.store.GetPaymentByID(ctx, p.ID); err != nil || p.Status != models.PaymentStatusRefunded {
+		t.Fatalf("payment after refund: %+v, %v", p, err)
+	}
+}
+
+func TestScreeningConversation(t *testing.T) {
+	h := newHarness(t)
+	ctx := context.Background()
+
+	// answer walks the questionnaire up to the age question
+	answer := func(user int64, gender, weight, goal string) {
+		h.say(user, "/start", 1)
+		h.say(user, gender, 1)
+		h.say(user, "170", 1)
+		h.say(user, weight, 1)
+		h.say(user, goal, 1)
+		h.say(user, "Москва", 1)
+	}
+
+	// Minors are turned away right after the age question
+	const minor = int64(5001)
+	answer(minor, "Мужской", "60", "Снизить вес")
+	assertContains(t, h.say(minor, "16", 1)[0].Text(), "только для взрослых")
+	assertContains(t, h.say(minor, "привет", 1)[0].Text(), "используйте /start")
+	if _, err := h.store.GetUser(ctx, minor); err == nil {
+		t.Fatal("refused minor was saved")
+	}
+
+	// Men are not asked about pregnancy
+	const man = int64(5002)
+	answer(man, "Мужской", "70", "Поддерживать вес")
+	assertButtons(t, h.say(man, "40", 1)[0], "⬜️ 🩸 Сахарный диабет",
+		"⬜️ 🍽 Расстройство пищевого поведения", "⬜️ 🫘 Болезни почек", "Ничего из этого")
+
+	// Pregnancy ends the questionnaire with a referral to a doctor
+	const pregnant = int64(5003)
+	answer(pregnant, "Женский", "60", "Поддерживать вес")
+	health := h.say(pregnant, "29", 1)[0]
+	checked := h.press(pregnant, health.CallbackData("⬜️ 🤰 Беременность или кормление грудью"), 1)[0]
+	calls := h.press(pregnant, checked.CallbackData("Готово"), 2)
+	assertContains(t, calls[1].Text(), "калорийность урезать нельзя")
+
+	// Losing weight from an underweight BMI is refused: 50 kg at 170 cm is 17.3
+	const slim = int64(5004)
+	answer(slim, "Женский", "50", "Снизить вес")
+	health = h.say(slim, "25", 1)[0]
+	calls = h.press(slim, health.CallbackData("Ничего из этого"), 2)
+	assertContains(t, calls[0].Text(), "Здоровье: без особенностей")
+	assertContains(t, calls[1].Text(), "индекс массы тела — 17.3")
+
+	// Diabetics get their plan with a caution to see an endocrinologist
+	const diabetic = int64(5005)
+	answer(diabetic, "Мужской", "95", "Снизить вес")
+	health = h.say(diabetic, "52", 1)[0]
+	checked = h.press(diabetic, health.CallbackData("⬜️ 🩸 Сахарный диабет"), 1)[0]
+	assertContains(t, h.press(diabetic, checked.CallbackData("Готово"), 2)[1].Text(), "Возраст: 52\nЗдоровье: сахарный диабет")
+	h.say(diabetic, "Да, всё верно", 2)
+
+	sessions := h.stripe.Sessions()
+	payload, signature, err := h.stripe.CompleteSession(sessions[len(sessions)-1].ID)
+	if err != nil {
+		t.Fatalf("CompleteSession: %v", err)
+	}
+	if code := h.deliverWebhook(payload, signature); code != http.StatusOK {
+		t.Fatalf("webhook status = %d", code)
+	}
+	plan := h.expect(diabetic, 1)[0]
+	assertContains(t, plan.Text(), "не заменяет консультацию врача")
+	assertContains(t, plan.Text(), "согласуйте план с эндокринологом")
+
+	u, err := h.store.GetUser(ctx, diabetic)
+	if err != nil || u.Age != 52 || !u.HasCondition(safety.ConditionDiabetes) {
+		t.Fatalf("screened user: %+v, %v", u, err)
+	}
+}
+
+func TestScreeningBeforeRevision(t *testing.T) {
+	h := newHarness(t)
+	ctx := context.Background()
+
+	// A user who signed up before the screening is asked before the next plan
+	const legacy = int64(5201)
+	h.purchase(legacy)
+	if err := h.store.SetUserScreening(ctx, legacy, 0, nil); err != nil {
+		t.Fatalf("SetUserScreening: %v", err)
+	}
+	assertContains(t, h.say(legacy, "/regenerate", 1)[0].Text(), "Сколько вам полных лет?")
+	health := h.say(legacy, "41", 1)[0]
+	checked := h.press(legacy, health.CallbackData("⬜️ 🩸 Сахарный диабет"), 1)[0]
+	calls := h.press(legacy, checked.CallbackData("Готово"), 2)
+	assertContains(t, calls[1].Text(), "ответы сохранены")
+	if u, _ := h.store.GetUser(ctx, legacy); u.Age != 41 || !u.HasCondition(safety.ConditionDiabetes) {
+		t.Fatalf("screened legacy user: %+v", u)
+	}
+	assertContains(t, h.say(legacy, "/regenerate", 1)[0].Text(), "Что изменить в плане")
+
+	// A refusal on a second /start sticks to the profile, so the plan is not
+	// revised either
+	const minor = int64(5202)
+	h.purchase(minor)
+	menu := h.say(minor, "/regenerate", 1)[0]
+	h.say(minor, "/start", 1)
+	h.say(minor, "Мужской", 1)
+	h.say(minor, "180", 1)
+	h.say(minor, "80", 1)
+	h.say(minor, "Снизить вес", 1)
+	h.say(minor, "Москва", 1)
+	assertContains(t, h.say(minor, "16", 1)[0].Text(), "только для взрослых")
+	if u, _ := h.store.GetUser(ctx, minor); u.Age != 16 {
+		t.Fatalf("age after refusal = %d", u.Age)
+	}
+	assertContains(t, h.press(minor, menu.CallbackData(revisionNames[models.RevisionPlan]), 1)[0].Text(), "только для взрослых")
+}
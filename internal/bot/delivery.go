@@ -0,0 +1,56 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"net/http"
+	"time"
+)
+
+// Telegram allows about 30 messages a second across all chats; unprompted
+// messages stay below that so replies to users are not throttled.
+const (
+	broadcastRate  = 20
+	broadcastBurst = 5
+)
+
+// errUserBlocked is returned by sendUnprompted when the user has blocked the bot.
+var errUserBlocked = errors.New("user blocked the bot")
+
+// sendUnprompted sends a message the user did not ask for, such as a
+// reminder. It waits for the broadcast rate limit, retries once after a 429
+// and marks the user as blocked on a 403.
+func (t *TelegramBot) sendUnprompted(ctx context.Context, telegramID int64, c tgbotapi.Chattable) error {
+	for attempt := 0; ; attempt++ {
+		if err := t.sendLimiter.Wait(ctx); err != nil {
+			return err
+		}
+
+		_, err := t.bot.Send(c)
+		if err == nil {
+			return nil
+		}
+
+		var apiErr *tgbotapi.Error
+		if !errors.As(err, &apiErr) {
+			return err
+		}
+
+		switch {
+		case apiErr.Code == http.StatusForbidden:
+			if err := t.db.SetUserBlocked(ctx, telegramID, true); err != nil {
+				t.logger.Error("Failed to mark user as blocked", "error", err, "telegramID", telegramID)
+			}
+			return errUserBlocked
+		case apiErr.Code == http.StatusTooManyRequests && attempt == 0:
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(time.Duration(apiErr.RetryAfter) * time.Second):
+			}
+		default:
+			return err
+		}
+	}
+}
@@ -0,0 +1,282 @@
+package bot
+
+import (
+	"context"
+	"diet-bot/internal/db"
+	"diet-bot/internal/gpt"
+	"diet-bot/internal/models"
+	"diet-bot/internal/nutrition"
+	"errors"
+	"fmt"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"math"
+	"strings"
+	"time"
+)
+
+// mealEstimateTimeout bounds the LLM call behind one diary entry.
+const mealEstimateTimeout = time.Minute
+
+// handleEatCommand logs a meal ("/eat овсянка 60г, банан") or shows today's
+// diary when called without arguments.
+func (t *TelegramBot) handleEatCommand(message *tgbotapi.Message) {
+	chatID := message.Chat.ID
+	ctx := context.Background()
+
+	user, err := t.db.GetUser(ctx, message.From.ID)
+	if errors.Is(err, db.ErrNotFound) {
+		t.bot.Send(tgbotapi.NewMessage(chatID, "Сначала заполните анкету с помощью /start."))
+		return
+	}
+	if err != nil {
+		t.logger.Error("Failed to get user for food diary", "error", err, "userID", message.From.ID)
+		t.bot.Send(tgbotapi.NewMessage(chatID, "Извините, произошла ошибка. Попробуйте позже."))
+		return
+	}
+
+	if text := strings.TrimSpace(message.CommandArguments()); text != "" {
+		t.logMeal(ctx, chatID, user, text)
+		return
+	}
+	t.sendFoodDiary(ctx, chatID, user)
+}
+
+// handleFreeText treats a message sent outside any dialog as a question
+// about the plan or a meal for the food diary.
+func (t *TelegramBot) handleFreeText(message *tgbotapi.Message) {
+	chatID := message.Chat.ID
+	ctx := context.Background()
+
+	user, err := t.db.GetUser(ctx, message.From.ID)
+	if errors.Is(err, db.ErrNotFound) {
+		t.bot.Send(tgbotapi.NewMessage(chatID, "Пожалуйста, используйте /start для начала работы с ботом."))
+		return
+	}
+	if err != nil {
+		t.logger.Error("Failed to get user for free text", "error", err, "userID", message.From.ID)
+		t.bot.Send(tgbotapi.NewMessage(chatID, "Извините, произошла ошибка. Попробуйте позже."))
+		return
+	}
+
+	if len(message.Photo) > 0 {
+		t.handleMealPhoto(ctx, message, user)
+		return
+	}
+	if message.Voice != nil {
+		t.handleVoice(ctx, message, user)
+		return
+	}
+
+	text := strings.TrimSpace(message.Text)
+	if text == "" {
+		t.bot.Send(tgbotapi.NewMessage(chatID, "Напишите, что вы съели, например «овсянка 60 г, банан», или посмотрите команды в /help."))
+		return
+	}
+	if isQuestion(text) {
+		t.answerQuestion(ctx, chatID, user, text)
+		return
+	}
+	t.logMeal(ctx, chatID, user, text)
+}
+
+// logMeal estimates the meal, saves its items for today and replies with them
+// and the day's progress against the target.
+func (t *TelegramBot) logMeal(ctx context.Context, chatID int64, user *models.User, text string) {
+	estimateCtx, cancel := context.WithTimeout(ctx, mealEstimateTimeout)
+	defer cancel()
+
+	logs, err := t.estimateMeal(estimateCtx, text)
+	if err != nil {
+		t.logger.Error("Failed to estimate meal", "error", err, "userID", user.ID)
+		t.bot.Send(tgbotapi.NewMessage(chatID, "Извините, не удалось посчитать калории. Попробуйте позже."))
+		return
+	}
+	if len(logs) == 0 {
+		t.bot.Send(tgbotapi.NewMessage(chatID, "Не нашёл в сообщении еды. Напишите, например: овсянка 60 г, банан"))
+		return
+	}
+
+	reply, err := t.saveMeal(ctx, user, logs)
+	if err != nil {
+		t.logger.Error("Failed to save food logs", "error", err, "userID", user.ID)
+		t.bot.Send(tgbotapi.NewMessage(chatID, "Извините, не удалось сохранить запись. Попробуйте позже."))
+		return
+	}
+	t.bot.Send(tgbotapi.NewMessage(chatID, reply))
+}
+
+// saveMeal logs the items for the user's today and returns the reply listing
+// them with the day's progress against the target.
+func (t *TelegramBot) saveMeal(ctx context.Context, user *models.User, logs []*models.FoodLog) (string, error) {
+	today := user.Today()
+	for _, l := range logs {
+		l.UserID = user.ID
+		l.LoggedOn = today
+	}
+	if err := t.db.SaveFoodLogs(ctx, logs); err != nil {
+		return "", err
+	}
+
+	text := "🍽 Записал:\n" + formatMeal(logs)
+	if day, err := t.db.ListFoodLogs(ctx, user.ID, today, today); err == nil {
+		text += "\n\n" + formatDayProgress(nutrition.Total(day), nutrition.DailyTarget(user))
+	} else {
+		t.logger.Error("Failed to list food logs", "error", err, "userID", user.ID)
+	}
+	return text, nil
+}
+
+// estimateMeal turns a meal description into diary entries. When every item
+// has a weight and is found in the food database no LLM call is made;
+// otherwise the LLM splits and estimates the meal, and its values are still
+// replaced by database ones for every item the database knows.
+func (t *TelegramBot) estimateMeal(ctx context.Context, text string) ([]*models.FoodLog, error) {
+	if logs, ok := t.resolveMealLocally(ctx, text); ok {
+		return logs, nil
+	}
+
+	estimate, err := t.estimator.EstimateMeal(ctx, text)
+	if err != nil {
+		return nil, err
+	}
+	return t.mealLogsFromEstimate(ctx, estimate), nil
+}
+
+// mealLogsFromEstimate turns LLM items into diary entries, preferring
+// database values for the foods the database knows.
+func (t *TelegramBot) mealLogsFromEstimate(ctx context.Context, estimate *gpt.MealEstimate) []*models.FoodLog {
+	logs := make([]*models.FoodLog, 0, len(estimate.Items))
+	for _, item := range estimate.Items {
+		if food := t.lookupFood(ctx, item.Name); food != nil && item.Grams > 0 {
+			logs = append(logs, foodLogFromDatabase(food, item.Grams))
+			continue
+		}
+		logs = append(logs, &models.FoodLog{
+			Name:     item.Name,
+			Grams:    round1(item.Grams),
+			Calories: round1(item.Calories),
+			Protein:  round1(item.Protein),
+			Fat:      round1(item.Fat),
+			Carbs:    round1(item.Carbs),
+			Source:   models.FoodSourceLLM,
+		})
+	}
+	return logs
+}
+
+// resolveMealLocally succeeds only if every item of the meal has a weight and
+// a confident database match.
+func (t *TelegramBot) resolveMealLocally(ctx context.Context, text string) ([]*models.FoodLog, bool) {
+	items := nutrition.SplitMeal(text)
+	if len(items) == 0 {
+		return nil, false
+	}
+
+	logs := make([]*models.FoodLog, 0, len(items))
+	for _, item := range items {
+		name, grams, ok := nutrition.ParsePortion(item)
+		if !ok {
+			return nil, false
+		}
+		food := t.lookupFood(ctx, name)
+		if food == nil {
+			return nil, false
+		}
+		logs = append(logs, foodLogFromDatabase(food, grams))
+	}
+	return logs, true
+}
+
+// lookupFood returns the database food for name, or nil when it is unknown
+// or the lookup fails.
+func (t *TelegramBot) lookupFood(ctx context.Context, name string) *models.Food {
+	food, err := nutrition.Lookup(ctx, t.db, name)
+	if err != nil {
+		t.logger.Error("Failed to look up food", "error", err, "name", name)
+		return nil
+	}
+	return food
+}
+
+// checkPlanCalories corrects the meals of a generated plan whose calories
+// disagree with the food database and renders the plan again if any did.
+func (t *TelegramBot) checkPlanCalories(ctx context.Context, result *gpt.PlanResult) {
+	corrected, err := nutrition.CheckPlan(ctx, t.db, result.Data)
+	if err != nil {
+		t.logger.Error("Failed to check plan calories", "error", err)
+	}
+	if corrected > 0 {
+		t.logger.Info("Corrected plan meal calories", "meals", corrected)
+		result.Text = gpt.FormatPlan(result.Data)
+	}
+}
+
+func foodLogFromDatabase(food *models.Food, grams float64) *models.FoodLog {
+	n := nutrition.Portion(food, grams)
+	return &models.FoodLog{
+		Name:     food.Name,
+		Grams:    round1(grams),
+		Calories: round1(n.Calories),
+		Protein:  round1(n.Protein),
+		Fat:      round1(n.Fat),
+		Carbs:    round1(n.Carbs),
+		Source:   models.FoodSourceDatabase,
+	}
+}
+
+func (t *TelegramBot) sendFoodDiary(ctx context.Context, chatID int64, user *models.User) {
+	today := user.Today()
+	logs, err := t.db.ListFoodLogs(ctx, user.ID, today, today)
+	if err != nil {
+		t.logger.Error("Failed to list food logs", "error", err, "userID", user.ID)
+		t.bot.Send(tgbotapi.NewMessage(chatID, "Извините, не удалось загрузить дневник. Попробуйте позже."))
+		return
+	}
+	if len(logs) == 0 {
+		t.bot.Send(tgbotapi.NewMessage(chatID, "Сегодня записей пока нет. Напишите, что съели, например: /eat овсянка 60 г, банан"))
+		return
+	}
+
+	var b strings.Builder
+	b.WriteString("📒 Дневник питания за сегодня:")
+	for _, l := range logs {
+		b.WriteString("\n" + formatFoodLog(l))
+	}
+	b.WriteString("\n\n" + formatDayProgress(nutrition.Total(logs), nutrition.DailyTarget(user)))
+	t.bot.Send(tgbotapi.NewMessage(chatID, b.String()))
+}
+
+// formatMeal lists the items with the meal total.
+func formatMeal(logs []*models.FoodLog) string {
+	var b strings.Builder
+	for _, l := range logs {
+		b.WriteString(formatFoodLog(l) + "\n")
+	}
+	meal := nutrition.Total(logs)
+	fmt.Fprintf(&b, "Итого: %.0f ккал (Б %.0f / Ж %.0f / У %.0f г)", meal.Calories, meal.Protein, meal.Fat, meal.Carbs)
+	return b.String()
+}
+
+func formatFoodLog(l *models.FoodLog) string {
+	if l.Grams > 0 {
+		return fmt.Sprintf("• %s, %g г — %.0f ккал", l.Name, l.Grams, l.Calories)
+	}
+	return fmt.Sprintf("• %s — %.0f ккал", l.Name, l.Calories)
+}
+
+// formatDayProgress compares the day's intake with the target.
+func formatDayProgress(eaten, target nutrition.Nutrients) string {
+	text := fmt.Sprintf("Сегодня: %.0f из %.0f ккал", eaten.Calories, target.Calories)
+	if left := target.Calories - eaten.Calories; left >= 0 {
+		text += fmt.Sprintf(", осталось %.0f.", left)
+	} else {
+		text += fmt.Sprintf(", перебор %.0f.", -left)
+	}
+	return text + fmt.Sprintf("\nБелки %.0f/%.0f г, жиры %.0f/%.0f г, углеводы %.0f/%.0f г",
+		eaten.Protein, target.Protein, eaten.Fat, target.Fat, eaten.Carbs, target.Carbs)
+}
+
+// round1 rounds to the 0.1 precision the diary is stored with.
+func round1(v float64) float64 {
+	return math.Round(v*10) / 10
+}
@@ -79,8 +79,39 @@ func (t *TelegramBot) HandleStripeWebhook(w http.ResponseWriter, r *http.Request
 		}
 
 		// Process payment success in background to avoid webhook timeout
-		go t.handlePaymentSuccess(userID, session.PaymentIntent.ID)
-		t.logger.Info("Payment processing started", "userID", userID, "paymentID", session.PaymentIntent.ID)
+		go t.handlePaymentSuccess(userID, session.ID, session.PaymentIntent.ID)
+		t.logger.Info("Payment processing started", "userID", userID, "sessionID", session.ID, "paymentID", session.PaymentIntent.ID)
+
+	case "charge.refunded":
+		var charge stripe.Charge
+		if err := json.Unmarshal(event.Data.Raw, &charge); err != nil {
+			t.logger.Error("Failed to parse charge", err)
+			http.Error(w, "Failed to parse event data", http.StatusBadRequest)
+			return
+		}
+		if err := t.handleChargeRefunded(r.Context(), &charge); err != nil {
+			t.logger.Error("Failed to process refund", "error", err, "chargeID", charge.ID)
+			http.Error(w, "Failed to process refund", http.StatusInternalServerError)
+			return
+		}
+
+	case "charge.dispute.created", "charge.dispute.closed":
+		var dispute stripe.Dispute
+		if err := json.Unmarshal(event.Data.Raw, &dispute); err != nil {
+			t.logger.Error("Failed to parse dispute", err)
+			http.Error(w, "Failed to parse event data", http.StatusBadRequest)
+			return
+		}
+
+		handle := t.handleDisputeCreated
+		if event.Type == "charge.dispute.closed" {
+			handle = t.handleDisputeClosed
+		}
+		if err := handle(r.Context(), &dispute); err != nil {
+			t.logger.Error("Failed to process dispute", "error", err, "disputeID", dispute.ID)
+			http.Error(w, "Failed to process dispute", http.StatusInternalServerError)
+			return
+		}
 
 	case "payment_intent.succeeded":
 		// Log payment intent success
@@ -0,0 +1,344 @@
+package bot
+
+import (
+	"bytes"
+	"context"
+	"diet-bot/internal/bot/telegramtest"
+	"diet-bot/internal/db"
+	"diet-bot/internal/gpt"
+	"diet-bot/internal/models"
+	"diet-bot/internal/payment"
+	"diet-bot/internal/payment/stripetest"
+	"diet-bot/internal/stt"
+	"diet-bot/pkg/logger"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const (
+	testToken         = "123:test-token"
+	testWebhookSecret = "whsec_test"
+	testAdminID       = int64(900)
+	testPlanDish      = "Овсянка с ягодами"
+	waitTimeout       = 5 * time.Second
+
+	// testMealEstimate is the structured answer to every meal that mentions food
+	testMealEstimate = `{"items":[` +
+		`{"name":"овсянка","grams":60,"calories":213,"protein":7.4,"fat":3.7,"carbs":36.5},` +
+		`{"name":"банан","grams":120,"calories":107,"protein":1.3,"fat":0.4,"carbs":27}]}`
+
+	// testRevisionMark ends every dish of a revised plan
+	testRevisionMark = " (новый вариант)"
+
+	// testTranscript is what every voice message says
+	testTranscript = "овсянка и банан"
+
+	// testRecipe is the recipe written for every dish
+	testRecipe = `{"prep_minutes":25,"ingredients":[{"name":"Куриное филе","amount":150,"unit":"г"}],` +
+		`"steps":["Отварите гречку.","Запеките курицу."],"calories":520,"protein":45,"fat":12,"carbs":55}`
+)
+
+// harness runs a TelegramBot against fake Telegram, Stripe and GPT servers and
+// an in-memory store.
+type harness struct {
+	t        *testing.T
+	bot      *TelegramBot
+	telegram *telegramtest.Server
+	stripe   *stripetest.Server
+	store    *db.MemoryDB
+	// gptDown makes every chat completion fail while set
+	gptDown *atomic.Bool
+
+	mu       sync.Mutex
+	consumed map[int64]int
+}
+
+func newHarness(t *testing.T) *harness {
+	t.Helper()
+
+	telegram := telegramtest.NewServer(testToken)
+	stripeFake := stripetest.NewServer(testWebhookSecret)
+	gptMux := http.NewServeMux()
+	gptMux.HandleFunc("/v1/audio/transcriptions", fakeTranscription)
+	gptDown := new(atomic.Bool)
+	gptMux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if gptDown.Load() {
+			http.Error(w, `{"error":{"message":"The server is overloaded","type":"server_error"}}`, http.StatusServiceUnavailable)
+			return
+		}
+		fakeChatCompletion(w, r)
+	})
+	gptFake := httptest.NewServer(gptMux)
+
+	stripeClient := payment.NewStripeClient(struct {
+		SecretKey  string
+		PublicKey  string
+		WebhookKey string
+		ProductID  string
+		PriceID    string
+		APIBase    string
+	}{
+		SecretKey:  "sk_test_fake",
+		WebhookKey: testWebhookSecret,
+		PriceID:    "price_test",
+		APIBase:    stripeFake.URL,
+	})
+	gptClient := gpt.NewClientWithBaseURL("test-key", gptFake.URL+"/v1")
+
+	store := db.NewMemoryDB()
+	b, err := NewTelegramBot(struct {
+		Token       string
+		AdminIDs    []int64
+		APIEndpoint string
+	}{
+		Token:       testToken,
+		AdminIDs:    []int64{testAdminID},
+		APIEndpoint: telegram.Endpoint(),
+	}, store, stripeClient, gptClient, logger.NewDevelopment())
+	if err != nil {
+		t.Fatalf("NewTelegramBot: %v", err)
+	}
+	b.bot.Debug = false
+	b.WithTranscriber(stt.NewOpenAI("test-key", gptFake.URL+"/v1", "", "ru"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	if err := b.Start(ctx); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	// Only wake-ups run the dispatcher; the tick never comes during a test
+	b.StartOutboxDispatcher(ctx, time.Hour)
+
+	t.Cleanup(func() {
+		cancel()
+		b.bot.StopReceivingUpdates()
+		telegram.Close()
+		stripeFake.Close()
+		gptFake.Close()
+	})
+
+	return &harness{
+		t:        t,
+		bot:      b,
+		telegram: telegram,
+		stripe:   stripeFake,
+		store:    store,
+		gptDown:  gptDown,
+		consumed: make(map[int64]int),
+	}
+}
+
+// say sends text as userID and returns the next n messages the bot sends to that chat.
+func (h *harness) say(userID int64, text string, n int) []telegramtest.Call {
+	h.t.Helper()
+	h.telegram.SendText(userID, text)
+	return h.expect(userID, n)
+}
+
+// press sends a callback query as userID and returns the next n messages to that chat.
+func (h *harness) press(userID int64, data string, n int) []telegramtest.Call {
+	h.t.Helper()
+	h.telegram.PressButton(userID, data)
+	return h.expect(userID, n)
+}
+
+// expect returns the next n messages the bot sends to chatID.
+func (h *harness) expect(chatID int64, n int) []telegramtest.Call {
+	h.t.Helper()
+
+	h.mu.Lock()
+	skip := h.consumed[chatID]
+	h.mu.Unlock()
+
+	calls, err := h.telegram.WaitForCalls(skip, n, func(c telegramtest.Call) bool {
+		return telegramtest.IsSend(c) && c.ChatID() == chatID
+	}, waitTimeout)
+	if err != nil {
+		for _, c := range calls {
+			h.t.Logf("%s: %q", c.Method, c.Text())
+		}
+		h.t.Fatalf("chat %d: %v", chatID, err)
+	}
+
+	h.mu.Lock()
+	h.consumed[chatID] += n
+	h.mu.Unlock()
+
+	return calls
+}
+
+// deliverWebhook posts a signed Stripe event to the webhook handler.
+func (h *harness) deliverWebhook(payload []byte, signature string) int {
+	req := httptest.NewRequest(http.MethodPost, "/webhook/stripe", bytes.NewReader(payload))
+	req.Header.Set("Stripe-Signature", signature)
+	rec := httptest.NewRecorder()
+	h.bot.HandleStripeWebhook(rec, req)
+	return rec.Code
+}
+
+// onboard walks userID through the questionnaire up to the confirmation step.
+func (h *harness) onboard(userID int64) {
+	h.t.Helper()
+	h.say(userID, "/start", 1)
+	h.say(userID, "Мужской", 1)
+	h.say(userID, "180", 1)
+	h.say(userID, "80", 1)
+	h.say(userID, "Снизить вес", 1)
+	h.say(userID, "Москва", 1)
+	h.say(userID, "30", 1)
+	h.press(userID, healthCallbackPrefix+healthDone, 2)
+}
+
+// purchase onboards userID, pays through the fake Stripe and waits for the plan.
+func (h *harness) purchase(userID int64) *models.Payment {
+	h.t.Helper()
+	h.onboard(userID)
+	h.say(userID, "Да, всё верно", 2)
+
+	sessions := h.stripe.Sessions()
+	sessionID := sessions[len(sessions)-1].ID
+	payload, signature, err := h.stripe.CompleteSession(sessionID)
+	if err != nil {
+		h.t.Fatalf("CompleteSession: %v", err)
+	}
+	if code := h.deliverWebhook(payload, signature); code != http.StatusOK {
+		h.t.Fatalf("webhook status = %d", code)
+	}
+
+	plan := h.expect(userID, 1)[0]
+	assertContains(h.t, plan.Text(), testPlanDish)
+
+	p, err := h.store.GetPaymentByStripeID(context.Background(), sessionID)
+	if err != nil {
+		h.t.Fatalf("GetPaymentByStripeID: %v", err)
+	}
+	return p
+}
+
+// testPlan is the structured plan every plan request gets: two days of three meals.
+func testPlan() models.PlanData {
+	meal := func(time, name, dish string, kcal int, ingredients ...models.Ingredient) models.PlanMeal {
+		return models.PlanMeal{Time: time, Name: name, Dish: dish, Calories: kcal, Ingredients: ingredients}
+	}
+	g := func(name string, amount float64) models.Ingredient {
+		return models.Ingredient{Name: name, Amount: amount, Unit: "г"}
+	}
+	return models.PlanData{
+		DailyCalories: 2080, Protein: 144, Fat: 72, Carbs: 211, WaterML: 2400,
+		Days: []models.PlanDay{
+			{Day: 1, Meals: []models.PlanMeal{
+				meal("08:00", "Завтрак", testPlanDish, 600, g("Овсяные хлопья", 60), g("Черника", 100), g("Молоко 2,5%", 200)),
+				meal("13:00", "Обед", "Курица с гречкой", 880, g("Куриное филе", 150), g("Гречка", 80)),
+				meal("19:00", "Ужин", "Творог с бананом", 600, g("Творог 5%", 200), models.Ingredient{Name: "Банан", Amount: 1, Unit: "шт"}),
+			}},
+			{Day: 2, Meals: []models.PlanMeal{
+				meal("08:00", "Завтрак", "Омлет с овощами", 550, models.Ingredient{Name: "Яйцо", Amount: 3, Unit: "шт"}, g("Помидоры", 150)),
+				meal("13:00", "Обед", "Рыба с рисом", 900, g("Треска", 200), g("Рис", 80)),
+				meal("19:00", "Ужин", "Салат с тунцом", 630, g("Тунец консервированный", 120), g("Огурцы", 150)),
+			}},
+		},
+		Tips: []string{"Пейте воду в течение дня."},
+	}
+}
+
+func fakeTranscription(w http.ResponseWriter, r *http.Request) {
+	if _, _, err := r.FormFile("file"); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"text": testTranscript})
+}
+
+func fakeChatCompletion(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasSuffix(r.URL.Path, "/chat/completions") {
+		http.NotFound(w, r)
+		return
+	}
+	var req struct {
+		Messages []struct {
+			Role string `json:"role"`
+			// a string, or a list of parts for photos
+			Content json.RawMessage `json:"content"`
+		} `json:"messages"`
+		ResponseFormat *struct {
+			Type       string `json:"type"`
+			JSONSchema struct {
+				Name string `json:"name"`
+			} `json:"json_schema"`
+		} `json:"response_format"`
+	}
+	json.NewDecoder(r.Body).Decode(&req)
+
+	// Meal estimates ask for a JSON schema; "привет" contains no food
+	content := ""
+	if req.ResponseFormat != nil && req.ResponseFormat.JSONSchema.Name == "diet_plan" {
+		// Revisions get every dish marked, so tests see what was replaced
+		plan := testPlan()
+		if strings.Contains(string(req.Messages[len(req.Messages)-1].Content), "Предыдущий план") {
+			for _, day := range plan.Days {
+				for i := range day.Meals {
+					day.Meals[i].Dish += testRevisionMark
+				}
+			}
+		}
+		data, _ := json.Marshal(plan)
+		content = string(data)
+	} else if req.ResponseFormat != nil && req.ResponseFormat.JSONSchema.Name == "recipe" {
+		content = testRecipe
+	} else if req.ResponseFormat != nil && req.ResponseFormat.Type == "json_schema" {
+		content = testMealEstimate
+		if last := req.Messages[len(req.Messages)-1].Content; strings.Contains(string(last), "привет") {
+			content = `{"items":[]}`
+		}
+	}
+
+	// Questions carry the profile in a second system message; the answer
+	// tells how many questions and whether the plan the model saw
+	if len(req.Messages) > 1 && req.Messages[1].Role == "system" {
+		questions, withPlan := 0, strings.Contains(string(req.Messages[1].Content), testPlanDish)
+		for _, m := range req.Messages {
+			if m.Role == "user" {
+				questions++
+			}
+		}
+		content = fmt.Sprintf("Ответ на вопрос №%d: замените творог греческим йогуртом. План учтён: %t.", questions, withPlan)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"id":     "chatcmpl-test",
+		"object": "chat.completion",
+		"model":  "gpt-4",
+		"choices": []map[string]interface{}{{
+			"index":         0,
+			"message":       map[string]string{"role": "assistant", "content": content},
+			"finish_reason": "stop",
+		}},
+		"usage": map[string]int{"prompt_tokens": 100, "completion_tokens": 50, "total_tokens": 150},
+	})
+}
+
+func assertContains(t *testing.T, got, want string) {
+	t.Helper()
+	if !strings.Contains(got, want) {
+		t.Fatalf("message %q does not contain %q", got, want)
+	}
+}
+
+func assertButtons(t *testing.T, call telegramtest.Call, want ...string) {
+	t.Helper()
+	var got []string
+	for _, row := range call.Buttons() {
+		got = append(got, row...)
+	}
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Fatalf("buttons = %v, want %v", got, want)
+	}
+}
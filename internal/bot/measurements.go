@@ -0,0 +1,321 @@
+package bot
+
+import (
+	"context"
+	"diet-bot/internal/db"
+	"diet-bot/internal/models"
+	"diet-bot/internal/nutrition"
+	"diet-bot/internal/progress"
+	"errors"
+	"fmt"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	minSize = 20  // cm
+	maxSize = 250 // cm
+
+	// measurementHistoryDays is how far back the trend after a measurement looks.
+	measurementHistoryDays = 90
+
+	measureSkip   = "Пропустить"
+	measureCancel = "Отмена"
+
+	// Keys of the measurement dialog in UserState.TemporaryData
+	measureStepKey   = "measure_step"
+	measureReturnKey = "measure_return"
+	measureSizeKey   = "measure_"
+)
+
+// measureSizes is the order the dialog asks in.
+var measureSizes = []string{progress.SizeWaist, progress.SizeNeck, progress.SizeHip, progress.SizeChest}
+
+var measureQuestions = map[string]string{
+	progress.SizeWaist: "Обхват талии на уровне пупка, в сантиметрах (например, 82):",
+	progress.SizeNeck:  "Обхват шеи чуть ниже кадыка, в сантиметрах:",
+	progress.SizeHip:   "Обхват бёдер по самой широкой части, в сантиметрах:",
+	progress.SizeChest: "Обхват груди по самой выступающей части, в сантиметрах:",
+}
+
+var bodyValueNames = map[string]string{
+	progress.SizeWaist: "Талия",
+	progress.SizeNeck:  "Шея",
+	progress.SizeHip:   "Бёдра",
+	progress.SizeChest: "Грудь",
+	progress.BodyFat:   "🔥 Жир",
+	progress.LeanMass:  "💪 Сухая масса",
+}
+
+// sizeAliases maps what users type in /measure to sizes.
+var sizeAliases = map[string]string{
+	"талия": progress.SizeWaist, "талию": progress.SizeWaist, "waist": progress.SizeWaist,
+	"шея": progress.SizeNeck, "шею": progress.SizeNeck, "neck": progress.SizeNeck,
+	"бёдра": progress.SizeHip, "бедра": progress.SizeHip, "hip": progress.SizeHip, "hips": progress.SizeHip,
+	"грудь": progress.SizeChest, "chest": progress.SizeChest,
+}
+
+// parseSize accepts centimetres with a dot or a comma as the decimal separator.
+func parseSize(text string) (float64, bool) {
+	size, err := strconv.ParseFloat(strings.Replace(strings.TrimSpace(text), ",", ".", 1), 64)
+	if err != nil || size < minSize || size > maxSize {
+		return 0, false
+	}
+	return float64(int(size*10+0.5)) / 10, true
+}
+
+// handleMeasureCommand saves measurements given inline, "/measure талия 82
+// шея 38", or asks for them one by one.
+func (t *TelegramBot) handleMeasureCommand(message *tgbotapi.Message) {
+	chatID := message.Chat.ID
+	userID := message.From.ID
+
+	user, err := t.db.GetUser(context.Background(), userID)
+	if errors.Is(err, db.ErrNotFound) {
+		t.bot.Send(tgbotapi.NewMessage(chatID, "Сначала заполните анкету с помощью /start."))
+		return
+	}
+	if err != nil {
+		t.logger.Error("Failed to get user for measurements", "error", err, "userID", userID)
+		t.bot.Send(tgbotapi.NewMessage(chatID, "Извините, произошла ошибка. Попробуйте позже."))
+		return
+	}
+
+	if args := strings.Fields(strings.ToLower(message.CommandArguments())); len(args) > 0 {
+		sizes, ok := parseSizes(args)
+		if !ok {
+			t.bot.Send(tgbotapi.NewMessage(chatID, "Использование:\n/measure — ввести замеры по шагам\n/measure талия 82 шея 38 бёдра 98 грудь 100\n"+
+				fmt.Sprintf("Обхваты — в сантиметрах, от %d до %d.", minSize, maxSize)))
+			return
+		}
+		t.saveMeasurement(chatID, user, sizes)
+		return
+	}
+
+	t.stateMutex.Lock()
+	state, exists := t.userStates[userID]
+	if !exists {
+		state = &models.UserState{TelegramID: userID, CurrentState: StateComplete, TemporaryData: make(map[string]interface{})}
+		t.userStates[userID] = state
+	}
+	if state.CurrentState != StateMeasure {
+		state.TemporaryData[measureReturnKey] = state.CurrentState
+	}
+	clearMeasureDraft(state)
+	state.TemporaryData[measureStepKey] = 0
+	state.CurrentState = StateMeasure
+	t.stateMutex.Unlock()
+
+	t.bot.Send(tgbotapi.NewMessage(chatID, "📏 Замеры тела. Измеряйте утром, сантиметровой лентой, не затягивая её. "+
+		"По талии и шее (и бёдрам — для женщин) я оценю процент жира."))
+	t.askMeasurement(chatID, measureSizes[0])
+}
+
+// parseSizes reads "талия 82 шея 38" pairs.
+func parseSizes(args []string) (map[string]float64, bool) {
+	if len(args)%2 != 0 {
+		return nil, false
+	}
+	sizes := make(map[string]float64)
+	for i := 0; i < len(args); i += 2 {
+		key, ok := sizeAliases[args[i]]
+		if !ok {
+			return nil, false
+		}
+		if sizes[key], ok = parseSize(args[i+1]); !ok {
+			return nil, false
+		}
+	}
+	return sizes, true
+}
+
+func (t *TelegramBot) askMeasurement(chatID int64, size string) {
+	msg := tgbotapi.NewMessage(chatID, measureQuestions[size])
+	msg.ReplyMarkup = tgbotapi.NewReplyKeyboard(tgbotapi.NewKeyboardButtonRow(
+		tgbotapi.NewKeyboardButton(measureSkip),
+		tgbotapi.NewKeyboardButton(measureCancel),
+	))
+	t.bot.Send(msg)
+}
+
+// handleMeasureAnswer takes the answer to the current dialog question and
+// asks the next one, saving the measurements after the last.
+func (t *TelegramBot) handleMeasureAnswer(message *tgbotapi.Message, state *models.UserState) {
+	chatID := message.Chat.ID
+	text := strings.TrimSpace(message.Text)
+
+	if text == measureCancel {
+		t.endMeasureDialog(state)
+		msg := tgbotapi.NewMessage(chatID, "Замеры отменены.")
+		msg.ReplyMarkup = tgbotapi.NewRemoveKeyboard(true)
+		t.bot.Send(msg)
+		return
+	}
+
+	var value float64
+	if text != measureSkip {
+		var ok bool
+		if value, ok = parseSize(text); !ok {
+			t.bot.Send(tgbotapi.NewMessage(chatID, fmt.Sprintf("Пожалуйста, введите обхват в сантиметрах, от %d до %d, или нажмите «%s».", minSize, maxSize, measureSkip)))
+			return
+		}
+	}
+
+	t.stateMutex.Lock()
+	step, _ := state.TemporaryData[measureStepKey].(int)
+	if value > 0 {
+		state.TemporaryData[measureSizeKey+measureSizes[step]] = value
+	}
+	if step+1 < len(measureSizes) {
+		state.TemporaryData[measureStepKey] = step + 1
+		t.stateMutex.Unlock()
+		t.askMeasurement(chatID, measureSizes[step+1])
+		return
+	}
+	sizes := make(map[string]float64)
+	for _, size := range measureSizes {
+		if value, ok := state.TemporaryData[measureSizeKey+size].(float64); ok {
+			sizes[size] = value
+		}
+	}
+	t.stateMutex.Unlock()
+	t.endMeasureDialog(state)
+
+	user, err := t.db.GetUser(context.Background(), message.From.ID)
+	if err != nil {
+		t.logger.Error("Failed to get user for measurements", "error", err, "userID", message.From.ID)
+		t.bot.Send(tgbotapi.NewMessage(chatID, "Извините, произошла ошибка. Попробуйте позже."))
+		return
+	}
+	t.saveMeasurement(chatID, user, sizes)
+}
+
+// endMeasureDialog puts the user back where they were before /measure.
+func (t *TelegramBot) endMeasureDialog(state *models.UserState) {
+	t.stateMutex.Lock()
+	defer t.stateMutex.Unlock()
+
+	previous, _ := state.TemporaryData[measureReturnKey].(string)
+	if previous == "" {
+		previous = StateComplete
+	}
+	state.CurrentState = previous
+	delete(state.TemporaryData, measureReturnKey)
+	clearMeasureDraft(state)
+}
+
+func clearMeasureDraft(state *models.UserState) {
+	delete(state.TemporaryData, measureStepKey)
+	for _, size := range measureSizes {
+		delete(state.TemporaryData, measureSizeKey+size)
+	}
+}
+
+// saveMeasurement stores today's measurements and replies with the trend.
+func (t *TelegramBot) saveMeasurement(chatID int64, user *models.User, sizes map[string]float64) {
+	ctx := context.Background()
+	if len(sizes) == 0 {
+		msg := tgbotapi.NewMessage(chatID, "Нужен хотя бы один обхват. Отправьте /measure, чтобы начать заново.")
+		msg.ReplyMarkup = tgbotapi.NewRemoveKeyboard(true)
+		t.bot.Send(msg)
+		return
+	}
+
+	m := &models.Measurement{
+		UserID:   user.ID,
+		Waist:    sizes[progress.SizeWaist],
+		Hip:      sizes[progress.SizeHip],
+		Chest:    sizes[progress.SizeChest],
+		Neck:     sizes[progress.SizeNeck],
+		Weight:   user.Weight,
+		LoggedOn: user.Today(),
+	}
+
+	if err := t.logMeasurement(ctx, user, m); err != nil {
+		t.logger.Error("Failed to save measurements", "error", err, "userID", user.ID)
+		t.bot.Send(tgbotapi.NewMessage(chatID, "Извините, не удалось сохранить замеры. Попробуйте позже."))
+		return
+	}
+
+	history, err := t.db.ListMeasurements(ctx, user.ID, user.Today().AddDate(0, 0, -measurementHistoryDays))
+	if err != nil {
+		t.logger.Error("Failed to list measurements", "error", err, "userID", user.ID)
+		history = []*models.Measurement{m}
+	}
+	trend, _ := progress.ComputeBodyTrend(history)
+
+	msg := tgbotapi.NewMessage(chatID, formatBodyTrend(trend, user))
+	msg.ReplyMarkup = tgbotapi.NewRemoveKeyboard(true)
+	t.bot.Send(msg)
+}
+
+// logMeasurement saves m with the body fat estimated from the day's merged
+// sizes and, when it gives the latest estimate, keeps it on the user for the
+// calorie calculator.
+func (t *TelegramBot) logMeasurement(ctx context.Context, user *models.User, m *models.Measurement) error {
+	return t.db.WithTx(ctx, func(tx db.Store) error {
+		if err := tx.SaveMeasurement(ctx, m); err != nil {
+			return err
+		}
+		// Saving filled in the sizes measured earlier today
+		if bodyFat, _ := nutrition.NavyBodyFat(user.Gender, user.Height, m.Waist, m.Neck, m.Hip); bodyFat != m.BodyFat {
+			m.BodyFat = bodyFat
+			if err := tx.SaveMeasurement(ctx, m); err != nil {
+				return err
+			}
+		}
+
+		all, err := tx.ListMeasurements(ctx, user.ID, time.Time{})
+		if err != nil {
+			return err
+		}
+		bodyFat := 0.0
+		for i := len(all) - 1; i >= 0; i-- {
+			if all[i].BodyFat > 0 {
+				bodyFat = all[i].BodyFat
+				break
+			}
+		}
+		if bodyFat == user.BodyFat {
+			return nil
+		}
+		user.BodyFat = bodyFat
+		return tx.SetUserBodyFat(ctx, user.TelegramID, bodyFat)
+	})
+}
+
+// formatBodyTrend lists the latest measurements with their changes.
+func formatBodyTrend(trend progress.BodyTrend, user *models.User) string {
+	m := trend.Latest
+	var b strings.Builder
+	fmt.Fprintf(&b, "📏 Замеры на %s сохранены\n", m.LoggedOn.Format("02.01.2006"))
+
+	line := func(key, value, unit string) {
+		fmt.Fprintf(&b, "\n%s: %s", bodyValueNames[key], value)
+		if c, ok := trend.Changes[key]; ok {
+			fmt.Fprintf(&b, " (%s %s с %s)", formatSigned(c.Delta), unit, c.Since.Format("02.01"))
+		}
+	}
+	for _, size := range measureSizes {
+		if value := progress.BodyValue(m, size); value > 0 {
+			line(size, fmt.Sprintf("%.1f см", value), "см")
+		}
+	}
+
+	if m.BodyFat == 0 {
+		need := "талию и шею"
+		if user.Gender == "Женский" {
+			need = "талию, шею и бёдра"
+		}
+		fmt.Fprintf(&b, "\n\nЧтобы оценить процент жира, измерьте %s.", need)
+		return b.String()
+	}
+	b.WriteString("\n")
+	line(progress.BodyFat, fmt.Sprintf("%.1f%%", m.BodyFat), "п.п.")
+	line(progress.LeanMass, fmt.Sprintf("%.1f кг", m.LeanMass()), "кг")
+	fmt.Fprintf(&b, "\n\nПроцент жира оценён по формуле ВМС США, погрешность — около 3–4%%. "+
+		"Дневная норма теперь считается по сухой массе: %.0f ккал. Новые варианты плана в /regenerate составляются уже под неё.", nutrition.DailyTarget(user).Calories)
+	return b.String()
+}
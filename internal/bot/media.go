@@ -0,0 +1,56 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// maxDownloadSize is the largest file the Bot API lets bots download.
+const maxDownloadSize = 20 << 20
+
+// fileEndpointFor derives the file download URL format from the API endpoint
+// format, e.g. https://api.telegram.org/bot%s/%s gives
+// https://api.telegram.org/file/bot%s/%s. tgbotapi hardcodes the public one.
+func fileEndpointFor(apiEndpoint string) string {
+	if i := strings.LastIndex(apiEndpoint, "/bot%s/%s"); i >= 0 {
+		return apiEndpoint[:i] + "/file/bot%s/%s"
+	}
+	return tgbotapi.FileEndpoint
+}
+
+// downloadFile fetches a file users sent to the bot.
+func (t *TelegramBot) downloadFile(ctx context.Context, fileID string) ([]byte, error) {
+	file, err := t.bot.GetFile(tgbotapi.FileConfig{FileID: fileID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get file info: %w", err)
+	}
+	if file.FileSize > maxDownloadSize {
+		return nil, fmt.Errorf("file is %d bytes, over the %d byte limit", file.FileSize, maxDownloadSize)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf(t.fileEndpoint, t.bot.Token, file.FilePath), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := t.bot.Client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download file: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to download file: %s", resp.Status)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxDownloadSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to download file: %w", err)
+	}
+	if len(data) > maxDownloadSize {
+		return nil, fmt.Errorf("file is over the %d byte limit", maxDownloadSize)
+	}
+	return data, nil
+}
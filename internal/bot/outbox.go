@@ -0,0 +1,123 @@
+package bot
+
+import (
+	"context"
+	"diet-bot/internal/models"
+	"encoding/json"
+	"fmt"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"time"
+)
+
+const (
+	outboxBatchSize   = 20
+	outboxLease       = time.Minute
+	outboxMaxAttempts = 10
+)
+
+// checkoutCreatedPayload is the outbox payload of models.OutboxTopicCheckoutCreated.
+type checkoutCreatedPayload struct {
+	PaymentID   int64  `json:"payment_id"`
+	ChatID      int64  `json:"chat_id"`
+	CheckoutURL string `json:"checkout_url"`
+}
+
+// outboxHandlers deliver committed outbox events by topic.
+func (t *TelegramBot) outboxHandlers() map[string]func(ctx context.Context, event *models.OutboxEvent) error {
+	return map[string]func(ctx context.Context, event *models.OutboxEvent) error{
+		models.OutboxTopicCheckoutCreated: t.sendCheckoutLink,
+	}
+}
+
+// StartOutboxDispatcher delivers outbox events when woken and retries
+// undelivered ones every interval until the context is cancelled.
+func (t *TelegramBot) StartOutboxDispatcher(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			case <-t.outboxWake:
+			}
+			t.dispatchOutbox(ctx)
+		}
+	}()
+}
+
+// wakeOutboxDispatcher has the dispatcher run soon without waiting for it;
+// wake-ups that arrive while one is pending are merged.
+func (t *TelegramBot) wakeOutboxDispatcher() {
+	select {
+	case t.outboxWake <- struct{}{}:
+	default:
+	}
+}
+
+// dispatchOutbox delivers one batch of pending outbox events.
+func (t *TelegramBot) dispatchOutbox(ctx context.Context) {
+	events, err := t.db.ClaimOutboxEvents(ctx, outboxBatchSize, outboxLease)
+	if err != nil {
+		t.logger.Error("Failed to claim outbox events", "error", err)
+		return
+	}
+
+	handlers := t.outboxHandlers()
+	for _, event := range events {
+		handler, ok := handlers[event.Topic]
+		if !ok {
+			err = fmt.Errorf("no handler for topic %q", event.Topic)
+		} else {
+			err = handler(ctx, event)
+		}
+
+		if err == nil {
+			if err := t.db.MarkOutboxEventProcessed(ctx, event.ID); err != nil {
+				t.logger.Error("Failed to mark outbox event processed", "eventID", event.ID, "error", err)
+			}
+			continue
+		}
+
+		t.logger.Error("Failed to deliver outbox event", "eventID", event.ID, "topic", event.Topic, "error", err)
+		if event.Attempts+1 >= outboxMaxAttempts {
+			// Give up so the event stops blocking the batch
+			t.notifyAdmins(fmt.Sprintf("Событие outbox #%d (%s) не доставлено после %d попыток: %v", event.ID, event.Topic, outboxMaxAttempts, err))
+			if err := t.db.MarkOutboxEventProcessed(ctx, event.ID); err != nil {
+				t.logger.Error("Failed to mark outbox event processed", "eventID", event.ID, "error", err)
+			}
+			continue
+		}
+		if err := t.db.MarkOutboxEventFailed(ctx, event.ID, err.Error()); err != nil {
+			t.logger.Error("Failed to mark outbox event failed", "eventID", event.ID, "error", err)
+		}
+	}
+}
+
+// sendCheckoutLink sends the payment button for a checkout created in StateConfirm.
+func (t *TelegramBot) sendCheckoutLink(ctx context.Context, event *models.OutboxEvent) error {
+	var payload checkoutCreatedPayload
+	if err := json.Unmarshal(event.Payload, &payload); err != nil {
+		return fmt.Errorf("invalid payload: %w", err)
+	}
+
+	// Nothing to pay for once the payment has moved on
+	payment, err := t.db.GetPaymentByID(ctx, payload.PaymentID)
+	if err != nil {
+		return err
+	}
+	if payment.Status != models.PaymentStatusPending {
+		return nil
+	}
+
+	paymentMsg := tgbotapi.NewMessage(payload.ChatID, "Нажмите на кнопку ниже, чтобы перейти к оплате:")
+	paymentMsg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonURL("Оплатить", payload.CheckoutURL),
+		),
+	)
+	_, err = t.bot.Send(paymentMsg)
+	return err
+}
@@ -0,0 +1,141 @@
+package bot
+
+import (
+	"context"
+	"crypto/rand"
+	"diet-bot/internal/models"
+	"encoding/hex"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"strings"
+	"time"
+)
+
+const (
+	mealCallbackPrefix = "meal:"
+	mealSaveAction     = "save"
+	mealCancelAction   = "cancel"
+
+	// mealDraftTTL is how long an estimate waits for confirmation
+	mealDraftTTL = time.Hour
+)
+
+// mealDraft is a photo or voice estimate the user has not confirmed yet.
+type mealDraft struct {
+	telegramID int64
+	logs       []*models.FoodLog
+	created    time.Time
+}
+
+// handleMealPhoto recognises the dishes on a photo and asks the user to
+// confirm them before they go to the diary.
+func (t *TelegramBot) handleMealPhoto(ctx context.Context, message *tgbotapi.Message, user *models.User) {
+	chatID := message.Chat.ID
+
+	// Telegram lists the sizes smallest first
+	photo := message.Photo[len(message.Photo)-1]
+	data, err := t.downloadFile(ctx, photo.FileID)
+	if err != nil {
+		t.logger.Error("Failed to download meal photo", "error", err, "userID", user.ID)
+		t.bot.Send(tgbotapi.NewMessage(chatID, "Извините, не удалось загрузить фото. Попробуйте ещё раз."))
+		return
+	}
+
+	estimateCtx, cancel := context.WithTimeout(ctx, mealEstimateTimeout)
+	defer cancel()
+
+	estimate, err := t.estimator.EstimateMealPhoto(estimateCtx, data, strings.TrimSpace(message.Caption))
+	if err != nil {
+		t.logger.Error("Failed to estimate meal photo", "error", err, "userID", user.ID)
+		t.bot.Send(tgbotapi.NewMessage(chatID, "Извините, не удалось распознать фото. Попробуйте позже или опишите блюдо текстом."))
+		return
+	}
+	logs := t.mealLogsFromEstimate(ctx, estimate)
+	if len(logs) == 0 {
+		t.bot.Send(tgbotapi.NewMessage(chatID, "Не нашёл на фото еды. Сфотографируйте тарелку поближе или опишите блюдо текстом."))
+		return
+	}
+
+	t.proposeMeal(chatID, message.From.ID, "📷 Похоже, на фото:\n"+formatMeal(logs)+
+		"\n\nЗаписать в дневник? Если я ошибся, нажмите «Отмена» и опишите блюдо текстом.", logs)
+}
+
+// proposeMeal keeps the estimate as a draft and sends text with buttons to
+// save or drop it.
+func (t *TelegramBot) proposeMeal(chatID, telegramID int64, text string, logs []*models.FoodLog) {
+	token := t.addMealDraft(&mealDraft{telegramID: telegramID, logs: logs, created: time.Now()})
+	msg := tgbotapi.NewMessage(chatID, text)
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("✅ Записать", mealCallbackPrefix+mealSaveAction+":"+token),
+		tgbotapi.NewInlineKeyboardButtonData("❌ Отмена", mealCallbackPrefix+mealCancelAction+":"+token),
+	))
+	t.bot.Send(msg)
+}
+
+// handleMealCallback saves or drops a proposed meal.
+func (t *TelegramBot) handleMealCallback(callbackQuery *tgbotapi.CallbackQuery) {
+	action, token, ok := strings.Cut(strings.TrimPrefix(callbackQuery.Data, mealCallbackPrefix), ":")
+	if !ok || callbackQuery.Message == nil {
+		return
+	}
+	ctx := context.Background()
+	chatID := callbackQuery.Message.Chat.ID
+	messageID := callbackQuery.Message.MessageID
+
+	draft := t.takeMealDraft(token, callbackQuery.From.ID)
+	if draft == nil {
+		t.bot.Send(tgbotapi.NewEditMessageText(chatID, messageID, "Эта оценка устарела. Отправьте блюдо ещё раз."))
+		return
+	}
+	if action != mealSaveAction {
+		t.bot.Send(tgbotapi.NewEditMessageText(chatID, messageID, "Запись отменена."))
+		return
+	}
+
+	user, err := t.db.GetUser(ctx, callbackQuery.From.ID)
+	if err != nil {
+		t.logger.Error("Failed to get user for meal confirmation", "error", err, "userID", callbackQuery.From.ID)
+		t.bot.Send(tgbotapi.NewMessage(chatID, "Извините, произошла ошибка. Попробуйте позже."))
+		return
+	}
+	reply, err := t.saveMeal(ctx, user, draft.logs)
+	if err != nil {
+		t.logger.Error("Failed to save food logs", "error", err, "userID", user.ID)
+		t.bot.Send(tgbotapi.NewMessage(chatID, "Извините, не удалось сохранить запись. Попробуйте позже."))
+		return
+	}
+	t.bot.Send(tgbotapi.NewEditMessageText(chatID, messageID, reply))
+}
+
+// addMealDraft stores the draft and returns the token its buttons carry.
+// Expired drafts are dropped on the way.
+func (t *TelegramBot) addMealDraft(draft *mealDraft) string {
+	buf := make([]byte, 8)
+	rand.Read(buf)
+	token := hex.EncodeToString(buf)
+
+	t.draftMutex.Lock()
+	defer t.draftMutex.Unlock()
+	for k, d := range t.mealDrafts {
+		if time.Since(d.created) > mealDraftTTL {
+			delete(t.mealDrafts, k)
+		}
+	}
+	t.mealDrafts[token] = draft
+	return token
+}
+
+// takeMealDraft removes and returns the user's draft, or nil when it is
+// unknown, expired or belongs to someone else.
+func (t *TelegramBot) takeMealDraft(token string, telegramID int64) *mealDraft {
+	t.draftMutex.Lock()
+	defer t.draftMutex.Unlock()
+	draft, ok := t.mealDrafts[token]
+	if !ok || draft.telegramID != telegramID {
+		return nil
+	}
+	delete(t.mealDrafts, token)
+	if time.Since(draft.created) > mealDraftTTL {
+		return nil
+	}
+	return draft
+}
@@ -0,0 +1,91 @@
+package bot
+
+import (
+	"context"
+	"diet-bot/internal/db"
+	"diet-bot/internal/models"
+	"errors"
+	"fmt"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// planHistoryLimit is how many plans /plans lists.
+const planHistoryLimit = 10
+
+// handlePlansCommand lists the user's plans with the profile each was built
+// from, or resends one plan when given its number.
+func (t *TelegramBot) handlePlansCommand(message *tgbotapi.Message) {
+	chatID := message.Chat.ID
+	ctx := context.Background()
+
+	user, err := t.db.GetUser(ctx, message.From.ID)
+	if errors.Is(err, db.ErrNotFound) {
+		t.bot.Send(tgbotapi.NewMessage(chatID, "У вас пока нет планов питания. Используйте /start, чтобы получить первый."))
+		return
+	}
+	if err != nil {
+		t.logger.Error("Failed to get user for plan history", "error", err, "userID", message.From.ID)
+		t.bot.Send(tgbotapi.NewMessage(chatID, "Извините, не удалось загрузить историю планов. Попробуйте позже."))
+		return
+	}
+
+	plans, err := t.db.ListDietPlans(ctx, user.ID, planHistoryLimit)
+	if err != nil {
+		t.logger.Error("Failed to list diet plans", "error", err, "userID", user.ID)
+		t.bot.Send(tgbotapi.NewMessage(chatID, "Извините, не удалось загрузить историю планов. Попробуйте позже."))
+		return
+	}
+	if len(plans) == 0 {
+		t.bot.Send(tgbotapi.NewMessage(chatID, "У вас пока нет планов питания. Используйте /start, чтобы получить первый."))
+		return
+	}
+
+	if arg := strings.TrimSpace(message.CommandArguments()); arg != "" {
+		id, err := strconv.ParseInt(strings.TrimPrefix(arg, "#"), 10, 64)
+		if err != nil {
+			t.bot.Send(tgbotapi.NewMessage(chatID, "Использование: /plans [номер плана]"))
+			return
+		}
+		for _, plan := range plans {
+			if plan.ID == id {
+				t.bot.Send(tgbotapi.NewMessage(chatID, formatPlanSummary(plan, user.Location())+"\n\n"+plan.PlanText))
+				return
+			}
+		}
+		t.bot.Send(tgbotapi.NewMessage(chatID, fmt.Sprintf("План #%d не найден.", id)))
+		return
+	}
+
+	var b strings.Builder
+	b.WriteString("📋 Ваши планы питания:")
+	for _, plan := range plans {
+		b.WriteString("\n\n" + formatPlanSummary(plan, user.Location()))
+	}
+	b.WriteString("\n\nЧтобы открыть план, отправьте /plans <номер>.")
+	t.bot.Send(tgbotapi.NewMessage(chatID, b.String()))
+}
+
+// formatPlanSummary describes when and from which inputs a plan was generated,
+// dating it in the user's time zone.
+func formatPlanSummary(plan *models.DietPlan, loc *time.Location) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "План #%d от %s", plan.ID, plan.CreatedAt.In(loc).Format("02.01.2006"))
+	if plan.ParentID != 0 {
+		b.WriteString("\nИзменение: " + describeRevision(plan))
+	}
+
+	if plan.Profile.IsEmpty() {
+		b.WriteString("\nДанные анкеты не сохранились")
+	} else {
+		p := plan.Profile
+		fmt.Fprintf(&b, "\nПол: %s, рост: %d см, вес: %g кг, цель: %s", p.Gender, p.Height, p.Weight, p.Goal)
+	}
+
+	if plan.Model != "" {
+		fmt.Fprintf(&b, "\nМодель: %s, промпт %s, токенов: %d", plan.Model, plan.PromptVersion, plan.PromptTokens+plan.CompletionTokens)
+	}
+	return b.String()
+}
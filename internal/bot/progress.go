@@ -0,0 +1,138 @@
+package bot
+
+import (
+	"context"
+	"diet-bot/internal/db"
+	"diet-bot/internal/models"
+	"diet-bot/internal/nutrition"
+	"diet-bot/internal/progress"
+	"errors"
+	"fmt"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"math"
+)
+
+const (
+	// calorieChartDays is how many days the calorie chart covers.
+	calorieChartDays = 14
+	// calorieTolerance is how far from the target a day still counts as on target.
+	calorieTolerance = 0.1
+)
+
+// handleProgressCommand sends the weight chart for the last weightHistoryDays
+// and, once the food diary has entries, the calorie chart.
+func (t *TelegramBot) handleProgressCommand(message *tgbotapi.Message) {
+	chatID := message.Chat.ID
+	ctx := context.Background()
+
+	user, err := t.db.GetUser(ctx, message.From.ID)
+	if errors.Is(err, db.ErrNotFound) {
+		t.bot.Send(tgbotapi.NewMessage(chatID, "Сначала заполните анкету с помощью /start."))
+		return
+	}
+	if err != nil {
+		t.logger.Error("Failed to get user for progress", "error", err, "userID", message.From.ID)
+		t.bot.Send(tgbotapi.NewMessage(chatID, "Извините, не удалось построить график. Попробуйте позже."))
+		return
+	}
+
+	t.sendWeightProgress(ctx, chatID, user)
+	t.sendCalorieProgress(ctx, chatID, user)
+}
+
+func (t *TelegramBot) sendWeightProgress(ctx context.Context, chatID int64, user *models.User) {
+	since := user.Today().AddDate(0, 0, -weightHistoryDays)
+	logs, err := t.db.ListWeightLogs(ctx, user.ID, since)
+	if err != nil {
+		t.logger.Error("Failed to list weight logs", "error", err, "userID", user.ID)
+		t.bot.Send(tgbotapi.NewMessage(chatID, "Извините, не удалось построить график. Попробуйте позже."))
+		return
+	}
+	trend, ok := progress.ComputeTrend(logs)
+	if !ok {
+		t.bot.Send(tgbotapi.NewMessage(chatID, "Записей веса пока нет. Отправьте, например, /weight 72.4"))
+		return
+	}
+
+	chart, err := progress.WeightChart(logs, user.Goal).PNG()
+	if err != nil {
+		t.logger.Error("Failed to render weight chart", "error", err, "userID", user.ID)
+		t.bot.Send(tgbotapi.NewMessage(chatID, "Извините, не удалось построить график. Попробуйте позже."))
+		return
+	}
+
+	caption := fmt.Sprintf("📈 Вес за %d дней\nСерые точки — записи, синяя линия — среднее за %d дней, зелёный пунктир — %s.\n\n%s",
+		weightHistoryDays, progress.MovingAverageDays, describeGoalLine(user.Goal), formatTrend(trend))
+	t.sendChart(chatID, "weight.png", chart, caption)
+}
+
+// sendCalorieProgress charts daily calories against the target for the last
+// calorieChartDays; it sends nothing while the food diary is empty.
+func (t *TelegramBot) sendCalorieProgress(ctx context.Context, chatID int64, user *models.User) {
+	today := user.Today()
+	logs, err := t.db.ListFoodLogs(ctx, user.ID, today.AddDate(0, 0, -calorieChartDays+1), today)
+	if err != nil {
+		t.logger.Error("Failed to list food logs", "error", err, "userID", user.ID)
+		return
+	}
+	if len(logs) == 0 {
+		return
+	}
+
+	// Entries come oldest first, so each day extends the last bar or starts a new one
+	var bars []progress.Bar
+	for _, l := range logs {
+		if n := len(bars); n > 0 && bars[n-1].Day.Equal(l.LoggedOn) {
+			bars[n-1].Value += l.Calories
+			continue
+		}
+		bars = append(bars, progress.Bar{Day: l.LoggedOn, Value: l.Calories})
+	}
+
+	plan, err := t.db.GetDietPlan(ctx, user.ID)
+	if err != nil && !errors.Is(err, db.ErrNotFound) {
+		t.logger.Error("Failed to get diet plan", "error", err, "userID", user.ID)
+		return
+	}
+	target := calorieTarget(user, plan)
+	chart, err := progress.BarChart{Bars: bars, Target: target, Tolerance: calorieTolerance, Unit: "kcal"}.PNG()
+	if err != nil {
+		t.logger.Error("Failed to render calorie chart", "error", err, "userID", user.ID)
+		return
+	}
+
+	caption := fmt.Sprintf("🍽 Калории за %d дней\nПунктир — цель %.0f ккал. Зелёные дни — в пределах ±%.0f%%, красные — больше, жёлтые — меньше.",
+		calorieChartDays, target, calorieTolerance*100)
+	t.sendChart(chatID, "calories.png", chart, caption)
+}
+
+// calorieTarget is the daily calories the chart and the weekly report measure
+// against: the latest plan's own target unless it is below what the bot
+// allows, or the computed target when there is no plan.
+func calorieTarget(user *models.User, plan *models.DietPlan) float64 {
+	if plan == nil || plan.Data == nil || plan.Data.DailyCalories <= 0 {
+		return nutrition.DailyTarget(user).Calories
+	}
+	return math.Max(float64(plan.Data.DailyCalories), nutrition.MinCalories(user))
+}
+
+// describeGoalLine explains the goal line of progress.WeightChart.
+func describeGoalLine(goal string) string {
+	rate := progress.GoalWeeklyRate(goal)
+	switch {
+	case rate < 0:
+		return fmt.Sprintf("цель: −%g кг в неделю", -rate)
+	case rate > 0:
+		return fmt.Sprintf("цель: +%g кг в неделю", rate)
+	default:
+		return "цель: удерживать вес"
+	}
+}
+
+func (t *TelegramBot) sendChart(chatID int64, name string, chart []byte, caption string) {
+	photo := tgbotapi.NewPhoto(chatID, tgbotapi.FileBytes{Name: name, Bytes: chart})
+	photo.Caption = caption
+	if _, err := t.bot.Send(photo); err != nil {
+		t.logger.Error("Failed to send chart", "error", err, "chatID", chatID)
+	}
+}
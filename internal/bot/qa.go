@@ -0,0 +1,218 @@
+package bot
+
+import (
+	"context"
+	"diet-bot/internal/db"
+	"diet-bot/internal/gpt"
+	"diet-bot/internal/models"
+	"errors"
+	"fmt"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Question tiers: users with a purchased plan may ask more
+const (
+	tierFree = "free"
+	tierPlan = "plan"
+)
+
+var dailyQuestionQuota = map[string]int{
+	tierFree: 3,
+	tierPlan: 20,
+}
+
+const (
+	// chatHistoryLimit is how many earlier messages the model sees
+	chatHistoryLimit = 10
+
+	answerTimeout = time.Minute
+)
+
+// questionWords start a question even without a question mark, as in
+// "чем заменить творог".
+var questionWords = map[string]bool{
+	"как": true, "какой": true, "какая": true, "какое": true, "какие": true,
+	"чем": true, "что": true, "почему": true, "зачем": true, "можно": true,
+	"сколько": true, "когда": true, "где": true, "стоит": true, "нужно": true,
+	"подскажи": true, "подскажите": true, "посоветуй": true, "посоветуйте": true,
+	"объясни": true, "объясните": true,
+}
+
+// medicalStems mark questions the bot must not answer; they belong to a
+// doctor. Matched against the start of each word.
+var medicalStems = []string{
+	"диабет", "инсулин", "беремен", "грудн", "лактац",
+	"лекарств", "таблет", "препарат", "антибиотик", "диагноз", "симптом",
+	"болезн", "болит", "гастрит", "язв", "панкреатит", "почечн", "гипертон",
+	"давлени", "холестерин", "щитовидн", "анорекс", "булими", "рвот", "онколог",
+}
+
+// isQuestion tells a question about the plan from a meal to log.
+func isQuestion(text string) bool {
+	if strings.Contains(text, "?") {
+		return true
+	}
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r)
+	})
+	return len(words) > 0 && questionWords[words[0]]
+}
+
+// isMedicalQuestion reports whether the question touches a medical topic.
+func isMedicalQuestion(text string) bool {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r)
+	})
+	for _, word := range words {
+		for _, stem := range medicalStems {
+			if strings.HasPrefix(word, stem) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// handleAskCommand answers "/ask чем заменить творог?" or explains how to ask
+// when called without a question.
+func (t *TelegramBot) handleAskCommand(message *tgbotapi.Message) {
+	chatID := message.Chat.ID
+	ctx := context.Background()
+
+	user, err := t.db.GetUser(ctx, message.From.ID)
+	if errors.Is(err, db.ErrNotFound) {
+		t.bot.Send(tgbotapi.NewMessage(chatID, "Сначала заполните анкету с помощью /start."))
+		return
+	}
+	if err != nil {
+		t.logger.Error("Failed to get user for question", "error", err, "userID", message.From.ID)
+		t.bot.Send(tgbotapi.NewMessage(chatID, "Извините, произошла ошибка. Попробуйте позже."))
+		return
+	}
+
+	if question := strings.TrimSpace(message.CommandArguments()); question != "" {
+		t.answerQuestion(ctx, chatID, user, question)
+		return
+	}
+
+	_, tier := t.questionTier(ctx, user)
+	asked, err := t.questionsAskedToday(ctx, user)
+	if err != nil {
+		t.logger.Error("Failed to count questions", "error", err, "userID", user.ID)
+	}
+	t.bot.Send(tgbotapi.NewMessage(chatID, fmt.Sprintf(
+		"💬 Задайте вопрос о питании или своём плане, например: «чем заменить творог?» — просто напишите его или отправьте /ask вопрос.\n\n"+
+			"Вопросов сегодня: %d из %d. Начать разговор заново: /forget",
+		asked, dailyQuestionQuota[tier])))
+}
+
+// handleForgetCommand clears the user's conversation memory.
+func (t *TelegramBot) handleForgetCommand(message *tgbotapi.Message) {
+	chatID := message.Chat.ID
+	ctx := context.Background()
+
+	user, err := t.db.GetUser(ctx, message.From.ID)
+	if errors.Is(err, db.ErrNotFound) {
+		t.bot.Send(tgbotapi.NewMessage(chatID, "Сначала заполните анкету с помощью /start."))
+		return
+	}
+	if err == nil {
+		err = t.db.ForgetChatMessages(ctx, user.ID)
+	}
+	if err != nil {
+		t.logger.Error("Failed to forget chat messages", "error", err, "userID", message.From.ID)
+		t.bot.Send(tgbotapi.NewMessage(chatID, "Извините, произошла ошибка. Попробуйте позже."))
+		return
+	}
+	t.bot.Send(tgbotapi.NewMessage(chatID, "🧹 Начинаем разговор заново: прежние вопросы я больше не учитываю."))
+}
+
+// answerQuestion checks the question against the medical filter, records it
+// against the daily quota and answers it with the plan and conversation as
+// context.
+func (t *TelegramBot) answerQuestion(ctx context.Context, chatID int64, user *models.User, question string) {
+	if isMedicalQuestion(question) {
+		t.bot.Send(tgbotapi.NewMessage(chatID, "🩺 Это медицинский вопрос, и ответить на него может только врач. "+
+			"Пожалуйста, обсудите его со специалистом. А с вопросами о питании и плане я помогу."))
+		return
+	}
+
+	plan, tier := t.questionTier(ctx, user)
+	quota := dailyQuestionQuota[tier]
+
+	// The history is read before the question joins it
+	history, err := t.db.ListChatMessages(ctx, user.ID, chatHistoryLimit)
+	if err != nil {
+		t.logger.Error("Failed to list chat messages", "error", err, "userID", user.ID)
+	}
+
+	// The question is counted before it is answered, so concurrent questions
+	// and failed answers cannot go over the quota
+	asked, err := t.db.SaveQuestion(ctx, &models.ChatMessage{UserID: user.ID, Role: models.ChatRoleUser, Content: question}, startOfDay(user), quota)
+	if errors.Is(err, db.ErrQuotaExceeded) {
+		text := fmt.Sprintf("На сегодня вопросы закончились: %d из %d. Возвращайтесь завтра!", asked, quota)
+		if tier == tierFree {
+			text += fmt.Sprintf("\n\nС персональным планом питания можно задавать до %d вопросов в день.", dailyQuestionQuota[tierPlan])
+		}
+		t.bot.Send(tgbotapi.NewMessage(chatID, text))
+		return
+	}
+	if err != nil {
+		t.logger.Error("Failed to save question", "error", err, "userID", user.ID)
+		t.bot.Send(tgbotapi.NewMessage(chatID, "Извините, произошла ошибка. Попробуйте позже."))
+		return
+	}
+
+	qc := gpt.QuestionContext{User: user, History: history}
+	if plan != nil {
+		qc.PlanText = plan.PlanText
+	}
+
+	answerCtx, cancel := context.WithTimeout(ctx, answerTimeout)
+	defer cancel()
+
+	answer, err := t.gptClient.AnswerQuestion(answerCtx, qc, question)
+	if err != nil || answer == "" {
+		t.logger.Error("Failed to answer question", "error", err, "userID", user.ID)
+		t.bot.Send(tgbotapi.NewMessage(chatID, "Извините, не удалось ответить. Попробуйте позже."))
+		return
+	}
+
+	err = t.db.SaveChatMessages(ctx, []*models.ChatMessage{{UserID: user.ID, Role: models.ChatRoleAssistant, Content: answer}})
+	if err != nil {
+		t.logger.Error("Failed to save answer", "error", err, "userID", user.ID)
+	}
+
+	if left := quota - asked - 1; left <= 3 {
+		answer += fmt.Sprintf("\n\nОсталось вопросов на сегодня: %d.", left)
+	}
+	t.bot.Send(tgbotapi.NewMessage(chatID, answer))
+}
+
+// questionTier returns the user's latest plan, if any, and the tier it puts
+// them in.
+func (t *TelegramBot) questionTier(ctx context.Context, user *models.User) (*models.DietPlan, string) {
+	plan, err := t.db.GetDietPlan(ctx, user.ID)
+	if err != nil {
+		if !errors.Is(err, db.ErrNotFound) {
+			t.logger.Error("Failed to get plan for question", "error", err, "userID", user.ID)
+		}
+		return nil, tierFree
+	}
+	return plan, tierPlan
+}
+
+// questionsAskedToday counts the questions asked since midnight where the
+// user lives.
+func (t *TelegramBot) questionsAskedToday(ctx context.Context, user *models.User) (int, error) {
+	return t.db.CountChatMessages(ctx, user.ID, models.ChatRoleUser, startOfDay(user))
+}
+
+// startOfDay is midnight where the user lives.
+func startOfDay(user *models.User) time.Time {
+	now := time.Now().In(user.Location())
+	return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+}
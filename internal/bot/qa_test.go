@@ -0,0 +1,29 @@
+package bot
+
+import "testing"
+
+func TestIsQuestion(t *testing.T) {
+	for _, text := range []string{"чем заменить творог?", "Чем заменить творог", "можно ли кофе", "а на ужин?", "Сколько воды пить"} {
+		if !isQuestion(text) {
+			t.Errorf("isQuestion(%q) = false", text)
+		}
+	}
+	for _, text := range []string{"овсянка 60г, банан", "творог и чай", "кофе с молоком"} {
+		if isQuestion(text) {
+			t.Errorf("isQuestion(%q) = true", text)
+		}
+	}
+}
+
+func TestIsMedicalQuestion(t *testing.T) {
+	for _, text := range []string{"можно ли при диабете?", "я беременна, что есть?", "какие таблетки для похудения", "у меня гастрит"} {
+		if !isMedicalQuestion(text) {
+			t.Errorf("isMedicalQuestion(%q) = false", text)
+		}
+	}
+	for _, text := range []string{"чем заменить творог?", "сколько белка на ужин", "можно печенье?", "что больше подходит на завтрак?"} {
+		if isMedicalQuestion(text) {
+			t.Errorf("isMedicalQuestion(%q) = true", text)
+		}
+	}
+}
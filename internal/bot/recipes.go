@@ -0,0 +1,195 @@
+package bot
+
+import (
+	"context"
+	"diet-bot/internal/db"
+	"diet-bot/internal/gpt"
+	"diet-bot/internal/models"
+	"errors"
+	"fmt"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	recipeCallbackPrefix = "recipe:"
+
+	recipeTimeout = time.Minute
+)
+
+// revisionRestrictions carry what a revision asked of the dishes over to
+// their recipes.
+var revisionRestrictions = map[string]string{
+	models.RevisionCheaper: "только недорогие продукты",
+	models.RevisionFaster:  "не дольше 20 минут готовки",
+}
+
+// recipeKeyboard has a "Рецепт" button for each day of a structured plan.
+func recipeKeyboard(plan *models.DietPlan) *tgbotapi.InlineKeyboardMarkup {
+	if plan.ID == 0 || plan.Data == nil || len(plan.Data.Days) == 0 {
+		return nil
+	}
+	var rows [][]tgbotapi.InlineKeyboardButton
+	var row []tgbotapi.InlineKeyboardButton
+	for _, day := range plan.Data.Days {
+		row = append(row, tgbotapi.NewInlineKeyboardButtonData(fmt.Sprintf("📖 Рецепт · день %d", day.Day),
+			fmt.Sprintf("%s%d:%d", recipeCallbackPrefix, plan.ID, day.Day)))
+		if len(row) == 2 {
+			rows, row = append(rows, row), nil
+		}
+	}
+	if len(row) > 0 {
+		rows = append(rows, row)
+	}
+	markup := tgbotapi.NewInlineKeyboardMarkup(rows...)
+	return &markup
+}
+
+// handleRecipesCommand shows the recipe buttons of the latest plan again.
+func (t *TelegramBot) handleRecipesCommand(message *tgbotapi.Message) {
+	chatID := message.Chat.ID
+
+	_, plan, ok := t.loadPlanForRevision(context.Background(), chatID, message.From.ID)
+	if !ok {
+		return
+	}
+	markup := recipeKeyboard(plan)
+	if markup == nil {
+		t.bot.Send(tgbotapi.NewMessage(chatID, "Этот план составлен в старом формате, и рецептов к нему нет. "+
+			"Обновите план через /regenerate — и у каждого блюда появится рецепт."))
+		return
+	}
+
+	msg := tgbotapi.NewMessage(chatID, "Рецепты блюд какого дня показать?")
+	msg.ReplyMarkup = markup
+	t.bot.Send(msg)
+}
+
+// handleRecipeCallback handles "recipe:<plan>:<day>", which lists the meals
+// of the day, and "recipe:<plan>:<day>:<meal>", which sends the recipe.
+func (t *TelegramBot) handleRecipeCallback(callbackQuery *tgbotapi.CallbackQuery) {
+	if callbackQuery.Message == nil {
+		return
+	}
+	parts := strings.Split(strings.TrimPrefix(callbackQuery.Data, recipeCallbackPrefix), ":")
+	if len(parts) < 2 {
+		return
+	}
+	planID, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return
+	}
+	dayNum, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return
+	}
+	var mealNum int
+	if len(parts) > 2 {
+		mealNum, _ = strconv.Atoi(parts[2])
+	}
+
+	ctx := context.Background()
+	chatID := callbackQuery.Message.Chat.ID
+
+	// Recipes stay available for older plans, but only to their owner
+	user, err := t.db.GetUser(ctx, callbackQuery.From.ID)
+	var plan *models.DietPlan
+	if err == nil {
+		plan, err = t.db.GetDietPlanByID(ctx, planID)
+	}
+	if errors.Is(err, db.ErrNotFound) || (err == nil && plan.UserID != user.ID) {
+		t.bot.Send(tgbotapi.NewMessage(chatID, "Этот план больше недоступен. Отправьте /recipes, чтобы открыть рецепты текущего плана."))
+		return
+	}
+	if err != nil {
+		t.logger.Error("Failed to load plan for recipe", "error", err, "planID", planID)
+		t.bot.Send(tgbotapi.NewMessage(chatID, "Извините, произошла ошибка. Попробуйте позже."))
+		return
+	}
+	if plan.Data == nil || plan.Data.FindDay(dayNum) == nil {
+		return
+	}
+	day := plan.Data.FindDay(dayNum)
+
+	if mealNum < 1 || mealNum > len(day.Meals) {
+		var rows [][]tgbotapi.InlineKeyboardButton
+		for i, m := range day.Meals {
+			rows = append(rows, tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData(
+				fmt.Sprintf("%s %s — %s", m.Time, m.Name, m.Dish), fmt.Sprintf("%s%d:%d:%d", recipeCallbackPrefix, plan.ID, day.Day, i+1))))
+		}
+		msg := tgbotapi.NewMessage(chatID, fmt.Sprintf("📅 День %d: рецепт какого блюда показать?", day.Day))
+		msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(rows...)
+		t.bot.Send(msg)
+		return
+	}
+
+	t.sendRecipe(ctx, chatID, gpt.RecipeRequest{
+		Dish:         day.Meals[mealNum-1].Dish,
+		Calories:     day.Meals[mealNum-1].Calories,
+		Ingredients:  day.Meals[mealNum-1].Ingredients,
+		Restrictions: t.recipeRestrictions(ctx, plan),
+	})
+}
+
+// sendRecipe sends the cached recipe for the request, generating and caching
+// it first when there is none.
+func (t *TelegramBot) sendRecipe(ctx context.Context, chatID int64, req gpt.RecipeRequest) {
+	key := models.RecipeCacheKey(req.Dish, req.Restrictions)
+	recipe, err := t.db.GetRecipe(ctx, key)
+	if err == nil {
+		t.bot.Send(tgbotapi.NewMessage(chatID, gpt.FormatRecipe(recipe)))
+		return
+	}
+	if !errors.Is(err, db.ErrNotFound) {
+		t.logger.Error("Failed to get cached recipe", "error", err, "dish", req.Dish)
+	}
+
+	progress, err := t.bot.Send(tgbotapi.NewMessage(chatID, fmt.Sprintf("⏳ Готовлю рецепт «%s»…", req.Dish)))
+	if err != nil {
+		t.logger.Error("Failed to send recipe progress", "error", err, "chatID", chatID)
+		return
+	}
+
+	genCtx, cancel := context.WithTimeout(ctx, recipeTimeout)
+	defer cancel()
+
+	recipe, err = t.gptClient.GenerateRecipe(genCtx, req)
+	if err != nil {
+		t.logger.Error("Failed to generate recipe", "error", err, "dish", req.Dish)
+		t.bot.Send(tgbotapi.NewEditMessageText(chatID, progress.MessageID, "Извините, не удалось составить рецепт. Попробуйте позже."))
+		return
+	}
+	if err := t.db.SaveRecipe(ctx, recipe); err != nil {
+		t.logger.Error("Failed to cache recipe", "error", err, "dish", req.Dish)
+	}
+
+	t.bot.Send(tgbotapi.NewEditMessageText(chatID, progress.MessageID, gpt.FormatRecipe(recipe)))
+}
+
+// recipeRestrictions collects what the plan and the revisions it came from
+// asked of its dishes.
+func (t *TelegramBot) recipeRestrictions(ctx context.Context, plan *models.DietPlan) []string {
+	var restrictions []string
+	seen := make(map[string]bool)
+	for p := plan; p != nil; {
+		if r, ok := revisionRestrictions[p.Revision]; ok && !seen[r] {
+			seen[r] = true
+			restrictions = append(restrictions, r)
+		}
+		// Each payment allows a bounded number of revisions, so the chain is short
+		if p.ParentID == 0 || len(seen) == len(revisionRestrictions) {
+			break
+		}
+		parent, err := t.db.GetDietPlanByID(ctx, p.ParentID)
+		if err != nil {
+			if !errors.Is(err, db.ErrNotFound) {
+				t.logger.Error("Failed to load parent plan", "error", err, "planID", p.ParentID)
+			}
+			break
+		}
+		p = parent
+	}
+	return restrictions
+}
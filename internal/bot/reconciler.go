@@ -0,0 +1,219 @@
+package bot
+
+import (
+	"context"
+	"diet-bot/internal/db"
+	"diet-bot/internal/models"
+	"errors"
+	"fmt"
+	"github.com/stripe/stripe-go/v72"
+	"strings"
+	"time"
+)
+
+// ReconcileReport summarises one pass of comparing Stripe with the payments table.
+type ReconcileReport struct {
+	Checked       int
+	Fulfilled     []int64
+	Expired       []int64
+	Discrepancies []string
+}
+
+func (r *ReconcileReport) discrepancy(format string, args ...interface{}) {
+	r.Discrepancies = append(r.Discrepancies, fmt.Sprintf(format, args...))
+}
+
+// String formats the report for admins.
+func (r *ReconcileReport) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Сверка платежей: проверено %d, выдано планов %d, истекло %d", r.Checked, len(r.Fulfilled), len(r.Expired))
+	if len(r.Fulfilled) > 0 {
+		fmt.Fprintf(&b, "\nВыданы пропущенные планы по платежам: %v", r.Fulfilled)
+	}
+	if len(r.Discrepancies) > 0 {
+		b.WriteString("\nРасхождения:")
+		for _, d := range r.Discrepancies {
+			b.WriteString("\n• " + d)
+		}
+	}
+	return b.String()
+}
+
+// StartReconciler periodically reconciles payments until the context is cancelled.
+// Sessions are listed for the lookback window and unsettled payments older than
+// it are looked up one by one; pending payments older than abandonAfter have
+// their checkout session expired.
+func (t *TelegramBot) StartReconciler(ctx context.Context, interval, lookback, abandonAfter time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			report, err := t.ReconcilePayments(ctx, lookback, abandonAfter)
+			if err != nil {
+				t.logger.Error("Payment reconciliation failed", "error", err)
+			} else {
+				t.logger.Info("Payment reconciliation finished",
+					"checked", report.Checked,
+					"fulfilled", len(report.Fulfilled),
+					"expired", len(report.Expired),
+					"discrepancies", len(report.Discrepancies))
+				if len(report.Fulfilled) > 0 || len(report.Discrepancies) > 0 {
+					t.notifyAdmins(report.String())
+				}
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// ReconcilePayments fulfils paid sessions that have no plan yet, whether the
+// webhook was missed or the plan could not be generated, expires
+// abandoned sessions and collects anything that does not add up.
+func (t *TelegramBot) ReconcilePayments(ctx context.Context, lookback, abandonAfter time.Duration) (*ReconcileReport, error) {
+	now := time.Now()
+	report := &ReconcileReport{}
+
+	sessions, err := t.stripeClient.ListCheckoutSessions(now.Add(-lookback))
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool, len(sessions))
+	for _, sess := range sessions {
+		seen[sess.ID] = true
+		report.Checked++
+
+		payment, err := t.db.GetPaymentByStripeID(ctx, sess.ID)
+		if errors.Is(err, db.ErrNotFound) {
+			if sess.PaymentStatus == stripe.CheckoutSessionPaymentStatusPaid {
+				report.discrepancy("оплаченная сессия %s без записи платежа (клиент %s)", sess.ID, sess.ClientReferenceID)
+			}
+			continue
+		}
+		if err != nil {
+			return report, err
+		}
+
+		t.reconcilePayment(ctx, report, payment, sess, now.Add(-abandonAfter))
+	}
+
+	// Pending and failed payments older than the lookback window are not in
+	// the listing; a failed one may still be paid until its session closes
+	var unsettled []*models.Payment
+	for _, status := range []string{models.PaymentStatusPending, models.PaymentStatusFailed} {
+		payments, err := t.db.ListPaymentsByStatus(ctx, status, now.Add(-lookback))
+		if err != nil {
+			return report, err
+		}
+		unsettled = append(unsettled, payments...)
+	}
+	for _, payment := range unsettled {
+		if seen[payment.StripePaymentID] {
+			continue
+		}
+
+		sess, err := t.stripeClient.GetCheckoutSession(payment.StripePaymentID)
+		if err != nil {
+			report.discrepancy("платёж #%d: не удалось получить сессию %s: %v", payment.ID, payment.StripePaymentID, err)
+			continue
+		}
+		report.Checked++
+
+		t.reconcilePayment(ctx, report, payment, sess, now.Add(-abandonAfter))
+	}
+
+	return report, nil
+}
+
+func (t *TelegramBot) reconcilePayment(ctx context.Context, report *ReconcileReport, payment *models.Payment, sess *stripe.CheckoutSession, abandonedBefore time.Time) {
+	paid := sess.PaymentStatus == stripe.CheckoutSessionPaymentStatusPaid
+	unsettled := payment.Status == models.PaymentStatusPending || payment.Status == models.PaymentStatusFailed
+
+	paymentIntentID := ""
+	if sess.PaymentIntent != nil {
+		paymentIntentID = sess.PaymentIntent.ID
+	}
+
+	awaiting, err := t.awaitsPlan(ctx, payment)
+	if err != nil {
+		report.discrepancy("платёж #%d: не удалось проверить план: %v", payment.ID, err)
+		return
+	}
+
+	switch {
+	case paid && awaiting:
+		user, err := t.db.GetUserByID(ctx, payment.UserID)
+		if err != nil {
+			report.discrepancy("платёж #%d оплачен, но пользователь не найден: %v", payment.ID, err)
+			return
+		}
+		if payment.StripePaymentIntentID == "" && paymentIntentID != "" {
+			if err := t.db.SetPaymentIntentID(ctx, sess.ID, paymentIntentID); err != nil {
+				t.logger.Error("Failed to save payment intent", "error", err, "sessionID", sess.ID)
+			}
+		}
+
+		planCtx, cancel := context.WithTimeout(ctx, planGenerationTimeout)
+		err = t.fulfilPayment(planCtx, user, payment)
+		cancel()
+		if errors.Is(err, errFulfilmentInProgress) {
+			// The webhook is generating the plan right now
+			return
+		}
+		if errors.Is(err, errPlanBelowMinimum) {
+			report.discrepancy("платёж #%d оплачен, но план ниже безопасного минимума, нужен возврат: /refund %d", payment.ID, payment.ID)
+			return
+		}
+		if err != nil {
+			report.discrepancy("платёж #%d оплачен, но выдать план не удалось: %v", payment.ID, err)
+			return
+		}
+
+		// A payment refunded while its plan was generated is not fulfilled
+		fulfilled, err := t.db.HasDietPlan(ctx, payment.ID)
+		if err != nil || !fulfilled {
+			report.discrepancy("платёж #%d оплачен, но плана по нему нет", payment.ID)
+			return
+		}
+		report.Fulfilled = append(report.Fulfilled, payment.ID)
+
+	case paid:
+		// The redirect fulfilled the plan but the webhook that links the intent was missed
+		if payment.StripePaymentIntentID == "" && paymentIntentID != "" {
+			if err := t.db.SetPaymentIntentID(ctx, sess.ID, paymentIntentID); err != nil {
+				t.logger.Error("Failed to save payment intent", "error", err, "sessionID", sess.ID)
+			}
+		}
+
+	case payment.Status == models.PaymentStatusCompleted:
+		report.discrepancy("платёж #%d отмечен как %s, но сессия %s не оплачена", payment.ID, payment.Status, sess.ID)
+
+	case unsettled && sess.Status == stripe.CheckoutSessionStatusExpired:
+		t.expirePayment(ctx, payment, report)
+
+	case unsettled && sess.Status == stripe.CheckoutSessionStatusOpen && payment.CreatedAt.Before(abandonedBefore):
+		if err := t.stripeClient.ExpireCheckoutSession(sess.ID); err != nil {
+			report.discrepancy("платёж #%d: не удалось закрыть сессию %s: %v", payment.ID, sess.ID, err)
+			return
+		}
+		t.expirePayment(ctx, payment, report)
+	}
+}
+
+// expirePayment marks an unsettled payment whose session has closed as expired.
+func (t *TelegramBot) expirePayment(ctx context.Context, payment *models.Payment, report *ReconcileReport) {
+	ok, err := t.transitionPayment(ctx, payment, models.PaymentStatusExpired)
+	if err != nil {
+		report.discrepancy("платёж #%d: %v", payment.ID, err)
+		return
+	}
+	if ok {
+		report.Expired = append(report.Expired, payment.ID)
+	}
+}
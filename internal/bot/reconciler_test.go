@@ -0,0 +1,132 @@
+package bot
+
+import (
+	"context"
+	"diet-bot/internal/models"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestReconcileMissedWebhook(t *testing.T) {
+	h := newHarness(t)
+	const user = int64(6101)
+	ctx := context.Background()
+
+	h.onboard(user)
+	h.say(user, "Да, всё верно", 2)
+
+	// The session is paid but the webhook never arrives
+	sessions := h.stripe.Sessions()
+	sessionID := sessions[len(sessions)-1].ID
+	if _, _, err := h.stripe.CompleteSession(sessionID); err != nil {
+		t.Fatalf("CompleteSession: %v", err)
+	}
+
+	report, err := h.bot.ReconcilePayments(ctx, time.Hour, time.Hour)
+	if err != nil {
+		t.Fatalf("ReconcilePayments: %v", err)
+	}
+	assertContains(t, h.expect(user, 1)[0].Text(), testPlanDish)
+
+	p, err := h.store.GetPaymentByStripeID(ctx, sessionID)
+	if err != nil || p.Status != models.PaymentStatusCompleted || p.StripePaymentIntentID == "" {
+		t.Fatalf("payment after reconciliation: %+v, %v", p, err)
+	}
+	if len(report.Fulfilled) != 1 || report.Fulfilled[0] != p.ID || len(report.Discrepancies) != 0 {
+		t.Fatalf("report: %+v", report)
+	}
+
+	// A fulfilled payment is left alone on the next pass
+	report, err = h.bot.ReconcilePayments(ctx, time.Hour, time.Hour)
+	if err != nil || len(report.Fulfilled) != 0 || len(report.Discrepancies) != 0 {
+		t.Fatalf("second pass: %+v, %v", report, err)
+	}
+}
+
+func TestReconcileFailedGeneration(t *testing.T) {
+	h := newHarness(t)
+	const user = int64(6102)
+	ctx := context.Background()
+
+	h.onboard(user)
+	h.say(user, "Да, всё верно", 2)
+
+	sessions := h.stripe.Sessions()
+	sessionID := sessions[len(sessions)-1].ID
+	payload, signature, err := h.stripe.CompleteSession(sessionID)
+	if err != nil {
+		t.Fatalf("CompleteSession: %v", err)
+	}
+
+	h.gptDown.Store(true)
+	if code := h.deliverWebhook(payload, signature); code != http.StatusOK {
+		t.Fatalf("webhook status = %d", code)
+	}
+	assertContains(t, h.expect(user, 1)[0].Text(), "повторим попытку")
+
+	// Without a plan the payment is not completed, so it stays to be retried
+	p, err := h.store.GetPaymentByStripeID(ctx, sessionID)
+	if err != nil || p.Status != models.PaymentStatusPending || p.StripePaymentIntentID == "" {
+		t.Fatalf("payment after failed generation: %+v, %v", p, err)
+	}
+	if ok, err := h.store.HasDietPlan(ctx, p.ID); err != nil || ok {
+		t.Fatalf("HasDietPlan after failed generation: %v, %v", ok, err)
+	}
+
+	report, err := h.bot.ReconcilePayments(ctx, time.Hour, time.Hour)
+	if err != nil || len(report.Fulfilled) != 0 || len(report.Discrepancies) != 1 {
+		t.Fatalf("report while the model is down: %+v, %v", report, err)
+	}
+
+	h.gptDown.Store(false)
+	report, err = h.bot.ReconcilePayments(ctx, time.Hour, time.Hour)
+	if err != nil {
+		t.Fatalf("ReconcilePayments: %v", err)
+	}
+	if len(report.Fulfilled) != 1 || report.Fulfilled[0] != p.ID || len(report.Discrepancies) != 0 {
+		t.Fatalf("report: %+v", report)
+	}
+	assertContains(t, h.expect(user, 1)[0].Text(), "план питания готов")
+
+	p, err = h.store.GetPaymentByStripeID(ctx, sessionID)
+	if err != nil || p.Status != models.PaymentStatusCompleted {
+		t.Fatalf("payment after retry: %+v, %v", p, err)
+	}
+}
+
+func TestReconcileAbandonedSession(t *testing.T) {
+	h := newHarness(t)
+	const user = int64(6103)
+	ctx := context.Background()
+
+	h.onboard(user)
+	h.say(user, "Да, всё верно", 2)
+
+	sessions := h.stripe.Sessions()
+	sessionID := sessions[len(sessions)-1].ID
+
+	// A fresh session is not abandoned yet
+	report, err := h.bot.ReconcilePayments(ctx, time.Hour, time.Hour)
+	if err != nil || len(report.Expired) != 0 {
+		t.Fatalf("report for a fresh session: %+v, %v", report, err)
+	}
+
+	report, err = h.bot.ReconcilePayments(ctx, time.Hour, 0)
+	if err != nil {
+		t.Fatalf("ReconcilePayments: %v", err)
+	}
+
+	p, err := h.store.GetPaymentByStripeID(ctx, sessionID)
+	if err != nil || p.Status != models.PaymentStatusExpired {
+		t.Fatalf("payment after reconciliation: %+v, %v", p, err)
+	}
+	if len(report.Expired) != 1 || report.Expired[0] != p.ID || len(report.Fulfilled) != 0 {
+		t.Fatalf("report: %+v", report)
+	}
+	for _, sess := range h.stripe.Sessions() {
+		if sess.ID == sessionID && sess.Status != "expired" {
+			t.Fatalf("checkout session left %s", sess.Status)
+		}
+	}
+}
@@ -0,0 +1,283 @@
+package bot
+
+import (
+	"context"
+	"diet-bot/internal/db"
+	"diet-bot/internal/models"
+	"errors"
+	"fmt"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/stripe/stripe-go/v72"
+	"strconv"
+	"strings"
+)
+
+// handleChargeRefunded records a full or partial refund reported by Stripe.
+// A full refund revokes the purchase.
+func (t *TelegramBot) handleChargeRefunded(ctx context.Context, charge *stripe.Charge) error {
+	if charge.PaymentIntent == nil {
+		t.logger.Warn("Refunded charge has no payment intent", "chargeID", charge.ID)
+		return nil
+	}
+
+	payment, err := t.findPaymentByIntent(ctx, charge.PaymentIntent.ID)
+	if payment == nil {
+		return err
+	}
+
+	status := models.PaymentStatusPartiallyRefunded
+	switch {
+	case charge.Refunded:
+		status = models.PaymentStatusRefunded
+	case payment.Status == models.PaymentStatusDisputed:
+		// A partial refund does not settle an open dispute
+		status = models.PaymentStatusDisputed
+	}
+
+	// Stripe may deliver the same event more than once
+	if payment.Status == status && payment.RefundedAmount == charge.AmountRefunded {
+		return nil
+	}
+
+	payment.RefundedAmount = charge.AmountRefunded
+	fulfilled := payment.Status != models.PaymentStatusPending
+	if ok, err := t.transitionPayment(ctx, payment, status); !ok {
+		return err
+	}
+
+	switch {
+	case status == models.PaymentStatusRefunded && !fulfilled:
+		// The plan was never made, so there is nothing to take back
+		t.notifyPaymentOwner(ctx, payment, "💸 Оплата возвращена.")
+	case status == models.PaymentStatusRefunded:
+		t.revokePurchase(ctx, payment, "💸 Оплата возвращена. Доступ к плану питания отозван. Если это ошибка, свяжитесь с поддержкой.")
+	default:
+		t.notifyPaymentOwner(ctx, payment, fmt.Sprintf("💸 Оформлен частичный возврат: %s.", formatMinorAmount(charge.AmountRefunded, string(charge.Currency))))
+	}
+
+	t.notifyAdmins(fmt.Sprintf("Платёж #%d: %s, возвращено %s", payment.ID, status, formatMinorAmount(charge.AmountRefunded, string(charge.Currency))))
+	return nil
+}
+
+// handleDisputeCreated freezes the payment while the dispute is open.
+func (t *TelegramBot) handleDisputeCreated(ctx context.Context, dispute *stripe.Dispute) error {
+	payment, err := t.findPaymentByIntent(ctx, disputePaymentIntentID(dispute))
+	if payment == nil {
+		return err
+	}
+
+	if payment.Status == models.PaymentStatusDisputed {
+		return nil
+	}
+	if ok, err := t.transitionPayment(ctx, payment, models.PaymentStatusDisputed); !ok {
+		return err
+	}
+
+	t.notifyAdmins(fmt.Sprintf("⚠️ Открыт спор по платежу #%d (%s), причина: %s", payment.ID, dispute.ID, dispute.Reason))
+	return nil
+}
+
+// handleDisputeClosed settles the payment once Stripe closes the dispute.
+// A lost dispute revokes the purchase.
+func (t *TelegramBot) handleDisputeClosed(ctx context.Context, dispute *stripe.Dispute) error {
+	payment, err := t.findPaymentByIntent(ctx, disputePaymentIntentID(dispute))
+	if payment == nil {
+		return err
+	}
+
+	var status string
+	switch dispute.Status {
+	case stripe.DisputeStatusWon, stripe.DisputeStatusWarningClosed:
+		// A refund made before or during the dispute still stands
+		status = models.PaymentStatusCompleted
+		if payment.RefundedAmount > 0 {
+			status = models.PaymentStatusPartiallyRefunded
+		}
+	case stripe.DisputeStatusLost:
+		status = models.PaymentStatusDisputeLost
+	case stripe.DisputeStatusChargeRefunded:
+		status = models.PaymentStatusRefunded
+	default:
+		t.logger.Warn("Unexpected dispute status on close", "disputeID", dispute.ID, "status", dispute.Status)
+		return nil
+	}
+
+	if payment.Status == status {
+		return nil
+	}
+	if ok, err := t.transitionPayment(ctx, payment, status); !ok {
+		return err
+	}
+
+	if payment.IsRevoked() {
+		t.revokePurchase(ctx, payment, "Платёж был оспорен через банк. Доступ к плану питания отозван.")
+	}
+
+	t.notifyAdmins(fmt.Sprintf("Спор по платежу #%d закрыт: %s", payment.ID, dispute.Status))
+	return nil
+}
+
+// handleRefundCommand lets an admin refund a payment: /refund <payment_id> [amount]
+func (t *TelegramBot) handleRefundCommand(message *tgbotapi.Message) {
+	chatID := message.Chat.ID
+
+	if !t.isAdmin(message.From.ID) {
+		msg := tgbotapi.NewMessage(chatID, "Неизвестная команда. Используйте /start для начала работы.")
+		t.bot.Send(msg)
+		return
+	}
+
+	args := strings.Fields(message.CommandArguments())
+	if len(args) == 0 || len(args) > 2 {
+		msg := tgbotapi.NewMessage(chatID, "Использование: /refund <id платежа> [сумма]\nБез суммы выполняется полный возврат.")
+		t.bot.Send(msg)
+		return
+	}
+
+	paymentID, err := strconv.ParseInt(args[0], 10, 64)
+	if err != nil {
+		t.bot.Send(tgbotapi.NewMessage(chatID, "Некорректный id платежа."))
+		return
+	}
+
+	// Amounts are entered in the same units as payments.amount (roubles),
+	// Stripe expects the smallest currency unit.
+	var amount int64
+	if len(args) == 2 {
+		amount, err = strconv.ParseInt(args[1], 10, 64)
+		if err != nil || amount <= 0 {
+			t.bot.Send(tgbotapi.NewMessage(chatID, "Некорректная сумма возврата."))
+			return
+		}
+		amount *= 100
+	}
+
+	ctx := context.Background()
+	payment, err := t.db.GetPaymentByID(ctx, paymentID)
+	if err != nil {
+		t.logger.Error("Failed to get payment for refund", "error", err, "paymentID", paymentID)
+		t.bot.Send(tgbotapi.NewMessage(chatID, "Платёж не найден."))
+		return
+	}
+
+	// A pending payment with an intent was paid but never got its plan
+	if !models.CanTransitionPayment(payment.Status, models.PaymentStatusRefunded) {
+		t.bot.Send(tgbotapi.NewMessage(chatID, fmt.Sprintf("Платёж #%d в статусе %s, возврат невозможен.", payment.ID, payment.Status)))
+		return
+	}
+	if payment.StripePaymentIntentID == "" {
+		t.bot.Send(tgbotapi.NewMessage(chatID, fmt.Sprintf("У платежа #%d нет payment intent в Stripe.", payment.ID)))
+		return
+	}
+
+	ref, err := t.stripeClient.CreateRefund(payment.StripePaymentIntentID, amount)
+	if err != nil {
+		t.logger.Error("Failed to create refund", "error", err, "paymentID", payment.ID)
+		t.bot.Send(tgbotapi.NewMessage(chatID, "Stripe отклонил возврат: "+err.Error()))
+		return
+	}
+
+	t.logger.Info("Refund created", "paymentID", payment.ID, "refundID", ref.ID, "admin", message.From.ID)
+
+	// The payment status is updated by the charge.refunded webhook
+	msg := tgbotapi.NewMessage(chatID, fmt.Sprintf("Возврат %s по платежу #%d создан (статус: %s). Статус платежа обновится после уведомления от Stripe.", ref.ID, payment.ID, ref.Status))
+	t.bot.Send(msg)
+}
+
+// findPaymentByIntent returns a nil payment both when it is unknown to us (nil
+// error, nothing to retry) and when the lookup itself failed.
+func (t *TelegramBot) findPaymentByIntent(ctx context.Context, paymentIntentID string) (*models.Payment, error) {
+	if paymentIntentID == "" {
+		t.logger.Warn("Stripe event has no payment intent")
+		return nil, nil
+	}
+
+	payment, err := t.db.GetPaymentByIntentID(ctx, paymentIntentID)
+	if errors.Is(err, db.ErrNotFound) {
+		t.logger.Warn("No payment for payment intent", "paymentIntentID", paymentIntentID)
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return payment, nil
+}
+
+// transitionPayment applies a status change. A transition that is not allowed
+// is logged and skipped with a nil error; other failures are returned so the
+// webhook fails and Stripe retries it.
+func (t *TelegramBot) transitionPayment(ctx context.Context, payment *models.Payment, status string) (bool, error) {
+	from := payment.Status
+	err := t.db.TransitionPaymentStatus(ctx, payment, status)
+	if errors.Is(err, db.ErrInvalidTransition) {
+		t.logger.Warn("Skipped payment status change", "error", err, "paymentID", payment.ID, "from", from, "to", status)
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to change payment %d status from %s to %s: %w", payment.ID, from, status, err)
+	}
+
+	t.logger.Info("Payment status changed", "paymentID", payment.ID, "from", from, "to", status)
+	return true, nil
+}
+
+// revokePurchase tells the buyer their purchase was taken back and resets their dialog.
+func (t *TelegramBot) revokePurchase(ctx context.Context, payment *models.Payment, text string) {
+	user := t.notifyPaymentOwner(ctx, payment, text)
+	if user == nil {
+		return
+	}
+
+	t.stateMutex.Lock()
+	t.userStates[user.TelegramID] = &models.UserState{
+		TelegramID:    user.TelegramID,
+		CurrentState:  StateStart,
+		TemporaryData: make(map[string]interface{}),
+	}
+	t.stateMutex.Unlock()
+}
+
+func (t *TelegramBot) notifyPaymentOwner(ctx context.Context, payment *models.Payment, text string) *models.User {
+	user, err := t.db.GetUserByID(ctx, payment.UserID)
+	if err != nil {
+		t.logger.Error("Failed to get payment owner", "error", err, "paymentID", payment.ID)
+		return nil
+	}
+
+	if _, err := t.bot.Send(tgbotapi.NewMessage(user.ChatID, text)); err != nil {
+		t.logger.Error("Failed to notify user about payment", "error", err, "chatID", user.ChatID)
+	}
+	return user
+}
+
+func (t *TelegramBot) notifyAdmins(text string) {
+	for _, adminID := range t.adminIDs {
+		if _, err := t.bot.Send(tgbotapi.NewMessage(adminID, text)); err != nil {
+			t.logger.Error("Failed to notify admin", "error", err, "adminID", adminID)
+		}
+	}
+}
+
+func (t *TelegramBot) isAdmin(userID int64) bool {
+	for _, adminID := range t.adminIDs {
+		if adminID == userID {
+			return true
+		}
+	}
+	return false
+}
+
+func disputePaymentIntentID(dispute *stripe.Dispute) string {
+	if dispute.PaymentIntent != nil {
+		return dispute.PaymentIntent.ID
+	}
+	if dispute.Charge != nil && dispute.Charge.PaymentIntent != nil {
+		return dispute.Charge.PaymentIntent.ID
+	}
+	return ""
+}
+
+func formatMinorAmount(amount int64, currency string) string {
+	return fmt.Sprintf("%d.%02d %s", amount/100, amount%100, strings.ToUpper(currency))
+}
@@ -0,0 +1,56 @@
+package bot
+
+import (
+	"context"
+	"diet-bot/internal/db"
+	"diet-bot/internal/models"
+	"diet-bot/pkg/logger"
+	"errors"
+	"github.com/stripe/stripe-go/v72"
+	"testing"
+)
+
+// brokenTransitions fails every payment status change as a lost connection would.
+type brokenTransitions struct {
+	db.Store
+}
+
+func (brokenTransitions) TransitionPaymentStatus(ctx context.Context, payment *models.Payment, to string) error {
+	return errors.New("connection reset by peer")
+}
+
+func TestRefundWebhookStoreErrors(t *testing.T) {
+	ctx := context.Background()
+	store := db.NewMemoryDB()
+	user := &models.User{TelegramID: 1, ChatID: 1, Gender: "Мужской", Height: 180, Weight: 80, Goal: "Снизить"}
+	if err := store.SaveUser(ctx, user); err != nil {
+		t.Fatalf("SaveUser: %v", err)
+	}
+	payment := &models.Payment{UserID: user.ID, Amount: 1000, Currency: "rub", StripePaymentID: "cs_1", Status: models.PaymentStatusPending}
+	if err := store.SavePayment(ctx, payment); err != nil {
+		t.Fatalf("SavePayment: %v", err)
+	}
+	if err := store.SetPaymentIntentID(ctx, "cs_1", "pi_1"); err != nil {
+		t.Fatalf("SetPaymentIntentID: %v", err)
+	}
+	charge := &stripe.Charge{ID: "ch_1", PaymentIntent: &stripe.PaymentIntent{ID: "pi_1"}, AmountRefunded: 100}
+
+	// A refund of a payment that is still pending cannot apply and is acknowledged
+	bot := &TelegramBot{db: store, logger: logger.NewDevelopment()}
+	if err := bot.handleChargeRefunded(ctx, charge); err != nil {
+		t.Fatalf("invalid transition: %v", err)
+	}
+
+	// A store failure is returned so Stripe retries the event
+	if err := store.TransitionPaymentStatus(ctx, payment, models.PaymentStatusCompleted); err != nil {
+		t.Fatalf("TransitionPaymentStatus: %v", err)
+	}
+	bot.db = brokenTransitions{store}
+	if err := bot.handleChargeRefunded(ctx, charge); err == nil {
+		t.Fatal("store failure was swallowed")
+	}
+	dispute := &stripe.Dispute{ID: "dp_1", PaymentIntent: &stripe.PaymentIntent{ID: "pi_1"}}
+	if err := bot.handleDisputeCreated(ctx, dispute); err == nil {
+		t.Fatal("store failure on dispute was swallowed")
+	}
+}
@@ -0,0 +1,340 @@
+package bot
+
+import (
+	"context"
+	"diet-bot/internal/db"
+	"diet-bot/internal/gpt"
+	"diet-bot/internal/models"
+	"diet-bot/internal/nutrition"
+	"diet-bot/internal/safety"
+	"errors"
+	"fmt"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	regenerateCallbackPrefix = "regen:"
+
+	// defaultFreeRevisions is how many times a paid plan may be changed
+	// unless WithFreeRevisions says otherwise
+	defaultFreeRevisions = 3
+
+	planGenerationTimeout = 3 * time.Minute
+
+	// planAttempts is how many plans are generated before giving up on ones
+	// that keep falling short of the user's minimum intake
+	planAttempts = 2
+)
+
+// revisionNames label the /regenerate buttons.
+var revisionNames = map[string]string{
+	models.RevisionPlan:    "🔄 Весь план",
+	models.RevisionDay:     "📅 Один день",
+	models.RevisionMeal:    "🍽 Заменить блюдо",
+	models.RevisionCheaper: "💰 Дешевле",
+	models.RevisionFaster:  "⏱ Быстрее готовить",
+}
+
+// revisionDescriptions say what a revision changed, in /plans.
+var revisionDescriptions = map[string]string{
+	models.RevisionPlan:    "новый вариант",
+	models.RevisionDay:     "замена дня",
+	models.RevisionMeal:    "замена блюда",
+	models.RevisionCheaper: "дешевле",
+	models.RevisionFaster:  "быстрее готовить",
+	models.RevisionAdapt:   "новая цель по калориям",
+}
+
+var errNoRevisionsLeft = errors.New("no free revisions left")
+
+var errPlanBelowMinimum = errors.New("plan is below the minimum intake")
+
+// generatePlan asks the model for a plan, corrects its meals from the food
+// database and rejects a plan that has the user eat less than
+// nutrition.MinCalories on any day, asking again before giving up. A target
+// below the minimum is raised to it first.
+func (t *TelegramBot) generatePlan(ctx context.Context, req gpt.PlanRequest) (*gpt.PlanResult, error) {
+	minimum := nutrition.MinCalories(req.User)
+	if req.Target.Calories < minimum {
+		req.Target = nutrition.WithCalories(req.Target, minimum)
+	}
+
+	for attempt := 1; ; attempt++ {
+		result, err := t.gptClient.GenerateDietPlan(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+		t.checkPlanCalories(ctx, result)
+
+		lowest := nutrition.PlanMinimum(result.Data)
+		if lowest >= minimum*(1-nutrition.PlanCalorieTolerance) {
+			return result, nil
+		}
+		t.logger.Warn("Generated plan is below the minimum intake", "userID", req.User.ID, "calories", lowest, "minimum", minimum, "attempt", attempt)
+		if attempt == planAttempts {
+			return nil, fmt.Errorf("%w: %.0f kcal, minimum %.0f kcal", errPlanBelowMinimum, lowest, minimum)
+		}
+	}
+}
+
+// WithFreeRevisions sets how many free revisions each payment includes.
+func (t *TelegramBot) WithFreeRevisions(n int) *TelegramBot {
+	t.freeRevisions = n
+	return t
+}
+
+// handleRegenerateCommand offers the ways to change the latest plan.
+func (t *TelegramBot) handleRegenerateCommand(message *tgbotapi.Message) {
+	chatID := message.Chat.ID
+	ctx := context.Background()
+
+	user, plan, ok := t.loadPlanForRevision(ctx, chatID, message.From.ID)
+	if !ok || t.needsScreening(chatID, user) {
+		return
+	}
+	left, ok := t.revisionsLeft(ctx, chatID, plan)
+	if !ok {
+		return
+	}
+
+	kinds := []string{models.RevisionPlan, models.RevisionDay, models.RevisionMeal, models.RevisionCheaper, models.RevisionFaster}
+	text := fmt.Sprintf("Что изменить в плане #%d? Бесплатных изменений осталось: %d.", plan.ID, left)
+	if plan.Data == nil {
+		// Days and meals can only be picked out of a structured plan
+		kinds = []string{models.RevisionPlan, models.RevisionCheaper, models.RevisionFaster}
+		text += "\n\nЭтот план составлен в старом формате, поэтому его можно изменить только целиком."
+	}
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for _, kind := range kinds {
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(revisionNames[kind], fmt.Sprintf("%s%d:%s", regenerateCallbackPrefix, plan.ID, kind)),
+		))
+	}
+
+	msg := tgbotapi.NewMessage(chatID, text)
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(rows...)
+	t.bot.Send(msg)
+}
+
+// handleRegenerateCallback walks the choice down to a day and a meal where
+// needed, then revises the plan. The data is "regen:<plan>:<kind>[:day[:meal]]".
+func (t *TelegramBot) handleRegenerateCallback(callbackQuery *tgbotapi.CallbackQuery) {
+	if callbackQuery.Message == nil {
+		return
+	}
+	parts := strings.Split(strings.TrimPrefix(callbackQuery.Data, regenerateCallbackPrefix), ":")
+	if len(parts) < 2 {
+		return
+	}
+	planID, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return
+	}
+	kind := parts[1]
+	if _, ok := revisionNames[kind]; !ok {
+		return
+	}
+	var day, meal int
+	if len(parts) > 2 {
+		day, _ = strconv.Atoi(parts[2])
+	}
+	if len(parts) > 3 {
+		meal, _ = strconv.Atoi(parts[3])
+	}
+
+	ctx := context.Background()
+	chatID := callbackQuery.Message.Chat.ID
+	messageID := callbackQuery.Message.MessageID
+
+	user, plan, ok := t.loadPlanForRevision(ctx, chatID, callbackQuery.From.ID)
+	if !ok || t.needsScreening(chatID, user) {
+		return
+	}
+	if plan.ID != planID {
+		t.bot.Send(tgbotapi.NewEditMessageText(chatID, messageID, "План с тех пор уже изменился. Отправьте /regenerate ещё раз."))
+		return
+	}
+
+	// Day and meal revisions first ask which day, then which meal
+	callback := fmt.Sprintf("%s%d:%s", regenerateCallbackPrefix, plan.ID, kind)
+	if (kind == models.RevisionDay || kind == models.RevisionMeal) && (plan.Data == nil || plan.Data.FindDay(day) == nil) {
+		if plan.Data == nil {
+			return
+		}
+		var rows [][]tgbotapi.InlineKeyboardButton
+		var row []tgbotapi.InlineKeyboardButton
+		for _, d := range plan.Data.Days {
+			row = append(row, tgbotapi.NewInlineKeyboardButtonData(strconv.Itoa(d.Day), fmt.Sprintf("%s:%d", callback, d.Day)))
+			if len(row) == 4 {
+				rows, row = append(rows, row), nil
+			}
+		}
+		if len(row) > 0 {
+			rows = append(rows, row)
+		}
+		t.bot.Send(tgbotapi.NewEditMessageTextAndMarkup(chatID, messageID, "Какой день изменить?", tgbotapi.NewInlineKeyboardMarkup(rows...)))
+		return
+	}
+	if kind == models.RevisionMeal {
+		meals := plan.Data.FindDay(day).Meals
+		if meal < 1 || meal > len(meals) {
+			var rows [][]tgbotapi.InlineKeyboardButton
+			for i, m := range meals {
+				rows = append(rows, tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData(
+					fmt.Sprintf("%s %s — %s", m.Time, m.Name, m.Dish), fmt.Sprintf("%s:%d:%d", callback, day, i+1))))
+			}
+			t.bot.Send(tgbotapi.NewEditMessageTextAndMarkup(chatID, messageID, fmt.Sprintf("Какое блюдо дня %d заменить?", day), tgbotapi.NewInlineKeyboardMarkup(rows...)))
+			return
+		}
+	}
+
+	t.revisePlan(ctx, chatID, messageID, user, plan, gpt.PlanRequest{Revision: kind, Day: day, Meal: meal})
+}
+
+// revisePlan generates and stores a revision of plan and sends it, editing
+// messageID to show progress or, when it is 0, sending a new message. One
+// revision per user runs at a time. Adaptations after weekly reports keep
+// the request's target and do not use up free revisions.
+func (t *TelegramBot) revisePlan(ctx context.Context, chatID int64, messageID int, user *models.User, plan *models.DietPlan, req gpt.PlanRequest) {
+	if _, busy := t.revising.LoadOrStore(user.ID, true); busy {
+		t.bot.Send(tgbotapi.NewMessage(chatID, "План уже меняется, подождите немного."))
+		return
+	}
+	defer t.revising.Delete(user.ID)
+
+	// The user's weight may have changed since the plan was bought
+	if reason := safety.Assess(user); reason != "" {
+		t.logger.Info("Refused to revise a plan", "userID", user.ID, "reason", reason)
+		t.bot.Send(tgbotapi.NewMessage(chatID, refusalText(reason, user)))
+		return
+	}
+
+	free := req.Revision == models.RevisionAdapt
+	if !free {
+		if _, ok := t.revisionsLeft(ctx, chatID, plan); !ok {
+			return
+		}
+	}
+	const progressText = "⏳ Меняю план, это займёт около минуты…"
+	if messageID == 0 {
+		sent, err := t.bot.Send(tgbotapi.NewMessage(chatID, progressText))
+		if err != nil {
+			t.logger.Error("Failed to send revision progress", "error", err, "chatID", chatID)
+			return
+		}
+		messageID = sent.MessageID
+	} else {
+		t.bot.Send(tgbotapi.NewEditMessageText(chatID, messageID, progressText))
+	}
+
+	genCtx, cancel := context.WithTimeout(ctx, planGenerationTimeout)
+	defer cancel()
+
+	req.User = user
+	if req.Target.Calories == 0 {
+		req.Target = nutrition.DailyTarget(user)
+	}
+	req.Previous = plan
+	result, err := t.generatePlan(genCtx, req)
+	if err != nil {
+		t.logger.Error("Failed to revise diet plan", "error", err, "userID", user.ID, "planID", plan.ID)
+		t.bot.Send(tgbotapi.NewEditMessageText(chatID, messageID, "Извините, не удалось изменить план. Попробуйте позже — бесплатное изменение не потрачено."))
+		return
+	}
+
+	revision := &models.DietPlan{
+		UserID:           user.ID,
+		PaymentID:        plan.PaymentID,
+		PlanText:         result.Text,
+		Data:             result.Data,
+		Profile:          models.NewProfileSnapshot(user),
+		PromptVersion:    result.PromptVersion,
+		Model:            result.Model,
+		PromptTokens:     result.PromptTokens,
+		CompletionTokens: result.CompletionTokens,
+		ParentID:         plan.ID,
+		Revision:         req.Revision,
+	}
+	var used int
+	err = t.db.WithTx(ctx, func(tx db.Store) error {
+		if free {
+			return tx.SaveDietPlan(ctx, revision)
+		}
+		n, err := tx.CountPlanRevisions(ctx, plan.PaymentID)
+		if err != nil {
+			return err
+		}
+		if used = n; used >= t.freeRevisions {
+			return errNoRevisionsLeft
+		}
+		return tx.SaveDietPlan(ctx, revision)
+	})
+	if errors.Is(err, errNoRevisionsLeft) {
+		t.bot.Send(tgbotapi.NewEditMessageText(chatID, messageID, t.noRevisionsText()))
+		return
+	}
+	if err != nil {
+		t.logger.Error("Failed to save plan revision", "error", err, "userID", user.ID, "planID", plan.ID)
+		t.bot.Send(tgbotapi.NewEditMessageText(chatID, messageID, "Извините, не удалось сохранить план. Попробуйте позже."))
+		return
+	}
+
+	t.bot.Send(tgbotapi.NewEditMessageText(chatID, messageID, fmt.Sprintf("✅ Готово: план #%d, %s.", revision.ID, describeRevision(revision))))
+	header := fmt.Sprintf("🔄 Обновлённый план питания. Бесплатных изменений осталось: %d.", t.freeRevisions-used-1)
+	if free {
+		header = fmt.Sprintf("🔄 План на следующую неделю: %.0f ккал в день.", req.Target.Calories)
+	}
+	msg := tgbotapi.NewMessage(chatID, header+"\n\n"+result.Text+"\n\n"+disclaimer(user))
+	if markup := recipeKeyboard(revision); markup != nil {
+		msg.ReplyMarkup = markup
+	}
+	t.bot.Send(msg)
+}
+
+// loadPlanForRevision finds the user's latest plan, telling them when there is
+// none.
+func (t *TelegramBot) loadPlanForRevision(ctx context.Context, chatID, telegramID int64) (*models.User, *models.DietPlan, bool) {
+	user, err := t.db.GetUser(ctx, telegramID)
+	var plan *models.DietPlan
+	if err == nil {
+		plan, err = t.db.GetDietPlan(ctx, user.ID)
+	}
+	if errors.Is(err, db.ErrNotFound) {
+		t.bot.Send(tgbotapi.NewMessage(chatID, "У вас пока нет плана питания. Используйте /start, чтобы получить первый."))
+		return nil, nil, false
+	}
+	if err != nil {
+		t.logger.Error("Failed to load plan for revision", "error", err, "userID", telegramID)
+		t.bot.Send(tgbotapi.NewMessage(chatID, "Извините, произошла ошибка. Попробуйте позже."))
+		return nil, nil, false
+	}
+	return user, plan, true
+}
+
+// revisionsLeft returns how many free revisions the plan's payment has left,
+// telling the user when there are none.
+func (t *TelegramBot) revisionsLeft(ctx context.Context, chatID int64, plan *models.DietPlan) (int, bool) {
+	used, err := t.db.CountPlanRevisions(ctx, plan.PaymentID)
+	if err != nil {
+		t.logger.Error("Failed to count plan revisions", "error", err, "planID", plan.ID)
+		t.bot.Send(tgbotapi.NewMessage(chatID, "Извините, произошла ошибка. Попробуйте позже."))
+		return 0, false
+	}
+	if used >= t.freeRevisions {
+		t.bot.Send(tgbotapi.NewMessage(chatID, t.noRevisionsText()))
+		return 0, false
+	}
+	return t.freeRevisions - used, true
+}
+
+func (t *TelegramBot) noRevisionsText() string {
+	return fmt.Sprintf("Бесплатные изменения этого плана закончились (%d из %d). Новый план можно получить через /start.", t.freeRevisions, t.freeRevisions)
+}
+
+// describeRevision names what a revision changed, e.g. "замена дня (из плана #12)".
+func describeRevision(plan *models.DietPlan) string {
+	return fmt.Sprintf("%s (из плана #%d)", revisionDescriptions[plan.Revision], plan.ParentID)
+}
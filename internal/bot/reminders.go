@@ -0,0 +1,408 @@
+package bot
+
+import (
+	"context"
+	"diet-bot/internal/db"
+	"diet-bot/internal/models"
+	"diet-bot/internal/schedule"
+	"errors"
+	"fmt"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	reminderBatchSize = 100
+	// reminderStaleAfter drops runs missed by more than this, e.g. while the
+	// bot was down, instead of sending a burst of outdated nudges.
+	reminderStaleAfter = 30 * time.Minute
+
+	reminderCallbackPrefix = "reminders:"
+)
+
+// reminderKinds lists the kinds in display order.
+var reminderKinds = []string{models.ReminderMeal, models.ReminderWater, models.ReminderWeighIn}
+
+// reminderPresets are the rules a reminder gets when switched on from the menu.
+var reminderPresets = map[string]string{
+	models.ReminderMeal:    "0 9 * * *; 0 13 * * *; 0 19 * * *",
+	models.ReminderWater:   "0 10-20/2 * * *",
+	models.ReminderWeighIn: "30 8 * * 1",
+}
+
+var reminderTitles = map[string]string{
+	models.ReminderMeal:    "🍽 Приёмы пищи",
+	models.ReminderWater:   "💧 Вода",
+	models.ReminderWeighIn: "⚖️ Взвешивание",
+}
+
+// reminderButtonNames complete the "Включить: …" button labels.
+var reminderButtonNames = map[string]string{
+	models.ReminderMeal:    "еда",
+	models.ReminderWater:   "вода",
+	models.ReminderWeighIn: "взвешивание",
+}
+
+var reminderTexts = map[string]string{
+	models.ReminderMeal:    "🍽 Время приёма пищи по вашему плану.",
+	models.ReminderWater:   "💧 Пора выпить стакан воды.",
+	models.ReminderWeighIn: "⚖️ Время взвеситься! Отправьте результат командой /weight, например /weight 72.4",
+}
+
+// reminderAliases maps what users type in /reminders to kinds.
+var reminderAliases = map[string]string{
+	"еда": models.ReminderMeal, "питание": models.ReminderMeal, "meal": models.ReminderMeal,
+	"вода": models.ReminderWater, "water": models.ReminderWater,
+	"вес": models.ReminderWeighIn, "взвешивание": models.ReminderWeighIn, "weigh_in": models.ReminderWeighIn,
+}
+
+var weekdayNames = []string{"вс", "пн", "вт", "ср", "чт", "пт", "сб"}
+
+// StartReminderScheduler sends due reminders every interval until the context
+// is cancelled. Each next run is delayed by up to maxJitter so that reminders
+// set for the same minute do not all go out at once.
+func (t *TelegramBot) StartReminderScheduler(ctx context.Context, interval, maxJitter time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			sent, err := t.runDueReminders(ctx, time.Now(), maxJitter)
+			if err != nil {
+				t.logger.Error("Reminder run failed", "error", err)
+			} else if sent > 0 {
+				t.logger.Info("Reminders sent", "count", sent)
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// runDueReminders reschedules every reminder due at now and then sends them.
+// Rescheduling commits first, so a crash loses a nudge rather than repeating it.
+func (t *TelegramBot) runDueReminders(ctx context.Context, now time.Time, maxJitter time.Duration) (int, error) {
+	var toSend []*models.Reminder
+
+	err := t.db.WithTx(ctx, func(tx db.Store) error {
+		due, err := tx.ClaimDueReminders(ctx, now, reminderBatchSize)
+		if err != nil {
+			return err
+		}
+
+		for _, r := range due {
+			next, err := nextReminderRun(r, now, maxJitter)
+			if err != nil {
+				// A broken rule would otherwise be claimed on every tick
+				t.logger.Error("Invalid reminder rule, disabling", "error", err, "reminderID", r.ID)
+				r.Enabled = false
+				if err := tx.SaveReminder(ctx, r); err != nil {
+					return err
+				}
+				continue
+			}
+
+			var sentAt *time.Time
+			if now.Sub(r.NextRunAt) <= reminderStaleAfter {
+				sentAt = &now
+				toSend = append(toSend, r)
+			}
+			if err := tx.RescheduleReminder(ctx, r.ID, next, sentAt); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	sent := 0
+	for _, r := range toSend {
+		msg := tgbotapi.NewMessage(r.ChatID, reminderTexts[r.Kind])
+		if r.Kind == models.ReminderWater {
+			var due bool
+			// Users who keep up with their water are left alone
+			if msg, due = t.waterReminder(ctx, r, now); !due {
+				continue
+			}
+		}
+		err := t.sendUnprompted(ctx, r.TelegramID, msg)
+		if errors.Is(err, errUserBlocked) {
+			t.logger.Info("Skipping reminders of user who blocked the bot", "telegramID", r.TelegramID)
+			continue
+		}
+		if err != nil {
+			t.logger.Error("Failed to send reminder", "error", err, "reminderID", r.ID)
+			continue
+		}
+		sent++
+	}
+	return sent, nil
+}
+
+// nextReminderRun returns the next run of r after now plus a random jitter.
+func nextReminderRun(r *models.Reminder, now time.Time, maxJitter time.Duration) (time.Time, error) {
+	rule, err := schedule.ParseRule(r.Rule)
+	if err != nil {
+		return time.Time{}, err
+	}
+	next := rule.Next(now, models.LoadLocation(r.Timezone))
+	if next.IsZero() {
+		return time.Time{}, fmt.Errorf("rule %q never fires", r.Rule)
+	}
+	if maxJitter > 0 {
+		next = next.Add(time.Duration(rand.Int63n(int64(maxJitter))))
+	}
+	return next, nil
+}
+
+// handleRemindersCommand shows the reminder menu, or changes one reminder:
+// "/reminders вода 10:00 14:00 будни" or "/reminders вода выкл".
+func (t *TelegramBot) handleRemindersCommand(message *tgbotapi.Message) {
+	chatID := message.Chat.ID
+	ctx := context.Background()
+
+	user, err := t.db.GetUser(ctx, message.From.ID)
+	if errors.Is(err, db.ErrNotFound) {
+		t.bot.Send(tgbotapi.NewMessage(chatID, "Сначала заполните анкету с помощью /start."))
+		return
+	}
+	if err != nil {
+		t.logger.Error("Failed to get user for reminders", "error", err, "userID", message.From.ID)
+		t.bot.Send(tgbotapi.NewMessage(chatID, "Извините, произошла ошибка. Попробуйте позже."))
+		return
+	}
+
+	args := strings.Fields(strings.ToLower(message.CommandArguments()))
+	if len(args) == 0 {
+		t.sendRemindersMenu(ctx, chatID, user, 0)
+		return
+	}
+
+	usage := "Использование:\n/reminders — меню напоминаний\n/reminders вода 10:00 14:00 18:00 [будни|выходные|пн,ср,пт]\n/reminders вода выкл\nВиды: еда, вода, вес."
+	kind, ok := reminderAliases[args[0]]
+	if !ok || len(args) < 2 {
+		t.bot.Send(tgbotapi.NewMessage(chatID, usage))
+		return
+	}
+
+	reminder := &models.Reminder{UserID: user.ID, Kind: kind, Enabled: true, Timezone: user.Timezone}
+	switch args[1] {
+	case "выкл", "off":
+		reminder.Enabled = false
+		reminder.Rule = reminderPresets[kind]
+		if existing := t.findReminder(ctx, user.ID, kind); existing != nil {
+			reminder.Rule = existing.Rule
+		}
+	case "вкл", "on":
+		reminder.Rule = reminderPresets[kind]
+	default:
+		rule, err := parseReminderTimes(args[1:])
+		if err != nil {
+			t.bot.Send(tgbotapi.NewMessage(chatID, "Не понял расписание: "+err.Error()+"\n\n"+usage))
+			return
+		}
+		reminder.Rule = rule.String()
+	}
+
+	if err := t.saveReminder(ctx, reminder); err != nil {
+		t.logger.Error("Failed to save reminder", "error", err, "userID", user.ID)
+		t.bot.Send(tgbotapi.NewMessage(chatID, "Извините, не удалось сохранить напоминание. Попробуйте позже."))
+		return
+	}
+	t.sendRemindersMenu(ctx, chatID, user, 0)
+}
+
+// parseReminderTimes turns "10:00 14:00 будни" into a rule.
+func parseReminderTimes(args []string) (schedule.Rule, error) {
+	var times []string
+	var weekdays []time.Weekday
+	for _, arg := range args {
+		for _, part := range strings.Split(arg, ",") {
+			if part == "" {
+				continue
+			}
+			if strings.Contains(part, ":") {
+				times = append(times, part)
+				continue
+			}
+			days, ok := parseWeekdays(part)
+			if !ok {
+				return nil, fmt.Errorf("«%s» — не время и не день недели", part)
+			}
+			weekdays = append(weekdays, days...)
+		}
+	}
+	if len(times) == 0 {
+		return nil, fmt.Errorf("укажите хотя бы одно время, например 09:00")
+	}
+	return schedule.DailyAt(times, weekdays)
+}
+
+func parseWeekdays(s string) ([]time.Weekday, bool) {
+	switch s {
+	case "ежедневно", "каждый":
+		return nil, true
+	case "будни":
+		return []time.Weekday{time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday}, true
+	case "выходные":
+		return []time.Weekday{time.Saturday, time.Sunday}, true
+	}
+	for i, name := range weekdayNames {
+		if s == name {
+			return []time.Weekday{time.Weekday(i)}, true
+		}
+	}
+	return nil, false
+}
+
+// saveReminder stores the reminder with its first run computed from now.
+func (t *TelegramBot) saveReminder(ctx context.Context, reminder *models.Reminder) error {
+	next, err := nextReminderRun(reminder, time.Now(), 0)
+	if err != nil {
+		return err
+	}
+	reminder.NextRunAt = next
+	return t.db.SaveReminder(ctx, reminder)
+}
+
+func (t *TelegramBot) findReminder(ctx context.Context, userID int64, kind string) *models.Reminder {
+	reminders, err := t.db.ListReminders(ctx, userID)
+	if err != nil {
+		t.logger.Error("Failed to list reminders", "error", err, "userID", userID)
+		return nil
+	}
+	for _, r := range reminders {
+		if r.Kind == kind {
+			return r
+		}
+	}
+	return nil
+}
+
+// sendRemindersMenu sends the reminder overview with toggle buttons, or edits
+// messageID in place when it is not zero.
+func (t *TelegramBot) sendRemindersMenu(ctx context.Context, chatID int64, user *models.User, messageID int) {
+	reminders, err := t.db.ListReminders(ctx, user.ID)
+	if err != nil {
+		t.logger.Error("Failed to list reminders", "error", err, "userID", user.ID)
+		t.bot.Send(tgbotapi.NewMessage(chatID, "Извините, не удалось загрузить напоминания. Попробуйте позже."))
+		return
+	}
+	byKind := make(map[string]*models.Reminder)
+	for _, r := range reminders {
+		byKind[r.Kind] = r
+	}
+
+	var b strings.Builder
+	b.WriteString("⏰ Напоминания")
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for _, kind := range reminderKinds {
+		r := byKind[kind]
+		status, label := "выключено", "Включить"
+		if r != nil && r.Enabled {
+			status, label = describeRule(r.Rule), "Выключить"
+		}
+		fmt.Fprintf(&b, "\n\n%s: %s", reminderTitles[kind], status)
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(label+": "+reminderButtonNames[kind], reminderCallbackPrefix+kind),
+		))
+	}
+	b.WriteString("\n\nСвоё время: /reminders вода 10:00 14:00 18:00")
+	fmt.Fprintf(&b, "\nЧасовой пояс: %s, сменить: /timezone", describeTimezone(user.Timezone))
+	markup := tgbotapi.NewInlineKeyboardMarkup(rows...)
+
+	if messageID != 0 {
+		edit := tgbotapi.NewEditMessageTextAndMarkup(chatID, messageID, b.String(), markup)
+		if _, err := t.bot.Send(edit); err != nil {
+			t.logger.Error("Failed to update reminders menu", "error", err, "chatID", chatID)
+		}
+		return
+	}
+
+	msg := tgbotapi.NewMessage(chatID, b.String())
+	msg.ReplyMarkup = markup
+	t.bot.Send(msg)
+}
+
+// handleReminderCallback toggles a reminder from the menu.
+func (t *TelegramBot) handleReminderCallback(callbackQuery *tgbotapi.CallbackQuery) {
+	kind := strings.TrimPrefix(callbackQuery.Data, reminderCallbackPrefix)
+	if _, ok := reminderPresets[kind]; !ok || callbackQuery.Message == nil {
+		return
+	}
+	ctx := context.Background()
+	chatID := callbackQuery.Message.Chat.ID
+
+	user, err := t.db.GetUser(ctx, callbackQuery.From.ID)
+	if err != nil {
+		t.logger.Error("Failed to get user for reminder toggle", "error", err, "userID", callbackQuery.From.ID)
+		return
+	}
+
+	reminder := t.findReminder(ctx, user.ID, kind)
+	if reminder == nil {
+		reminder = &models.Reminder{UserID: user.ID, Kind: kind, Rule: reminderPresets[kind], Timezone: user.Timezone}
+	}
+	reminder.Enabled = !reminder.Enabled
+
+	if err := t.saveReminder(ctx, reminder); err != nil {
+		t.logger.Error("Failed to save reminder", "error", err, "userID", user.ID)
+		return
+	}
+	t.sendRemindersMenu(ctx, chatID, user, callbackQuery.Message.MessageID)
+}
+
+// describeRule renders the rules /reminders creates as "09:00, 13:00
+// ежедневно"; anything else is shown as the cron expression.
+func describeRule(text string) string {
+	if text == reminderPresets[models.ReminderWater] {
+		return "каждые 2 часа с 10:00 до 20:00"
+	}
+
+	var times []string
+	days := ""
+	for _, expr := range strings.Split(text, ";") {
+		f := strings.Fields(expr)
+		minute, errM := strconv.Atoi(f[0])
+		var hour int
+		var errH error
+		if len(f) == 5 {
+			hour, errH = strconv.Atoi(f[1])
+		}
+		if len(f) != 5 || f[2] != "*" || f[3] != "*" || errM != nil || errH != nil || (days != "" && days != f[4]) {
+			return "по расписанию " + strings.TrimSpace(text)
+		}
+		days = f[4]
+		times = append(times, fmt.Sprintf("%02d:%02d", hour, minute))
+	}
+	return strings.Join(times, ", ") + " " + describeWeekdays(days)
+}
+
+func describeWeekdays(dow string) string {
+	switch dow {
+	case "*":
+		return "ежедневно"
+	case "1,2,3,4,5", "1-5":
+		return "по будням"
+	case "0,6":
+		return "по выходным"
+	}
+	var names []string
+	for _, d := range strings.Split(dow, ",") {
+		i, err := strconv.Atoi(d)
+		if err != nil || i < 0 || i > 7 {
+			return "(дни: " + dow + ")"
+		}
+		names = append(names, weekdayNames[i%7])
+	}
+	return "по дням: " + strings.Join(names, ", ")
+}
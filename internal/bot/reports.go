@@ -0,0 +1,265 @@
+package bot
+
+import (
+	"context"
+	"diet-bot/internal/db"
+	"diet-bot/internal/gpt"
+	"diet-bot/internal/models"
+	"diet-bot/internal/nutrition"
+	"diet-bot/internal/progress"
+	"errors"
+	"fmt"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	reportCallbackPrefix = "report:"
+	reportApplyAction    = "apply"
+	reportKeepAction     = "keep"
+
+	// reportHour is when, on Mondays in the user's time zone, reports go out
+	reportHour = 10
+)
+
+// reportVerdicts explain a review to the user.
+var reportVerdicts = map[string]string{
+	progress.VerdictNoData:   "📝 Для оценки темпа нужно хотя бы два взвешивания за неделю. Записывайте вес командой /weight, например /weight 72.4",
+	progress.VerdictOnTrack:  "✅ Вы движетесь к цели в безопасном темпе — так держать!",
+	progress.VerdictStalled:  "⏸ Вес почти не меняется: организм привык к текущей калорийности.",
+	progress.VerdictTooFast:  "⚠️ Вес меняется быстрее, чем безопасно: так теряются мышцы и растёт риск срыва.",
+	progress.VerdictOffPlan:  "🍽 Вес почти не меняется, но и по дневнику вы заметно отходите от плана. Попробуйте неделю держаться его калорийности — менять цель пока рано.",
+	progress.VerdictDrifting: "↕️ Вес заметно уходит от того, что вы хотите удерживать.",
+}
+
+// StartWeeklyReports sends weekly progress reports every interval until the
+// context is cancelled. Each subscriber gets one report a week, on Monday
+// after reportHour in their time zone.
+func (t *TelegramBot) StartWeeklyReports(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			sent, err := t.runWeeklyReports(ctx, time.Now())
+			if err != nil {
+				t.logger.Error("Weekly report run failed", "error", err)
+			} else if sent > 0 {
+				t.logger.Info("Weekly reports sent", "count", sent)
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// runWeeklyReports sends the reports due at now.
+func (t *TelegramBot) runWeeklyReports(ctx context.Context, now time.Time) (int, error) {
+	users, err := t.db.ListSubscribers(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	sent := 0
+	for _, user := range users {
+		local := now.In(user.Location())
+		if local.Weekday() != time.Monday || local.Hour() < reportHour {
+			continue
+		}
+		ok, err := t.sendWeeklyReport(ctx, user, models.Day(local))
+		if err != nil {
+			t.logger.Error("Failed to send weekly report", "error", err, "userID", user.ID)
+			continue
+		}
+		if ok {
+			sent++
+		}
+	}
+	return sent, nil
+}
+
+// sendWeeklyReport reviews the week before weekStart and sends the report,
+// unless the user already got one this week. The report is claimed first, so
+// a crash loses it rather than repeating it.
+func (t *TelegramBot) sendWeeklyReport(ctx context.Context, user *models.User, weekStart time.Time) (bool, error) {
+	plan, err := t.db.GetDietPlan(ctx, user.ID)
+	if errors.Is(err, db.ErrNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	weekAgo := weekStart.AddDate(0, 0, -7)
+	weights, err := t.db.ListWeightLogs(ctx, user.ID, weekStart.AddDate(0, 0, -progress.RateWindowDays))
+	if err != nil {
+		return false, err
+	}
+	weights = weighInsBetween(weights, time.Time{}, weekStart)
+	foods, err := t.db.ListFoodLogs(ctx, user.ID, weekAgo, weekStart.AddDate(0, 0, -1))
+	if err != nil {
+		return false, err
+	}
+
+	target := calorieTarget(user, plan)
+	in := progress.ReviewInput{Goal: user.Goal, Weight: user.Weight, Target: target, MinCalories: nutrition.MinCalories(user)}
+	// A rate from weigh-ins that stopped before the week tells nothing about it
+	if trend, ok := progress.ComputeTrend(weights); ok && !trend.LatestOn.Before(weekAgo) {
+		in.Weight, in.WeeklyRate, in.HasRate = trend.Latest, trend.WeeklyRate, trend.HasRate
+	}
+	days := make(map[time.Time]bool)
+	for _, f := range foods {
+		days[f.LoggedOn] = true
+	}
+	if in.DiaryDays = len(days); in.DiaryDays > 0 {
+		in.DiaryAverage = nutrition.Total(foods).Calories / float64(in.DiaryDays)
+	}
+	review := progress.Assess(in)
+
+	report := &models.WeeklyReport{
+		UserID:           user.ID,
+		PlanID:           plan.ID,
+		WeekStart:        weekStart,
+		Verdict:          review.Verdict,
+		WeeklyRate:       math.Round(in.WeeklyRate*100) / 100,
+		TargetCalories:   int(target),
+		ProposedCalories: int(review.Calories),
+	}
+	claimed, err := t.db.ClaimWeeklyReport(ctx, report)
+	if err != nil || !claimed {
+		return false, err
+	}
+
+	msg := tgbotapi.NewMessage(user.ChatID, formatWeeklyReport(report, in, weighInsBetween(weights, weekAgo, weekStart.AddDate(0, 0, -1))))
+	if report.ProposedCalories > 0 {
+		msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(
+			tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData(
+				fmt.Sprintf("🔄 Обновить план: %d ккал", report.ProposedCalories),
+				fmt.Sprintf("%s%d:%s", reportCallbackPrefix, report.ID, reportApplyAction))),
+			tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData(
+				"Оставить как есть", fmt.Sprintf("%s%d:%s", reportCallbackPrefix, report.ID, reportKeepAction))),
+		)
+	}
+	err = t.sendUnprompted(ctx, user.TelegramID, msg)
+	if errors.Is(err, errUserBlocked) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// weighInsBetween returns the weigh-ins from the day from to the day to,
+// inclusive.
+func weighInsBetween(logs []*models.WeightLog, from, to time.Time) []*models.WeightLog {
+	var between []*models.WeightLog
+	for _, l := range logs {
+		if !l.LoggedOn.Before(from) && !l.LoggedOn.After(to) {
+			between = append(between, l)
+		}
+	}
+	return between
+}
+
+// formatWeeklyReport renders the report with the weigh-ins of its week.
+func formatWeeklyReport(report *models.WeeklyReport, in progress.ReviewInput, weights []*models.WeightLog) string {
+	var b strings.Builder
+	weekAgo := report.WeekStart.AddDate(0, 0, -7)
+	fmt.Fprintf(&b, "📊 Итоги недели %s — %s\n", weekAgo.Format("02.01"), report.WeekStart.AddDate(0, 0, -1).Format("02.01"))
+
+	switch {
+	case len(weights) >= 2:
+		first, last := weights[0].Weight, weights[len(weights)-1].Weight
+		fmt.Fprintf(&b, "\n⚖️ Вес: %.1f → %.1f кг (%s кг)", first, last, formatSigned(last-first))
+	case len(weights) == 1:
+		fmt.Fprintf(&b, "\n⚖️ Вес: %.1f кг", weights[0].Weight)
+	default:
+		b.WriteString("\n⚖️ Взвешиваний за неделю не было")
+	}
+	if in.HasRate {
+		fmt.Fprintf(&b, "\n📈 Темп: %s кг в неделю", formatSigned(in.WeeklyRate))
+	}
+
+	if in.DiaryDays > 0 {
+		fmt.Fprintf(&b, "\n🍽 Дневник: %d из 7 дней, в среднем %.0f ккал при цели %d ккал", in.DiaryDays, in.DiaryAverage, report.TargetCalories)
+	} else {
+		b.WriteString("\n🍽 Дневник питания на этой неделе пуст")
+	}
+
+	b.WriteString("\n\n" + reportVerdicts[report.Verdict])
+	if report.ProposedCalories > 0 {
+		fmt.Fprintf(&b, "\n\nПредлагаю изменить калорийность с %d до %d ккал в день и обновить план на следующую неделю. Это бесплатно.",
+			report.TargetCalories, report.ProposedCalories)
+	}
+	return b.String()
+}
+
+// formatSigned writes a change of weight or size as formatTrend does.
+func formatSigned(delta float64) string {
+	if delta < 0 {
+		return fmt.Sprintf("−%.1f", -delta)
+	}
+	return fmt.Sprintf("+%.1f", delta)
+}
+
+// handleReportCallback handles "report:<id>:apply", which adapts the plan to
+// the proposed target, and "report:<id>:keep".
+func (t *TelegramBot) handleReportCallback(callbackQuery *tgbotapi.CallbackQuery) {
+	if callbackQuery.Message == nil {
+		return
+	}
+	parts := strings.Split(strings.TrimPrefix(callbackQuery.Data, reportCallbackPrefix), ":")
+	if len(parts) != 2 {
+		return
+	}
+	reportID, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return
+	}
+
+	ctx := context.Background()
+	chatID := callbackQuery.Message.Chat.ID
+	messageID := callbackQuery.Message.MessageID
+
+	user, plan, ok := t.loadPlanForRevision(ctx, chatID, callbackQuery.From.ID)
+	if !ok {
+		return
+	}
+	report, err := t.db.GetWeeklyReport(ctx, reportID)
+	if errors.Is(err, db.ErrNotFound) || (err == nil && report.UserID != user.ID) {
+		return
+	}
+	if err != nil {
+		t.logger.Error("Failed to get weekly report", "error", err, "reportID", reportID)
+		t.bot.Send(tgbotapi.NewMessage(chatID, "Извините, произошла ошибка. Попробуйте позже."))
+		return
+	}
+
+	// Adapting the plan waits for the screening; the buttons stay for later
+	if parts[1] == reportApplyAction && t.needsScreening(chatID, user) {
+		return
+	}
+
+	// The report keeps its text; only the buttons go
+	t.bot.Send(tgbotapi.NewEditMessageReplyMarkup(chatID, messageID, tgbotapi.InlineKeyboardMarkup{InlineKeyboard: [][]tgbotapi.InlineKeyboardButton{}}))
+
+	switch parts[1] {
+	case reportKeepAction:
+		t.bot.Send(tgbotapi.NewMessage(chatID, "Хорошо, оставляем план как есть. Следующий отчёт — через неделю."))
+	case reportApplyAction:
+		if report.ProposedCalories == 0 {
+			return
+		}
+		if plan.ID != report.PlanID {
+			t.bot.Send(tgbotapi.NewMessage(chatID, "План с тех пор уже изменился. Если нужно, измените его через /regenerate."))
+			return
+		}
+		target := nutrition.WithCalories(nutrition.DailyTarget(user), float64(report.ProposedCalories))
+		t.revisePlan(ctx, chatID, 0, user, plan, gpt.PlanRequest{Revision: models.RevisionAdapt, Target: target})
+	}
+}
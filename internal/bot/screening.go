@@ -0,0 +1,341 @@
+package bot
+
+import (
+	"context"
+	"diet-bot/internal/db"
+	"diet-bot/internal/models"
+	"diet-bot/internal/safety"
+	"errors"
+	"fmt"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"strconv"
+	"strings"
+)
+
+// healthCallbackPrefix marks the buttons of the health question: a condition
+// to toggle or healthDone.
+const healthCallbackPrefix = "health:"
+
+const healthDone = "done"
+
+// Questionnaire keys of the screening answers. screeningOnlyKey marks a
+// screening of a user who signed up before the bot asked, outside /start.
+const (
+	ageKey           = "age"
+	conditionsKey    = "conditions"
+	screeningOnlyKey = "screening_only"
+)
+
+// Ages outside this range are typos rather than answers.
+const (
+	minAnswerAge = 10
+	maxAnswerAge = 100
+)
+
+var conditionLabels = map[string]string{
+	safety.ConditionPregnancy:      "🤰 Беременность или кормление грудью",
+	safety.ConditionDiabetes:       "🩸 Сахарный диабет",
+	safety.ConditionEatingDisorder: "🍽 Расстройство пищевого поведения",
+	safety.ConditionKidneyDisease:  "🫘 Болезни почек",
+}
+
+// conditionNames name the conditions in the questionnaire summary.
+var conditionNames = map[string]string{
+	safety.ConditionPregnancy:      "беременность или кормление грудью",
+	safety.ConditionDiabetes:       "сахарный диабет",
+	safety.ConditionEatingDisorder: "расстройство пищевого поведения",
+	safety.ConditionKidneyDisease:  "болезни почек",
+}
+
+const healthPrompt = "Отметьте всё, что к вам относится, и нажмите «Готово». " +
+	"От этого зависит, какой план питания для вас безопасен."
+
+const planDisclaimer = "⚠️ План носит информационный характер и не заменяет консультацию врача. " +
+	"Если у вас есть хронические заболевания или вы принимаете лекарства, обсудите план с врачом."
+
+const diabetesCaution = "🩸 При диабете согласуйте план с эндокринологом: при смене питания может понадобиться " +
+	"коррекция доз препаратов. Чаще измеряйте сахар и держите под рукой быстрые углеводы на случай гипогликемии."
+
+// disclaimer is appended to every plan the user receives.
+func disclaimer(user *models.User) string {
+	if user.HasCondition(safety.ConditionDiabetes) {
+		return planDisclaimer + "\n\n" + diabetesCaution
+	}
+	return planDisclaimer
+}
+
+// refusalText explains why the bot will not plan the user's diet and where
+// to turn instead.
+func refusalText(reason string, user *models.User) string {
+	switch reason {
+	case safety.RefusalMinor:
+		return fmt.Sprintf("Извините, я составляю планы питания только для взрослых — с %d лет. "+
+			"Подростку нужна энергия для роста, а не дефицит калорий. С вопросами о питании лучше обратиться "+
+			"к педиатру или диетологу вместе с родителями.", safety.MinAge)
+	case safety.RefusalPregnancy:
+		return "Во время беременности и кормления грудью калорийность урезать нельзя, а потребности в питательных " +
+			"веществах особые. Я не могу составить для вас план — пожалуйста, обсудите питание с вашим врачом."
+	case safety.RefusalEatingDisorder:
+		return "Спасибо, что рассказали. При расстройствах пищевого поведения подсчёт калорий и ограничения могут навредить, " +
+			"поэтому я не составлю для вас план. Пожалуйста, обратитесь к психотерапевту или врачу, который работает с РПП."
+	case safety.RefusalKidneyDisease:
+		return "При болезнях почек количество белка, соли, калия и фосфора в рационе подбирает врач, а в моих планах " +
+			"много белка. Я не составлю для вас план — пожалуйста, обратитесь к нефрологу или врачу-диетологу."
+	case safety.RefusalUnderweight:
+		return fmt.Sprintf("Ваш индекс массы тела — %.1f, это ниже нормы (%.1f), и снижать вес небезопасно. "+
+			"Я могу составить план, чтобы поддержать или набрать вес: отправьте /start и выберите другую цель. "+
+			"Если вес уходит сам, обратитесь к врачу.", safety.BMI(user.Weight, user.Height), safety.UnderweightBMI)
+	}
+	return "Извините, я не могу составить для вас план питания. Пожалуйста, обратитесь к врачу."
+}
+
+// goalFromAnswer turns a goal button into the goal stored on the user.
+func goalFromAnswer(answer string) string {
+	switch answer {
+	case "Снизить вес":
+		return "Снизить"
+	case "Поддерживать вес":
+		return "Поддерживать"
+	case "Набрать вес":
+		return "Набрать"
+	}
+	return answer
+}
+
+// draftUser is the user the questionnaire answers describe so far.
+func draftUser(state *models.UserState) *models.User {
+	user := &models.User{TelegramID: state.TelegramID}
+	user.Gender, _ = state.TemporaryData["gender"].(string)
+	user.Height, _ = state.TemporaryData["height"].(int)
+	user.Weight, _ = state.TemporaryData["weight"].(float64)
+	goal, _ := state.TemporaryData["goal"].(string)
+	user.Goal = goalFromAnswer(goal)
+	user.Timezone, _ = state.TemporaryData["timezone"].(string)
+	user.Age, _ = state.TemporaryData[ageKey].(int)
+	user.Conditions, _ = state.TemporaryData[conditionsKey].([]string)
+	return user
+}
+
+// handleAgeAnswer takes the age and moves on to the health question.
+func (t *TelegramBot) handleAgeAnswer(message *tgbotapi.Message, state *models.UserState) {
+	chatID := message.Chat.ID
+	age, err := strconv.Atoi(strings.TrimSpace(message.Text))
+	if err != nil || age < minAnswerAge || age > maxAnswerAge {
+		t.bot.Send(tgbotapi.NewMessage(chatID, "Пожалуйста, введите возраст числом полных лет (например, 35):"))
+		return
+	}
+
+	t.stateMutex.Lock()
+	state.TemporaryData[ageKey] = age
+	user := draftUser(state)
+	t.stateMutex.Unlock()
+
+	if reason := safety.Assess(user); reason == safety.RefusalMinor {
+		t.refuseOnboarding(chatID, user, reason)
+		return
+	}
+
+	t.stateMutex.Lock()
+	state.TemporaryData[conditionsKey] = []string{}
+	state.CurrentState = StateHealth
+	t.stateMutex.Unlock()
+
+	msg := tgbotapi.NewMessage(chatID, healthPrompt)
+	msg.ReplyMarkup = healthKeyboard(user.Gender, nil)
+	t.bot.Send(msg)
+}
+
+// healthKeyboard lists the conditions as checkboxes. Pregnancy is not asked
+// of men.
+func healthKeyboard(gender string, checked []string) tgbotapi.InlineKeyboardMarkup {
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for _, condition := range safety.Conditions {
+		if condition == safety.ConditionPregnancy && gender == "Мужской" {
+			continue
+		}
+		box := "⬜️ "
+		if containsString(checked, condition) {
+			box = "✅ "
+		}
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(box+conditionLabels[condition], healthCallbackPrefix+condition)))
+	}
+	done := "Ничего из этого"
+	if len(checked) > 0 {
+		done = "Готово"
+	}
+	rows = append(rows, tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData(done, healthCallbackPrefix+healthDone)))
+	return tgbotapi.NewInlineKeyboardMarkup(rows...)
+}
+
+// handleHealthCallback toggles a condition or, on healthDone, screens the
+// answers and shows the summary.
+func (t *TelegramBot) handleHealthCallback(callbackQuery *tgbotapi.CallbackQuery) {
+	if callbackQuery.Message == nil {
+		return
+	}
+	chatID := callbackQuery.Message.Chat.ID
+	messageID := callbackQuery.Message.MessageID
+	answer := strings.TrimPrefix(callbackQuery.Data, healthCallbackPrefix)
+
+	t.stateMutex.Lock()
+	state, exists := t.userStates[callbackQuery.From.ID]
+	if !exists || state.CurrentState != StateHealth {
+		t.stateMutex.Unlock()
+		return
+	}
+	if answer != healthDone {
+		if _, known := conditionLabels[answer]; !known {
+			t.stateMutex.Unlock()
+			return
+		}
+		conditions, _ := state.TemporaryData[conditionsKey].([]string)
+		state.TemporaryData[conditionsKey] = toggleString(conditions, answer)
+	}
+	user := draftUser(state)
+	t.stateMutex.Unlock()
+
+	if answer != healthDone {
+		t.bot.Send(tgbotapi.NewEditMessageTextAndMarkup(chatID, messageID, healthPrompt, healthKeyboard(user.Gender, user.Conditions)))
+		return
+	}
+
+	t.bot.Send(tgbotapi.NewEditMessageText(chatID, messageID, "Здоровье: "+describeConditions(user.Conditions)))
+	if reason := safety.Assess(user); reason != "" {
+		t.refuseOnboarding(chatID, user, reason)
+		return
+	}
+
+	t.stateMutex.Lock()
+	screeningOnly, _ := state.TemporaryData[screeningOnlyKey].(bool)
+	if screeningOnly {
+		delete(t.userStates, user.TelegramID)
+	} else {
+		state.CurrentState = StateConfirm
+	}
+	t.stateMutex.Unlock()
+
+	if screeningOnly {
+		t.finishScreening(chatID, user)
+		return
+	}
+	t.sendOnboardingSummary(chatID, state)
+}
+
+// refuseOnboarding explains the refusal and drops the questionnaire. A user
+// who already has a profile keeps the screening answers, so their plan is not
+// revised either.
+func (t *TelegramBot) refuseOnboarding(chatID int64, user *models.User, reason string) {
+	t.logger.Info("Refused to plan a diet", "user_id", user.TelegramID, "reason", reason)
+
+	t.stateMutex.Lock()
+	delete(t.userStates, user.TelegramID)
+	t.stateMutex.Unlock()
+
+	err := t.db.SetUserScreening(context.Background(), user.TelegramID, user.Age, user.Conditions)
+	if err != nil && !errors.Is(err, db.ErrNotFound) {
+		t.logger.Error("Failed to save screening answers", "error", err, "user_id", user.TelegramID)
+	}
+
+	msg := tgbotapi.NewMessage(chatID, refusalText(reason, user))
+	msg.ReplyMarkup = tgbotapi.NewRemoveKeyboard(true)
+	t.bot.Send(msg)
+}
+
+// needsScreening starts the screening questions for a user who signed up
+// before the bot asked them, and reports whether it did. Plans are not
+// generated for such users until they answer.
+func (t *TelegramBot) needsScreening(chatID int64, user *models.User) bool {
+	if user.Age > 0 {
+		return false
+	}
+
+	t.stateMutex.Lock()
+	t.userStates[user.TelegramID] = &models.UserState{
+		TelegramID:   user.TelegramID,
+		CurrentState: StateAge,
+		TemporaryData: map[string]interface{}{
+			"gender":         user.Gender,
+			"height":         user.Height,
+			"weight":         user.Weight,
+			"goal":           user.Goal,
+			"timezone":       user.Timezone,
+			screeningOnlyKey: true,
+		},
+	}
+	t.stateMutex.Unlock()
+
+	msg := tgbotapi.NewMessage(chatID, "Прежде чем менять план, ответьте на два вопроса о здоровье — раньше я их не задавал. "+
+		"Сколько вам полных лет?")
+	msg.ReplyMarkup = tgbotapi.NewRemoveKeyboard(true)
+	t.bot.Send(msg)
+	return true
+}
+
+// finishScreening saves the answers of a screening outside /start.
+func (t *TelegramBot) finishScreening(chatID int64, user *models.User) {
+	if err := t.db.SetUserScreening(context.Background(), user.TelegramID, user.Age, user.Conditions); err != nil {
+		t.logger.Error("Failed to save screening answers", "error", err, "user_id", user.TelegramID)
+		t.bot.Send(tgbotapi.NewMessage(chatID, "Извините, не удалось сохранить ответы. Попробуйте позже."))
+		return
+	}
+	t.bot.Send(tgbotapi.NewMessage(chatID, "Спасибо, ответы сохранены. Теперь план можно менять: отправьте /regenerate "+
+		"или нажмите кнопку в еженедельном отчёте ещё раз."))
+}
+
+// sendOnboardingSummary asks the user to confirm the questionnaire answers.
+func (t *TelegramBot) sendOnboardingSummary(chatID int64, state *models.UserState) {
+	t.stateMutex.RLock()
+	user := draftUser(state)
+	goal, _ := state.TemporaryData["goal"].(string)
+	place, _ := state.TemporaryData["place"].(string)
+	t.stateMutex.RUnlock()
+
+	summary := fmt.Sprintf("Давайте проверим введенные данные:\n\nПол: %s\nРост: %d см\nВес: %g кг\nЦель: %s\nЧасовой пояс: %s (%s)\nВозраст: %d\nЗдоровье: %s\n\nВсё верно?",
+		user.Gender, user.Height, user.Weight, goal, describeTimezone(user.Timezone), place, user.Age, describeConditions(user.Conditions))
+
+	msg := tgbotapi.NewMessage(chatID, summary)
+	msg.ReplyMarkup = tgbotapi.NewReplyKeyboard(
+		tgbotapi.NewKeyboardButtonRow(
+			tgbotapi.NewKeyboardButton("Да, всё верно"),
+			tgbotapi.NewKeyboardButton("Нет, изменить"),
+		),
+	)
+	t.bot.Send(msg)
+}
+
+func describeConditions(conditions []string) string {
+	if len(conditions) == 0 {
+		return "без особенностей"
+	}
+	names := make([]string, 0, len(conditions))
+	for _, condition := range safety.Conditions {
+		if containsString(conditions, condition) {
+			names = append(names, conditionNames[condition])
+		}
+	}
+	return strings.Join(names, ", ")
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// toggleString adds s to list or removes it, returning a new slice.
+func toggleString(list []string, s string) []string {
+	toggled := make([]string, 0, len(list)+1)
+	for _, item := range list {
+		if item != s {
+			toggled = append(toggled, item)
+		}
+	}
+	if len(toggled) == len(list) {
+		toggled = append(toggled, s)
+	}
+	return toggled
+}
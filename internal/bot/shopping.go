@@ -0,0 +1,252 @@
+package bot
+
+import (
+	"context"
+	"diet-bot/internal/db"
+	"diet-bot/internal/models"
+	"diet-bot/internal/shopping"
+	"errors"
+	"fmt"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"strconv"
+	"strings"
+)
+
+const (
+	shoppingCallbackPrefix = "shop:"
+	shoppingDaysAction     = "days"
+	shoppingTickAction     = "tick"
+
+	// maxShoppingButtons keeps the checklist under Telegram's limit on
+	// inline buttons; items past it are still listed in the text
+	maxShoppingButtons = 100
+)
+
+// handleShoppingCommand builds a shopping list from the latest plan. With
+// "/shopping 1-3" it covers those days, otherwise it asks which.
+func (t *TelegramBot) handleShoppingCommand(message *tgbotapi.Message) {
+	chatID := message.Chat.ID
+	ctx := context.Background()
+
+	user, plan, ok := t.loadPlanForRevision(ctx, chatID, message.From.ID)
+	if !ok || !t.checkShoppingPlan(chatID, plan) {
+		return
+	}
+
+	if args := strings.TrimSpace(message.CommandArguments()); args != "" {
+		first, last, ok := parseDayRange(args)
+		if !ok || plan.Data.FindDay(first) == nil || plan.Data.FindDay(last) == nil {
+			t.bot.Send(tgbotapi.NewMessage(chatID, fmt.Sprintf(
+				"Укажите дни плана, например: /shopping 1-3. В плане %d дн.", len(plan.Data.Days))))
+			return
+		}
+		text, markup, ok := t.createShoppingList(ctx, chatID, user, plan, first, last)
+		if !ok {
+			return
+		}
+		msg := tgbotapi.NewMessage(chatID, text)
+		msg.ReplyMarkup = markup
+		t.bot.Send(msg)
+		return
+	}
+
+	days := plan.Data.Days
+	first, last := days[0].Day, days[len(days)-1].Day
+	ranges := [][2]int{{first, last}}
+	if len(days) > 1 {
+		half := days[(len(days)-1)/2].Day
+		ranges = append(ranges, [2]int{first, half}, [2]int{half + 1, last})
+	}
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for i, r := range ranges {
+		label := "🛒 " + formatDayRange(r[0], r[1])
+		if i == 0 {
+			label = "🛒 Весь план (" + formatDayRange(r[0], r[1]) + ")"
+		}
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData(label,
+			fmt.Sprintf("%s%s:%d:%d-%d", shoppingCallbackPrefix, shoppingDaysAction, plan.ID, r[0], r[1]))))
+	}
+
+	msg := tgbotapi.NewMessage(chatID, "На какие дни собрать список покупок? Другие дни можно указать так: /shopping 2-4.")
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(rows...)
+	t.bot.Send(msg)
+}
+
+// handleShoppingCallback handles "shop:days:<plan>:<first>-<last>", which
+// builds a list, and "shop:tick:<list>:<position>", which ticks an item off
+// or back on.
+func (t *TelegramBot) handleShoppingCallback(callbackQuery *tgbotapi.CallbackQuery) {
+	if callbackQuery.Message == nil {
+		return
+	}
+	parts := strings.Split(strings.TrimPrefix(callbackQuery.Data, shoppingCallbackPrefix), ":")
+	if len(parts) != 3 {
+		return
+	}
+	id, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return
+	}
+
+	ctx := context.Background()
+	chatID := callbackQuery.Message.Chat.ID
+	messageID := callbackQuery.Message.MessageID
+
+	switch parts[0] {
+	case shoppingDaysAction:
+		first, last, ok := parseDayRange(parts[2])
+		if !ok {
+			return
+		}
+		user, plan, ok := t.loadPlanForRevision(ctx, chatID, callbackQuery.From.ID)
+		if !ok || !t.checkShoppingPlan(chatID, plan) {
+			return
+		}
+		if plan.ID != id {
+			t.bot.Send(tgbotapi.NewEditMessageText(chatID, messageID, "План с тех пор изменился. Отправьте /shopping ещё раз."))
+			return
+		}
+		text, markup, ok := t.createShoppingList(ctx, chatID, user, plan, first, last)
+		if !ok {
+			return
+		}
+		t.bot.Send(tgbotapi.NewEditMessageTextAndMarkup(chatID, messageID, text, markup))
+
+	case shoppingTickAction:
+		position, err := strconv.Atoi(parts[2])
+		if err != nil {
+			return
+		}
+		t.tickShoppingItem(ctx, chatID, messageID, callbackQuery.From.ID, id, position)
+	}
+}
+
+// checkShoppingPlan tells the user when the plan has no ingredients to list.
+func (t *TelegramBot) checkShoppingPlan(chatID int64, plan *models.DietPlan) bool {
+	if plan.Data == nil || len(plan.Data.Days) == 0 {
+		t.bot.Send(tgbotapi.NewMessage(chatID, "Этот план составлен в старом формате без списка ингредиентов, поэтому собрать по нему покупки не получится. "+
+			"Обновите план через /regenerate — и список покупок станет доступен."))
+		return false
+	}
+	return true
+}
+
+// createShoppingList builds and stores the list for days first to last and
+// returns the checklist message for it.
+func (t *TelegramBot) createShoppingList(ctx context.Context, chatID int64, user *models.User, plan *models.DietPlan, first, last int) (string, tgbotapi.InlineKeyboardMarkup, bool) {
+	items := shopping.Build(plan.Data, first, last)
+	if len(items) == 0 {
+		t.bot.Send(tgbotapi.NewMessage(chatID, "В эти дни плана нет ингредиентов для покупки."))
+		return "", tgbotapi.InlineKeyboardMarkup{}, false
+	}
+
+	list := &models.ShoppingList{UserID: user.ID, PlanID: plan.ID, FirstDay: first, LastDay: last, Items: items}
+	if err := t.db.SaveShoppingList(ctx, list); err != nil {
+		t.logger.Error("Failed to save shopping list", "error", err, "userID", user.ID, "planID", plan.ID)
+		t.bot.Send(tgbotapi.NewMessage(chatID, "Извините, не удалось составить список покупок. Попробуйте позже."))
+		return "", tgbotapi.InlineKeyboardMarkup{}, false
+	}
+	text, markup := formatShoppingList(list)
+	return text, markup, true
+}
+
+// tickShoppingItem flips an item of the user's list and redraws the checklist.
+func (t *TelegramBot) tickShoppingItem(ctx context.Context, chatID int64, messageID int, telegramID, listID int64, position int) {
+	user, err := t.db.GetUser(ctx, telegramID)
+	var list *models.ShoppingList
+	if err == nil {
+		list, err = t.db.GetShoppingList(ctx, listID)
+	}
+	if errors.Is(err, db.ErrNotFound) || (err == nil && list.UserID != user.ID) {
+		return
+	}
+	if err == nil {
+		err = t.db.ToggleShoppingItem(ctx, listID, position)
+	}
+	if err == nil {
+		list, err = t.db.GetShoppingList(ctx, listID)
+	}
+	if err != nil {
+		t.logger.Error("Failed to tick shopping item", "error", err, "listID", listID, "position", position)
+		return
+	}
+
+	text, markup := formatShoppingList(list)
+	t.bot.Send(tgbotapi.NewEditMessageTextAndMarkup(chatID, messageID, text, markup))
+}
+
+// formatShoppingList renders the list grouped by section, with a button per
+// item to tick it off.
+func formatShoppingList(list *models.ShoppingList) (string, tgbotapi.InlineKeyboardMarkup) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "🛒 Список покупок: %s плана #%d\n", strings.ToLower(formatDayRange(list.FirstDay, list.LastDay)), list.PlanID)
+
+	var rows [][]tgbotapi.InlineKeyboardButton
+	section, checked := "", 0
+	for _, item := range list.Items {
+		if item.Section != section {
+			section = item.Section
+			fmt.Fprintf(&b, "\n%s\n", section)
+		}
+		mark := "⬜"
+		if item.Checked {
+			mark = "✅"
+			checked++
+		}
+		line := fmt.Sprintf("%s %s — %s", mark, item.Name, formatAmount(item.Amount, item.Unit))
+		b.WriteString(line + "\n")
+
+		if len(rows) < maxShoppingButtons {
+			rows = append(rows, tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData(line,
+				fmt.Sprintf("%s%s:%d:%d", shoppingCallbackPrefix, shoppingTickAction, list.ID, item.Position))))
+		}
+	}
+
+	if checked == len(list.Items) {
+		b.WriteString("\n🎉 Всё куплено!")
+	} else {
+		fmt.Fprintf(&b, "\nКуплено: %d из %d. Нажимайте на продукты, чтобы отмечать покупки.", checked, len(list.Items))
+	}
+	return b.String(), tgbotapi.NewInlineKeyboardMarkup(rows...)
+}
+
+// formatAmount shows 1500 g as "1,5 кг" and 250 ml as "250 мл".
+func formatAmount(amount float64, unit string) string {
+	switch {
+	case unit == shopping.UnitGram && amount >= 1000:
+		amount, unit = amount/1000, "кг"
+	case unit == shopping.UnitML && amount >= 1000:
+		amount, unit = amount/1000, "л"
+	}
+	n := strings.Replace(strconv.FormatFloat(amount, 'f', -1, 64), ".", ",", 1)
+	if unit == "" {
+		return n
+	}
+	return n + " " + unit
+}
+
+// parseDayRange reads "2-4" or "3".
+func parseDayRange(s string) (int, int, bool) {
+	from, to, found := strings.Cut(strings.ReplaceAll(s, "–", "-"), "-")
+	first, err := strconv.Atoi(strings.TrimSpace(from))
+	if err != nil {
+		return 0, 0, false
+	}
+	last := first
+	if found {
+		if last, err = strconv.Atoi(strings.TrimSpace(to)); err != nil {
+			return 0, 0, false
+		}
+	}
+	if first < 1 || last < first {
+		return 0, 0, false
+	}
+	return first, last, true
+}
+
+func formatDayRange(first, last int) string {
+	if first == last {
+		return fmt.Sprintf("День %d", first)
+	}
+	return fmt.Sprintf("Дни %d–%d", first, last)
+}
@@ -5,11 +5,18 @@ import (
 	"diet-bot/internal/db"
 	"diet-bot/internal/gpt"
 	"diet-bot/internal/models"
+	"diet-bot/internal/nutrition"
 	"diet-bot/internal/payment"
+	"diet-bot/internal/stt"
 	"diet-bot/pkg/logger"
+	"encoding/json"
+	"errors"
 	"fmt"
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/stripe/stripe-go/v72"
+	"golang.org/x/time/rate"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 )
@@ -20,25 +27,62 @@ const (
 	StateHeight     = "height"
 	StateWeight     = "weight"
 	StateGoal       = "goal"
+	StateTimezone   = "timezone"
+	StateAge        = "age"
+	StateHealth     = "health"
 	StateConfirm    = "confirm"
 	StatePayment    = "payment"
 	StateProcessing = "processing"
 	StateComplete   = "complete"
+	// StateMeasure is the /measure dialog, which can start from any state
+	StateMeasure = "measure"
 )
 
 type TelegramBot struct {
 	bot          *tgbotapi.BotAPI
-	db           *db.PostgresDB
+	db           db.Store
 	stripeClient *payment.StripeClient
 	gptClient    *gpt.Client
+	estimator    gpt.MealEstimator
+	transcriber  stt.Transcriber
 	logger       *logger.Logger
 	userStates   map[int64]*models.UserState
 	stateMutex   sync.RWMutex
 	callbackURL  string
+	adminIDs     []int64
+	sendLimiter  *rate.Limiter
+	fileEndpoint string
+
+	// mealDrafts hold photo and voice estimates waiting for the user to confirm them
+	mealDrafts map[string]*mealDraft
+	draftMutex sync.Mutex
+
+	freeRevisions int
+	// revising holds the IDs of users whose plan is being revised
+	revising sync.Map
+	// fulfilling holds the IDs of payments whose plan is being generated
+	fulfilling sync.Map
+
+	// feedBaseURL and feedSecret make calendar feed links; empty disables them
+	feedBaseURL string
+	feedSecret  string
+
+	// outboxWake asks the outbox dispatcher to run before its next tick
+	outboxWake chan struct{}
 }
 
-func NewTelegramBot(token string, db *db.PostgresDB, stripeClient *payment.StripeClient, gptClient *gpt.Client, logger *logger.Logger) (*TelegramBot, error) {
-	bot, err := tgbotapi.NewBotAPI(token)
+func NewTelegramBot(cfg struct {
+	Token       string
+	AdminIDs    []int64
+	APIEndpoint string
+}, db db.Store, stripeClient *payment.StripeClient, gptClient *gpt.Client, logger *logger.Logger) (*TelegramBot, error) {
+	// An empty endpoint talks to the real Bot API; tests point it at a local fake
+	apiEndpoint := cfg.APIEndpoint
+	if apiEndpoint == "" {
+		apiEndpoint = tgbotapi.APIEndpoint
+	}
+
+	bot, err := tgbotapi.NewBotAPIWithAPIEndpoint(cfg.Token, apiEndpoint)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create Telegram bot: %w", err)
 	}
@@ -53,13 +97,35 @@ func NewTelegramBot(token string, db *db.PostgresDB, stripeClient *payment.Strip
 		db:           db,
 		stripeClient: stripeClient,
 		gptClient:    gptClient,
+		estimator:    gptClient,
 		logger:       logger,
 		userStates:   make(map[int64]*models.UserState),
 		stateMutex:   sync.RWMutex{},
 		callbackURL:  fmt.Sprintf("https://t.me/%s", bot.Self.UserName),
+		adminIDs:     cfg.AdminIDs,
+		sendLimiter:  rate.NewLimiter(broadcastRate, broadcastBurst),
+		fileEndpoint: fileEndpointFor(apiEndpoint),
+		mealDrafts:   make(map[string]*mealDraft),
+		outboxWake:   make(chan struct{}, 1),
+
+		freeRevisions: defaultFreeRevisions,
 	}, nil
 }
 
+// WithTranscriber enables voice messages. Without a transcriber the bot asks
+// users to type instead.
+func (t *TelegramBot) WithTranscriber(transcriber stt.Transcriber) *TelegramBot {
+	t.transcriber = transcriber
+	return t
+}
+
+// WithMealEstimator replaces the GPT client as the estimator of meal
+// descriptions and photos.
+func (t *TelegramBot) WithMealEstimator(estimator gpt.MealEstimator) *TelegramBot {
+	t.estimator = estimator
+	return t
+}
+
 // Start begins receiving updates from Telegram via polling
 func (t *TelegramBot) Start(ctx context.Context) error {
 	// First, remove any existing webhook to ensure we can use polling
@@ -101,6 +167,13 @@ func (t *TelegramBot) handleUpdates(ctx context.Context, updates tgbotapi.Update
 
 			t.logger.Info("Received update", "update_id", update.UpdateID)
 
+			// Anyone writing to the bot has unblocked it
+			if from := update.SentFrom(); from != nil {
+				if err := t.db.SetUserBlocked(ctx, from.ID, false); err != nil {
+					t.logger.Error("Failed to clear blocked flag", "error", err, "userID", from.ID)
+				}
+			}
+
 			if update.Message != nil {
 				// Process message
 				t.logger.Info("Received message",
@@ -137,19 +210,35 @@ func (t *TelegramBot) handleCommand(message *tgbotapi.Message) {
 		if message.CommandArguments() == "payment_success" {
 			// Handle successful payment
 			t.stateMutex.RLock()
-			state, exists := t.userStates[userID]
+			sessionID := ""
+			if state, exists := t.userStates[userID]; exists {
+				sessionID = state.StripeSessionID
+			}
 			t.stateMutex.RUnlock()
 
-			if exists && state.StripeSessionID != "" {
+			if sessionID != "" {
 				// Send confirmation message
 				msg := tgbotapi.NewMessage(chatID, "Спасибо за оплату! Ваш персонализированный план питания будет готов в ближайшее время.")
 				t.bot.Send(msg)
 
-				// Process payment asynchronously
+				// Verify the payment with Stripe before fulfilling it; an unpaid
+				// session is left to the webhook or the reconciler
 				go func() {
-					// In a real implementation, you would verify the payment status with Stripe
-					// For now, we'll simulate success
-					t.handlePaymentSuccess(userID, state.StripeSessionID)
+					sess, err := t.stripeClient.GetCheckoutSession(sessionID)
+					if err != nil {
+						t.logger.Error("Failed to verify checkout session", "error", err, "sessionID", sessionID)
+						return
+					}
+					if sess.PaymentStatus != stripe.CheckoutSessionPaymentStatusPaid {
+						t.logger.Info("Checkout session is not paid yet", "sessionID", sess.ID, "status", sess.PaymentStatus)
+						return
+					}
+
+					paymentIntentID := ""
+					if sess.PaymentIntent != nil {
+						paymentIntentID = sess.PaymentIntent.ID
+					}
+					t.handlePaymentSuccess(userID, sess.ID, paymentIntentID)
 				}()
 				return
 			}
@@ -196,9 +285,53 @@ func (t *TelegramBot) handleCommand(message *tgbotapi.Message) {
 			t.logger.Info("Sent start message", "message_id", sent.MessageID)
 		}
 
+	case "refund":
+		t.handleRefundCommand(message)
+
+	case "plans":
+		t.handlePlansCommand(message)
+
+	case "regenerate":
+		t.handleRegenerateCommand(message)
+
+	case "shopping":
+		t.handleShoppingCommand(message)
+
+	case "recipes":
+		t.handleRecipesCommand(message)
+
+	case "calendar":
+		t.handleCalendarCommand(message)
+
+	case "water":
+		t.handleWaterCommand(message)
+
+	case "measure":
+		t.handleMeasureCommand(message)
+
+	case "weight":
+		t.handleWeightCommand(message)
+
+	case "progress":
+		t.handleProgressCommand(message)
+
+	case "reminders":
+		t.handleRemindersCommand(message)
+
+	case "timezone":
+		t.handleTimezoneCommand(message)
+
+	case "eat":
+		t.handleEatCommand(message)
+
+	case "ask":
+		t.handleAskCommand(message)
+
+	case "forget":
+		t.handleForgetCommand(message)
+
 	case "help":
-		// Send help information
-		msg := tgbotapi.NewMessage(chatID, "Я бот для создания персонализированных планов питания. Используйте /start, чтобы начать процесс.")
+		msg := tgbotapi.NewMessage(chatID, helpText())
 		_, err := t.bot.Send(msg)
 		if err != nil {
 			t.logger.Error("Failed to send help message", "error", err)
@@ -214,34 +347,72 @@ func (t *TelegramBot) handleCommand(message *tgbotapi.Message) {
 	}
 }
 
+// helpCommands are the commands /help lists, in the order users need them.
+var helpCommands = []struct{ command, description string }{
+	{"start", "заполнить анкету и получить план питания"},
+	{"plans", "посмотреть свои планы"},
+	{"regenerate", "изменить план, день или блюдо"},
+	{"recipes", "открыть рецепты блюд плана"},
+	{"shopping", "получить список покупок"},
+	{"calendar", "добавить приёмы пищи в календарь"},
+	{"eat", "записать еду; можно и просто сообщением, фото тарелки или голосовым"},
+	{"ask", "спросить о питании; можно и просто вопросом, например «чем заменить творог?»"},
+	{"forget", "начать разговор с вопросами заново"},
+	{"weight", "записать вес"},
+	{"measure", "записать обхваты и следить за процентом жира"},
+	{"water", "отметить выпитую воду"},
+	{"progress", "увидеть график веса"},
+	{"reminders", "настроить напоминания"},
+	{"timezone", "сменить часовой пояс"},
+	{"help", "показать этот список"},
+}
+
+// helpText lists the commands one per line.
+func helpText() string {
+	var b strings.Builder
+	b.WriteString("Я бот для создания персонализированных планов питания. Команды:\n")
+	for _, c := range helpCommands {
+		fmt.Fprintf(&b, "\n/%s — %s", c.command, c.description)
+	}
+	return b.String()
+}
+
 // handleMessage processes regular messages based on user state
 func (t *TelegramBot) handleMessage(message *tgbotapi.Message) {
 	chatID := message.Chat.ID
 	userID := message.From.ID
 	text := message.Text
 
-	// Get user state
+	// Get user state; the payment webhook may change it concurrently, so the
+	// current step is read under the lock and every write takes it too
 	t.stateMutex.RLock()
 	state, exists := t.userStates[userID]
+	current := ""
+	if exists {
+		current = state.CurrentState
+	}
 	t.stateMutex.RUnlock()
 
-	if !exists {
-		// User has no state, prompt to start
-		msg := tgbotapi.NewMessage(chatID, "Пожалуйста, используйте /start для начала работы с ботом.")
-		_, err := t.bot.Send(msg)
-		if err != nil {
-			t.logger.Error("Failed to send no state message", "error", err)
-		}
+	// A location shared outside the questionnaire changes the time zone
+	if message.Location != nil && (!exists || current != StateTimezone) {
+		t.handleLocation(message)
+		return
+	}
+
+	// Outside the questionnaire a message is a meal for the food diary;
+	// users who have not started yet are asked to
+	if !exists || current == StatePayment || current == StateComplete {
+		t.handleFreeText(message)
 		return
 	}
 
 	t.logger.Info("Processing message based on state",
 		"user_id", userID,
-		"state", state.CurrentState,
+		"state", current,
 		"text", text)
 
 	// Process based on current state
-	switch state.CurrentState {
+	switch current {
 	case StateGender:
 		if text != "Мужской" && text != "Женский" {
 			msg := tgbotapi.NewMessage(chatID, "Пожалуйста, выберите пол с помощью кнопок ниже.")
@@ -256,8 +427,10 @@ func (t *TelegramBot) handleMessage(message *tgbotapi.Message) {
 		}
 
 		// Save gender and move to next state
+		t.stateMutex.Lock()
 		state.TemporaryData["gender"] = text
 		state.CurrentState = StateHeight
+		t.stateMutex.Unlock()
 
 		// Ask for height
 		msg := tgbotapi.NewMessage(chatID, "Спасибо! Теперь укажите ваш рост в сантиметрах (например, 175):")
@@ -274,8 +447,10 @@ func (t *TelegramBot) handleMessage(message *tgbotapi.Message) {
 		}
 
 		// Save height and move to next state
+		t.stateMutex.Lock()
 		state.TemporaryData["height"] = height
 		state.CurrentState = StateWeight
+		t.stateMutex.Unlock()
 
 		// Ask for weight
 		msg := tgbotapi.NewMessage(chatID, "Спасибо! Теперь укажите ваш вес в килограммах (например, 70):")
@@ -283,16 +458,18 @@ func (t *TelegramBot) handleMessage(message *tgbotapi.Message) {
 
 	case StateWeight:
 		// Try to parse weight
-		weight, err := strconv.Atoi(text)
-		if err != nil || weight < 30 || weight > 300 {
+		weight, ok := parseWeight(text)
+		if !ok {
 			msg := tgbotapi.NewMessage(chatID, "Пожалуйста, введите корректный вес в килограммах (например, 70):")
 			t.bot.Send(msg)
 			return
 		}
 
 		// Save weight and move to next state
+		t.stateMutex.Lock()
 		state.TemporaryData["weight"] = weight
 		state.CurrentState = StateGoal
+		t.stateMutex.Unlock()
 
 		// Ask for goal
 		msg := tgbotapi.NewMessage(chatID, "Спасибо! Какая у вас цель?")
@@ -329,32 +506,52 @@ func (t *TelegramBot) handleMessage(message *tgbotapi.Message) {
 			return
 		}
 
-		// Save goal and move to confirmation
+		// Save goal and ask where the user lives
+		t.stateMutex.Lock()
 		state.TemporaryData["goal"] = text
-		state.CurrentState = StateConfirm
+		state.CurrentState = StateTimezone
+		t.stateMutex.Unlock()
 
-		// Show summary and ask for confirmation
-		gender := state.TemporaryData["gender"].(string)
-		height := state.TemporaryData["height"].(int)
-		weight := state.TemporaryData["weight"].(int)
-		goal := state.TemporaryData["goal"].(string)
+		msg := tgbotapi.NewMessage(chatID, timezonePrompt)
+		msg.ReplyMarkup = timezoneKeyboard()
+		t.bot.Send(msg)
 
-		summary := fmt.Sprintf("Давайте проверим введенные данные:\n\nПол: %s\nРост: %d см\nВес: %d кг\nЦель: %s\n\nВсё верно?", gender, height, weight, goal)
+	case StateTimezone:
+		timezone, place, ok := resolveTimezone(message, text)
+		if !ok {
+			msg := tgbotapi.NewMessage(chatID, "Не нашёл такой город. Напишите ближайший крупный город или отправьте местоположение.")
+			msg.ReplyMarkup = timezoneKeyboard()
+			t.bot.Send(msg)
+			return
+		}
 
-		msg := tgbotapi.NewMessage(chatID, summary)
-		msg.ReplyMarkup = tgbotapi.NewReplyKeyboard(
-			tgbotapi.NewKeyboardButtonRow(
-				tgbotapi.NewKeyboardButton("Да, всё верно"),
-				tgbotapi.NewKeyboardButton("Нет, изменить"),
-			),
-		)
+		// Save time zone and move on to the medical screening
+		t.stateMutex.Lock()
+		state.TemporaryData["timezone"] = timezone
+		state.TemporaryData["place"] = place
+		state.CurrentState = StateAge
+		t.stateMutex.Unlock()
+
+		msg := tgbotapi.NewMessage(chatID, "Сколько вам полных лет?")
+		msg.ReplyMarkup = tgbotapi.NewRemoveKeyboard(true)
 		t.bot.Send(msg)
 
+	case StateAge:
+		t.handleAgeAnswer(message, state)
+
+	case StateHealth:
+		t.bot.Send(tgbotapi.NewMessage(chatID, "Отметьте подходящее кнопками под вопросом о здоровье и нажмите «Готово»."))
+
+	case StateMeasure:
+		t.handleMeasureAnswer(message, state)
+
 	case StateConfirm:
 		if text == "Нет, изменить" {
 			// Reset to beginning of form
+			t.stateMutex.Lock()
 			state.CurrentState = StateGender
 			state.TemporaryData = make(map[string]interface{})
+			t.stateMutex.Unlock()
 
 			msg := tgbotapi.NewMessage(chatID, "Давайте начнем заново. Выберите ваш пол:")
 			msg.ReplyMarkup = tgbotapi.NewReplyKeyboard(
@@ -375,87 +572,89 @@ func (t *TelegramBot) handleMessage(message *tgbotapi.Message) {
 
 		// Process confirmation and proceed to payment
 		ctx := context.Background()
-		gender := state.TemporaryData["gender"].(string)
-		height := state.TemporaryData["height"].(int)
-		weight := state.TemporaryData["weight"].(int)
-		goal := state.TemporaryData["goal"].(string)
-
-		// Process goal text
-		goalText := goal
-		if goal == "Снизить вес" {
-			goalText = "Снизить"
-		} else if goal == "Поддерживать вес" {
-			goalText = "Поддерживать"
-		} else if goal == "Набрать вес" {
-			goalText = "Набрать"
-		}
+		t.stateMutex.RLock()
+		user := draftUser(state)
+		t.stateMutex.RUnlock()
+		user.TelegramID = userID
+		user.ChatID = chatID
+		user.Username = message.From.UserName
 
-		// Create user object
-		user := &models.User{
-			TelegramID: userID,
-			ChatID:     chatID,
-			Username:   message.From.UserName,
-			Gender:     gender,
-			Height:     height,
-			Weight:     weight,
-			Goal:       goalText,
-		}
+		// Create a Stripe checkout session
+		successURL := fmt.Sprintf("https://t.me/%s?start=payment_success", t.bot.Self.UserName)
+		cancelURL := fmt.Sprintf("https://t.me/%s?start=payment_cancel", t.bot.Self.UserName)
 
-		// Save to database
-		err := t.db.SaveUser(ctx, user)
+		sessionID, checkoutURL, err := t.stripeClient.CreateCheckoutSession(userID, successURL, cancelURL)
 		if err != nil {
-			t.logger.Error("Failed to save user data", "error", err)
-			msg := tgbotapi.NewMessage(chatID, "Извините, произошла ошибка при сохранении данных. Пожалуйста, попробуйте позже.")
+			t.logger.Error("Failed to create Stripe session", "error", err)
+			msg := tgbotapi.NewMessage(chatID, "Извините, произошла ошибка при создании платежной сессии. Пожалуйста, попробуйте позже.")
 			t.bot.Send(msg)
 			return
 		}
 
-		// Move to payment state
-		state.CurrentState = StatePayment
+		// The user, the payment and the message with the payment link are
+		// recorded together, so fulfilment always finds the payment
+		err = t.db.WithTx(ctx, func(tx db.Store) error {
+			if err := tx.SaveUser(ctx, user); err != nil {
+				return fmt.Errorf("failed to save user: %w", err)
+			}
+			if err := retimeReminders(ctx, tx, user, time.Now()); err != nil {
+				return fmt.Errorf("failed to move reminders to the new time zone: %w", err)
+			}
 
-		// Send payment info
-		msg := tgbotapi.NewMessage(chatID, "Спасибо! Ваши данные сохранены. Для получения персонализированного плана питания, требуется оплата в размере 1000 руб.")
-		msg.ReplyMarkup = tgbotapi.NewRemoveKeyboard(true)
-		t.bot.Send(msg)
+			payment := &models.Payment{
+				UserID:          user.ID,
+				Amount:          1000,
+				Currency:        "rub",
+				StripePaymentID: sessionID,
+				Status:          models.PaymentStatusPending,
+			}
+			if err := tx.SavePayment(ctx, payment); err != nil {
+				return fmt.Errorf("failed to save payment: %w", err)
+			}
 
-		// Create a Stripe checkout session
-		// Create a Stripe checkout session
-		successURL := fmt.Sprintf("https://t.me/%s?start=payment_success", t.bot.Self.UserName)
-		cancelURL := fmt.Sprintf("https://t.me/%s?start=payment_cancel", t.bot.Self.UserName)
+			// The questionnaire weight starts or continues the weight history
+			weightLog := &models.WeightLog{UserID: user.ID, Weight: user.Weight, LoggedOn: user.Today()}
+			if err := tx.SaveWeightLog(ctx, weightLog); err != nil {
+				return fmt.Errorf("failed to save weight log: %w", err)
+			}
 
-		sessionID, checkoutURL, err := t.stripeClient.CreateCheckoutSession(userID, successURL, cancelURL)
+			payload, err := json.Marshal(checkoutCreatedPayload{
+				PaymentID:   payment.ID,
+				ChatID:      chatID,
+				CheckoutURL: checkoutURL,
+			})
+			if err != nil {
+				return err
+			}
+			return tx.AddOutboxEvent(ctx, &models.OutboxEvent{
+				Topic:   models.OutboxTopicCheckoutCreated,
+				Payload: payload,
+			})
+		})
 		if err != nil {
-			t.logger.Error("Failed to create Stripe session", "error", err)
-			msg := tgbotapi.NewMessage(chatID, "Извините, произошла ошибка при создании платежной сессии. Пожалуйста, попробуйте позже.")
+			t.logger.Error("Failed to save checkout", "error", err)
+			// Nobody can pay for a session we have no record of
+			if err := t.stripeClient.ExpireCheckoutSession(sessionID); err != nil {
+				t.logger.Error("Failed to expire orphaned checkout session", "sessionID", sessionID, "error", err)
+			}
+			msg := tgbotapi.NewMessage(chatID, "Извините, произошла ошибка при сохранении данных. Пожалуйста, попробуйте позже.")
 			t.bot.Send(msg)
 			return
 		}
 
-		// Save session ID to user state
+		// Move to payment state
+		t.stateMutex.Lock()
+		state.CurrentState = StatePayment
 		state.StripeSessionID = sessionID
+		t.stateMutex.Unlock()
 
-		// Create a payment record in the database
-		payment := &models.Payment{
-			UserID:          user.ID,
-			Amount:          1000,
-			Currency:        "rub",
-			StripePaymentID: sessionID,
-			Status:          "pending",
-		}
-		err = t.db.SavePayment(ctx, payment)
-		if err != nil {
-			t.logger.Error("Failed to save payment record", "error", err)
-			// Continue anyway, as this is not critical for the user
-		}
+		// Send payment info
+		msg := tgbotapi.NewMessage(chatID, "Спасибо! Ваши данные сохранены. Для получения персонализированного плана питания, требуется оплата в размере 1000 руб.")
+		msg.ReplyMarkup = tgbotapi.NewRemoveKeyboard(true)
+		t.bot.Send(msg)
 
-		// Send the real payment link using URL directly from Stripe
-		paymentMsg := tgbotapi.NewMessage(chatID, "Нажмите на кнопку ниже, чтобы перейти к оплате:")
-		paymentMsg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(
-			tgbotapi.NewInlineKeyboardRow(
-				tgbotapi.NewInlineKeyboardButtonURL("Оплатить", checkoutURL),
-			),
-		)
-		t.bot.Send(paymentMsg)
+		// Have the dispatcher deliver the payment link now rather than on its next tick
+		t.wakeOutboxDispatcher()
 	default:
 		// Unknown state, reset to start
 		msg := tgbotapi.NewMessage(chatID, "Извините, произошла ошибка. Пожалуйста, используйте /start для начала заново.")
@@ -483,7 +682,24 @@ func (t *TelegramBot) handleCallbackQuery(callbackQuery *tgbotapi.CallbackQuery)
 	callback := tgbotapi.NewCallback(callbackQuery.ID, "")
 	t.bot.Request(callback)
 
-	// Handle specific callback actions if needed
+	switch {
+	case strings.HasPrefix(callbackQuery.Data, reminderCallbackPrefix):
+		t.handleReminderCallback(callbackQuery)
+	case strings.HasPrefix(callbackQuery.Data, mealCallbackPrefix):
+		t.handleMealCallback(callbackQuery)
+	case strings.HasPrefix(callbackQuery.Data, regenerateCallbackPrefix):
+		t.handleRegenerateCallback(callbackQuery)
+	case strings.HasPrefix(callbackQuery.Data, shoppingCallbackPrefix):
+		t.handleShoppingCallback(callbackQuery)
+	case strings.HasPrefix(callbackQuery.Data, recipeCallbackPrefix):
+		t.handleRecipeCallback(callbackQuery)
+	case strings.HasPrefix(callbackQuery.Data, reportCallbackPrefix):
+		t.handleReportCallback(callbackQuery)
+	case strings.HasPrefix(callbackQuery.Data, waterCallbackPrefix):
+		t.handleWaterCallback(callbackQuery)
+	case strings.HasPrefix(callbackQuery.Data, healthCallbackPrefix):
+		t.handleHealthCallback(callbackQuery)
+	}
 }
 
 // Stop gracefully shuts down the bot
@@ -500,12 +716,13 @@ func (t *TelegramBot) Stop(ctx context.Context) error {
 	}
 }
 
-// handlePaymentSuccess processes successful payments
-func (t *TelegramBot) handlePaymentSuccess(userID int64, paymentIntentID string) {
-	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+// handlePaymentSuccess processes successful payments. The payment intent ID is
+// empty when the success comes from the Telegram redirect rather than the webhook.
+func (t *TelegramBot) handlePaymentSuccess(userID int64, stripeSessionID, paymentIntentID string) {
+	ctx, cancel := context.WithTimeout(context.Background(), planGenerationTimeout)
 	defer cancel()
 
-	t.logger.Info("Processing successful payment", "userID", userID, "paymentID", paymentIntentID)
+	t.logger.Info("Processing successful payment", "userID", userID, "sessionID", stripeSessionID)
 
 	// Get user from database
 	user, err := t.db.GetUser(ctx, userID)
@@ -514,56 +731,145 @@ func (t *TelegramBot) handlePaymentSuccess(userID int64, paymentIntentID string)
 		return
 	}
 
-	// Update payment status
-	err = t.db.UpdatePaymentStatus(ctx, paymentIntentID, "completed")
-	if err != nil {
-		t.logger.Error("Failed to update payment status", "error", err, "paymentID", paymentIntentID)
-		return
+	// Remember the payment intent so refunds and disputes can be matched
+	if paymentIntentID != "" {
+		if err := t.db.SetPaymentIntentID(ctx, stripeSessionID, paymentIntentID); err != nil {
+			t.logger.Error("Failed to save payment intent", "error", err, "sessionID", stripeSessionID)
+		}
 	}
 
 	// Get payment record
-	payment, err := t.db.GetPaymentByStripeID(ctx, paymentIntentID)
+	payment, err := t.db.GetPaymentByStripeID(ctx, stripeSessionID)
 	if err != nil {
-		t.logger.Error("Failed to get payment record", "error", err, "paymentID", paymentIntentID)
+		t.logger.Error("Failed to get payment record", "error", err, "sessionID", stripeSessionID)
 		return
 	}
 
-	// Generate diet plan with GPT
-	t.logger.Info("Generating diet plan with GPT", "userID", userID)
-	planText, err := t.gptClient.GenerateDietPlan(ctx, user)
+	// Only the first confirmation fulfils the plan; a refunded payment never does
+	pending, err := t.awaitsPlan(ctx, payment)
 	if err != nil {
-		t.logger.Error("Failed to generate diet plan", "error", err, "userID", userID)
+		t.logger.Error("Failed to check payment fulfilment", "error", err, "paymentID", payment.ID)
+		return
+	}
+	if !pending {
+		t.logger.Info("Payment already processed", "paymentID", payment.ID, "status", payment.Status)
+		return
+	}
 
-		// Send error message to user
-		msg := tgbotapi.NewMessage(user.ChatID, "К сожалению, произошла ошибка при создании плана питания. Пожалуйста, свяжитесь с поддержкой.")
+	err = t.fulfilPayment(ctx, user, payment)
+	if errors.Is(err, errFulfilmentInProgress) {
+		t.logger.Info("Payment is already being fulfilled", "paymentID", payment.ID)
+		return
+	}
+	if errors.Is(err, errPlanBelowMinimum) {
+		// Asking the model again will not help, so the payment goes back
+		t.logger.Error("Failed to fulfil payment", "error", err, "paymentID", payment.ID, "userID", userID)
+		t.notifyAdmins(fmt.Sprintf("⚠️ Платёж #%d: план для пользователя %d не удалось составить не ниже безопасного минимума калорий. Оформите возврат: /refund %d",
+			payment.ID, userID, payment.ID))
+		msg := tgbotapi.NewMessage(user.ChatID, "К сожалению, не удалось составить безопасный план питания под ваши параметры. Мы вернём оплату — администратор уже получил уведомление.")
 		_, _ = t.bot.Send(msg)
 		return
 	}
+	if err != nil {
+		t.logger.Error("Failed to fulfil payment", "error", err, "paymentID", payment.ID, "userID", userID)
 
-	// Save diet plan to database
-	dietPlan := &models.DietPlan{
-		UserID:    user.ID,
-		PaymentID: payment.ID,
-		PlanText:  planText,
+		// The payment stays unfulfilled, so the reconciler tries again
+		msg := tgbotapi.NewMessage(user.ChatID, "К сожалению, произошла ошибка при создании плана питания. Оплата получена — мы повторим попытку автоматически и пришлём план, как только он будет готов.")
+		_, _ = t.bot.Send(msg)
+	}
+}
+
+// awaitsPlan reports whether a payment still has to be fulfilled: it is not
+// completed yet, or it was completed before plans were saved with it and has
+// no plan.
+func (t *TelegramBot) awaitsPlan(ctx context.Context, payment *models.Payment) (bool, error) {
+	if payment.AwaitingFulfillment() {
+		return true, nil
+	}
+	if payment.Status != models.PaymentStatusCompleted {
+		return false, nil
+	}
+	fulfilled, err := t.db.HasDietPlan(ctx, payment.ID)
+	return !fulfilled, err
+}
+
+var (
+	errFulfilmentInProgress = errors.New("payment is already being fulfilled")
+	errAlreadyFulfilled     = errors.New("payment already has a plan")
+)
+
+// fulfilPayment generates the plan for a paid payment and sends it. The payment
+// is marked completed in the transaction that saves the plan, so a failed
+// generation leaves it to be retried.
+func (t *TelegramBot) fulfilPayment(ctx context.Context, user *models.User, payment *models.Payment) error {
+	if _, busy := t.fulfilling.LoadOrStore(payment.ID, true); busy {
+		return errFulfilmentInProgress
 	}
+	defer t.fulfilling.Delete(payment.ID)
 
-	err = t.db.SaveDietPlan(ctx, dietPlan)
+	// Generate diet plan with GPT
+	t.logger.Info("Generating diet plan with GPT", "userID", user.TelegramID, "paymentID", payment.ID)
+	result, err := t.generatePlan(ctx, gpt.PlanRequest{User: user, Target: nutrition.DailyTarget(user)})
 	if err != nil {
-		t.logger.Error("Failed to save diet plan", "error", err, "userID", userID)
+		return fmt.Errorf("failed to generate diet plan: %w", err)
 	}
 
-	// Send diet plan to user
-	t.logger.Info("Sending diet plan to user", "userID", userID, "chatID", user.ChatID)
-	msg := tgbotapi.NewMessage(user.ChatID, "🎉 Ваш персонализированный план питания готов!\n\n"+planText)
-	_, err = t.bot.Send(msg)
+	// Save diet plan to database together with the inputs that produced it
+	dietPlan := &models.DietPlan{
+		UserID:           user.ID,
+		PaymentID:        payment.ID,
+		PlanText:         result.Text,
+		Data:             result.Data,
+		Profile:          models.NewProfileSnapshot(user),
+		PromptVersion:    result.PromptVersion,
+		Model:            result.Model,
+		PromptTokens:     result.PromptTokens,
+		CompletionTokens: result.CompletionTokens,
+	}
+
+	// A copy is transitioned so a rolled back transaction leaves payment as stored
+	paid := *payment
+	err = t.db.WithTx(ctx, func(tx db.Store) error {
+		if paid.Status == models.PaymentStatusCompleted {
+			fulfilled, err := tx.HasDietPlan(ctx, paid.ID)
+			if err != nil {
+				return err
+			}
+			if fulfilled {
+				return errAlreadyFulfilled
+			}
+		} else if err := tx.TransitionPaymentStatus(ctx, &paid, models.PaymentStatusCompleted); err != nil {
+			return err
+		}
+		return tx.SaveDietPlan(ctx, dietPlan)
+	})
+	if errors.Is(err, db.ErrInvalidTransition) || errors.Is(err, errAlreadyFulfilled) {
+		t.logger.Warn("Payment changed while its plan was generated", "error", err, "paymentID", payment.ID)
+		return nil
+	}
 	if err != nil {
-		t.logger.Error("Failed to send diet plan message", "error", err, "chatID", user.ChatID)
+		return fmt.Errorf("failed to save diet plan: %w", err)
 	}
+	t.logger.Info("Payment status changed", "paymentID", payment.ID, "from", payment.Status, "to", paid.Status)
 
-	// Update user state
+	// The dialog is over before the plan arrives, so nothing the user starts
+	// after reading it is overwritten; a restarted questionnaire is left alone
 	t.stateMutex.Lock()
-	if state, ok := t.userStates[userID]; ok {
+	if state, ok := t.userStates[user.TelegramID]; ok && state.CurrentState == StatePayment {
 		state.CurrentState = StateComplete
 	}
 	t.stateMutex.Unlock()
+
+	// Send diet plan to user
+	t.logger.Info("Sending diet plan to user", "userID", user.TelegramID, "chatID", user.ChatID)
+	msg := tgbotapi.NewMessage(user.ChatID, "🎉 Ваш персонализированный план питания готов!\n\n"+result.Text+
+		"\n\n"+disclaimer(user)+
+		fmt.Sprintf("\n\nНе нравится день или блюдо? Отправьте /regenerate — изменить план можно бесплатно до %d раз.", t.freeRevisions))
+	if markup := recipeKeyboard(dietPlan); markup != nil {
+		msg.ReplyMarkup = markup
+	}
+	if _, err := t.bot.Send(msg); err != nil {
+		t.logger.Error("Failed to send diet plan message", "error", err, "chatID", user.ChatID)
+	}
+	return nil
 }
@@ -0,0 +1,397 @@
+// Package telegramtest provides an in-process fake of the Telegram Bot API for
+// driving the bot in tests. Updates are queued with SendText and PressButton and
+// handed out through getUpdates; every outgoing call is recorded.
+package telegramtest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// BotUsername is the username getMe reports.
+const BotUsername = "diet_test_bot"
+
+// Call is one recorded Bot API call made by the bot.
+type Call struct {
+	Method string
+	Params url.Values
+	Files  map[string][]byte
+}
+
+// ChatID returns the chat_id parameter of the call.
+func (c Call) ChatID() int64 {
+	id, _ := strconv.ParseInt(c.Params.Get("chat_id"), 10, 64)
+	return id
+}
+
+// Text returns the message text or caption.
+func (c Call) Text() string {
+	if text := c.Params.Get("text"); text != "" {
+		return text
+	}
+	return c.Params.Get("caption")
+}
+
+// Buttons returns the button labels of the reply or inline keyboard, row by row.
+func (c Call) Buttons() [][]string {
+	var markup struct {
+		Keyboard       [][]struct{ Text string } `json:"keyboard"`
+		InlineKeyboard [][]struct {
+			Text string `json:"text"`
+		} `json:"inline_keyboard"`
+	}
+	if err := json.Unmarshal([]byte(c.Params.Get("reply_markup")), &markup); err != nil {
+		return nil
+	}
+
+	var rows [][]string
+	for _, row := range markup.Keyboard {
+		var labels []string
+		for _, b := range row {
+			labels = append(labels, b.Text)
+		}
+		rows = append(rows, labels)
+	}
+	for _, row := range markup.InlineKeyboard {
+		var labels []string
+		for _, b := range row {
+			labels = append(labels, b.Text)
+		}
+		rows = append(rows, labels)
+	}
+	return rows
+}
+
+// CallbackData returns the callback data of the inline button with the given label.
+func (c Call) CallbackData(label string) string {
+	var markup struct {
+		InlineKeyboard [][]struct {
+			Text         string `json:"text"`
+			CallbackData string `json:"callback_data"`
+			URL          string `json:"url"`
+		} `json:"inline_keyboard"`
+	}
+	if err := json.Unmarshal([]byte(c.Params.Get("reply_markup")), &markup); err != nil {
+		return ""
+	}
+	for _, row := range markup.InlineKeyboard {
+		for _, b := range row {
+			if b.Text == label {
+				if b.CallbackData != "" {
+					return b.CallbackData
+				}
+				return b.URL
+			}
+		}
+	}
+	return ""
+}
+
+// Server is a fake Bot API. Point the bot at Endpoint().
+type Server struct {
+	*httptest.Server
+
+	Token string
+
+	mu        sync.Mutex
+	updateID  int
+	messageID int
+	updates   []json.RawMessage
+	calls     []Call
+	changed   chan struct{}
+	closed    chan struct{}
+	blocked   map[int64]bool
+	files     map[string][]byte
+	closeOnce sync.Once
+}
+
+// NewServer starts a fake Bot API for the given token.
+func NewServer(token string) *Server {
+	s := &Server{
+		Token:   token,
+		changed: make(chan struct{}),
+		closed:  make(chan struct{}),
+		blocked: make(map[int64]bool),
+		files:   make(map[string][]byte),
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+	return s
+}
+
+// Endpoint is the API endpoint format to pass to tgbotapi.NewBotAPIWithAPIEndpoint.
+func (s *Server) Endpoint() string {
+	return s.URL + "/bot%s/%s"
+}
+
+// Close releases pending long polls and shuts the server down.
+func (s *Server) Close() {
+	s.closeOnce.Do(func() { close(s.closed) })
+	s.Server.Close()
+}
+
+// Block makes every call addressed to chatID fail like Telegram does once a user blocks the bot.
+func (s *Server) Block(chatID int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.blocked[chatID] = true
+}
+
+// SendText queues a private text message from userID. Text starting with "/" is
+// marked up as a bot command.
+func (s *Server) SendText(userID int64, text string) {
+	message := s.message(userID)
+	message["text"] = text
+	if strings.HasPrefix(text, "/") {
+		command := strings.SplitN(text, " ", 2)[0]
+		message["entities"] = []map[string]interface{}{
+			{"type": "bot_command", "offset": 0, "length": len([]rune(command))},
+		}
+	}
+	s.queue(map[string]interface{}{"message": message})
+}
+
+// SendMessage queues a private message from userID with arbitrary extra fields
+// (photo, voice, location...) merged into the message object.
+func (s *Server) SendMessage(userID int64, fields map[string]interface{}) {
+	message := s.message(userID)
+	for k, v := range fields {
+		message[k] = v
+	}
+	s.queue(map[string]interface{}{"message": message})
+}
+
+// PressButton queues a callback query from userID carrying data.
+func (s *Server) PressButton(userID int64, data string) {
+	s.mu.Lock()
+	id := strconv.Itoa(s.updateID + 1000)
+	s.mu.Unlock()
+
+	s.queue(map[string]interface{}{
+		"callback_query": map[string]interface{}{
+			"id":            id,
+			"from":          user(userID),
+			"chat_instance": "test",
+			"data":          data,
+			"message": map[string]interface{}{
+				"message_id": 1,
+				"date":       time.Now().Unix(),
+				"chat":       map[string]interface{}{"id": userID, "type": "private"},
+			},
+		},
+	})
+}
+
+// AddFile registers a downloadable file for getFile and the file endpoint.
+func (s *Server) AddFile(fileID string, data []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.files[fileID] = data
+}
+
+// Calls returns every call recorded so far.
+func (s *Server) Calls() []Call {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Call(nil), s.calls...)
+}
+
+// WaitForCalls waits until at least n calls matching the filter were recorded
+// after the first skip matching ones, and returns them.
+func (s *Server) WaitForCalls(skip, n int, match func(Call) bool, timeout time.Duration) ([]Call, error) {
+	deadline := time.After(timeout)
+	for {
+		s.mu.Lock()
+		var matched []Call
+		for _, c := range s.calls {
+			if match(c) {
+				matched = append(matched, c)
+			}
+		}
+		changed := s.changed
+		s.mu.Unlock()
+
+		if len(matched) >= skip+n {
+			return matched[skip : skip+n], nil
+		}
+
+		select {
+		case <-changed:
+		case <-deadline:
+			return matched[min(skip, len(matched)):], fmt.Errorf("timed out waiting for %d calls, got %d", n, len(matched)-min(skip, len(matched)))
+		}
+	}
+}
+
+// IsSend matches calls that deliver something to a chat.
+func IsSend(c Call) bool {
+	return strings.HasPrefix(c.Method, "send") || c.Method == "editMessageText"
+}
+
+func (s *Server) message(userID int64) map[string]interface{} {
+	s.mu.Lock()
+	s.messageID++
+	id := s.messageID
+	s.mu.Unlock()
+
+	return map[string]interface{}{
+		"message_id": id,
+		"date":       time.Now().Unix(),
+		"from":       user(userID),
+		"chat":       map[string]interface{}{"id": userID, "type": "private"},
+	}
+}
+
+func (s *Server) queue(update map[string]interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.updateID++
+	update["update_id"] = s.updateID
+	raw, _ := json.Marshal(update)
+	s.updates = append(s.updates, raw)
+	s.notify()
+}
+
+// notify must be called with mu held.
+func (s *Server) notify() {
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	if strings.HasPrefix(r.URL.Path, "/file/bot"+s.Token+"/") {
+		s.serveFile(w, strings.TrimPrefix(r.URL.Path, "/file/bot"+s.Token+"/"))
+		return
+	}
+
+	prefix := "/bot" + s.Token + "/"
+	if !strings.HasPrefix(r.URL.Path, prefix) {
+		reply(w, http.StatusUnauthorized, map[string]interface{}{"ok": false, "error_code": 401, "description": "Unauthorized"})
+		return
+	}
+	method := strings.TrimPrefix(r.URL.Path, prefix)
+
+	call := Call{Method: method, Params: url.Values{}, Files: map[string][]byte{}}
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/") {
+		if err := r.ParseMultipartForm(32 << 20); err == nil {
+			call.Params = r.MultipartForm.Value
+			for field, headers := range r.MultipartForm.File {
+				f, err := headers[0].Open()
+				if err == nil {
+					call.Files[field], _ = io.ReadAll(f)
+					f.Close()
+				}
+			}
+		}
+	} else if err := r.ParseForm(); err == nil {
+		call.Params = r.PostForm
+	}
+
+	switch method {
+	case "getMe":
+		ok(w, map[string]interface{}{"id": 1, "is_bot": true, "first_name": "Diet Bot", "username": BotUsername})
+	case "getUpdates":
+		s.getUpdates(w, call.Params)
+	case "getFile":
+		fileID := call.Params.Get("file_id")
+		ok(w, map[string]interface{}{"file_id": fileID, "file_unique_id": fileID, "file_path": "files/" + fileID})
+	default:
+		s.record(w, call)
+	}
+}
+
+func (s *Server) record(w http.ResponseWriter, call Call) {
+	chatID := call.ChatID()
+
+	s.mu.Lock()
+	s.calls = append(s.calls, call)
+	blocked := s.blocked[chatID]
+	s.messageID++
+	id := s.messageID
+	s.notify()
+	s.mu.Unlock()
+
+	if blocked {
+		reply(w, http.StatusForbidden, map[string]interface{}{"ok": false, "error_code": 403, "description": "Forbidden: bot was blocked by the user"})
+		return
+	}
+
+	if !IsSend(call) {
+		ok(w, true)
+		return
+	}
+
+	ok(w, map[string]interface{}{
+		"message_id": id,
+		"date":       time.Now().Unix(),
+		"chat":       map[string]interface{}{"id": chatID, "type": "private"},
+		"text":       call.Text(),
+	})
+}
+
+func (s *Server) getUpdates(w http.ResponseWriter, params url.Values) {
+	offset, _ := strconv.Atoi(params.Get("offset"))
+	timeout, _ := strconv.Atoi(params.Get("timeout"))
+	deadline := time.After(time.Duration(timeout) * time.Second)
+
+	for {
+		s.mu.Lock()
+		var pending []json.RawMessage
+		for i, raw := range s.updates {
+			if i+1 >= offset {
+				pending = append(pending, raw)
+			}
+		}
+		changed := s.changed
+		s.mu.Unlock()
+
+		if len(pending) > 0 {
+			ok(w, pending)
+			return
+		}
+
+		select {
+		case <-changed:
+		case <-deadline:
+			ok(w, []json.RawMessage{})
+			return
+		case <-s.closed:
+			ok(w, []json.RawMessage{})
+			return
+		}
+	}
+}
+
+func (s *Server) serveFile(w http.ResponseWriter, path string) {
+	s.mu.Lock()
+	data, found := s.files[strings.TrimPrefix(path, "files/")]
+	s.mu.Unlock()
+
+	if !found {
+		http.NotFound(w, nil)
+		return
+	}
+	w.Write(data)
+}
+
+func user(id int64) map[string]interface{} {
+	return map[string]interface{}{"id": id, "is_bot": false, "first_name": "Test", "username": fmt.Sprintf("user%d", id)}
+}
+
+func ok(w http.ResponseWriter, result interface{}) {
+	reply(w, http.StatusOK, map[string]interface{}{"ok": true, "result": result})
+}
+
+func reply(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
@@ -0,0 +1,162 @@
+package bot
+
+import (
+	"context"
+	"diet-bot/internal/db"
+	"diet-bot/internal/geo"
+	"diet-bot/internal/models"
+	"errors"
+	"fmt"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"strings"
+	"time"
+)
+
+const timezonePrompt = "В каком городе вы живёте? Напишите название или отправьте местоположение — по нему я определю часовой пояс для напоминаний и дневника."
+
+// timezoneKeyboard offers a location share and the most common cities.
+func timezoneKeyboard() tgbotapi.ReplyKeyboardMarkup {
+	return tgbotapi.NewReplyKeyboard(
+		tgbotapi.NewKeyboardButtonRow(
+			tgbotapi.NewKeyboardButtonLocation("📍 Отправить местоположение"),
+		),
+		tgbotapi.NewKeyboardButtonRow(
+			tgbotapi.NewKeyboardButton("Москва"),
+			tgbotapi.NewKeyboardButton("Новосибирск"),
+			tgbotapi.NewKeyboardButton("Екатеринбург"),
+		),
+	)
+}
+
+// resolveTimezone finds the time zone for a shared location, a city name or
+// an IANA name such as "Europe/Berlin". place describes what was matched.
+func resolveTimezone(message *tgbotapi.Message, text string) (timezone, place string, ok bool) {
+	if loc := message.Location; loc != nil {
+		city, _ := geo.NearestCity(loc.Latitude, loc.Longitude)
+		return city.Timezone, "рядом с городом " + city.Name, true
+	}
+
+	text = strings.TrimSpace(text)
+	if city, found := geo.FindCity(text); found {
+		return city.Timezone, city.Name, true
+	}
+	if strings.Contains(text, "/") {
+		if loc, err := time.LoadLocation(text); err == nil {
+			return loc.String(), loc.String(), true
+		}
+	}
+	return "", "", false
+}
+
+// describeTimezone renders a zone as "Asia/Novosibirsk, UTC+7".
+func describeTimezone(timezone string) string {
+	_, offset := time.Now().In(models.LoadLocation(timezone)).Zone()
+	sign := "+"
+	if offset < 0 {
+		sign, offset = "−", -offset
+	}
+	text := fmt.Sprintf("%s, UTC%s%d", timezone, sign, offset/3600)
+	if minutes := offset % 3600 / 60; minutes != 0 {
+		text += fmt.Sprintf(":%02d", minutes)
+	}
+	return text
+}
+
+// handleTimezoneCommand shows the user's time zone or changes it:
+// "/timezone Новосибирск".
+func (t *TelegramBot) handleTimezoneCommand(message *tgbotapi.Message) {
+	chatID := message.Chat.ID
+	ctx := context.Background()
+
+	user, err := t.db.GetUser(ctx, message.From.ID)
+	if errors.Is(err, db.ErrNotFound) {
+		t.bot.Send(tgbotapi.NewMessage(chatID, "Сначала заполните анкету с помощью /start."))
+		return
+	}
+	if err != nil {
+		t.logger.Error("Failed to get user for timezone", "error", err, "userID", message.From.ID)
+		t.bot.Send(tgbotapi.NewMessage(chatID, "Извините, произошла ошибка. Попробуйте позже."))
+		return
+	}
+
+	arg := message.CommandArguments()
+	if strings.TrimSpace(arg) == "" {
+		msg := tgbotapi.NewMessage(chatID, fmt.Sprintf("🕒 Ваш часовой пояс: %s.\n\nЧтобы изменить его, отправьте /timezone Город или поделитесь местоположением.", describeTimezone(user.Timezone)))
+		msg.ReplyMarkup = timezoneKeyboard()
+		t.bot.Send(msg)
+		return
+	}
+	t.changeTimezone(ctx, message, user, arg)
+}
+
+// handleLocation treats a location shared outside the questionnaire as a
+// time zone change.
+func (t *TelegramBot) handleLocation(message *tgbotapi.Message) {
+	chatID := message.Chat.ID
+	ctx := context.Background()
+
+	user, err := t.db.GetUser(ctx, message.From.ID)
+	if errors.Is(err, db.ErrNotFound) {
+		t.bot.Send(tgbotapi.NewMessage(chatID, "Пожалуйста, используйте /start для начала работы с ботом."))
+		return
+	}
+	if err != nil {
+		t.logger.Error("Failed to get user for location", "error", err, "userID", message.From.ID)
+		t.bot.Send(tgbotapi.NewMessage(chatID, "Извините, произошла ошибка. Попробуйте позже."))
+		return
+	}
+	t.changeTimezone(ctx, message, user, "")
+}
+
+func (t *TelegramBot) changeTimezone(ctx context.Context, message *tgbotapi.Message, user *models.User, text string) {
+	chatID := message.Chat.ID
+
+	timezone, place, ok := resolveTimezone(message, text)
+	if !ok {
+		msg := tgbotapi.NewMessage(chatID, "Не нашёл такой город. Напишите ближайший крупный город или отправьте местоположение.")
+		msg.ReplyMarkup = timezoneKeyboard()
+		t.bot.Send(msg)
+		return
+	}
+
+	err := t.db.WithTx(ctx, func(tx db.Store) error {
+		if err := tx.SetUserTimezone(ctx, user.TelegramID, timezone); err != nil {
+			return err
+		}
+		user.Timezone = timezone
+		return retimeReminders(ctx, tx, user, time.Now())
+	})
+	if err != nil {
+		t.logger.Error("Failed to change timezone", "error", err, "userID", user.ID)
+		t.bot.Send(tgbotapi.NewMessage(chatID, "Извините, не удалось сохранить часовой пояс. Попробуйте позже."))
+		return
+	}
+
+	msg := tgbotapi.NewMessage(chatID, fmt.Sprintf("✅ Часовой пояс: %s (%s). Напоминания будут приходить по местному времени.", describeTimezone(timezone), place))
+	msg.ReplyMarkup = tgbotapi.NewRemoveKeyboard(true)
+	t.bot.Send(msg)
+}
+
+// retimeReminders moves the user's reminders to their current time zone so
+// that "09:00" keeps meaning nine in the morning where they are.
+func retimeReminders(ctx context.Context, store db.Store, user *models.User, now time.Time) error {
+	reminders, err := store.ListReminders(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+	for _, r := range reminders {
+		if r.Timezone == user.Timezone {
+			continue
+		}
+		r.Timezone = user.Timezone
+		next, err := nextReminderRun(r, now, 0)
+		if err != nil {
+			return err
+		}
+		r.NextRunAt = next
+		if err := store.SaveReminder(ctx, r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package bot
+
+import (
+	"bytes"
+	"context"
+	"diet-bot/internal/models"
+	"fmt"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"strings"
+	"time"
+)
+
+const (
+	// maxVoiceDuration keeps transcription cheap; a meal takes seconds to dictate
+	maxVoiceDuration = 2 * time.Minute
+
+	transcribeTimeout = time.Minute
+)
+
+// handleVoice transcribes a voice message and handles it like typed text: a
+// question is answered, a meal is estimated. The transcript is echoed with
+// the estimate, which is only logged once the user confirms it, so a
+// misheard word can be corrected by typing instead.
+func (t *TelegramBot) handleVoice(ctx context.Context, message *tgbotapi.Message, user *models.User) {
+	chatID := message.Chat.ID
+
+	if t.transcriber == nil {
+		t.bot.Send(tgbotapi.NewMessage(chatID, "Голосовые сообщения пока не поддерживаются. Напишите, что вы съели, текстом."))
+		return
+	}
+	if time.Duration(message.Voice.Duration)*time.Second > maxVoiceDuration {
+		t.bot.Send(tgbotapi.NewMessage(chatID, fmt.Sprintf("Голосовое слишком длинное. Уложитесь в %d минуты или напишите текстом.", int(maxVoiceDuration.Minutes()))))
+		return
+	}
+
+	data, err := t.downloadFile(ctx, message.Voice.FileID)
+	if err != nil {
+		t.logger.Error("Failed to download voice message", "error", err, "userID", user.ID)
+		t.bot.Send(tgbotapi.NewMessage(chatID, "Извините, не удалось загрузить голосовое. Попробуйте ещё раз."))
+		return
+	}
+
+	transcribeCtx, cancel := context.WithTimeout(ctx, transcribeTimeout)
+	defer cancel()
+
+	// Telegram records voice messages as Opus in OGG
+	text, err := t.transcriber.Transcribe(transcribeCtx, bytes.NewReader(data), "voice.ogg")
+	if err != nil {
+		t.logger.Error("Failed to transcribe voice message", "error", err, "userID", user.ID)
+		t.bot.Send(tgbotapi.NewMessage(chatID, "Извините, не удалось распознать голосовое. Попробуйте позже или напишите текстом."))
+		return
+	}
+	text = strings.TrimSpace(text)
+	if text == "" {
+		t.bot.Send(tgbotapi.NewMessage(chatID, "Не расслышал ни слова. Попробуйте ещё раз или напишите текстом."))
+		return
+	}
+
+	heard := fmt.Sprintf("🎙 Распознал: «%s»", text)
+	if isQuestion(text) {
+		t.bot.Send(tgbotapi.NewMessage(chatID, heard))
+		t.answerQuestion(ctx, chatID, user, text)
+		return
+	}
+
+	estimateCtx, cancelEstimate := context.WithTimeout(ctx, mealEstimateTimeout)
+	defer cancelEstimate()
+
+	logs, err := t.estimateMeal(estimateCtx, text)
+	if err != nil {
+		t.logger.Error("Failed to estimate meal", "error", err, "userID", user.ID)
+		t.bot.Send(tgbotapi.NewMessage(chatID, heard+"\n\nИзвините, не удалось посчитать калории. Попробуйте позже."))
+		return
+	}
+	if len(logs) == 0 {
+		t.bot.Send(tgbotapi.NewMessage(chatID, heard+"\n\nНе нашёл здесь еды. Если я ослышался, напишите, что вы съели, текстом."))
+		return
+	}
+	t.proposeMeal(chatID, message.From.ID, heard+"\n\n"+formatMeal(logs)+
+		"\n\nЗаписать в дневник? Если я ослышался, нажмите «Отмена» и отправьте исправленный текст.", logs)
+}
@@ -0,0 +1,162 @@
+package bot
+
+import (
+	"context"
+	"diet-bot/internal/db"
+	"diet-bot/internal/models"
+	"diet-bot/internal/nutrition"
+	"errors"
+	"fmt"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	waterCallbackPrefix = "water:"
+
+	waterGlass = 250 // ml
+	// maxWaterPortion bounds what "/water N" adds at once
+	maxWaterPortion = 3000
+)
+
+// waterKeyboard goes under every water message; pressing it updates the
+// counter of the current day, however old the message is.
+func waterKeyboard() tgbotapi.InlineKeyboardMarkup {
+	button := func(label string, amount int) tgbotapi.InlineKeyboardButton {
+		return tgbotapi.NewInlineKeyboardButtonData(label, waterCallbackPrefix+strconv.Itoa(amount))
+	}
+	return tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(button("🥛 +250 мл", waterGlass), button("🍶 +500 мл", 2*waterGlass)),
+		tgbotapi.NewInlineKeyboardRow(button("↩️ −250 мл", -waterGlass)),
+	)
+}
+
+// handleWaterCommand shows today's water with the quick-add buttons, or adds
+// a portion: "/water 300".
+func (t *TelegramBot) handleWaterCommand(message *tgbotapi.Message) {
+	chatID := message.Chat.ID
+	ctx := context.Background()
+
+	user, err := t.db.GetUser(ctx, message.From.ID)
+	if errors.Is(err, db.ErrNotFound) {
+		t.bot.Send(tgbotapi.NewMessage(chatID, "Сначала заполните анкету с помощью /start."))
+		return
+	}
+	if err != nil {
+		t.logger.Error("Failed to get user for water log", "error", err, "userID", message.From.ID)
+		t.bot.Send(tgbotapi.NewMessage(chatID, "Извините, произошла ошибка. Попробуйте позже."))
+		return
+	}
+
+	amount := 0
+	if args := strings.TrimSpace(message.CommandArguments()); args != "" {
+		amount, err = strconv.Atoi(strings.TrimSpace(strings.TrimSuffix(args, "мл")))
+		if err != nil || amount <= 0 || amount > maxWaterPortion {
+			t.bot.Send(tgbotapi.NewMessage(chatID, "Укажите, сколько миллилитров вы выпили, например: /water 300. "+
+				"Или отправьте /water без числа и отмечайте стаканы кнопками."))
+			return
+		}
+	}
+
+	text, ok := t.addWater(ctx, user, amount, time.Now())
+	if !ok {
+		t.bot.Send(tgbotapi.NewMessage(chatID, "Извините, не удалось записать воду. Попробуйте позже."))
+		return
+	}
+	msg := tgbotapi.NewMessage(chatID, text)
+	msg.ReplyMarkup = waterKeyboard()
+	t.bot.Send(msg)
+}
+
+// handleWaterCallback handles "water:<ml>" from the quick-add buttons.
+func (t *TelegramBot) handleWaterCallback(callbackQuery *tgbotapi.CallbackQuery) {
+	if callbackQuery.Message == nil {
+		return
+	}
+	amount, err := strconv.Atoi(strings.TrimPrefix(callbackQuery.Data, waterCallbackPrefix))
+	if err != nil || amount == 0 || amount > maxWaterPortion || amount < -maxWaterPortion {
+		return
+	}
+	ctx := context.Background()
+
+	user, err := t.db.GetUser(ctx, callbackQuery.From.ID)
+	if err != nil {
+		t.logger.Error("Failed to get user for water log", "error", err, "userID", callbackQuery.From.ID)
+		return
+	}
+	text, ok := t.addWater(ctx, user, amount, time.Now())
+	if !ok {
+		return
+	}
+	// Editing the text to the same value fails, e.g. on "−250" at zero; that is fine
+	t.bot.Send(tgbotapi.NewEditMessageTextAndMarkup(callbackQuery.Message.Chat.ID, callbackQuery.Message.MessageID, text, waterKeyboard()))
+}
+
+// addWater adds amount ml to the user's counter for the day of now and
+// returns the day's status.
+func (t *TelegramBot) addWater(ctx context.Context, user *models.User, amount int, now time.Time) (string, bool) {
+	local := now.In(user.Location())
+	var drunk int
+	var err error
+	if amount == 0 {
+		drunk, err = t.db.GetWater(ctx, user.ID, models.Day(local))
+	} else {
+		drunk, err = t.db.AddWater(ctx, user.ID, models.Day(local), amount)
+	}
+	if err != nil {
+		t.logger.Error("Failed to log water", "error", err, "userID", user.ID)
+		return "", false
+	}
+	return formatWaterStatus(drunk, nutrition.WaterTarget(user.Weight), local), true
+}
+
+// waterReminder is the water nudge for r at now. It is only due when the
+// user is behind the day's schedule.
+func (t *TelegramBot) waterReminder(ctx context.Context, r *models.Reminder, now time.Time) (tgbotapi.MessageConfig, bool) {
+	msg := tgbotapi.NewMessage(r.ChatID, reminderTexts[r.Kind])
+	msg.ReplyMarkup = waterKeyboard()
+
+	user, err := t.db.GetUserByID(ctx, r.UserID)
+	var drunk int
+	if err == nil {
+		drunk, err = t.db.GetWater(ctx, user.ID, models.Day(now.In(user.Location())))
+	}
+	if err != nil {
+		// Better a plain nudge than none
+		t.logger.Error("Failed to check water for reminder", "error", err, "reminderID", r.ID)
+		return msg, true
+	}
+
+	local := now.In(user.Location())
+	target := nutrition.WaterTarget(user.Weight)
+	if drunk >= nutrition.WaterDue(target, local) {
+		return msg, false
+	}
+	msg.Text += "\n\n" + formatWaterStatus(drunk, target, local)
+	return msg, true
+}
+
+// formatWaterStatus shows how much of the target was drunk and how it
+// compares with the schedule at local.
+func formatWaterStatus(drunk, target int, local time.Time) string {
+	const barLength = 10
+	filled := min(drunk*barLength/target, barLength)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "💧 Вода сегодня: %d из %d мл\n%s%s %d%%", drunk, target,
+		strings.Repeat("🟦", filled), strings.Repeat("⬜", barLength-filled), drunk*100/target)
+
+	due := nutrition.WaterDue(target, local)
+	switch {
+	case drunk >= target:
+		b.WriteString("\n\n🎉 Дневная норма выполнена!")
+	case drunk < due:
+		fmt.Fprintf(&b, "\n\nК этому времени стоит выпить около %d мл, до графика не хватает %d мл.", due, due-drunk)
+	default:
+		b.WriteString("\n\nВы пьёте по графику 👍")
+	}
+	b.WriteString("\n\nНорма — 30 мл на килограмм веса. Отмечайте выпитое кнопками ниже или командой /water 300.")
+	return b.String()
+}
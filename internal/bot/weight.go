@@ -0,0 +1,199 @@
+package bot
+
+import (
+	"context"
+	"diet-bot/internal/db"
+	"diet-bot/internal/models"
+	"diet-bot/internal/progress"
+	"errors"
+	"fmt"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	minWeight = 30
+	maxWeight = 300
+
+	// weightHistoryDays is how far back /weight looks for history and trend.
+	weightHistoryDays = 90
+	// weightHistoryEntries is how many entries /weight lists.
+	weightHistoryEntries = 10
+)
+
+// parseWeight accepts kilograms with a dot or a comma as the decimal separator.
+func parseWeight(text string) (float64, bool) {
+	weight, err := strconv.ParseFloat(strings.Replace(strings.TrimSpace(text), ",", ".", 1), 64)
+	if err != nil || weight < minWeight || weight > maxWeight {
+		return 0, false
+	}
+	// Stored with one decimal place
+	return float64(int(weight*10+0.5)) / 10, true
+}
+
+// parseLogDate understands "сегодня", "вчера", DD.MM, DD.MM.YYYY and
+// YYYY-MM-DD relative to today. Dates in the future are rejected.
+func parseLogDate(text string, today time.Time) (time.Time, bool) {
+	text = strings.ToLower(strings.TrimSpace(text))
+	switch text {
+	case "сегодня":
+		return today, true
+	case "вчера":
+		return today.AddDate(0, 0, -1), true
+	}
+
+	var day time.Time
+	var err error
+	switch {
+	case strings.Contains(text, "-"):
+		day, err = time.Parse("2006-01-02", text)
+	case strings.Count(text, ".") == 2:
+		day, err = time.Parse("02.01.2006", text)
+	default:
+		var parsed time.Time
+		parsed, err = time.Parse("02.01", text)
+		// Without a year the most recent such date is meant
+		year := today.Year()
+		if time.Date(year, parsed.Month(), parsed.Day(), 0, 0, 0, 0, time.UTC).After(today) {
+			year--
+		}
+		day = time.Date(year, parsed.Month(), parsed.Day(), 0, 0, 0, 0, time.UTC)
+		// 29.02 rolls over to 1 March outside leap years
+		if day.Month() != parsed.Month() || day.Day() != parsed.Day() {
+			return time.Time{}, false
+		}
+	}
+	if err != nil || day.After(today) {
+		return time.Time{}, false
+	}
+	return day, true
+}
+
+// handleWeightCommand logs a weigh-in ("/weight 72.4 [дата]") or shows the
+// history and trend when called without arguments.
+func (t *TelegramBot) handleWeightCommand(message *tgbotapi.Message) {
+	chatID := message.Chat.ID
+	ctx := context.Background()
+
+	user, err := t.db.GetUser(ctx, message.From.ID)
+	if errors.Is(err, db.ErrNotFound) {
+		t.bot.Send(tgbotapi.NewMessage(chatID, "Сначала заполните анкету с помощью /start."))
+		return
+	}
+	if err != nil {
+		t.logger.Error("Failed to get user for weight log", "error", err, "userID", message.From.ID)
+		t.bot.Send(tgbotapi.NewMessage(chatID, "Извините, произошла ошибка. Попробуйте позже."))
+		return
+	}
+
+	args := strings.Fields(message.CommandArguments())
+	if len(args) == 0 {
+		t.sendWeightHistory(ctx, chatID, user)
+		return
+	}
+
+	usage := "Использование: /weight 72.4 [дата]\nДата — «вчера», 01.03 или 01.03.2024. Без аргументов покажу историю."
+	if len(args) > 2 {
+		t.bot.Send(tgbotapi.NewMessage(chatID, usage))
+		return
+	}
+
+	weight, ok := parseWeight(args[0])
+	if !ok {
+		t.bot.Send(tgbotapi.NewMessage(chatID, fmt.Sprintf("Вес должен быть числом от %d до %d кг.\n\n%s", minWeight, maxWeight, usage)))
+		return
+	}
+
+	today := user.Today()
+	day := today
+	if len(args) == 2 {
+		if day, ok = parseLogDate(args[1], today); !ok {
+			t.bot.Send(tgbotapi.NewMessage(chatID, "Не понял дату или она в будущем.\n\n"+usage))
+			return
+		}
+	}
+
+	log := &models.WeightLog{UserID: user.ID, Weight: weight, LoggedOn: day}
+	if err := t.logWeight(ctx, user, log); err != nil {
+		t.logger.Error("Failed to save weight log", "error", err, "userID", user.ID)
+		t.bot.Send(tgbotapi.NewMessage(chatID, "Извините, не удалось сохранить вес. Попробуйте позже."))
+		return
+	}
+
+	text := fmt.Sprintf("✅ Записал %g кг на %s.", log.Weight, log.LoggedOn.Format("02.01.2006"))
+	if logs, err := t.db.ListWeightLogs(ctx, user.ID, today.AddDate(0, 0, -weightHistoryDays)); err == nil {
+		if trend, ok := progress.ComputeTrend(logs); ok {
+			text += "\n\n" + formatTrend(trend)
+		}
+	}
+	t.bot.Send(tgbotapi.NewMessage(chatID, text))
+}
+
+// logWeight saves the entry and, when it is the newest one, makes it the
+// profile weight used for future plans.
+func (t *TelegramBot) logWeight(ctx context.Context, user *models.User, log *models.WeightLog) error {
+	return t.db.WithTx(ctx, func(tx db.Store) error {
+		if err := tx.SaveWeightLog(ctx, log); err != nil {
+			return err
+		}
+
+		latest, err := tx.GetLatestWeightLog(ctx, user.ID)
+		if err != nil {
+			return err
+		}
+		if latest.ID != log.ID {
+			return nil
+		}
+
+		user.Weight = log.Weight
+		return tx.SaveUser(ctx, user)
+	})
+}
+
+func (t *TelegramBot) sendWeightHistory(ctx context.Context, chatID int64, user *models.User) {
+	since := user.Today().AddDate(0, 0, -weightHistoryDays)
+	logs, err := t.db.ListWeightLogs(ctx, user.ID, since)
+	if err != nil {
+		t.logger.Error("Failed to list weight logs", "error", err, "userID", user.ID)
+		t.bot.Send(tgbotapi.NewMessage(chatID, "Извините, не удалось загрузить историю веса. Попробуйте позже."))
+		return
+	}
+
+	trend, ok := progress.ComputeTrend(logs)
+	if !ok {
+		t.bot.Send(tgbotapi.NewMessage(chatID, "Записей веса пока нет. Отправьте, например, /weight 72.4"))
+		return
+	}
+
+	var b strings.Builder
+	b.WriteString("⚖️ История веса:\n")
+	from := len(logs) - weightHistoryEntries
+	if from < 0 {
+		from = 0
+	}
+	for i := len(logs) - 1; i >= from; i-- {
+		fmt.Fprintf(&b, "\n%s — %g кг", logs[i].LoggedOn.Format("02.01.2006"), logs[i].Weight)
+	}
+	b.WriteString("\n\n" + formatTrend(trend))
+	t.bot.Send(tgbotapi.NewMessage(chatID, b.String()))
+}
+
+// formatTrend describes the smoothed weight and how fast it is changing.
+func formatTrend(trend progress.Trend) string {
+	text := fmt.Sprintf("Среднее за %d дней: %.1f кг", progress.MovingAverageDays, trend.MovingAverage)
+	if !trend.HasRate {
+		return text + "\nТемп появится, когда будут записи хотя бы за два дня."
+	}
+
+	switch {
+	case trend.WeeklyRate <= -0.05:
+		text += fmt.Sprintf("\nТемп: −%.1f кг в неделю", -trend.WeeklyRate)
+	case trend.WeeklyRate >= 0.05:
+		text += fmt.Sprintf("\nТемп: +%.1f кг в неделю", trend.WeeklyRate)
+	default:
+		text += "\nТемп: вес стабилен"
+	}
+	return text
+}
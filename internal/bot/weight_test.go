@@ -0,0 +1,53 @@
+package bot
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseWeight(t *testing.T) {
+	for text, want := range map[string]float64{"72.4": 72.4, "72,4": 72.4, " 80 ": 80, "65.06": 65.1} {
+		if got, ok := parseWeight(text); !ok || got != want {
+			t.Errorf("parseWeight(%q) = %v, %v; want %v", text, got, ok, want)
+		}
+	}
+	for _, text := range []string{"", "abc", "29.9", "301", "70кг"} {
+		if _, ok := parseWeight(text); ok {
+			t.Errorf("parseWeight(%q) accepted", text)
+		}
+	}
+}
+
+func TestParseLogDate(t *testing.T) {
+	today := time.Date(2024, 3, 10, 0, 0, 0, 0, time.UTC)
+
+	for text, want := range map[string]time.Time{
+		"сегодня":    today,
+		"Вчера":      today.AddDate(0, 0, -1),
+		"01.03":      time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC),
+		"20.12":      time.Date(2023, 12, 20, 0, 0, 0, 0, time.UTC),
+		"05.02.2024": time.Date(2024, 2, 5, 0, 0, 0, 0, time.UTC),
+		"2024-02-05": time.Date(2024, 2, 5, 0, 0, 0, 0, time.UTC),
+	} {
+		if got, ok := parseLogDate(text, today); !ok || !got.Equal(want) {
+			t.Errorf("parseLogDate(%q) = %v, %v; want %v", text, got, ok, want)
+		}
+	}
+	for _, text := range []string{"завтра", "11.03.2024", "2024-13-01", "32.01"} {
+		if _, ok := parseLogDate(text, today); ok {
+			t.Errorf("parseLogDate(%q) accepted", text)
+		}
+	}
+
+	// 29.02 is the leap day of this year, and no date at all a year later
+	if got, ok := parseLogDate("29.02", today); !ok || !got.Equal(time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("parseLogDate(29.02) in a leap year = %v, %v", got, ok)
+	}
+	if got, ok := parseLogDate("29.02", today.AddDate(1, 0, 0)); ok {
+		t.Errorf("parseLogDate(29.02) outside a leap year = %v", got)
+	}
+	// Before this year's leap day the last year had none
+	if got, ok := parseLogDate("29.02", time.Date(2024, 2, 10, 0, 0, 0, 0, time.UTC)); ok {
+		t.Errorf("parseLogDate(29.02) before the leap day = %v", got)
+	}
+}
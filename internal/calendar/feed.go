@@ -0,0 +1,41 @@
+package calendar
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"strings"
+)
+
+// FeedPath is where the server serves feeds; the token and ".ics" follow it.
+const FeedPath = "/calendar/"
+
+// FeedToken is the signed part of a user's feed link, "<userID>-<signature>".
+// Only someone with the link can read the feed, and changing the secret
+// revokes every link.
+func FeedToken(secret string, userID int64) string {
+	id := strconv.FormatInt(userID, 10)
+	return id + "-" + sign(secret, id)
+}
+
+// ParseFeedToken returns the user a feed token was issued to.
+func ParseFeedToken(secret, token string) (int64, bool) {
+	id, signature, ok := strings.Cut(token, "-")
+	if !ok || secret == "" || !hmac.Equal([]byte(signature), []byte(sign(secret, id))) {
+		return 0, false
+	}
+	userID, err := strconv.ParseInt(id, 10, 64)
+	return userID, err == nil
+}
+
+// FeedURL is the link to subscribe to a user's feed on a server at baseURL.
+func FeedURL(baseURL, secret string, userID int64) string {
+	return strings.TrimRight(baseURL, "/") + FeedPath + FeedToken(secret, userID) + ".ics"
+}
+
+func sign(secret, id string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("calendar-feed:" + id))
+	return hex.EncodeToString(mac.Sum(nil))[:32]
+}
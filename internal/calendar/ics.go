@@ -0,0 +1,136 @@
+// Package calendar exports the meal times of a structured plan as iCalendar
+// (RFC 5545) and signs the per-user feed links.
+package calendar
+
+import (
+	"bytes"
+	"diet-bot/internal/models"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	// mealDuration is how long a meal event lasts
+	mealDuration = 30 * time.Minute
+	// maxLineOctets is the longest content line before it is folded
+	maxLineOctets = 75
+)
+
+// Options set where and how long the plan runs in the calendar.
+type Options struct {
+	PlanID   int64
+	Location *time.Location
+	// Start is the date of plan day 1 in Location
+	Start time.Time
+	// Cycles is how many times the plan repeats, 0 for as long as the calendar
+	// is kept
+	Cycles int
+	// Now stamps the events
+	Now time.Time
+}
+
+// Build returns a calendar with a recurring event for every meal of the plan.
+// A plan of N days repeats every N days, so day 1 follows the last day.
+func Build(data *models.PlanData, opts Options) []byte {
+	loc := opts.Location
+	start := time.Date(opts.Start.Year(), opts.Start.Month(), opts.Start.Day(), 0, 0, 0, 0, loc)
+
+	var events []event
+	for _, day := range data.Days {
+		for i, meal := range day.Meals {
+			clock, err := time.Parse("15:04", strings.TrimSpace(meal.Time))
+			if err != nil {
+				continue
+			}
+			at := time.Date(start.Year(), start.Month(), start.Day()+day.Day-1, clock.Hour(), clock.Minute(), 0, 0, loc)
+			events = append(events, event{
+				uid:         fmt.Sprintf("plan-%d-day-%d-meal-%d@diet-bot", opts.PlanID, day.Day, i+1),
+				start:       at,
+				summary:     fmt.Sprintf("%s — %s", meal.Name, meal.Dish),
+				description: describeMeal(meal),
+			})
+		}
+	}
+
+	w := &writer{}
+	w.line("BEGIN:VCALENDAR")
+	w.line("VERSION:2.0")
+	w.line("PRODID:-//diet-bot//meal plan//RU")
+	w.line("CALSCALE:GREGORIAN")
+	w.line("METHOD:PUBLISH")
+	w.line("X-WR-CALNAME:" + escape("План питания"))
+	w.line("X-WR-TIMEZONE:" + loc.String())
+
+	end := start.AddDate(0, 0, len(data.Days)*max(opts.Cycles, 1))
+	if opts.Cycles == 0 {
+		end = start.AddDate(2, 0, 0)
+	}
+	writeTimezone(w, loc, start.AddDate(0, 0, -1), end)
+
+	rule := fmt.Sprintf("RRULE:FREQ=DAILY;INTERVAL=%d", len(data.Days))
+	if opts.Cycles > 0 {
+		rule += fmt.Sprintf(";COUNT=%d", opts.Cycles)
+	}
+	stamp := opts.Now.UTC().Format("20060102T150405Z")
+	for _, e := range events {
+		w.line("BEGIN:VEVENT")
+		w.line("UID:" + e.uid)
+		w.line("DTSTAMP:" + stamp)
+		w.line(fmt.Sprintf("DTSTART;TZID=%s:%s", loc.String(), e.start.Format("20060102T150405")))
+		w.line(fmt.Sprintf("DURATION:PT%dM", int(mealDuration.Minutes())))
+		w.line(rule)
+		w.line("SUMMARY:" + escape(e.summary))
+		w.line("DESCRIPTION:" + escape(e.description))
+		w.line("END:VEVENT")
+	}
+	w.line("END:VCALENDAR")
+	return w.buf.Bytes()
+}
+
+type event struct {
+	uid         string
+	start       time.Time
+	summary     string
+	description string
+}
+
+// describeMeal lists the calories and ingredients of a meal.
+func describeMeal(meal models.PlanMeal) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s, %d ккал", meal.Dish, meal.Calories)
+	if len(meal.Ingredients) > 0 {
+		b.WriteString("\nПродукты:")
+		for _, ing := range meal.Ingredients {
+			fmt.Fprintf(&b, "\n• %s — %g %s", ing.Name, ing.Amount, ing.Unit)
+		}
+	}
+	return b.String()
+}
+
+// escape escapes a TEXT value.
+func escape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`).Replace(s)
+}
+
+// writer writes CRLF-terminated content lines, folding long ones without
+// splitting a UTF-8 character.
+type writer struct {
+	buf bytes.Buffer
+}
+
+func (w *writer) line(s string) {
+	limit := maxLineOctets
+	for len(s) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(s[cut]) {
+			cut--
+		}
+		w.buf.WriteString(s[:cut] + "\r\n ")
+		s = s[cut:]
+		// Continuation lines start with a space, which counts towards the limit
+		limit = maxLineOctets - 1
+	}
+	w.buf.WriteString(s + "\r\n")
+}
@@ -0,0 +1,111 @@
+package calendar
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"diet-bot/internal/models"
+)
+
+func testData() *models.PlanData {
+	return &models.PlanData{Days: []models.PlanDay{
+		{Day: 1, Meals: []models.PlanMeal{
+			{Time: "08:00", Name: "Завтрак", Dish: "Овсянка, ягоды", Calories: 450, Ingredients: []models.Ingredient{
+				{Name: "Овсяные хлопья", Amount: 60, Unit: "г"},
+				{Name: "Черника", Amount: 100, Unit: "г"},
+			}},
+			{Time: "около обеда", Name: "Обед", Dish: "Суп"},
+		}},
+		{Day: 2, Meals: []models.PlanMeal{
+			{Time: "19:30", Name: "Ужин", Dish: "Рыба с рисом и очень длинным описанием, которое не помещается в одну строку календаря", Calories: 600},
+		}},
+	}}
+}
+
+func TestBuild(t *testing.T) {
+	moscow, _ := time.LoadLocation("Europe/Moscow")
+	ics := string(Build(testData(), Options{
+		PlanID:   7,
+		Location: moscow,
+		Start:    time.Date(2024, 3, 11, 0, 0, 0, 0, time.UTC),
+		Cycles:   4,
+		Now:      time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC),
+	}))
+	unfolded := strings.ReplaceAll(ics, "\r\n ", "")
+
+	for _, want := range []string{
+		"BEGIN:VCALENDAR\r\nVERSION:2.0\r\n",
+		"BEGIN:VTIMEZONE\r\nTZID:Europe/Moscow\r\nBEGIN:STANDARD\r\nDTSTART:19700101T000000\r\nTZOFFSETFROM:+0300\r\nTZOFFSETTO:+0300\r\n",
+		"UID:plan-7-day-1-meal-1@diet-bot\r\nDTSTAMP:20240310T120000Z\r\nDTSTART;TZID=Europe/Moscow:20240311T080000\r\nDURATION:PT30M\r\nRRULE:FREQ=DAILY;INTERVAL=2;COUNT=4\r\n",
+		`SUMMARY:Завтрак — Овсянка\, ягоды`,
+		`DESCRIPTION:Овсянка\, ягоды\, 450 ккал\nПродукты:\n• Овсяные хлопья — 60 г`,
+		"UID:plan-7-day-2-meal-1@diet-bot",
+		"DTSTART;TZID=Europe/Moscow:20240312T193000",
+		"END:VCALENDAR\r\n",
+	} {
+		if !strings.Contains(unfolded, want) {
+			t.Errorf("calendar does not contain %q:\n%s", want, ics)
+		}
+	}
+	if strings.Contains(ics, "Суп") {
+		t.Error("meal without a valid time was exported")
+	}
+	if strings.Count(ics, "BEGIN:VEVENT") != 2 {
+		t.Errorf("events: %d", strings.Count(ics, "BEGIN:VEVENT"))
+	}
+
+	for _, line := range strings.Split(strings.TrimSuffix(ics, "\r\n"), "\r\n") {
+		if len(line) > maxLineOctets {
+			t.Errorf("line of %d octets: %q", len(line), line)
+		}
+	}
+	if !strings.Contains(unfolded, "SUMMARY:Ужин — Рыба с рисом и очень длинным описанием\\, которое не помещается в одну строку календаря\r\n") {
+		t.Errorf("long summary not folded back:\n%s", unfolded)
+	}
+}
+
+func TestBuildUnbounded(t *testing.T) {
+	ics := string(Build(testData(), Options{Location: time.UTC, Start: time.Now(), Now: time.Now()}))
+	if !strings.Contains(ics, "RRULE:FREQ=DAILY;INTERVAL=2\r\n") {
+		t.Fatalf("unbounded rule missing:\n%s", ics)
+	}
+}
+
+func TestTimezoneTransitions(t *testing.T) {
+	newYork, _ := time.LoadLocation("America/New_York")
+	w := &writer{}
+	writeTimezone(w, newYork, time.Date(2024, 3, 1, 0, 0, 0, 0, newYork), time.Date(2024, 12, 1, 0, 0, 0, 0, newYork))
+	tz := w.buf.String()
+
+	for _, want := range []string{
+		"BEGIN:STANDARD\r\nDTSTART:19700101T000000\r\nTZOFFSETFROM:-0500\r\nTZOFFSETTO:-0500\r\nTZNAME:EST\r\n",
+		"BEGIN:DAYLIGHT\r\nDTSTART:20240310T020000\r\nTZOFFSETFROM:-0500\r\nTZOFFSETTO:-0400\r\nTZNAME:EDT\r\nEND:DAYLIGHT\r\n",
+		"BEGIN:STANDARD\r\nDTSTART:20241103T020000\r\nTZOFFSETFROM:-0400\r\nTZOFFSETTO:-0500\r\nTZNAME:EST\r\n",
+	} {
+		if !strings.Contains(tz, want) {
+			t.Errorf("timezone does not contain %q:\n%s", want, tz)
+		}
+	}
+}
+
+func TestFeedToken(t *testing.T) {
+	token := FeedToken("secret", 42)
+	if id, ok := ParseFeedToken("secret", token); !ok || id != 42 {
+		t.Fatalf("ParseFeedToken(%q) = %d, %v", token, id, ok)
+	}
+	for _, bad := range []string{"43" + token[2:], token + "0", "42", ""} {
+		if _, ok := ParseFeedToken("secret", bad); ok {
+			t.Errorf("ParseFeedToken accepted %q", bad)
+		}
+	}
+	if _, ok := ParseFeedToken("other", token); ok {
+		t.Error("token valid under another secret")
+	}
+	if _, ok := ParseFeedToken("", FeedToken("", 42)); ok {
+		t.Error("token valid without a secret")
+	}
+	if got := FeedURL("https://bot.example.com/", "secret", 42); got != "https://bot.example.com/calendar/"+token+".ics" {
+		t.Errorf("FeedURL = %q", got)
+	}
+}
@@ -0,0 +1,83 @@
+package calendar
+
+import (
+	"fmt"
+	"time"
+)
+
+// writeTimezone writes the VTIMEZONE of loc from the day from to the day to:
+// the offset in effect at from, then one observance per offset change.
+func writeTimezone(w *writer, loc *time.Location, from, to time.Time) {
+	w.line("BEGIN:VTIMEZONE")
+	w.line("TZID:" + loc.String())
+
+	at := from.In(loc)
+	name, offset := at.Zone()
+	writeObservance(w, at.IsDST(), time.Date(1970, 1, 1, 0, 0, 0, 0, time.UTC), offset, offset, name)
+
+	for {
+		next, ok := nextTransition(loc, at, to)
+		if !ok {
+			break
+		}
+		nextName, nextOffset := next.Zone()
+		// The onset is written in the local time of the offset it replaces
+		onset := next.UTC().Add(time.Duration(offset) * time.Second)
+		writeObservance(w, next.IsDST(), onset, offset, nextOffset, nextName)
+		at, offset = next, nextOffset
+	}
+	w.line("END:VTIMEZONE")
+}
+
+func writeObservance(w *writer, dst bool, onset time.Time, from, to int, name string) {
+	kind := "STANDARD"
+	if dst {
+		kind = "DAYLIGHT"
+	}
+	w.line("BEGIN:" + kind)
+	w.line("DTSTART:" + onset.Format("20060102T150405"))
+	w.line("TZOFFSETFROM:" + formatOffset(from))
+	w.line("TZOFFSETTO:" + formatOffset(to))
+	w.line("TZNAME:" + name)
+	w.line("END:" + kind)
+}
+
+// nextTransition finds the first offset change of loc after t and before
+// until, to the second.
+func nextTransition(loc *time.Location, t, until time.Time) (time.Time, bool) {
+	_, offset := t.In(loc).Zone()
+	changed := func(at time.Time) bool {
+		_, o := at.In(loc).Zone()
+		return o != offset
+	}
+
+	lo := t
+	for {
+		hi := lo.Add(24 * time.Hour)
+		if !hi.Before(until) {
+			return time.Time{}, false
+		}
+		if changed(hi) {
+			// The change falls within (lo, hi]
+			for hi.Sub(lo) > time.Second {
+				mid := lo.Add(hi.Sub(lo) / 2)
+				if changed(mid) {
+					hi = mid
+				} else {
+					lo = mid
+				}
+			}
+			return hi.In(loc), true
+		}
+		lo = hi
+	}
+}
+
+// formatOffset writes a UTC offset in seconds as +HHMM.
+func formatOffset(seconds int) string {
+	sign := '+'
+	if seconds < 0 {
+		sign, seconds = '-', -seconds
+	}
+	return fmt.Sprintf("%c%02d%02d", sign, seconds/3600, seconds%3600/60)
+}
@@ -0,0 +1,184 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"diet-bot/internal/models"
+)
+
+func (db *PostgresDB) SaveChatMessages(ctx context.Context, messages []*models.ChatMessage) error {
+	query := `
+        INSERT INTO chat_messages (user_id, role, content)
+        VALUES ($1, $2, $3)
+        RETURNING id, created_at
+    `
+
+	for _, msg := range messages {
+		err := db.q.QueryRow(ctx, query, msg.UserID, msg.Role, msg.Content).Scan(&msg.ID, &msg.CreatedAt)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (db *PostgresDB) ListChatMessages(ctx context.Context, userID int64, limit int) ([]*models.ChatMessage, error) {
+	query := `
+        SELECT id, user_id, role, content, created_at
+        FROM (
+            SELECT id, user_id, role, content, created_at
+            FROM chat_messages
+            WHERE user_id = $1 AND forgotten_at IS NULL
+            ORDER BY id DESC
+            LIMIT $2
+        ) latest
+        ORDER BY id
+    `
+
+	rows, err := db.q.Query(ctx, query, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var messages []*models.ChatMessage
+	for rows.Next() {
+		var msg models.ChatMessage
+		if err := rows.Scan(&msg.ID, &msg.UserID, &msg.Role, &msg.Content, &msg.CreatedAt); err != nil {
+			return nil, err
+		}
+		messages = append(messages, &msg)
+	}
+
+	return messages, rows.Err()
+}
+
+func (db *PostgresDB) CountChatMessages(ctx context.Context, userID int64, role string, since time.Time) (int, error) {
+	query := `
+        SELECT COUNT(*)
+        FROM chat_messages
+        WHERE user_id = $1 AND role = $2 AND created_at >= $3
+    `
+
+	var count int
+	err := db.q.QueryRow(ctx, query, userID, role, since).Scan(&count)
+	return count, err
+}
+
+func (db *PostgresDB) SaveQuestion(ctx context.Context, msg *models.ChatMessage, since time.Time, quota int) (int, error) {
+	var asked int
+	err := db.WithTx(ctx, func(tx Store) error {
+		// Locking the user makes concurrent questions count one after another
+		q := tx.(*PostgresDB).q
+		if _, err := q.Exec(ctx, `SELECT 1 FROM users WHERE id = $1 FOR UPDATE`, msg.UserID); err != nil {
+			return err
+		}
+
+		n, err := tx.CountChatMessages(ctx, msg.UserID, msg.Role, since)
+		if err != nil {
+			return err
+		}
+		if asked = n; asked >= quota {
+			return ErrQuotaExceeded
+		}
+		return tx.SaveChatMessages(ctx, []*models.ChatMessage{msg})
+	})
+	return asked, err
+}
+
+func (db *PostgresDB) ForgetChatMessages(ctx context.Context, userID int64) error {
+	query := `
+        UPDATE chat_messages
+        SET content = '', forgotten_at = NOW()
+        WHERE user_id = $1 AND forgotten_at IS NULL
+    `
+
+	_, err := db.q.Exec(ctx, query, userID)
+	return err
+}
+
+func (m *MemoryDB) SaveChatMessages(ctx context.Context, messages []*models.ChatMessage) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	for _, msg := range messages {
+		stored := *msg
+		stored.ID = m.nextID()
+		stored.CreatedAt = now
+		m.chatMessages = append(m.chatMessages, &stored)
+
+		msg.ID = stored.ID
+		msg.CreatedAt = now
+	}
+	return nil
+}
+
+func (m *MemoryDB) ListChatMessages(ctx context.Context, userID int64, limit int) ([]*models.ChatMessage, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var messages []*models.ChatMessage
+	for _, stored := range m.chatMessages {
+		if stored.UserID == userID && stored.ForgottenAt == nil {
+			msg := *stored
+			messages = append(messages, &msg)
+		}
+	}
+	if len(messages) > limit {
+		messages = messages[len(messages)-limit:]
+	}
+	return messages, nil
+}
+
+func (m *MemoryDB) CountChatMessages(ctx context.Context, userID int64, role string, since time.Time) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	count := 0
+	for _, stored := range m.chatMessages {
+		if stored.UserID == userID && stored.Role == role && !stored.CreatedAt.Before(since) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (m *MemoryDB) SaveQuestion(ctx context.Context, msg *models.ChatMessage, since time.Time, quota int) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	asked := 0
+	for _, stored := range m.chatMessages {
+		if stored.UserID == msg.UserID && stored.Role == msg.Role && !stored.CreatedAt.Before(since) {
+			asked++
+		}
+	}
+	if asked >= quota {
+		return asked, ErrQuotaExceeded
+	}
+
+	stored := *msg
+	stored.ID = m.nextID()
+	stored.CreatedAt = time.Now()
+	m.chatMessages = append(m.chatMessages, &stored)
+
+	msg.ID = stored.ID
+	msg.CreatedAt = stored.CreatedAt
+	return asked, nil
+}
+
+func (m *MemoryDB) ForgetChatMessages(ctx context.Context, userID int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	for _, stored := range m.chatMessages {
+		if stored.UserID == userID && stored.ForgottenAt == nil {
+			stored.Content = ""
+			stored.ForgottenAt = &now
+		}
+	}
+	return nil
+}
@@ -0,0 +1,1014 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+
+	"diet-bot/internal/models"
+	"diet-bot/migrations"
+)
+
+// storeFactory returns an empty store for one contract test.
+type storeFactory func(t *testing.T) Store
+
+func TestMemoryDBContract(t *testing.T) {
+	runStoreContract(t, func(t *testing.T) Store { return NewMemoryDB() })
+}
+
+// TestPostgresDBContract runs against TEST_DATABASE_URL, or an ephemeral
+// instance started with pg_tmp when it is installed.
+func TestPostgresDBContract(t *testing.T) {
+	databaseURL := os.Getenv("TEST_DATABASE_URL")
+	if databaseURL == "" {
+		if _, err := exec.LookPath("pg_tmp"); err != nil {
+			t.Skip("set TEST_DATABASE_URL or install pg_tmp to run Postgres contract tests")
+		}
+		out, err := exec.Command("pg_tmp").Output()
+		if err != nil {
+			t.Fatalf("pg_tmp: %v", err)
+		}
+		databaseURL = strings.TrimSpace(string(out))
+	}
+
+	database, err := NewPostgresDBFromURL(databaseURL)
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	t.Cleanup(database.Close)
+
+	all, err := LoadMigrations(migrations.FS)
+	if err != nil {
+		t.Fatalf("LoadMigrations: %v", err)
+	}
+	ctx := context.Background()
+	if _, err := database.Migrate(ctx, all); err != nil {
+		t.Fatalf("Migrate: %v", err)
+	}
+
+	runStoreContract(t, func(t *testing.T) Store {
+		_, err := database.pool.Exec(ctx, `
+            DO $$
+            DECLARE r record;
+            BEGIN
+                FOR r IN SELECT tablename FROM pg_tables
+                         WHERE schemaname = 'public' AND tablename <> 'schema_migrations'
+                LOOP
+                    EXECUTE 'TRUNCATE TABLE ' || quote_ident(r.tablename) || ' RESTART IDENTITY CASCADE';
+                END LOOP;
+            END $$
+        `)
+		if err != nil {
+			t.Fatalf("truncate: %v", err)
+		}
+		return database
+	})
+}
+
+func runStoreContract(t *testing.T, newStore storeFactory) {
+	t.Run("Users", func(t *testing.T) { testUserRepo(t, newStore(t)) })
+	t.Run("Payments", func(t *testing.T) { testPaymentRepo(t, newStore(t)) })
+	t.Run("PaymentTransitions", func(t *testing.T) { testPaymentTransitions(t, newStore(t)) })
+	t.Run("Plans", func(t *testing.T) { testPlanRepo(t, newStore(t)) })
+	t.Run("PlanRevisions", func(t *testing.T) { testPlanRevisions(t, newStore(t)) })
+	t.Run("Transactions", func(t *testing.T) { testTransactions(t, newStore(t)) })
+	t.Run("Outbox", func(t *testing.T) { testOutboxRepo(t, newStore(t)) })
+	t.Run("WeightLogs", func(t *testing.T) { testWeightRepo(t, newStore(t)) })
+	t.Run("Reminders", func(t *testing.T) { testReminderRepo(t, newStore(t)) })
+	t.Run("FoodLogs", func(t *testing.T) { testFoodRepo(t, newStore(t)) })
+	t.Run("Foods", func(t *testing.T) { testFoodSearch(t, newStore(t)) })
+	t.Run("Chat", func(t *testing.T) { testChatRepo(t, newStore(t)) })
+	t.Run("ShoppingLists", func(t *testing.T) { testShoppingRepo(t, newStore(t)) })
+	t.Run("Recipes", func(t *testing.T) { testRecipeRepo(t, newStore(t)) })
+	t.Run("WeeklyReports", func(t *testing.T) { testReportRepo(t, newStore(t)) })
+	t.Run("Water", func(t *testing.T) { testWaterRepo(t, newStore(t)) })
+	t.Run("Measurements", func(t *testing.T) { testMeasurementRepo(t, newStore(t)) })
+}
+
+func saveTestUser(t *testing.T, store Store, telegramID int64) *models.User {
+	t.Helper()
+	return saveTestUserWithWeight(t, store, telegramID, 80)
+}
+
+func saveTestUserWithWeight(t *testing.T, store Store, telegramID int64, weight float64) *models.User {
+	t.Helper()
+	user := &models.User{
+		TelegramID: telegramID,
+		ChatID:     telegramID,
+		Username:   "tester",
+		Gender:     "Мужской",
+		Height:     180,
+		Weight:     weight,
+		Goal:       "Снизить",
+	}
+	if err := store.SaveUser(context.Background(), user); err != nil {
+		t.Fatalf("SaveUser: %v", err)
+	}
+	return user
+}
+
+func saveTestPayment(t *testing.T, store Store, userID int64, sessionID string) *models.Payment {
+	t.Helper()
+	payment := &models.Payment{
+		UserID:          userID,
+		Amount:          1000,
+		Currency:        "rub",
+		StripePaymentID: sessionID,
+		Status:          models.PaymentStatusPending,
+	}
+	if err := store.SavePayment(context.Background(), payment); err != nil {
+		t.Fatalf("SavePayment: %v", err)
+	}
+	return payment
+}
+
+func testUserRepo(t *testing.T, store Store) {
+	ctx := context.Background()
+
+	if _, err := store.GetUser(ctx, 1); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("GetUser of missing user: %v", err)
+	}
+	if _, err := store.GetUserByID(ctx, 1); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("GetUserByID of missing user: %v", err)
+	}
+
+	user := saveTestUser(t, store, 1001)
+	if user.ID == 0 {
+		t.Fatal("SaveUser did not set ID")
+	}
+
+	if fresh, err := store.GetUser(ctx, 1001); err != nil || fresh.Age != 0 || len(fresh.Conditions) != 0 {
+		t.Fatalf("new user screening: %+v, %v", fresh, err)
+	}
+
+	updated := &models.User{TelegramID: 1001, ChatID: 1001, Gender: "Женский", Height: 165, Weight: 60.5, Goal: "Набрать", Age: 34, Conditions: []string{"diabetes"}}
+	if err := store.SaveUser(ctx, updated); err != nil {
+		t.Fatalf("SaveUser(update): %v", err)
+	}
+	if updated.ID != user.ID {
+		t.Fatalf("update changed ID from %d to %d", user.ID, updated.ID)
+	}
+
+	got, err := store.GetUser(ctx, 1001)
+	if err != nil {
+		t.Fatalf("GetUser: %v", err)
+	}
+	if got.Gender != "Женский" || got.Height != 165 || got.Weight != 60.5 || got.Goal != "Набрать" || got.Username != "tester" {
+		t.Fatalf("unexpected user after update: %+v", got)
+	}
+	if got.Age != 34 || !got.HasCondition("diabetes") || len(got.Conditions) != 1 {
+		t.Fatalf("screening after update = %d, %v", got.Age, got.Conditions)
+	}
+
+	// Screening answers change on their own, leaving the profile alone
+	if err := store.SetUserScreening(ctx, 1001, 35, []string{"pregnancy", "diabetes"}); err != nil {
+		t.Fatalf("SetUserScreening: %v", err)
+	}
+	if got, _ := store.GetUser(ctx, 1001); got.Age != 35 || !got.HasCondition("pregnancy") || len(got.Conditions) != 2 || got.Weight != 60.5 {
+		t.Fatalf("user after SetUserScreening: %+v", got)
+	}
+	if err := store.SetUserScreening(ctx, 9999, 35, nil); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("SetUserScreening of missing user: %v", err)
+	}
+
+	byID, err := store.GetUserByID(ctx, user.ID)
+	if err != nil || byID.TelegramID != 1001 {
+		t.Fatalf("GetUserByID: %+v, %v", byID, err)
+	}
+
+	// Users start in the default time zone until they pick one
+	if got.Timezone != models.DefaultTimezone {
+		t.Fatalf("default timezone = %q", got.Timezone)
+	}
+	if err := store.SetUserTimezone(ctx, 1001, "Asia/Novosibirsk"); err != nil {
+		t.Fatalf("SetUserTimezone: %v", err)
+	}
+	if got, _ := store.GetUser(ctx, 1001); got.Timezone != "Asia/Novosibirsk" {
+		t.Fatalf("timezone after SetUserTimezone = %q", got.Timezone)
+	}
+	if err := store.SetUserTimezone(ctx, 9999, "Asia/Tokyo"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("SetUserTimezone of missing user: %v", err)
+	}
+}
+
+func testPaymentRepo(t *testing.T, store Store) {
+	ctx := context.Background()
+	user := saveTestUser(t, store, 2001)
+
+	if _, err := store.GetPaymentByStripeID(ctx, "cs_missing"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("GetPaymentByStripeID of missing payment: %v", err)
+	}
+
+	payment := saveTestPayment(t, store, user.ID, "cs_1")
+	if payment.ID == 0 {
+		t.Fatal("SavePayment did not set ID")
+	}
+
+	got, err := store.GetPaymentByStripeID(ctx, "cs_1")
+	if err != nil || got.ID != payment.ID || got.UserID != user.ID || got.Status != models.PaymentStatusPending || got.StripePaymentIntentID != "" {
+		t.Fatalf("GetPaymentByStripeID: %+v, %v", got, err)
+	}
+
+	if _, err := store.GetPaymentByIntentID(ctx, "pi_1"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("GetPaymentByIntentID before linking: %v", err)
+	}
+	if err := store.SetPaymentIntentID(ctx, "cs_1", "pi_1"); err != nil {
+		t.Fatalf("SetPaymentIntentID: %v", err)
+	}
+	got, err = store.GetPaymentByIntentID(ctx, "pi_1")
+	if err != nil || got.ID != payment.ID {
+		t.Fatalf("GetPaymentByIntentID: %+v, %v", got, err)
+	}
+
+	got, err = store.GetPaymentByID(ctx, payment.ID)
+	if err != nil || got.StripePaymentIntentID != "pi_1" {
+		t.Fatalf("GetPaymentByID: %+v, %v", got, err)
+	}
+
+	second := saveTestPayment(t, store, user.ID, "cs_2")
+	if err := store.TransitionPaymentStatus(ctx, second, models.PaymentStatusCompleted); err != nil {
+		t.Fatalf("TransitionPaymentStatus: %v", err)
+	}
+
+	pending, err := store.ListPaymentsByStatus(ctx, models.PaymentStatusPending, time.Now().Add(time.Minute))
+	if err != nil || len(pending) != 1 || pending[0].ID != payment.ID {
+		t.Fatalf("ListPaymentsByStatus: %+v, %v", pending, err)
+	}
+	pending, err = store.ListPaymentsByStatus(ctx, models.PaymentStatusPending, time.Now().Add(-time.Hour))
+	if err != nil || len(pending) != 0 {
+		t.Fatalf("ListPaymentsByStatus before cutoff: %+v, %v", pending, err)
+	}
+}
+
+func testPaymentTransitions(t *testing.T, store Store) {
+	ctx := context.Background()
+	user := saveTestUser(t, store, 3001)
+	payment := saveTestPayment(t, store, user.ID, "cs_t")
+
+	stale := *payment
+	if err := store.TransitionPaymentStatus(ctx, payment, models.PaymentStatusCompleted); err != nil {
+		t.Fatalf("pending -> completed: %v", err)
+	}
+	if payment.Status != models.PaymentStatusCompleted {
+		t.Fatalf("status not updated on struct: %s", payment.Status)
+	}
+
+	// A second worker still holding the pending copy must lose
+	if err := store.TransitionPaymentStatus(ctx, &stale, models.PaymentStatusCompleted); !errors.Is(err, ErrInvalidTransition) {
+		t.Fatalf("stale transition: %v", err)
+	}
+
+	if err := store.TransitionPaymentStatus(ctx, payment, models.PaymentStatusPending); !errors.Is(err, ErrInvalidTransition) {
+		t.Fatalf("completed -> pending: %v", err)
+	}
+
+	payment.RefundedAmount = 50000
+	if err := store.TransitionPaymentStatus(ctx, payment, models.PaymentStatusPartiallyRefunded); err != nil {
+		t.Fatalf("completed -> partially_refunded: %v", err)
+	}
+	payment.RefundedAmount = 100000
+	if err := store.TransitionPaymentStatus(ctx, payment, models.PaymentStatusRefunded); err != nil {
+		t.Fatalf("partially_refunded -> refunded: %v", err)
+	}
+
+	got, err := store.GetPaymentByID(ctx, payment.ID)
+	if err != nil || got.Status != models.PaymentStatusRefunded || got.RefundedAmount != 100000 {
+		t.Fatalf("after refund: %+v, %v", got, err)
+	}
+}
+
+func testPlanRepo(t *testing.T, store Store) {
+	ctx := context.Background()
+	user := saveTestUser(t, store, 4001)
+
+	if _, err := store.GetDietPlan(ctx, user.ID); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("GetDietPlan without plans: %v", err)
+	}
+
+	first := saveTestPayment(t, store, user.ID, "cs_p1")
+	second := saveTestPayment(t, store, user.ID, "cs_p2")
+	for _, p := range []*models.Payment{first, second} {
+		if err := store.TransitionPaymentStatus(ctx, p, models.PaymentStatusCompleted); err != nil {
+			t.Fatalf("complete payment: %v", err)
+		}
+	}
+
+	old := &models.DietPlan{
+		UserID:           user.ID,
+		PaymentID:        first.ID,
+		PlanText:         "old plan",
+		Profile:          models.NewProfileSnapshot(user),
+		PromptVersion:    "diet-plan-v1",
+		Model:            "gpt-4-0613",
+		PromptTokens:     120,
+		CompletionTokens: 900,
+	}
+	if err := store.SaveDietPlan(ctx, old); err != nil || old.ID == 0 {
+		t.Fatalf("SaveDietPlan: %v", err)
+	}
+
+	// Later profile edits must not leak into the stored snapshot
+	saveTestUserWithWeight(t, store, 4001, 75)
+	latest := &models.DietPlan{UserID: user.ID, PaymentID: second.ID, PlanText: "new plan"}
+	if err := store.SaveDietPlan(ctx, latest); err != nil {
+		t.Fatalf("SaveDietPlan: %v", err)
+	}
+
+	got, err := store.GetDietPlan(ctx, user.ID)
+	if err != nil || got.ID != latest.ID || got.PlanText != "new plan" {
+		t.Fatalf("GetDietPlan: %+v, %v", got, err)
+	}
+
+	history, err := store.ListDietPlans(ctx, user.ID, 10)
+	if err != nil || len(history) != 2 || history[0].ID != latest.ID || history[1].ID != old.ID {
+		t.Fatalf("ListDietPlans: %+v, %v", history, err)
+	}
+	if p := history[1]; p.Profile.Weight != 80 || p.Profile.Goal != "Снизить" || p.Model != "gpt-4-0613" ||
+		p.PromptVersion != "diet-plan-v1" || p.PromptTokens != 120 || p.CompletionTokens != 900 {
+		t.Fatalf("plan metadata not preserved: %+v", p)
+	}
+	if !history[0].Profile.IsEmpty() {
+		t.Fatalf("plan saved without snapshot has profile %+v", history[0].Profile)
+	}
+	if limited, err := store.ListDietPlans(ctx, user.ID, 1); err != nil || len(limited) != 1 || limited[0].ID != latest.ID {
+		t.Fatalf("ListDietPlans with limit: %+v, %v", limited, err)
+	}
+
+	// Refunding the latest purchase falls back to the previous plan
+	if err := store.TransitionPaymentStatus(ctx, second, models.PaymentStatusRefunded); err != nil {
+		t.Fatalf("refund: %v", err)
+	}
+	got, err = store.GetDietPlan(ctx, user.ID)
+	if err != nil || got.ID != old.ID {
+		t.Fatalf("GetDietPlan after refund: %+v, %v", got, err)
+	}
+
+	if got, err := store.GetDietPlanByID(ctx, old.ID); err != nil || got.PlanText != "old plan" || got.UserID != user.ID {
+		t.Fatalf("GetDietPlanByID: %+v, %v", got, err)
+	}
+	if _, err := store.GetDietPlanByID(ctx, latest.ID); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("GetDietPlanByID(refunded) = %v, want ErrNotFound", err)
+	}
+}
+
+func testPlanRevisions(t *testing.T, store Store) {
+	ctx := context.Background()
+	user := saveTestUser(t, store, 4101)
+	payment := saveTestPayment(t, store, user.ID, "cs_rev")
+	if err := store.TransitionPaymentStatus(ctx, payment, models.PaymentStatusCompleted); err != nil {
+		t.Fatalf("complete payment: %v", err)
+	}
+
+	data := &models.PlanData{
+		DailyCalories: 2000,
+		Days: []models.PlanDay{{Day: 1, Meals: []models.PlanMeal{{
+			Time: "08:00", Name: "Завтрак", Dish: "Овсянка", Calories: 350,
+			Ingredients: []models.Ingredient{{Name: "овсяные хлопья", Amount: 60, Unit: "г"}},
+		}}}},
+	}
+	if ok, err := store.HasDietPlan(ctx, payment.ID); err != nil || ok {
+		t.Fatalf("HasDietPlan before saving: %v, %v", ok, err)
+	}
+	original := &models.DietPlan{UserID: user.ID, PaymentID: payment.ID, PlanText: "v1", Data: data}
+	if err := store.SaveDietPlan(ctx, original); err != nil {
+		t.Fatalf("SaveDietPlan: %v", err)
+	}
+	if ok, err := store.HasDietPlan(ctx, payment.ID); err != nil || !ok {
+		t.Fatalf("HasDietPlan: %v, %v", ok, err)
+	}
+	data.Days[0].Meals[0].Dish = "changed after save"
+
+	if n, err := store.CountPlanRevisions(ctx, payment.ID); err != nil || n != 0 {
+		t.Fatalf("CountPlanRevisions before revisions: %d, %v", n, err)
+	}
+	revision := &models.DietPlan{UserID: user.ID, PaymentID: payment.ID, PlanText: "v2", ParentID: original.ID, Revision: models.RevisionDay}
+	if err := store.SaveDietPlan(ctx, revision); err != nil {
+		t.Fatalf("SaveDietPlan(revision): %v", err)
+	}
+	if n, err := store.CountPlanRevisions(ctx, payment.ID); err != nil || n != 1 {
+		t.Fatalf("CountPlanRevisions: %d, %v", n, err)
+	}
+	adapted := &models.DietPlan{UserID: user.ID, PaymentID: payment.ID, PlanText: "v3", ParentID: revision.ID, Revision: models.RevisionAdapt}
+	if err := store.SaveDietPlan(ctx, adapted); err != nil {
+		t.Fatalf("SaveDietPlan(adapted): %v", err)
+	}
+	if n, err := store.CountPlanRevisions(ctx, payment.ID); err != nil || n != 1 {
+		t.Fatalf("CountPlanRevisions counts adaptations: %d, %v", n, err)
+	}
+
+	history, err := store.ListDietPlans(ctx, user.ID, 10)
+	if err != nil || len(history) != 3 {
+		t.Fatalf("ListDietPlans: %+v, %v", history, err)
+	}
+	history = history[1:]
+	if got := history[0]; got.ParentID != original.ID || got.Revision != models.RevisionDay || got.Data != nil {
+		t.Fatalf("revision: %+v", got)
+	}
+	got := history[1]
+	if got.ParentID != 0 || got.Revision != "" || got.Data == nil {
+		t.Fatalf("original: %+v", got)
+	}
+	meal := got.Data.Days[0].Meals[0]
+	if meal.Dish != "Овсянка" || meal.Ingredients[0].Amount != 60 || got.Data.DailyCalories != 2000 {
+		t.Fatalf("plan data not preserved: %+v", got.Data)
+	}
+}
+
+func testTransactions(t *testing.T, store Store) {
+	ctx := context.Background()
+	errAbort := errors.New("abort")
+
+	err := store.WithTx(ctx, func(tx Store) error {
+		user := saveTestUser(t, tx, 5001)
+		saveTestPayment(t, tx, user.ID, "cs_rolled_back")
+		return errAbort
+	})
+	if !errors.Is(err, errAbort) {
+		t.Fatalf("WithTx returned %v", err)
+	}
+	if _, err := store.GetUser(ctx, 5001); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("user survived rollback: %v", err)
+	}
+	if _, err := store.GetPaymentByStripeID(ctx, "cs_rolled_back"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("payment survived rollback: %v", err)
+	}
+
+	err = store.WithTx(ctx, func(tx Store) error {
+		user := saveTestUser(t, tx, 5002)
+		saveTestPayment(t, tx, user.ID, "cs_committed")
+
+		// A failed nested unit of work only undoes its own writes
+		nested := tx.WithTx(ctx, func(tx Store) error {
+			saveTestPayment(t, tx, user.ID, "cs_nested")
+			return errAbort
+		})
+		if !errors.Is(nested, errAbort) {
+			t.Fatalf("nested WithTx returned %v", nested)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("WithTx: %v", err)
+	}
+	if _, err := store.GetUser(ctx, 5002); err != nil {
+		t.Fatalf("GetUser after commit: %v", err)
+	}
+	if _, err := store.GetPaymentByStripeID(ctx, "cs_committed"); err != nil {
+		t.Fatalf("GetPaymentByStripeID after commit: %v", err)
+	}
+	if _, err := store.GetPaymentByStripeID(ctx, "cs_nested"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("nested payment survived its rollback: %v", err)
+	}
+}
+
+func testOutboxRepo(t *testing.T, store Store) {
+	ctx := context.Background()
+
+	events, err := store.ClaimOutboxEvents(ctx, 10, time.Minute)
+	if err != nil || len(events) != 0 {
+		t.Fatalf("ClaimOutboxEvents on empty outbox: %+v, %v", events, err)
+	}
+
+	var ids []int64
+	for _, topic := range []string{"first", "second"} {
+		event := &models.OutboxEvent{Topic: topic, Payload: json.RawMessage(`{"n":1}`)}
+		if err := store.AddOutboxEvent(ctx, event); err != nil || event.ID == 0 {
+			t.Fatalf("AddOutboxEvent: %v", err)
+		}
+		ids = append(ids, event.ID)
+	}
+
+	events, err = store.ClaimOutboxEvents(ctx, 10, time.Minute)
+	if err != nil || len(events) != 2 || events[0].ID != ids[0] || events[1].Topic != "second" {
+		t.Fatalf("ClaimOutboxEvents: %+v, %v", events, err)
+	}
+	var payload map[string]int
+	if err := json.Unmarshal(events[0].Payload, &payload); err != nil || payload["n"] != 1 {
+		t.Fatalf("payload = %s, %v", events[0].Payload, err)
+	}
+
+	// Leased events are invisible to other dispatchers
+	if again, err := store.ClaimOutboxEvents(ctx, 10, time.Minute); err != nil || len(again) != 0 {
+		t.Fatalf("claimed leased events: %+v, %v", again, err)
+	}
+
+	if err := store.MarkOutboxEventProcessed(ctx, ids[0]); err != nil {
+		t.Fatalf("MarkOutboxEventProcessed: %v", err)
+	}
+	if err := store.MarkOutboxEventFailed(ctx, ids[1], "boom"); err != nil {
+		t.Fatalf("MarkOutboxEventFailed: %v", err)
+	}
+
+	events, err = store.ClaimOutboxEvents(ctx, 10, time.Minute)
+	if err != nil || len(events) != 1 || events[0].ID != ids[1] || events[0].Attempts != 1 || events[0].LastError != "boom" {
+		t.Fatalf("ClaimOutboxEvents after failure: %+v, %v", events, err)
+	}
+
+	if err := store.MarkOutboxEventProcessed(ctx, -1); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("MarkOutboxEventProcessed of missing event: %v", err)
+	}
+}
+
+func testWeightRepo(t *testing.T, store Store) {
+	ctx := context.Background()
+	user := saveTestUser(t, store, 6001)
+	other := saveTestUser(t, store, 6002)
+
+	if _, err := store.GetLatestWeightLog(ctx, user.ID); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("GetLatestWeightLog without logs: %v", err)
+	}
+
+	day := time.Date(2024, 3, 10, 0, 0, 0, 0, time.UTC)
+	for i, weight := range []float64{80.2, 79.8, 79.5} {
+		log := &models.WeightLog{UserID: user.ID, Weight: weight, LoggedOn: day.AddDate(0, 0, i*2)}
+		if err := store.SaveWeightLog(ctx, log); err != nil || log.ID == 0 {
+			t.Fatalf("SaveWeightLog: %v", err)
+		}
+	}
+	if err := store.SaveWeightLog(ctx, &models.WeightLog{UserID: other.ID, Weight: 60, LoggedOn: day}); err != nil {
+		t.Fatalf("SaveWeightLog: %v", err)
+	}
+
+	// A second entry for the same day replaces the first
+	fix := &models.WeightLog{UserID: user.ID, Weight: 79.9, LoggedOn: day.AddDate(0, 0, 2)}
+	if err := store.SaveWeightLog(ctx, fix); err != nil {
+		t.Fatalf("SaveWeightLog(replace): %v", err)
+	}
+
+	logs, err := store.ListWeightLogs(ctx, user.ID, day.AddDate(0, 0, 1))
+	if err != nil || len(logs) != 2 {
+		t.Fatalf("ListWeightLogs: %+v, %v", logs, err)
+	}
+	if logs[0].Weight != 79.9 || !logs[0].LoggedOn.Equal(day.AddDate(0, 0, 2)) || logs[0].ID != fix.ID || logs[1].Weight != 79.5 {
+		t.Fatalf("unexpected logs: %+v %+v", logs[0], logs[1])
+	}
+
+	latest, err := store.GetLatestWeightLog(ctx, user.ID)
+	if err != nil || latest.Weight != 79.5 || !latest.LoggedOn.Equal(day.AddDate(0, 0, 4)) {
+		t.Fatalf("GetLatestWeightLog: %+v, %v", latest, err)
+	}
+}
+
+func testReminderRepo(t *testing.T, store Store) {
+	ctx := context.Background()
+	user := saveTestUser(t, store, 7001)
+	other := saveTestUser(t, store, 7002)
+	now := time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)
+
+	water := &models.Reminder{UserID: user.ID, Kind: models.ReminderWater, Rule: "0 10 * * *", Timezone: "UTC", Enabled: true, NextRunAt: now.Add(-time.Minute)}
+	meal := &models.Reminder{UserID: user.ID, Kind: models.ReminderMeal, Rule: "0 9 * * *", Timezone: "UTC", Enabled: true, NextRunAt: now.Add(time.Hour)}
+	blocked := &models.Reminder{UserID: other.ID, Kind: models.ReminderWater, Rule: "0 9 * * *", Timezone: "UTC", Enabled: true, NextRunAt: now.Add(-time.Hour)}
+	for _, r := range []*models.Reminder{water, meal, blocked} {
+		if err := store.SaveReminder(ctx, r); err != nil || r.ID == 0 {
+			t.Fatalf("SaveReminder: %v", err)
+		}
+	}
+
+	// Saving the same kind again replaces the reminder
+	replaced := &models.Reminder{UserID: user.ID, Kind: models.ReminderWater, Rule: "0 11 * * *", Timezone: "Europe/Moscow", Enabled: true, NextRunAt: now.Add(-time.Minute)}
+	if err := store.SaveReminder(ctx, replaced); err != nil || replaced.ID != water.ID {
+		t.Fatalf("SaveReminder(replace): id %d, %v", replaced.ID, err)
+	}
+
+	list, err := store.ListReminders(ctx, user.ID)
+	if err != nil || len(list) != 2 || list[0].Kind != models.ReminderMeal || list[1].Rule != "0 11 * * *" || list[1].ChatID != 7001 {
+		t.Fatalf("ListReminders: %+v, %v", list, err)
+	}
+
+	if err := store.SetUserBlocked(ctx, 7002, true); err != nil {
+		t.Fatalf("SetUserBlocked: %v", err)
+	}
+	if u, err := store.GetUser(ctx, 7002); err != nil || u.BlockedAt == nil {
+		t.Fatalf("blocked user: %+v, %v", u, err)
+	}
+
+	due, err := store.ClaimDueReminders(ctx, now, 10)
+	if err != nil || len(due) != 1 || due[0].ID != water.ID || due[0].TelegramID != 7001 || due[0].Timezone != "Europe/Moscow" {
+		t.Fatalf("ClaimDueReminders: %+v, %v", due, err)
+	}
+
+	next := now.Add(24 * time.Hour)
+	if err := store.RescheduleReminder(ctx, water.ID, next, &now); err != nil {
+		t.Fatalf("RescheduleReminder: %v", err)
+	}
+	if due, err := store.ClaimDueReminders(ctx, now, 10); err != nil || len(due) != 0 {
+		t.Fatalf("ClaimDueReminders after reschedule: %+v, %v", due, err)
+	}
+
+	if err := store.SetUserBlocked(ctx, 7002, false); err != nil {
+		t.Fatalf("SetUserBlocked(false): %v", err)
+	}
+	due, err = store.ClaimDueReminders(ctx, now, 10)
+	if err != nil || len(due) != 1 || due[0].ID != blocked.ID {
+		t.Fatalf("ClaimDueReminders after unblock: %+v, %v", due, err)
+	}
+
+	list, _ = store.ListReminders(ctx, user.ID)
+	if r := list[1]; !r.NextRunAt.Equal(next) || r.LastSentAt == nil || !r.LastSentAt.Equal(now) {
+		t.Fatalf("rescheduled reminder: %+v", r)
+	}
+
+	if err := store.RescheduleReminder(ctx, -1, next, nil); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("RescheduleReminder of missing reminder: %v", err)
+	}
+}
+
+func testFoodRepo(t *testing.T, store Store) {
+	ctx := context.Background()
+	user := saveTestUser(t, store, 8001)
+	other := saveTestUser(t, store, 8002)
+	day := time.Date(2024, 3, 10, 0, 0, 0, 0, time.UTC)
+
+	logs := []*models.FoodLog{
+		{UserID: user.ID, LoggedOn: day.AddDate(0, 0, 1), Name: "банан", Grams: 120, Calories: 107, Protein: 1.3, Fat: 0.4, Carbs: 27, Source: models.FoodSourceLLM},
+		{UserID: user.ID, LoggedOn: day, Name: "овсянка", Grams: 60, Calories: 213, Protein: 7.4, Fat: 3.7, Carbs: 36.5, Source: models.FoodSourceLLM},
+		{UserID: user.ID, LoggedOn: day.AddDate(0, 0, 3), Name: "творог", Grams: 200, Calories: 242, Protein: 34, Fat: 10, Carbs: 6, Source: models.FoodSourceLLM},
+		{UserID: other.ID, LoggedOn: day, Name: "кофе", Grams: 200, Calories: 4, Source: models.FoodSourceLLM},
+	}
+	if err := store.SaveFoodLogs(ctx, logs); err != nil {
+		t.Fatalf("SaveFoodLogs: %v", err)
+	}
+	for _, log := range logs {
+		if log.ID == 0 || log.CreatedAt.IsZero() {
+			t.Fatalf("SaveFoodLogs did not set ID and CreatedAt: %+v", log)
+		}
+	}
+
+	got, err := store.ListFoodLogs(ctx, user.ID, day, day.AddDate(0, 0, 1))
+	if err != nil || len(got) != 2 {
+		t.Fatalf("ListFoodLogs: %+v, %v", got, err)
+	}
+	if got[0].Name != "овсянка" || got[0].Protein != 7.4 || !got[0].LoggedOn.Equal(day) || got[1].Name != "банан" || got[1].Grams != 120 {
+		t.Fatalf("unexpected logs: %+v %+v", got[0], got[1])
+	}
+}
+
+func testFoodSearch(t *testing.T, store Store) {
+	ctx := context.Background()
+
+	foods := []*models.Food{
+		{Source: "test", ExternalID: "1", Name: "Бананы", Calories: 96, Protein: 1.5, Fat: 0.2, Carbs: 21},
+		{Source: "test", ExternalID: "2", Name: "Творог 5%", Calories: 121, Protein: 17.2, Fat: 5, Carbs: 1.8},
+		{Source: "test", ExternalID: "3", Name: "Хлопья овсяные Геркулес", Calories: 352, Protein: 12.3, Fat: 6.2, Carbs: 61.8},
+		{Source: "test", ExternalID: "4", Name: "Сок банановый", Calories: 48, Carbs: 12},
+	}
+	if err := store.UpsertFoods(ctx, foods); err != nil {
+		t.Fatalf("UpsertFoods: %v", err)
+	}
+
+	// Re-importing a food updates it in place
+	fix := &models.Food{Source: "test", ExternalID: "2", Name: "Творог 5%", Calories: 121, Protein: 17.2, Fat: 5, Carbs: 3}
+	if err := store.UpsertFoods(ctx, []*models.Food{fix}); err != nil || fix.ID != foods[1].ID {
+		t.Fatalf("UpsertFoods(replace): id %d, %v", fix.ID, err)
+	}
+
+	matches, err := store.SearchFoods(ctx, "банан", 5)
+	if err != nil || len(matches) == 0 {
+		t.Fatalf("SearchFoods(банан): %+v, %v", matches, err)
+	}
+	if matches[0].Name != "Бананы" || matches[0].Score < 0.5 {
+		t.Fatalf("best match for банан: %+v", matches[0])
+	}
+
+	matches, err = store.SearchFoods(ctx, "творог", 5)
+	if err != nil || len(matches) != 1 || matches[0].Carbs != 3 {
+		t.Fatalf("SearchFoods(творог): %+v, %v", matches, err)
+	}
+
+	// A query word inside a longer name is found by the full-text match
+	matches, err = store.SearchFoods(ctx, "геркулес", 5)
+	if err != nil || len(matches) != 1 || matches[0].ExternalID != "3" {
+		t.Fatalf("SearchFoods(геркулес): %+v, %v", matches, err)
+	}
+
+	if matches, err := store.SearchFoods(ctx, "шоколад", 5); err != nil || len(matches) != 0 {
+		t.Fatalf("SearchFoods(шоколад): %+v, %v", matches, err)
+	}
+}
+
+func testChatRepo(t *testing.T, store Store) {
+	ctx := context.Background()
+	user := saveTestUser(t, store, 9001)
+	other := saveTestUser(t, store, 9002)
+	before := time.Now().Add(-time.Minute)
+
+	var messages []*models.ChatMessage
+	for i, content := range []string{"чем заменить творог?", "Греческим йогуртом.", "а рыбу?", "Курицей."} {
+		role := models.ChatRoleUser
+		if i%2 == 1 {
+			role = models.ChatRoleAssistant
+		}
+		messages = append(messages, &models.ChatMessage{UserID: user.ID, Role: role, Content: content})
+	}
+	messages = append(messages, &models.ChatMessage{UserID: other.ID, Role: models.ChatRoleUser, Content: "привет"})
+	if err := store.SaveChatMessages(ctx, messages); err != nil {
+		t.Fatalf("SaveChatMessages: %v", err)
+	}
+	if messages[0].ID == 0 || messages[0].CreatedAt.IsZero() {
+		t.Fatalf("SaveChatMessages did not set ID and CreatedAt: %+v", messages[0])
+	}
+
+	got, err := store.ListChatMessages(ctx, user.ID, 3)
+	if err != nil || len(got) != 3 {
+		t.Fatalf("ListChatMessages: %+v, %v", got, err)
+	}
+	if got[0].Content != "Греческим йогуртом." || got[2].Content != "Курицей." || got[2].Role != models.ChatRoleAssistant {
+		t.Fatalf("unexpected messages: %+v %+v %+v", got[0], got[1], got[2])
+	}
+
+	count, err := store.CountChatMessages(ctx, user.ID, models.ChatRoleUser, before)
+	if err != nil || count != 2 {
+		t.Fatalf("CountChatMessages: %d, %v", count, err)
+	}
+	if count, _ := store.CountChatMessages(ctx, user.ID, models.ChatRoleUser, time.Now().Add(time.Minute)); count != 0 {
+		t.Fatalf("CountChatMessages(future) = %d", count)
+	}
+
+	if err := store.ForgetChatMessages(ctx, user.ID); err != nil {
+		t.Fatalf("ForgetChatMessages: %v", err)
+	}
+	if got, _ := store.ListChatMessages(ctx, user.ID, 10); len(got) != 0 {
+		t.Fatalf("messages left after forgetting: %+v", got)
+	}
+	// Forgotten questions still count towards the quota
+	if count, _ := store.CountChatMessages(ctx, user.ID, models.ChatRoleUser, before); count != 2 {
+		t.Fatalf("CountChatMessages after forgetting = %d", count)
+	}
+	if got, _ := store.ListChatMessages(ctx, other.ID, 10); len(got) != 1 {
+		t.Fatalf("other user's messages: %+v", got)
+	}
+
+	question := &models.ChatMessage{UserID: user.ID, Role: models.ChatRoleUser, Content: "а на ужин?"}
+	if asked, err := store.SaveQuestion(ctx, question, before, 3); err != nil || asked != 2 || question.ID == 0 {
+		t.Fatalf("SaveQuestion: %d, %v, %+v", asked, err, question)
+	}
+	over := &models.ChatMessage{UserID: user.ID, Role: models.ChatRoleUser, Content: "а завтра?"}
+	if asked, err := store.SaveQuestion(ctx, over, before, 3); !errors.Is(err, ErrQuotaExceeded) || asked != 3 {
+		t.Fatalf("SaveQuestion over the quota: %d, %v", asked, err)
+	}
+	if count, _ := store.CountChatMessages(ctx, user.ID, models.ChatRoleUser, before); count != 3 {
+		t.Fatalf("CountChatMessages after the quota = %d", count)
+	}
+}
+
+func testShoppingRepo(t *testing.T, store Store) {
+	ctx := context.Background()
+	user := saveTestUser(t, store, 9101)
+	payment := saveTestPayment(t, store, user.ID, "cs_shopping")
+	plan := &models.DietPlan{UserID: user.ID, PaymentID: payment.ID, PlanText: "plan"}
+	if err := store.SaveDietPlan(ctx, plan); err != nil {
+		t.Fatalf("SaveDietPlan: %v", err)
+	}
+
+	list := &models.ShoppingList{UserID: user.ID, PlanID: plan.ID, FirstDay: 1, LastDay: 3, Items: []models.ShoppingItem{
+		{Position: 1, Name: "Черника", Amount: 100, Unit: "г", Section: "фрукты"},
+		{Position: 2, Name: "Молоко", Amount: 450, Unit: "мл", Section: "молочное"},
+		{Position: 3, Name: "Яйцо", Amount: 2.5, Unit: "шт", Section: "молочное"},
+	}}
+	if err := store.SaveShoppingList(ctx, list); err != nil {
+		t.Fatalf("SaveShoppingList: %v", err)
+	}
+	if list.ID == 0 || list.CreatedAt.IsZero() {
+		t.Fatalf("SaveShoppingList did not set ID and CreatedAt: %+v", list)
+	}
+
+	if err := store.ToggleShoppingItem(ctx, list.ID, 2); err != nil {
+		t.Fatalf("ToggleShoppingItem: %v", err)
+	}
+	if err := store.ToggleShoppingItem(ctx, list.ID, 4); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("ToggleShoppingItem(missing) = %v, want ErrNotFound", err)
+	}
+
+	got, err := store.GetShoppingList(ctx, list.ID)
+	if err != nil {
+		t.Fatalf("GetShoppingList: %v", err)
+	}
+	if got.UserID != user.ID || got.PlanID != plan.ID || got.FirstDay != 1 || got.LastDay != 3 || len(got.Items) != 3 {
+		t.Fatalf("GetShoppingList = %+v", got)
+	}
+	if got.Items[0].Checked || !got.Items[1].Checked || got.Items[2].Amount != 2.5 || got.Items[2].Name != "Яйцо" {
+		t.Fatalf("items: %+v", got.Items)
+	}
+
+	// Ticking twice brings the item back
+	if err := store.ToggleShoppingItem(ctx, list.ID, 2); err != nil {
+		t.Fatalf("ToggleShoppingItem: %v", err)
+	}
+	if got, _ := store.GetShoppingList(ctx, list.ID); got.Items[1].Checked {
+		t.Fatalf("item still checked: %+v", got.Items[1])
+	}
+
+	if _, err := store.GetShoppingList(ctx, list.ID+1000); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("GetShoppingList(missing) = %v, want ErrNotFound", err)
+	}
+}
+
+func testRecipeRepo(t *testing.T, store Store) {
+	ctx := context.Background()
+	key := models.RecipeCacheKey("Курица с гречкой", []string{"дешевле", "быстрее"})
+
+	if _, err := store.GetRecipe(ctx, key); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("GetRecipe before save = %v, want ErrNotFound", err)
+	}
+
+	recipe := &models.Recipe{
+		CacheKey:     key,
+		Dish:         "Курица с гречкой",
+		Restrictions: []string{"дешевле", "быстрее"},
+		Data: models.RecipeData{
+			PrepMinutes: 30,
+			Ingredients: []models.Ingredient{{Name: "Куриное филе", Amount: 150, Unit: "г"}},
+			Steps:       []string{"Отварите гречку.", "Обжарьте курицу."},
+			Calories:    520, Protein: 45, Fat: 12.5, Carbs: 55,
+		},
+		Model:        "gpt-4o",
+		PromptTokens: 200, CompletionTokens: 300,
+	}
+	if err := store.SaveRecipe(ctx, recipe); err != nil || recipe.ID == 0 || recipe.CreatedAt.IsZero() {
+		t.Fatalf("SaveRecipe: %+v, %v", recipe, err)
+	}
+	recipe.Data.Steps[0] = "changed after save"
+
+	got, err := store.GetRecipe(ctx, key)
+	if err != nil {
+		t.Fatalf("GetRecipe: %v", err)
+	}
+	if got.ID != recipe.ID || got.Dish != "Курица с гречкой" || len(got.Restrictions) != 2 || got.Model != "gpt-4o" || got.CompletionTokens != 300 {
+		t.Fatalf("GetRecipe = %+v", got)
+	}
+	if d := got.Data; d.PrepMinutes != 30 || d.Steps[0] != "Отварите гречку." || d.Ingredients[0].Amount != 150 || d.Fat != 12.5 {
+		t.Fatalf("recipe data not preserved: %+v", d)
+	}
+
+	// A second recipe under the same key keeps the first
+	duplicate := &models.Recipe{CacheKey: key, Dish: "другое", Data: models.RecipeData{Steps: []string{"другое"}}}
+	if err := store.SaveRecipe(ctx, duplicate); err != nil || duplicate.ID != recipe.ID {
+		t.Fatalf("SaveRecipe(duplicate): %+v, %v", duplicate, err)
+	}
+	if got, _ := store.GetRecipe(ctx, key); got.Dish != "Курица с гречкой" {
+		t.Fatalf("duplicate replaced the recipe: %+v", got)
+	}
+}
+
+func testReportRepo(t *testing.T, store Store) {
+	ctx := context.Background()
+
+	subscribe := func(telegramID int64, status string) *models.User {
+		user := saveTestUser(t, store, telegramID)
+		payment := saveTestPayment(t, store, user.ID, fmt.Sprintf("cs_report_%d", telegramID))
+		if err := store.TransitionPaymentStatus(ctx, payment, models.PaymentStatusCompleted); err != nil {
+			t.Fatalf("complete payment: %v", err)
+		}
+		if status != models.PaymentStatusCompleted {
+			if err := store.TransitionPaymentStatus(ctx, payment, status); err != nil {
+				t.Fatalf("transition payment: %v", err)
+			}
+		}
+		if err := store.SaveDietPlan(ctx, &models.DietPlan{UserID: user.ID, PaymentID: payment.ID, PlanText: "plan"}); err != nil {
+			t.Fatalf("SaveDietPlan: %v", err)
+		}
+		return user
+	}
+	subscriber := subscribe(9201, models.PaymentStatusCompleted)
+	subscribe(9202, models.PaymentStatusRefunded)
+	subscribe(9203, models.PaymentStatusCompleted)
+	if err := store.SetUserBlocked(ctx, 9203, true); err != nil {
+		t.Fatalf("SetUserBlocked: %v", err)
+	}
+	saveTestUser(t, store, 9204)
+
+	users, err := store.ListSubscribers(ctx)
+	if err != nil || len(users) != 1 || users[0].ID != subscriber.ID {
+		t.Fatalf("ListSubscribers: %+v, %v", users, err)
+	}
+
+	plan, _ := store.GetDietPlan(ctx, subscriber.ID)
+	week := time.Date(2024, 3, 4, 0, 0, 0, 0, time.UTC)
+	report := &models.WeeklyReport{
+		UserID: subscriber.ID, PlanID: plan.ID, WeekStart: week, Verdict: "stalled",
+		WeeklyRate: -0.05, TargetCalories: 2080, ProposedCalories: 1930,
+	}
+	if claimed, err := store.ClaimWeeklyReport(ctx, report); err != nil || !claimed || report.ID == 0 {
+		t.Fatalf("ClaimWeeklyReport: %v, %v, %+v", claimed, err, report)
+	}
+	again := &models.WeeklyReport{UserID: subscriber.ID, PlanID: plan.ID, WeekStart: week, Verdict: "on_track", TargetCalories: 2080}
+	if claimed, err := store.ClaimWeeklyReport(ctx, again); err != nil || claimed {
+		t.Fatalf("ClaimWeeklyReport(same week): %v, %v", claimed, err)
+	}
+
+	got, err := store.GetWeeklyReport(ctx, report.ID)
+	if err != nil {
+		t.Fatalf("GetWeeklyReport: %v", err)
+	}
+	if got.UserID != subscriber.ID || got.PlanID != plan.ID || !got.WeekStart.Equal(week) || got.Verdict != "stalled" ||
+		got.WeeklyRate != -0.05 || got.TargetCalories != 2080 || got.ProposedCalories != 1930 {
+		t.Fatalf("GetWeeklyReport = %+v", got)
+	}
+	if _, err := store.GetWeeklyReport(ctx, report.ID+1000); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("GetWeeklyReport(missing) = %v, want ErrNotFound", err)
+	}
+}
+
+func testWaterRepo(t *testing.T, store Store) {
+	ctx := context.Background()
+	user := saveTestUser(t, store, 9301)
+	other := saveTestUser(t, store, 9302)
+	day := time.Date(2024, 3, 10, 0, 0, 0, 0, time.UTC)
+
+	if total, err := store.GetWater(ctx, user.ID, day); err != nil || total != 0 {
+		t.Fatalf("GetWater without logs = %d, %v", total, err)
+	}
+	for i, want := range []int{250, 750, 1000} {
+		total, err := store.AddWater(ctx, user.ID, day, []int{250, 500, 250}[i])
+		if err != nil || total != want {
+			t.Fatalf("AddWater #%d = %d, %v; want %d", i, total, err, want)
+		}
+	}
+	if _, err := store.AddWater(ctx, other.ID, day, 500); err != nil {
+		t.Fatalf("AddWater(other): %v", err)
+	}
+	if _, err := store.AddWater(ctx, user.ID, day.AddDate(0, 0, 1), 300); err != nil {
+		t.Fatalf("AddWater(next day): %v", err)
+	}
+
+	// Taking away more than was drunk stops at zero
+	if total, err := store.AddWater(ctx, user.ID, day, -250); err != nil || total != 750 {
+		t.Fatalf("AddWater(-250) = %d, %v", total, err)
+	}
+	if total, err := store.AddWater(ctx, user.ID, day, -1000); err != nil || total != 0 {
+		t.Fatalf("AddWater(-1000) = %d, %v", total, err)
+	}
+	if total, err := store.AddWater(ctx, user.ID, day.AddDate(0, 0, 2), -250); err != nil || total != 0 {
+		t.Fatalf("AddWater(-250) on a new day = %d, %v", total, err)
+	}
+
+	for _, c := range []struct {
+		userID int64
+		day    time.Time
+		want   int
+	}{{user.ID, day, 0}, {user.ID, day.AddDate(0, 0, 1), 300}, {other.ID, day, 500}} {
+		if total, err := store.GetWater(ctx, c.userID, c.day); err != nil || total != c.want {
+			t.Errorf("GetWater(%d, %s) = %d, %v; want %d", c.userID, c.day.Format("2006-01-02"), total, err, c.want)
+		}
+	}
+}
+
+func testMeasurementRepo(t *testing.T, store Store) {
+	ctx := context.Background()
+	user := saveTestUser(t, store, 9401)
+	other := saveTestUser(t, store, 9402)
+	day := time.Date(2024, 3, 10, 0, 0, 0, 0, time.UTC)
+
+	for i, waist := range []float64{90, 88.5, 87} {
+		m := &models.Measurement{UserID: user.ID, Waist: waist, Neck: 39, Weight: 80, BodyFat: 20 - float64(i), LoggedOn: day.AddDate(0, 0, i*7)}
+		if err := store.SaveMeasurement(ctx, m); err != nil || m.ID == 0 {
+			t.Fatalf("SaveMeasurement: %v", err)
+		}
+	}
+	if err := store.SaveMeasurement(ctx, &models.Measurement{UserID: other.ID, Hip: 100, Weight: 60, LoggedOn: day}); err != nil {
+		t.Fatalf("SaveMeasurement: %v", err)
+	}
+
+	// A second set for the same day updates the first; sizes left out keep their values
+	fix := &models.Measurement{UserID: user.ID, Waist: 88, Chest: 101.5, Weight: 79.5, BodyFat: 18.5, LoggedOn: day.AddDate(0, 0, 7)}
+	if err := store.SaveMeasurement(ctx, fix); err != nil {
+		t.Fatalf("SaveMeasurement(merge): %v", err)
+	}
+	if fix.Neck != 39 || fix.Waist != 88 {
+		t.Fatalf("merged sizes not returned: %+v", fix)
+	}
+
+	measurements, err := store.ListMeasurements(ctx, user.ID, day.AddDate(0, 0, 1))
+	if err != nil || len(measurements) != 2 {
+		t.Fatalf("ListMeasurements: %+v, %v", measurements, err)
+	}
+	got := measurements[0]
+	if got.ID != fix.ID || got.Waist != 88 || got.Chest != 101.5 || got.Neck != 39 || got.BodyFat != 18.5 || got.Weight != 79.5 ||
+		!got.LoggedOn.Equal(day.AddDate(0, 0, 7)) {
+		t.Fatalf("merged measurement: %+v", got)
+	}
+	if measurements[1].Waist != 87 || measurements[1].BodyFat != 18 {
+		t.Fatalf("latest measurement: %+v", measurements[1])
+	}
+
+	// The latest estimate is kept on the user and survives profile updates
+	if err := store.SetUserBodyFat(ctx, user.TelegramID, 18); err != nil {
+		t.Fatalf("SetUserBodyFat: %v", err)
+	}
+	user.Weight = 79
+	if err := store.SaveUser(ctx, user); err != nil {
+		t.Fatalf("SaveUser: %v", err)
+	}
+	if stored, err := store.GetUser(ctx, user.TelegramID); err != nil || stored.BodyFat != 18 || stored.Weight != 79 {
+		t.Fatalf("GetUser after SetUserBodyFat: %+v, %v", stored, err)
+	}
+	if err := store.SetUserBodyFat(ctx, 1, 18); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("SetUserBodyFat of missing user: %v", err)
+	}
+}
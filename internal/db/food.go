@@ -0,0 +1,249 @@
+package db
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"diet-bot/internal/models"
+)
+
+func (db *PostgresDB) SaveFoodLogs(ctx context.Context, logs []*models.FoodLog) error {
+	query := `
+        INSERT INTO food_logs (user_id, logged_on, name, grams, calories, protein, fat, carbs, source)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+        RETURNING id, created_at
+    `
+
+	for _, log := range logs {
+		err := db.q.QueryRow(ctx, query,
+			log.UserID, log.LoggedOn, log.Name, log.Grams,
+			log.Calories, log.Protein, log.Fat, log.Carbs, log.Source,
+		).Scan(&log.ID, &log.CreatedAt)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (db *PostgresDB) ListFoodLogs(ctx context.Context, userID int64, from, to time.Time) ([]*models.FoodLog, error) {
+	query := `
+        SELECT id, user_id, logged_on, name, grams, calories, protein, fat, carbs, source, created_at
+        FROM food_logs
+        WHERE user_id = $1 AND logged_on >= $2 AND logged_on <= $3
+        ORDER BY logged_on, id
+    `
+
+	rows, err := db.q.Query(ctx, query, userID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var logs []*models.FoodLog
+	for rows.Next() {
+		var log models.FoodLog
+		err := rows.Scan(&log.ID, &log.UserID, &log.LoggedOn, &log.Name, &log.Grams,
+			&log.Calories, &log.Protein, &log.Fat, &log.Carbs, &log.Source, &log.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		logs = append(logs, &log)
+	}
+
+	return logs, rows.Err()
+}
+
+func (db *PostgresDB) UpsertFoods(ctx context.Context, foods []*models.Food) error {
+	query := `
+        INSERT INTO foods (source, external_id, name, calories, protein, fat, carbs)
+        VALUES ($1, $2, $3, $4, $5, $6, $7)
+        ON CONFLICT (source, external_id) DO UPDATE SET
+            name = EXCLUDED.name,
+            calories = EXCLUDED.calories,
+            protein = EXCLUDED.protein,
+            fat = EXCLUDED.fat,
+            carbs = EXCLUDED.carbs,
+            updated_at = NOW()
+        RETURNING id
+    `
+
+	for _, f := range foods {
+		err := db.q.QueryRow(ctx, query,
+			f.Source, f.ExternalID, f.Name, f.Calories, f.Protein, f.Fat, f.Carbs,
+		).Scan(&f.ID)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (db *PostgresDB) SearchFoods(ctx context.Context, query string, limit int) ([]*models.FoodMatch, error) {
+	// Trigram similarity catches typos and word forms; the full-text match
+	// finds the query as a word of a longer name
+	sql := `
+        SELECT id, source, external_id, name, calories, protein, fat, carbs, similarity(name, $1) AS score
+        FROM foods
+        WHERE name % $1 OR to_tsvector('simple', name) @@ plainto_tsquery('simple', $1)
+        ORDER BY score DESC, length(name), id
+        LIMIT $2
+    `
+
+	rows, err := db.q.Query(ctx, sql, query, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var matches []*models.FoodMatch
+	for rows.Next() {
+		var m models.FoodMatch
+		err := rows.Scan(&m.ID, &m.Source, &m.ExternalID, &m.Name,
+			&m.Calories, &m.Protein, &m.Fat, &m.Carbs, &m.Score)
+		if err != nil {
+			return nil, err
+		}
+		matches = append(matches, &m)
+	}
+
+	return matches, rows.Err()
+}
+
+func (m *MemoryDB) SaveFoodLogs(ctx context.Context, logs []*models.FoodLog) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	for _, log := range logs {
+		stored := *log
+		stored.ID = m.nextID()
+		stored.CreatedAt = now
+		m.foodLogs = append(m.foodLogs, &stored)
+
+		log.ID = stored.ID
+		log.CreatedAt = now
+	}
+	sort.SliceStable(m.foodLogs, func(i, j int) bool { return m.foodLogs[i].LoggedOn.Before(m.foodLogs[j].LoggedOn) })
+	return nil
+}
+
+func (m *MemoryDB) ListFoodLogs(ctx context.Context, userID int64, from, to time.Time) ([]*models.FoodLog, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var logs []*models.FoodLog
+	for _, stored := range m.foodLogs {
+		if stored.UserID == userID && !stored.LoggedOn.Before(from) && !stored.LoggedOn.After(to) {
+			log := *stored
+			logs = append(logs, &log)
+		}
+	}
+	return logs, nil
+}
+
+func (m *MemoryDB) UpsertFoods(ctx context.Context, foods []*models.Food) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, f := range foods {
+		stored := *f
+		replaced := false
+		for i, existing := range m.foods {
+			if existing.Source == f.Source && existing.ExternalID == f.ExternalID {
+				stored.ID = existing.ID
+				m.foods[i] = &stored
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			stored.ID = m.nextID()
+			m.foods = append(m.foods, &stored)
+		}
+		f.ID = stored.ID
+	}
+	return nil
+}
+
+// SearchFoods approximates the Postgres query: pg_trgm similarity with its
+// default 0.3 threshold, or every query word appearing in the name.
+func (m *MemoryDB) SearchFoods(ctx context.Context, query string, limit int) ([]*models.FoodMatch, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	queryWords := words(query)
+	var matches []*models.FoodMatch
+	for _, f := range m.foods {
+		score := trigramSimilarity(query, f.Name)
+		if score < 0.3 && !containsWords(words(f.Name), queryWords) {
+			continue
+		}
+		matches = append(matches, &models.FoodMatch{Food: *f, Score: score})
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		a, b := matches[i], matches[j]
+		if a.Score != b.Score {
+			return a.Score > b.Score
+		}
+		return len([]rune(a.Name)) < len([]rune(b.Name))
+	})
+	if len(matches) > limit {
+		matches = matches[:limit]
+	}
+	return matches, nil
+}
+
+// words splits s into lower-case words the way pg_trgm does.
+func words(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+func containsWords(have, want []string) bool {
+	if len(want) == 0 {
+		return false
+	}
+	set := make(map[string]bool, len(have))
+	for _, w := range have {
+		set[w] = true
+	}
+	for _, w := range want {
+		if !set[w] {
+			return false
+		}
+	}
+	return true
+}
+
+// trigramSimilarity is pg_trgm's similarity(): shared trigrams of the padded
+// words over all distinct trigrams.
+func trigramSimilarity(a, b string) float64 {
+	ta, tb := trigrams(a), trigrams(b)
+	if len(ta) == 0 || len(tb) == 0 {
+		return 0
+	}
+	shared := 0
+	for t := range ta {
+		if tb[t] {
+			shared++
+		}
+	}
+	return float64(shared) / float64(len(ta)+len(tb)-shared)
+}
+
+func trigrams(s string) map[string]bool {
+	set := make(map[string]bool)
+	for _, w := range words(s) {
+		r := []rune("  " + w + " ")
+		for i := 0; i+3 <= len(r); i++ {
+			set[string(r[i:i+3])] = true
+		}
+	}
+	return set
+}
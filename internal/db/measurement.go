@@ -0,0 +1,105 @@
+package db
+
+import (
+	"context"
+	"diet-bot/internal/models"
+	"sort"
+	"time"
+)
+
+func (db *PostgresDB) SaveMeasurement(ctx context.Context, m *models.Measurement) error {
+	query := `
+        INSERT INTO measurements (user_id, waist, hip, chest, neck, weight, body_fat, logged_on)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+        ON CONFLICT (user_id, logged_on) DO UPDATE SET
+            waist = COALESCE(NULLIF(EXCLUDED.waist, 0), measurements.waist),
+            hip = COALESCE(NULLIF(EXCLUDED.hip, 0), measurements.hip),
+            chest = COALESCE(NULLIF(EXCLUDED.chest, 0), measurements.chest),
+            neck = COALESCE(NULLIF(EXCLUDED.neck, 0), measurements.neck),
+            weight = EXCLUDED.weight,
+            body_fat = EXCLUDED.body_fat,
+            created_at = NOW()
+        RETURNING id, waist, hip, chest, neck, created_at
+    `
+
+	return db.q.QueryRow(ctx, query, m.UserID, m.Waist, m.Hip, m.Chest, m.Neck, m.Weight, m.BodyFat, m.LoggedOn).
+		Scan(&m.ID, &m.Waist, &m.Hip, &m.Chest, &m.Neck, &m.CreatedAt)
+}
+
+func (db *PostgresDB) ListMeasurements(ctx context.Context, userID int64, since time.Time) ([]*models.Measurement, error) {
+	query := `
+        SELECT id, user_id, waist, hip, chest, neck, weight, body_fat, logged_on, created_at
+        FROM measurements
+        WHERE user_id = $1 AND logged_on >= $2
+        ORDER BY logged_on
+    `
+
+	rows, err := db.q.Query(ctx, query, userID, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var measurements []*models.Measurement
+	for rows.Next() {
+		var m models.Measurement
+		if err := rows.Scan(&m.ID, &m.UserID, &m.Waist, &m.Hip, &m.Chest, &m.Neck, &m.Weight, &m.BodyFat, &m.LoggedOn, &m.CreatedAt); err != nil {
+			return nil, err
+		}
+		measurements = append(measurements, &m)
+	}
+
+	return measurements, rows.Err()
+}
+
+func (m *MemoryDB) SaveMeasurement(ctx context.Context, measurement *models.Measurement) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	for _, stored := range m.measurements {
+		if stored.UserID == measurement.UserID && stored.LoggedOn.Equal(measurement.LoggedOn) {
+			for _, size := range []struct{ from, to *float64 }{
+				{&stored.Waist, &measurement.Waist},
+				{&stored.Hip, &measurement.Hip},
+				{&stored.Chest, &measurement.Chest},
+				{&stored.Neck, &measurement.Neck},
+			} {
+				if *size.to == 0 {
+					*size.to = *size.from
+				}
+			}
+			id := stored.ID
+			*stored = *measurement
+			stored.ID = id
+			stored.CreatedAt = now
+			measurement.ID = id
+			measurement.CreatedAt = now
+			return nil
+		}
+	}
+
+	stored := *measurement
+	stored.ID = m.nextID()
+	stored.CreatedAt = now
+	m.measurements = append(m.measurements, &stored)
+	sort.SliceStable(m.measurements, func(i, j int) bool { return m.measurements[i].LoggedOn.Before(m.measurements[j].LoggedOn) })
+
+	measurement.ID = stored.ID
+	measurement.CreatedAt = now
+	return nil
+}
+
+func (m *MemoryDB) ListMeasurements(ctx context.Context, userID int64, since time.Time) ([]*models.Measurement, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var measurements []*models.Measurement
+	for _, stored := range m.measurements {
+		if stored.UserID == userID && !stored.LoggedOn.Before(since) {
+			measurement := *stored
+			measurements = append(measurements, &measurement)
+		}
+	}
+	return measurements, nil
+}
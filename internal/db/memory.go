@@ -0,0 +1,473 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"diet-bot/internal/models"
+)
+
+// MemoryDB is an in-memory Store for tests and local runs without Postgres.
+// It hands out copies, so callers cannot mutate stored records by accident.
+type MemoryDB struct {
+	mu sync.Mutex
+	*memoryState
+
+	// txMu serialises WithTx calls; writes made outside a transaction while
+	// one is rolling back are lost with it.
+	txMu sync.Mutex
+}
+
+// memoryState holds every table; clone must copy each one so WithTx can roll back.
+type memoryState struct {
+	seq      int64
+	users    map[int64]*models.User
+	payments map[int64]*models.Payment
+	plans    []*models.DietPlan
+	outbox   []*memoryOutboxEvent
+
+	weightLogs []*models.WeightLog
+	reminders  []*models.Reminder
+	foodLogs   []*models.FoodLog
+	foods      []*models.Food
+
+	chatMessages  []*models.ChatMessage
+	shoppingLists []*models.ShoppingList
+	recipes       []*models.Recipe
+	weeklyReports []*models.WeeklyReport
+	waterLogs     []*models.WaterLog
+	measurements  []*models.Measurement
+}
+
+func NewMemoryDB() *MemoryDB {
+	return &MemoryDB{memoryState: &memoryState{
+		users:    make(map[int64]*models.User),
+		payments: make(map[int64]*models.Payment),
+	}}
+}
+
+func (s *memoryState) clone() *memoryState {
+	c := &memoryState{
+		seq:      s.seq,
+		users:    make(map[int64]*models.User, len(s.users)),
+		payments: make(map[int64]*models.Payment, len(s.payments)),
+	}
+	for id, u := range s.users {
+		user := *u
+		c.users[id] = &user
+	}
+	for id, p := range s.payments {
+		payment := *p
+		c.payments[id] = &payment
+	}
+	for _, p := range s.plans {
+		plan := *p
+		c.plans = append(c.plans, &plan)
+	}
+	for _, e := range s.outbox {
+		event := *e
+		c.outbox = append(c.outbox, &event)
+	}
+	for _, l := range s.weightLogs {
+		log := *l
+		c.weightLogs = append(c.weightLogs, &log)
+	}
+	for _, r := range s.reminders {
+		reminder := *r
+		c.reminders = append(c.reminders, &reminder)
+	}
+	for _, l := range s.foodLogs {
+		log := *l
+		c.foodLogs = append(c.foodLogs, &log)
+	}
+	for _, f := range s.foods {
+		food := *f
+		c.foods = append(c.foods, &food)
+	}
+	for _, msg := range s.chatMessages {
+		message := *msg
+		c.chatMessages = append(c.chatMessages, &message)
+	}
+	for _, l := range s.shoppingLists {
+		c.shoppingLists = append(c.shoppingLists, copyShoppingList(l))
+	}
+	for _, r := range s.recipes {
+		c.recipes = append(c.recipes, copyRecipe(r))
+	}
+	for _, r := range s.weeklyReports {
+		report := *r
+		c.weeklyReports = append(c.weeklyReports, &report)
+	}
+	for _, l := range s.waterLogs {
+		log := *l
+		c.waterLogs = append(c.waterLogs, &log)
+	}
+	for _, msr := range s.measurements {
+		measurement := *msr
+		c.measurements = append(c.measurements, &measurement)
+	}
+	return c
+}
+
+// copyPlanData deep-copies the nested slices of a structured plan.
+func copyPlanData(data *models.PlanData) *models.PlanData {
+	if data == nil {
+		return nil
+	}
+	c := *data
+	c.Tips = append([]string(nil), data.Tips...)
+	c.Days = make([]models.PlanDay, len(data.Days))
+	for i, day := range data.Days {
+		c.Days[i] = day
+		c.Days[i].Meals = make([]models.PlanMeal, len(day.Meals))
+		for j, meal := range day.Meals {
+			c.Days[i].Meals[j] = meal
+			c.Days[i].Meals[j].Ingredients = append([]models.Ingredient(nil), meal.Ingredients...)
+		}
+	}
+	return &c
+}
+
+// nextID must be called with mu held.
+func (m *MemoryDB) nextID() int64 {
+	m.seq++
+	return m.seq
+}
+
+// WithTx runs fn against the store and restores the previous state if it fails.
+func (m *MemoryDB) WithTx(ctx context.Context, fn func(tx Store) error) error {
+	m.txMu.Lock()
+	defer m.txMu.Unlock()
+
+	return (&memoryTx{m}).WithTx(ctx, fn)
+}
+
+// memoryTx is the Store handed to WithTx callbacks; nesting only snapshots.
+type memoryTx struct {
+	*MemoryDB
+}
+
+func (tx *memoryTx) WithTx(ctx context.Context, fn func(tx Store) error) error {
+	tx.mu.Lock()
+	snapshot := tx.memoryState.clone()
+	tx.mu.Unlock()
+
+	if err := fn(tx); err != nil {
+		tx.mu.Lock()
+		*tx.memoryState = *snapshot
+		tx.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+func (m *MemoryDB) SaveUser(ctx context.Context, user *models.User) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if user.Timezone == "" {
+		user.Timezone = models.DefaultTimezone
+	}
+	now := time.Now()
+	for _, existing := range m.users {
+		if existing.TelegramID == user.TelegramID {
+			existing.Gender = user.Gender
+			existing.Height = user.Height
+			existing.Weight = user.Weight
+			existing.Goal = user.Goal
+			existing.Timezone = user.Timezone
+			existing.Age = user.Age
+			existing.Conditions = append([]string(nil), user.Conditions...)
+			existing.UpdatedAt = now
+			user.ID = existing.ID
+			return nil
+		}
+	}
+
+	stored := *user
+	stored.Conditions = append([]string(nil), user.Conditions...)
+	stored.ID = m.nextID()
+	stored.CreatedAt = now
+	stored.UpdatedAt = now
+	m.users[stored.ID] = &stored
+
+	user.ID = stored.ID
+	return nil
+}
+
+func (m *MemoryDB) GetUser(ctx context.Context, telegramID int64) (*models.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, u := range m.users {
+		if u.TelegramID == telegramID {
+			user := *u
+			return &user, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (m *MemoryDB) GetUserByID(ctx context.Context, id int64) (*models.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	u, ok := m.users[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	user := *u
+	return &user, nil
+}
+
+func (m *MemoryDB) SetUserTimezone(ctx context.Context, telegramID int64, timezone string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, u := range m.users {
+		if u.TelegramID == telegramID {
+			u.Timezone = timezone
+			u.UpdatedAt = time.Now()
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+func (m *MemoryDB) SetUserBodyFat(ctx context.Context, telegramID int64, bodyFat float64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, u := range m.users {
+		if u.TelegramID == telegramID {
+			u.BodyFat = bodyFat
+			u.UpdatedAt = time.Now()
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+func (m *MemoryDB) SetUserScreening(ctx context.Context, telegramID int64, age int, conditions []string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, u := range m.users {
+		if u.TelegramID == telegramID {
+			u.Age = age
+			u.Conditions = append([]string(nil), conditions...)
+			u.UpdatedAt = time.Now()
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+func (m *MemoryDB) SetUserBlocked(ctx context.Context, telegramID int64, blocked bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, u := range m.users {
+		if u.TelegramID != telegramID {
+			continue
+		}
+		if !blocked {
+			u.BlockedAt = nil
+		} else if u.BlockedAt == nil {
+			now := time.Now()
+			u.BlockedAt = &now
+		}
+	}
+	return nil
+}
+
+func (m *MemoryDB) SavePayment(ctx context.Context, payment *models.Payment) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, p := range m.payments {
+		if p.StripePaymentID == payment.StripePaymentID {
+			return fmt.Errorf("payment with Stripe ID %s already exists", payment.StripePaymentID)
+		}
+	}
+
+	now := time.Now()
+	stored := *payment
+	stored.ID = m.nextID()
+	stored.CreatedAt = now
+	stored.UpdatedAt = now
+	m.payments[stored.ID] = &stored
+
+	payment.ID = stored.ID
+	payment.CreatedAt = now
+	payment.UpdatedAt = now
+	return nil
+}
+
+func (m *MemoryDB) findPayment(match func(*models.Payment) bool) (*models.Payment, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, p := range m.payments {
+		if match(p) {
+			payment := *p
+			return &payment, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (m *MemoryDB) GetPaymentByID(ctx context.Context, id int64) (*models.Payment, error) {
+	return m.findPayment(func(p *models.Payment) bool { return p.ID == id })
+}
+
+func (m *MemoryDB) GetPaymentByStripeID(ctx context.Context, stripePaymentID string) (*models.Payment, error) {
+	return m.findPayment(func(p *models.Payment) bool { return p.StripePaymentID == stripePaymentID })
+}
+
+func (m *MemoryDB) GetPaymentByIntentID(ctx context.Context, paymentIntentID string) (*models.Payment, error) {
+	return m.findPayment(func(p *models.Payment) bool {
+		return paymentIntentID != "" && p.StripePaymentIntentID == paymentIntentID
+	})
+}
+
+func (m *MemoryDB) ListPaymentsByStatus(ctx context.Context, status string, createdBefore time.Time) ([]*models.Payment, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var payments []*models.Payment
+	for _, p := range m.payments {
+		if p.Status == status && p.CreatedAt.Before(createdBefore) {
+			payment := *p
+			payments = append(payments, &payment)
+		}
+	}
+	sort.Slice(payments, func(i, j int) bool { return payments[i].ID < payments[j].ID })
+
+	return payments, nil
+}
+
+func (m *MemoryDB) SetPaymentIntentID(ctx context.Context, stripePaymentID, paymentIntentID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, p := range m.payments {
+		if p.StripePaymentID == stripePaymentID {
+			p.StripePaymentIntentID = paymentIntentID
+			p.UpdatedAt = time.Now()
+		}
+	}
+	return nil
+}
+
+func (m *MemoryDB) TransitionPaymentStatus(ctx context.Context, payment *models.Payment, to string) error {
+	if !models.CanTransitionPayment(payment.Status, to) {
+		return fmt.Errorf("%w: %s -> %s", ErrInvalidTransition, payment.Status, to)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, ok := m.payments[payment.ID]
+	if !ok || stored.Status != payment.Status {
+		return fmt.Errorf("%w: payment %d is no longer %s", ErrInvalidTransition, payment.ID, payment.Status)
+	}
+
+	stored.Status = to
+	stored.RefundedAmount = payment.RefundedAmount
+	stored.UpdatedAt = time.Now()
+	payment.Status = to
+	return nil
+}
+
+func (m *MemoryDB) SaveDietPlan(ctx context.Context, plan *models.DietPlan) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored := *plan
+	stored.ID = m.nextID()
+	stored.CreatedAt = time.Now()
+	stored.Data = copyPlanData(plan.Data)
+	m.plans = append(m.plans, &stored)
+
+	plan.ID = stored.ID
+	plan.CreatedAt = stored.CreatedAt
+	return nil
+}
+
+func (m *MemoryDB) GetDietPlan(ctx context.Context, userID int64) (*models.DietPlan, error) {
+	plans, err := m.ListDietPlans(ctx, userID, 1)
+	if err != nil {
+		return nil, err
+	}
+	if len(plans) == 0 {
+		return nil, ErrNotFound
+	}
+	return plans[0], nil
+}
+
+func (m *MemoryDB) GetDietPlanByID(ctx context.Context, id int64) (*models.DietPlan, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, plan := range m.plans {
+		if plan.ID != id {
+			continue
+		}
+		if p, ok := m.payments[plan.PaymentID]; !ok || p.IsRevoked() {
+			break
+		}
+		found := *plan
+		found.Data = copyPlanData(plan.Data)
+		return &found, nil
+	}
+	return nil, ErrNotFound
+}
+
+func (m *MemoryDB) CountPlanRevisions(ctx context.Context, paymentID int64) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	count := 0
+	for _, plan := range m.plans {
+		if plan.PaymentID == paymentID && plan.Revision != "" && plan.Revision != models.RevisionAdapt {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (m *MemoryDB) HasDietPlan(ctx context.Context, paymentID int64) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, plan := range m.plans {
+		if plan.PaymentID == paymentID {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (m *MemoryDB) ListDietPlans(ctx context.Context, userID int64, limit int) ([]*models.DietPlan, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var plans []*models.DietPlan
+	for i := len(m.plans) - 1; i >= 0 && len(plans) < limit; i-- {
+		plan := m.plans[i]
+		if plan.UserID != userID {
+			continue
+		}
+		if p, ok := m.payments[plan.PaymentID]; !ok || p.IsRevoked() {
+			continue
+		}
+		found := *plan
+		found.Data = copyPlanData(plan.Data)
+		plans = append(plans, &found)
+	}
+	return plans, nil
+}
@@ -0,0 +1,62 @@
+package db
+
+import (
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"diet-bot/migrations"
+)
+
+func TestLoadMigrationsOrdersPairs(t *testing.T) {
+	fsys := fstest.MapFS{
+		"0002_second.up.sql":   {Data: []byte("CREATE TABLE b ();")},
+		"0002_second.down.sql": {Data: []byte("DROP TABLE b;")},
+		"0001_first.up.sql":    {Data: []byte("CREATE TABLE a ();")},
+		"0001_first.down.sql":  {Data: []byte("DROP TABLE a;")},
+		"README.md":            {Data: []byte("ignored")},
+	}
+
+	got, err := LoadMigrations(fsys)
+	if err != nil {
+		t.Fatalf("LoadMigrations: %v", err)
+	}
+	if len(got) != 2 || got[0].Version != 1 || got[1].Version != 2 {
+		t.Fatalf("unexpected migrations: %+v", got)
+	}
+	if got[0].Name != "first" || got[0].Up != "CREATE TABLE a ();" || got[0].Down != "DROP TABLE a;" {
+		t.Fatalf("unexpected first migration: %+v", got[0])
+	}
+}
+
+func TestLoadMigrationsRejectsIncompletePairs(t *testing.T) {
+	fsys := fstest.MapFS{
+		"0001_first.up.sql": {Data: []byte("CREATE TABLE a ();")},
+	}
+	if _, err := LoadMigrations(fsys); err == nil || !strings.Contains(err.Error(), "down") {
+		t.Fatalf("expected missing down file error, got %v", err)
+	}
+
+	fsys = fstest.MapFS{
+		"0001_first.up.sql":   {Data: []byte("CREATE TABLE a ();")},
+		"0001_other.down.sql": {Data: []byte("DROP TABLE a;")},
+	}
+	if _, err := LoadMigrations(fsys); err == nil {
+		t.Fatal("expected an error for mismatched names")
+	}
+}
+
+func TestEmbeddedMigrationsAreContiguous(t *testing.T) {
+	all, err := LoadMigrations(migrations.FS)
+	if err != nil {
+		t.Fatalf("LoadMigrations: %v", err)
+	}
+	if len(all) == 0 {
+		t.Fatal("no embedded migrations")
+	}
+	for i, m := range all {
+		if m.Version != int64(i+1) {
+			t.Fatalf("migration %d_%s out of sequence at position %d", m.Version, m.Name, i)
+		}
+	}
+}
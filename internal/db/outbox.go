@@ -0,0 +1,161 @@
+package db
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"diet-bot/internal/models"
+)
+
+func (db *PostgresDB) AddOutboxEvent(ctx context.Context, event *models.OutboxEvent) error {
+	query := `
+        INSERT INTO outbox_events (topic, payload)
+        VALUES ($1, $2)
+        RETURNING id, created_at
+    `
+
+	return db.q.QueryRow(ctx, query, event.Topic, []byte(event.Payload)).Scan(&event.ID, &event.CreatedAt)
+}
+
+func (db *PostgresDB) ClaimOutboxEvents(ctx context.Context, limit int, lease time.Duration) ([]*models.OutboxEvent, error) {
+	query := `
+        UPDATE outbox_events
+        SET locked_until = NOW() + $2::interval
+        WHERE id IN (
+            SELECT id FROM outbox_events
+            WHERE processed_at IS NULL AND (locked_until IS NULL OR locked_until < NOW())
+            ORDER BY id
+            LIMIT $1
+            FOR UPDATE SKIP LOCKED
+        )
+        RETURNING id, topic, payload, attempts, COALESCE(last_error, ''), created_at
+    `
+
+	rows, err := db.q.Query(ctx, query, limit, lease)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []*models.OutboxEvent
+	for rows.Next() {
+		var event models.OutboxEvent
+		var payload []byte
+		if err := rows.Scan(&event.ID, &event.Topic, &payload, &event.Attempts, &event.LastError, &event.CreatedAt); err != nil {
+			return nil, err
+		}
+		event.Payload = payload
+		events = append(events, &event)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// UPDATE ... RETURNING does not keep the subquery order
+	sort.Slice(events, func(i, j int) bool { return events[i].ID < events[j].ID })
+	return events, nil
+}
+
+func (db *PostgresDB) MarkOutboxEventProcessed(ctx context.Context, id int64) error {
+	tag, err := db.q.Exec(ctx, `
+        UPDATE outbox_events SET processed_at = NOW(), locked_until = NULL
+        WHERE id = $1
+    `, id)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (db *PostgresDB) MarkOutboxEventFailed(ctx context.Context, id int64, lastError string) error {
+	tag, err := db.q.Exec(ctx, `
+        UPDATE outbox_events SET attempts = attempts + 1, last_error = $2, locked_until = NULL
+        WHERE id = $1
+    `, id, lastError)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// memoryOutboxEvent keeps the dispatcher lease next to the event.
+type memoryOutboxEvent struct {
+	models.OutboxEvent
+	lockedUntil time.Time
+}
+
+func (m *MemoryDB) AddOutboxEvent(ctx context.Context, event *models.OutboxEvent) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	event.ID = m.nextID()
+	event.CreatedAt = time.Now()
+	stored := &memoryOutboxEvent{OutboxEvent: *event}
+	stored.Payload = append([]byte(nil), event.Payload...)
+	m.outbox = append(m.outbox, stored)
+	return nil
+}
+
+func (m *MemoryDB) ClaimOutboxEvents(ctx context.Context, limit int, lease time.Duration) ([]*models.OutboxEvent, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	var events []*models.OutboxEvent
+	for _, e := range m.outbox {
+		if len(events) >= limit {
+			break
+		}
+		if e.ProcessedAt != nil || now.Before(e.lockedUntil) {
+			continue
+		}
+		e.lockedUntil = now.Add(lease)
+		event := e.OutboxEvent
+		events = append(events, &event)
+	}
+	return events, nil
+}
+
+func (m *MemoryDB) findOutboxEvent(id int64) (*memoryOutboxEvent, error) {
+	for _, e := range m.outbox {
+		if e.ID == id {
+			return e, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (m *MemoryDB) MarkOutboxEventProcessed(ctx context.Context, id int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	e, err := m.findOutboxEvent(id)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	e.ProcessedAt = &now
+	e.lockedUntil = time.Time{}
+	return nil
+}
+
+func (m *MemoryDB) MarkOutboxEventFailed(ctx context.Context, id int64, lastError string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	e, err := m.findOutboxEvent(id)
+	if err != nil {
+		return err
+	}
+	e.Attempts++
+	e.LastError = lastError
+	e.lockedUntil = time.Time{}
+	return nil
+}
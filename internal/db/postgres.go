@@ -2,16 +2,39 @@ package db
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"time"
 
 	"diet-bot/internal/models"
 
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
 	"github.com/jackc/pgx/v4/pgxpool"
 )
 
+// ErrNotFound is returned when the requested record does not exist.
+var ErrNotFound = errors.New("not found")
+
+// ErrInvalidTransition is returned when a payment cannot move to the requested status.
+var ErrInvalidTransition = errors.New("invalid payment status transition")
+
+// ErrQuotaExceeded is returned when a question would go over the daily quota.
+var ErrQuotaExceeded = errors.New("question quota exceeded")
+
+// querier is satisfied by both the pool and a transaction, so the same
+// repository methods run standalone or inside WithTx.
+type querier interface {
+	Exec(ctx context.Context, sql string, arguments ...interface{}) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row
+}
+
 type PostgresDB struct {
 	pool *pgxpool.Pool
+	q    querier
+	tx   pgx.Tx
 }
 
 func NewPostgresDB(cfg struct {
@@ -41,6 +64,21 @@ func NewPostgresDB(cfg struct {
 	poolConfig.MaxConnLifetime = cfg.ConnLifetime
 	poolConfig.MaxConnIdleTime = 15 * time.Minute
 
+	return connect(poolConfig)
+}
+
+// NewPostgresDBFromURL connects using a postgres:// URL or DSN with the pool
+// settings it carries, as used by tests and tooling.
+func NewPostgresDBFromURL(databaseURL string) (*PostgresDB, error) {
+	poolConfig, err := pgxpool.ParseConfig(databaseURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse DB connection string: %w", err)
+	}
+
+	return connect(poolConfig)
+}
+
+func connect(poolConfig *pgxpool.Config) (*PostgresDB, error) {
 	// Connect with timeout
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
@@ -56,73 +94,253 @@ func NewPostgresDB(cfg struct {
 		return nil, fmt.Errorf("failed to ping database: %w", err)
 	}
 
-	return &PostgresDB{pool: pool}, nil
+	return &PostgresDB{pool: pool, q: pool}, nil
 }
 
 func (db *PostgresDB) Close() {
-	if db.pool != nil {
+	if db.pool != nil && db.tx == nil {
 		db.pool.Close()
 	}
 }
-func (db *PostgresDB) GetPaymentByStripeID(ctx context.Context, stripePaymentID string) (*models.Payment, error) {
-	query := `
-        SELECT id, user_id, amount, currency, stripe_payment_id, status, created_at, updated_at
-        FROM payments
-        WHERE stripe_payment_id = $1
-    `
 
+// WithTx runs fn as a unit of work: every repository call made through the
+// Store passed to fn commits together, or not at all if fn returns an error.
+// Nested calls use savepoints.
+func (db *PostgresDB) WithTx(ctx context.Context, fn func(tx Store) error) error {
+	var tx pgx.Tx
+	var err error
+	if db.tx != nil {
+		tx, err = db.tx.Begin(ctx)
+	} else {
+		tx, err = db.pool.Begin(ctx)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if err := fn(&PostgresDB{pool: db.pool, q: tx, tx: tx}); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+const paymentColumns = `id, user_id, amount, currency, stripe_payment_id, COALESCE(stripe_payment_intent_id, ''),
+        status, refunded_amount, created_at, updated_at`
+
+func scanPayment(row pgx.Row) (*models.Payment, error) {
 	var payment models.Payment
-	err := db.pool.QueryRow(ctx, query, stripePaymentID).Scan(
+	err := row.Scan(
 		&payment.ID, &payment.UserID, &payment.Amount, &payment.Currency,
-		&payment.StripePaymentID, &payment.Status,
+		&payment.StripePaymentID, &payment.StripePaymentIntentID,
+		&payment.Status, &payment.RefundedAmount,
 		&payment.CreatedAt, &payment.UpdatedAt,
 	)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &payment, nil
+}
 
+func (db *PostgresDB) GetPaymentByStripeID(ctx context.Context, stripePaymentID string) (*models.Payment, error) {
+	query := `SELECT ` + paymentColumns + ` FROM payments WHERE stripe_payment_id = $1`
+
+	payment, err := scanPayment(db.q.QueryRow(ctx, query, stripePaymentID))
 	if err != nil {
 		return nil, fmt.Errorf("failed to get payment by Stripe ID: %w", err)
 	}
 
-	return &payment, nil
+	return payment, nil
+}
+
+func (db *PostgresDB) GetPaymentByIntentID(ctx context.Context, paymentIntentID string) (*models.Payment, error) {
+	query := `SELECT ` + paymentColumns + ` FROM payments WHERE stripe_payment_intent_id = $1`
+
+	payment, err := scanPayment(db.q.QueryRow(ctx, query, paymentIntentID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get payment by payment intent ID: %w", err)
+	}
+
+	return payment, nil
+}
+
+func (db *PostgresDB) GetPaymentByID(ctx context.Context, id int64) (*models.Payment, error) {
+	query := `SELECT ` + paymentColumns + ` FROM payments WHERE id = $1`
+
+	payment, err := scanPayment(db.q.QueryRow(ctx, query, id))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get payment: %w", err)
+	}
+
+	return payment, nil
+}
+
+// ListPaymentsByStatus returns payments in the given status created before the cutoff, oldest first.
+func (db *PostgresDB) ListPaymentsByStatus(ctx context.Context, status string, createdBefore time.Time) ([]*models.Payment, error) {
+	query := `SELECT ` + paymentColumns + ` FROM payments WHERE status = $1 AND created_at < $2 ORDER BY created_at`
+
+	rows, err := db.q.Query(ctx, query, status, createdBefore)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list payments: %w", err)
+	}
+	defer rows.Close()
+
+	var payments []*models.Payment
+	for rows.Next() {
+		payment, err := scanPayment(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan payment: %w", err)
+		}
+		payments = append(payments, payment)
+	}
+
+	return payments, rows.Err()
+}
+
+// SetPaymentIntentID links a checkout session's payment record to the payment
+// intent Stripe created for it, so charge and dispute events can find it.
+func (db *PostgresDB) SetPaymentIntentID(ctx context.Context, stripePaymentID, paymentIntentID string) error {
+	query := `
+        UPDATE payments
+        SET stripe_payment_intent_id = $2, updated_at = NOW()
+        WHERE stripe_payment_id = $1
+    `
+
+	_, err := db.q.Exec(ctx, query, stripePaymentID, paymentIntentID)
+	return err
+}
+
+// TransitionPaymentStatus moves the payment to status to, storing its current
+// refunded amount. The update only applies while the row still has the status
+// held in payment, so concurrent webhook deliveries cannot both win.
+func (db *PostgresDB) TransitionPaymentStatus(ctx context.Context, payment *models.Payment, to string) error {
+	if !models.CanTransitionPayment(payment.Status, to) {
+		return fmt.Errorf("%w: %s -> %s", ErrInvalidTransition, payment.Status, to)
+	}
+
+	query := `
+        UPDATE payments
+        SET status = $3, refunded_amount = $4, updated_at = NOW()
+        WHERE id = $1 AND status = $2
+    `
+
+	tag, err := db.q.Exec(ctx, query, payment.ID, payment.Status, to, payment.RefundedAmount)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("%w: payment %d is no longer %s", ErrInvalidTransition, payment.ID, payment.Status)
+	}
+
+	payment.Status = to
+	return nil
 }
 
 func (db *PostgresDB) SaveUser(ctx context.Context, user *models.User) error {
 	query := `
-        INSERT INTO users (telegram_id, chat_id, username, gender, height, weight, goal)
-        VALUES ($1, $2, $3, $4, $5, $6, $7)
+        INSERT INTO users (telegram_id, chat_id, username, gender, height, weight, goal, timezone, age, conditions)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
         ON CONFLICT (telegram_id) DO UPDATE
-        SET gender = $4, height = $5, weight = $6, goal = $7, updated_at = NOW()
+        SET gender = $4, height = $5, weight = $6, goal = $7, timezone = $8, age = $9, conditions = $10, updated_at = NOW()
         RETURNING id
     `
 
-	err := db.pool.QueryRow(ctx, query,
+	if user.Timezone == "" {
+		user.Timezone = models.DefaultTimezone
+	}
+	conditions := user.Conditions
+	if conditions == nil {
+		conditions = []string{}
+	}
+	err := db.q.QueryRow(ctx, query,
 		user.TelegramID, user.ChatID, user.Username,
-		user.Gender, user.Height, user.Weight, user.Goal,
+		user.Gender, user.Height, user.Weight, user.Goal, user.Timezone, user.Age, conditions,
 	).Scan(&user.ID)
 
 	return err
 }
 
-func (db *PostgresDB) GetUser(ctx context.Context, telegramID int64) (*models.User, error) {
-	query := `
-        SELECT id, telegram_id, chat_id, username, gender, height, weight, goal, created_at, updated_at
-        FROM users
-        WHERE telegram_id = $1
-    `
+const userColumns = `id, telegram_id, chat_id, username, gender, height, weight, goal, age, conditions, body_fat, timezone, blocked_at, created_at, updated_at`
 
+func scanUser(row pgx.Row) (*models.User, error) {
 	var user models.User
-	err := db.pool.QueryRow(ctx, query, telegramID).Scan(
+	err := row.Scan(
 		&user.ID, &user.TelegramID, &user.ChatID, &user.Username,
-		&user.Gender, &user.Height, &user.Weight, &user.Goal,
+		&user.Gender, &user.Height, &user.Weight, &user.Goal, &user.Age, &user.Conditions, &user.BodyFat, &user.Timezone, &user.BlockedAt,
 		&user.CreatedAt, &user.UpdatedAt,
 	)
-
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
 	if err != nil {
 		return nil, err
 	}
-
 	return &user, nil
 }
 
+func (db *PostgresDB) GetUserByID(ctx context.Context, id int64) (*models.User, error) {
+	return scanUser(db.q.QueryRow(ctx, `SELECT `+userColumns+` FROM users WHERE id = $1`, id))
+}
+
+func (db *PostgresDB) GetUser(ctx context.Context, telegramID int64) (*models.User, error) {
+	return scanUser(db.q.QueryRow(ctx, `SELECT `+userColumns+` FROM users WHERE telegram_id = $1`, telegramID))
+}
+
+func (db *PostgresDB) SetUserTimezone(ctx context.Context, telegramID int64, timezone string) error {
+	tag, err := db.q.Exec(ctx, `UPDATE users SET timezone = $2, updated_at = NOW() WHERE telegram_id = $1`, telegramID, timezone)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (db *PostgresDB) SetUserBodyFat(ctx context.Context, telegramID int64, bodyFat float64) error {
+	tag, err := db.q.Exec(ctx, `UPDATE users SET body_fat = $2, updated_at = NOW() WHERE telegram_id = $1`, telegramID, bodyFat)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (db *PostgresDB) SetUserScreening(ctx context.Context, telegramID int64, age int, conditions []string) error {
+	if conditions == nil {
+		conditions = []string{}
+	}
+	query := `UPDATE users SET age = $2, conditions = $3, updated_at = NOW() WHERE telegram_id = $1`
+	tag, err := db.q.Exec(ctx, query, telegramID, age, conditions)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (db *PostgresDB) SetUserBlocked(ctx context.Context, telegramID int64, blocked bool) error {
+	// Both forms skip rows already in the requested state, so the unblock run
+	// on every update does not write
+	query := `UPDATE users SET blocked_at = NULL WHERE telegram_id = $1 AND blocked_at IS NOT NULL`
+	if blocked {
+		query = `UPDATE users SET blocked_at = NOW() WHERE telegram_id = $1 AND blocked_at IS NULL`
+	}
+	_, err := db.q.Exec(ctx, query, telegramID)
+	return err
+}
+
 func (db *PostgresDB) SavePayment(ctx context.Context, payment *models.Payment) error {
 	query := `
         INSERT INTO payments (user_id, amount, currency, stripe_payment_id, status)
@@ -130,7 +348,7 @@ func (db *PostgresDB) SavePayment(ctx context.Context, payment *models.Payment)
         RETURNING id
     `
 
-	err := db.pool.QueryRow(ctx, query,
+	err := db.q.QueryRow(ctx, query,
 		payment.UserID, payment.Amount, payment.Currency,
 		payment.StripePaymentID, payment.Status,
 	).Scan(&payment.ID)
@@ -138,48 +356,120 @@ func (db *PostgresDB) SavePayment(ctx context.Context, payment *models.Payment)
 	return err
 }
 
-func (db *PostgresDB) UpdatePaymentStatus(ctx context.Context, stripePaymentID string, status string) error {
-	query := `
-        UPDATE payments
-        SET status = $2, updated_at = NOW()
-        WHERE stripe_payment_id = $1
-    `
+const planColumns = `dp.id, dp.user_id, dp.payment_id, dp.plan_text, dp.plan_data, dp.profile_snapshot, dp.prompt_version,
+        dp.model, dp.prompt_tokens, dp.completion_tokens, COALESCE(dp.parent_id, 0), dp.revision, dp.created_at`
 
-	_, err := db.pool.Exec(ctx, query, stripePaymentID, status)
-	return err
+func scanPlan(row pgx.Row) (*models.DietPlan, error) {
+	var plan models.DietPlan
+	var data, profile []byte
+	err := row.Scan(
+		&plan.ID, &plan.UserID, &plan.PaymentID, &plan.PlanText, &data, &profile, &plan.PromptVersion,
+		&plan.Model, &plan.PromptTokens, &plan.CompletionTokens, &plan.ParentID, &plan.Revision, &plan.CreatedAt,
+	)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(profile, &plan.Profile); err != nil {
+		return nil, fmt.Errorf("invalid profile snapshot of plan %d: %w", plan.ID, err)
+	}
+	if data != nil {
+		if err := json.Unmarshal(data, &plan.Data); err != nil {
+			return nil, fmt.Errorf("invalid data of plan %d: %w", plan.ID, err)
+		}
+	}
+	return &plan, nil
 }
 
 func (db *PostgresDB) SaveDietPlan(ctx context.Context, plan *models.DietPlan) error {
+	profile, err := json.Marshal(plan.Profile)
+	if err != nil {
+		return err
+	}
+	// Text-only plans keep plan_data NULL
+	var data []byte
+	if plan.Data != nil {
+		if data, err = json.Marshal(plan.Data); err != nil {
+			return err
+		}
+	}
+
 	query := `
-        INSERT INTO diet_plans (user_id, payment_id, plan_text)
-        VALUES ($1, $2, $3)
-        RETURNING id
+        INSERT INTO diet_plans (user_id, payment_id, plan_text, plan_data, profile_snapshot, prompt_version,
+                                model, prompt_tokens, completion_tokens, parent_id, revision)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, NULLIF($10::bigint, 0), $11)
+        RETURNING id, created_at
     `
 
-	err := db.pool.QueryRow(ctx, query,
-		plan.UserID, plan.PaymentID, plan.PlanText,
-	).Scan(&plan.ID)
-
-	return err
+	return db.q.QueryRow(ctx, query,
+		plan.UserID, plan.PaymentID, plan.PlanText, data, profile, plan.PromptVersion,
+		plan.Model, plan.PromptTokens, plan.CompletionTokens, plan.ParentID, plan.Revision,
+	).Scan(&plan.ID, &plan.CreatedAt)
 }
 
 func (db *PostgresDB) GetDietPlan(ctx context.Context, userID int64) (*models.DietPlan, error) {
 	query := `
-        SELECT id, user_id, payment_id, plan_text, created_at
-        FROM diet_plans
-        WHERE user_id = $1
-        ORDER BY created_at DESC
+        SELECT ` + planColumns + `
+        FROM diet_plans dp
+        JOIN payments p ON p.id = dp.payment_id
+        WHERE dp.user_id = $1 AND p.status NOT IN ('refunded', 'dispute_lost')
+        ORDER BY dp.created_at DESC, dp.id DESC
         LIMIT 1
     `
 
-	var plan models.DietPlan
-	err := db.pool.QueryRow(ctx, query, userID).Scan(
-		&plan.ID, &plan.UserID, &plan.PaymentID, &plan.PlanText, &plan.CreatedAt,
-	)
+	return scanPlan(db.q.QueryRow(ctx, query, userID))
+}
+
+func (db *PostgresDB) GetDietPlanByID(ctx context.Context, id int64) (*models.DietPlan, error) {
+	query := `
+        SELECT ` + planColumns + `
+        FROM diet_plans dp
+        JOIN payments p ON p.id = dp.payment_id
+        WHERE dp.id = $1 AND p.status NOT IN ('refunded', 'dispute_lost')
+    `
+
+	return scanPlan(db.q.QueryRow(ctx, query, id))
+}
 
+func (db *PostgresDB) CountPlanRevisions(ctx context.Context, paymentID int64) (int, error) {
+	var count int
+	err := db.q.QueryRow(ctx, `SELECT COUNT(*) FROM diet_plans WHERE payment_id = $1 AND revision NOT IN ('', $2)`, paymentID, models.RevisionAdapt).Scan(&count)
+	return count, err
+}
+
+func (db *PostgresDB) HasDietPlan(ctx context.Context, paymentID int64) (bool, error) {
+	var exists bool
+	err := db.q.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM diet_plans WHERE payment_id = $1)`, paymentID).Scan(&exists)
+	return exists, err
+}
+
+func (db *PostgresDB) ListDietPlans(ctx context.Context, userID int64, limit int) ([]*models.DietPlan, error) {
+	query := `
+        SELECT ` + planColumns + `
+        FROM diet_plans dp
+        JOIN payments p ON p.id = dp.payment_id
+        WHERE dp.user_id = $1 AND p.status NOT IN ('refunded', 'dispute_lost')
+        ORDER BY dp.created_at DESC, dp.id DESC
+        LIMIT $2
+    `
+
+	rows, err := db.q.Query(ctx, query, userID, limit)
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
+
+	var plans []*models.DietPlan
+	for rows.Next() {
+		plan, err := scanPlan(rows)
+		if err != nil {
+			return nil, err
+		}
+		plans = append(plans, plan)
+	}
 
-	return &plan, nil
+	return plans, rows.Err()
 }
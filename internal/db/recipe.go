@@ -0,0 +1,95 @@
+package db
+
+import (
+	"context"
+	"diet-bot/internal/models"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+func (db *PostgresDB) GetRecipe(ctx context.Context, cacheKey string) (*models.Recipe, error) {
+	var recipe models.Recipe
+	var data []byte
+	err := db.q.QueryRow(ctx, `
+        SELECT id, cache_key, dish, restrictions, recipe_data, model, prompt_tokens, completion_tokens, created_at
+        FROM recipes
+        WHERE cache_key = $1
+    `, cacheKey).Scan(&recipe.ID, &recipe.CacheKey, &recipe.Dish, &recipe.Restrictions, &data,
+		&recipe.Model, &recipe.PromptTokens, &recipe.CompletionTokens, &recipe.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, &recipe.Data); err != nil {
+		return nil, fmt.Errorf("invalid data of recipe %d: %w", recipe.ID, err)
+	}
+	return &recipe, nil
+}
+
+func (db *PostgresDB) SaveRecipe(ctx context.Context, recipe *models.Recipe) error {
+	data, err := json.Marshal(recipe.Data)
+	if err != nil {
+		return err
+	}
+	restrictions := recipe.Restrictions
+	if restrictions == nil {
+		restrictions = []string{}
+	}
+
+	// The no-op update makes RETURNING yield the row that won a race
+	return db.q.QueryRow(ctx, `
+        INSERT INTO recipes (cache_key, dish, restrictions, recipe_data, model, prompt_tokens, completion_tokens)
+        VALUES ($1, $2, $3, $4, $5, $6, $7)
+        ON CONFLICT (cache_key) DO UPDATE SET cache_key = EXCLUDED.cache_key
+        RETURNING id, created_at
+    `, recipe.CacheKey, recipe.Dish, restrictions, data, recipe.Model, recipe.PromptTokens, recipe.CompletionTokens,
+	).Scan(&recipe.ID, &recipe.CreatedAt)
+}
+
+func (m *MemoryDB) GetRecipe(ctx context.Context, cacheKey string) (*models.Recipe, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, stored := range m.recipes {
+		if stored.CacheKey == cacheKey {
+			return copyRecipe(stored), nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (m *MemoryDB) SaveRecipe(ctx context.Context, recipe *models.Recipe) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, stored := range m.recipes {
+		if stored.CacheKey == recipe.CacheKey {
+			recipe.ID, recipe.CreatedAt = stored.ID, stored.CreatedAt
+			return nil
+		}
+	}
+
+	stored := copyRecipe(recipe)
+	stored.ID = m.nextID()
+	stored.CreatedAt = time.Now()
+	m.recipes = append(m.recipes, stored)
+
+	recipe.ID = stored.ID
+	recipe.CreatedAt = stored.CreatedAt
+	return nil
+}
+
+func copyRecipe(recipe *models.Recipe) *models.Recipe {
+	c := *recipe
+	c.Restrictions = append([]string(nil), recipe.Restrictions...)
+	c.Data.Ingredients = append([]models.Ingredient(nil), recipe.Data.Ingredients...)
+	c.Data.Steps = append([]string(nil), recipe.Data.Steps...)
+	return &c
+}
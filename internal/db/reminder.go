@@ -0,0 +1,173 @@
+package db
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"diet-bot/internal/models"
+)
+
+const reminderColumns = `r.id, r.user_id, u.telegram_id, u.chat_id, r.kind, r.rule, r.timezone, r.enabled, r.next_run_at, r.last_sent_at, r.created_at`
+
+func (db *PostgresDB) SaveReminder(ctx context.Context, reminder *models.Reminder) error {
+	query := `
+        INSERT INTO reminders (user_id, kind, rule, timezone, enabled, next_run_at)
+        VALUES ($1, $2, $3, $4, $5, $6)
+        ON CONFLICT (user_id, kind) DO UPDATE SET
+            rule = EXCLUDED.rule,
+            timezone = EXCLUDED.timezone,
+            enabled = EXCLUDED.enabled,
+            next_run_at = EXCLUDED.next_run_at,
+            updated_at = NOW()
+        RETURNING id, created_at
+    `
+
+	return db.q.QueryRow(ctx, query,
+		reminder.UserID, reminder.Kind, reminder.Rule, reminder.Timezone, reminder.Enabled, reminder.NextRunAt,
+	).Scan(&reminder.ID, &reminder.CreatedAt)
+}
+
+func (db *PostgresDB) queryReminders(ctx context.Context, query string, args ...interface{}) ([]*models.Reminder, error) {
+	rows, err := db.q.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var reminders []*models.Reminder
+	for rows.Next() {
+		var r models.Reminder
+		err := rows.Scan(&r.ID, &r.UserID, &r.TelegramID, &r.ChatID, &r.Kind, &r.Rule, &r.Timezone, &r.Enabled,
+			&r.NextRunAt, &r.LastSentAt, &r.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		reminders = append(reminders, &r)
+	}
+
+	return reminders, rows.Err()
+}
+
+func (db *PostgresDB) ListReminders(ctx context.Context, userID int64) ([]*models.Reminder, error) {
+	return db.queryReminders(ctx, `
+        SELECT `+reminderColumns+`
+        FROM reminders r
+        JOIN users u ON u.id = r.user_id
+        WHERE r.user_id = $1
+        ORDER BY r.kind
+    `, userID)
+}
+
+func (db *PostgresDB) ClaimDueReminders(ctx context.Context, now time.Time, limit int) ([]*models.Reminder, error) {
+	return db.queryReminders(ctx, `
+        SELECT `+reminderColumns+`
+        FROM reminders r
+        JOIN users u ON u.id = r.user_id
+        WHERE r.enabled AND r.next_run_at <= $1 AND u.blocked_at IS NULL
+        ORDER BY r.next_run_at
+        LIMIT $2
+        FOR UPDATE OF r SKIP LOCKED
+    `, now, limit)
+}
+
+func (db *PostgresDB) RescheduleReminder(ctx context.Context, id int64, nextRunAt time.Time, sentAt *time.Time) error {
+	tag, err := db.q.Exec(ctx, `
+        UPDATE reminders
+        SET next_run_at = $2, last_sent_at = COALESCE($3, last_sent_at), updated_at = NOW()
+        WHERE id = $1
+    `, id, nextRunAt, sentAt)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (m *MemoryDB) SaveReminder(ctx context.Context, reminder *models.Reminder) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, stored := range m.reminders {
+		if stored.UserID == reminder.UserID && stored.Kind == reminder.Kind {
+			stored.Rule = reminder.Rule
+			stored.Timezone = reminder.Timezone
+			stored.Enabled = reminder.Enabled
+			stored.NextRunAt = reminder.NextRunAt
+			reminder.ID = stored.ID
+			reminder.CreatedAt = stored.CreatedAt
+			return nil
+		}
+	}
+
+	stored := *reminder
+	stored.ID = m.nextID()
+	stored.CreatedAt = time.Now()
+	m.reminders = append(m.reminders, &stored)
+
+	reminder.ID = stored.ID
+	reminder.CreatedAt = stored.CreatedAt
+	return nil
+}
+
+// withChatID returns a copy of r with the owner's IDs; mu must be held.
+func (m *MemoryDB) withChatID(r *models.Reminder) *models.Reminder {
+	reminder := *r
+	if u, ok := m.users[r.UserID]; ok {
+		reminder.TelegramID = u.TelegramID
+		reminder.ChatID = u.ChatID
+	}
+	return &reminder
+}
+
+func (m *MemoryDB) ListReminders(ctx context.Context, userID int64) ([]*models.Reminder, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var reminders []*models.Reminder
+	for _, r := range m.reminders {
+		if r.UserID == userID {
+			reminders = append(reminders, m.withChatID(r))
+		}
+	}
+	sort.Slice(reminders, func(i, j int) bool { return reminders[i].Kind < reminders[j].Kind })
+	return reminders, nil
+}
+
+func (m *MemoryDB) ClaimDueReminders(ctx context.Context, now time.Time, limit int) ([]*models.Reminder, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var due []*models.Reminder
+	for _, r := range m.reminders {
+		u, ok := m.users[r.UserID]
+		if !r.Enabled || r.NextRunAt.After(now) || !ok || u.BlockedAt != nil {
+			continue
+		}
+		due = append(due, m.withChatID(r))
+	}
+	sort.Slice(due, func(i, j int) bool { return due[i].NextRunAt.Before(due[j].NextRunAt) })
+	if len(due) > limit {
+		due = due[:limit]
+	}
+	return due, nil
+}
+
+func (m *MemoryDB) RescheduleReminder(ctx context.Context, id int64, nextRunAt time.Time, sentAt *time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, r := range m.reminders {
+		if r.ID == id {
+			r.NextRunAt = nextRunAt
+			if sentAt != nil {
+				sent := *sentAt
+				r.LastSentAt = &sent
+			}
+			return nil
+		}
+	}
+	return ErrNotFound
+}
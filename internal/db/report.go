@@ -0,0 +1,125 @@
+package db
+
+import (
+	"context"
+	"diet-bot/internal/models"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+func (db *PostgresDB) ListSubscribers(ctx context.Context) ([]*models.User, error) {
+	rows, err := db.q.Query(ctx, `
+        SELECT `+userColumns+`
+        FROM users
+        WHERE blocked_at IS NULL AND EXISTS (
+            SELECT 1 FROM diet_plans dp
+            JOIN payments p ON p.id = dp.payment_id
+            WHERE dp.user_id = users.id AND p.status NOT IN ('refunded', 'dispute_lost')
+        )
+        ORDER BY id
+    `)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []*models.User
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
+
+func (db *PostgresDB) ClaimWeeklyReport(ctx context.Context, report *models.WeeklyReport) (bool, error) {
+	err := db.q.QueryRow(ctx, `
+        INSERT INTO weekly_reports (user_id, plan_id, week_start, verdict, weekly_rate, target_calories, proposed_calories)
+        VALUES ($1, $2, $3, $4, $5, $6, $7)
+        ON CONFLICT (user_id, week_start) DO NOTHING
+        RETURNING id, created_at
+    `, report.UserID, report.PlanID, report.WeekStart, report.Verdict, report.WeeklyRate,
+		report.TargetCalories, report.ProposedCalories,
+	).Scan(&report.ID, &report.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (db *PostgresDB) GetWeeklyReport(ctx context.Context, id int64) (*models.WeeklyReport, error) {
+	var r models.WeeklyReport
+	err := db.q.QueryRow(ctx, `
+        SELECT id, user_id, plan_id, week_start, verdict, weekly_rate, target_calories, proposed_calories, created_at
+        FROM weekly_reports
+        WHERE id = $1
+    `, id).Scan(&r.ID, &r.UserID, &r.PlanID, &r.WeekStart, &r.Verdict, &r.WeeklyRate,
+		&r.TargetCalories, &r.ProposedCalories, &r.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+func (m *MemoryDB) ListSubscribers(ctx context.Context) ([]*models.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	subscribed := make(map[int64]bool)
+	for _, plan := range m.plans {
+		if p, ok := m.payments[plan.PaymentID]; ok && !p.IsRevoked() {
+			subscribed[plan.UserID] = true
+		}
+	}
+
+	var users []*models.User
+	for id := range subscribed {
+		if u, ok := m.users[id]; ok && u.BlockedAt == nil {
+			user := *u
+			users = append(users, &user)
+		}
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].ID < users[j].ID })
+	return users, nil
+}
+
+func (m *MemoryDB) ClaimWeeklyReport(ctx context.Context, report *models.WeeklyReport) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, stored := range m.weeklyReports {
+		if stored.UserID == report.UserID && stored.WeekStart.Equal(report.WeekStart) {
+			return false, nil
+		}
+	}
+
+	stored := *report
+	stored.ID = m.nextID()
+	stored.CreatedAt = time.Now()
+	m.weeklyReports = append(m.weeklyReports, &stored)
+
+	report.ID = stored.ID
+	report.CreatedAt = stored.CreatedAt
+	return true, nil
+}
+
+func (m *MemoryDB) GetWeeklyReport(ctx context.Context, id int64) (*models.WeeklyReport, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, stored := range m.weeklyReports {
+		if stored.ID == id {
+			r := *stored
+			return &r, nil
+		}
+	}
+	return nil, ErrNotFound
+}
@@ -0,0 +1,195 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"diet-bot/internal/models"
+)
+
+// UserRepo stores bot users and their questionnaire answers.
+type UserRepo interface {
+	// SaveUser inserts the user or updates the profile of an existing one with
+	// the same Telegram ID, setting user.ID either way.
+	SaveUser(ctx context.Context, user *models.User) error
+	GetUser(ctx context.Context, telegramID int64) (*models.User, error)
+	GetUserByID(ctx context.Context, id int64) (*models.User, error)
+	// SetUserTimezone stores an IANA time zone name for the user.
+	SetUserTimezone(ctx context.Context, telegramID int64, timezone string) error
+	// SetUserBodyFat stores the user's latest body fat estimate in percent.
+	SetUserBodyFat(ctx context.Context, telegramID int64, bodyFat float64) error
+	// SetUserScreening stores the user's answers to the medical screening.
+	SetUserScreening(ctx context.Context, telegramID int64, age int, conditions []string) error
+	// SetUserBlocked records whether the user has blocked the bot; the first
+	// time it was noticed is kept.
+	SetUserBlocked(ctx context.Context, telegramID int64, blocked bool) error
+}
+
+// PaymentRepo stores checkout payments and their status history.
+type PaymentRepo interface {
+	SavePayment(ctx context.Context, payment *models.Payment) error
+	GetPaymentByID(ctx context.Context, id int64) (*models.Payment, error)
+	GetPaymentByStripeID(ctx context.Context, stripePaymentID string) (*models.Payment, error)
+	GetPaymentByIntentID(ctx context.Context, paymentIntentID string) (*models.Payment, error)
+	ListPaymentsByStatus(ctx context.Context, status string, createdBefore time.Time) ([]*models.Payment, error)
+	SetPaymentIntentID(ctx context.Context, stripePaymentID, paymentIntentID string) error
+	// TransitionPaymentStatus fails with ErrInvalidTransition when the move is
+	// not allowed or the stored status no longer matches payment.Status.
+	TransitionPaymentStatus(ctx context.Context, payment *models.Payment, to string) error
+}
+
+// PlanRepo stores generated diet plans.
+type PlanRepo interface {
+	SaveDietPlan(ctx context.Context, plan *models.DietPlan) error
+	// GetDietPlan returns the user's latest plan whose payment was not revoked.
+	GetDietPlan(ctx context.Context, userID int64) (*models.DietPlan, error)
+	// GetDietPlanByID returns a plan whose payment was not revoked.
+	GetDietPlanByID(ctx context.Context, id int64) (*models.DietPlan, error)
+	// ListDietPlans returns up to limit of the user's plans whose payment was
+	// not revoked, newest first.
+	ListDietPlans(ctx context.Context, userID int64, limit int) ([]*models.DietPlan, error)
+	// CountPlanRevisions counts the revisions made under a payment, leaving
+	// out adaptations after weekly reports.
+	CountPlanRevisions(ctx context.Context, paymentID int64) (int, error)
+	// HasDietPlan reports whether a plan was saved for the payment.
+	HasDietPlan(ctx context.Context, paymentID int64) (bool, error)
+}
+
+// OutboxRepo queues side effects that must follow a committed transaction,
+// such as messages to the user.
+type OutboxRepo interface {
+	AddOutboxEvent(ctx context.Context, event *models.OutboxEvent) error
+	// ClaimOutboxEvents locks up to limit unprocessed events for lease so
+	// concurrent dispatchers do not deliver the same event twice.
+	ClaimOutboxEvents(ctx context.Context, limit int, lease time.Duration) ([]*models.OutboxEvent, error)
+	MarkOutboxEventProcessed(ctx context.Context, id int64) error
+	// MarkOutboxEventFailed records the error and releases the lease for a retry.
+	MarkOutboxEventFailed(ctx context.Context, id int64, lastError string) error
+}
+
+// WeightRepo stores weigh-ins, one per user and day.
+type WeightRepo interface {
+	// SaveWeightLog records the weight for log.LoggedOn, replacing an earlier
+	// entry for the same day.
+	SaveWeightLog(ctx context.Context, log *models.WeightLog) error
+	// ListWeightLogs returns the user's entries logged on or after since, oldest first.
+	ListWeightLogs(ctx context.Context, userID int64, since time.Time) ([]*models.WeightLog, error)
+	GetLatestWeightLog(ctx context.Context, userID int64) (*models.WeightLog, error)
+}
+
+// ReminderRepo stores scheduled reminders, one per user and kind.
+type ReminderRepo interface {
+	// SaveReminder creates or replaces the user's reminder of reminder.Kind.
+	SaveReminder(ctx context.Context, reminder *models.Reminder) error
+	ListReminders(ctx context.Context, userID int64) ([]*models.Reminder, error)
+	// ClaimDueReminders returns enabled reminders due at now whose user has not
+	// blocked the bot. Inside WithTx the rows stay locked until commit.
+	ClaimDueReminders(ctx context.Context, now time.Time, limit int) ([]*models.Reminder, error)
+	// RescheduleReminder sets the next run, and the last send time when sentAt is not nil.
+	RescheduleReminder(ctx context.Context, id int64, nextRunAt time.Time, sentAt *time.Time) error
+}
+
+// FoodRepo stores the food diary and the food composition database.
+type FoodRepo interface {
+	SaveFoodLogs(ctx context.Context, logs []*models.FoodLog) error
+	// ListFoodLogs returns the user's entries logged from from to to
+	// inclusive, oldest first.
+	ListFoodLogs(ctx context.Context, userID int64, from, to time.Time) ([]*models.FoodLog, error)
+	// UpsertFoods creates or replaces foods by source and external ID.
+	UpsertFoods(ctx context.Context, foods []*models.Food) error
+	// SearchFoods returns up to limit foods whose names are similar to query,
+	// best match first.
+	SearchFoods(ctx context.Context, query string, limit int) ([]*models.FoodMatch, error)
+}
+
+// ChatRepo stores the Q&A conversation each user has with the bot.
+type ChatRepo interface {
+	SaveChatMessages(ctx context.Context, messages []*models.ChatMessage) error
+	// ListChatMessages returns the user's latest limit messages that are not
+	// forgotten, oldest first.
+	ListChatMessages(ctx context.Context, userID int64, limit int) ([]*models.ChatMessage, error)
+	// CountChatMessages counts the user's messages with role written at or
+	// after since, forgotten ones included.
+	CountChatMessages(ctx context.Context, userID int64, role string, since time.Time) (int, error)
+	// SaveQuestion counts the messages with msg's role written since and saves
+	// msg unless quota were already written, failing with ErrQuotaExceeded.
+	// It returns the count before msg.
+	SaveQuestion(ctx context.Context, msg *models.ChatMessage, since time.Time, quota int) (int, error)
+	// ForgetChatMessages erases the content of the user's conversation and
+	// hides it from ListChatMessages.
+	ForgetChatMessages(ctx context.Context, userID int64) error
+}
+
+// ShoppingRepo stores shopping lists built from plans.
+type ShoppingRepo interface {
+	// SaveShoppingList stores the list with its items.
+	SaveShoppingList(ctx context.Context, list *models.ShoppingList) error
+	GetShoppingList(ctx context.Context, id int64) (*models.ShoppingList, error)
+	// ToggleShoppingItem ticks an item off or back on.
+	ToggleShoppingItem(ctx context.Context, listID int64, position int) error
+}
+
+// RecipeRepo caches generated recipes.
+type RecipeRepo interface {
+	GetRecipe(ctx context.Context, cacheKey string) (*models.Recipe, error)
+	// SaveRecipe stores the recipe under its cache key. When the key is taken,
+	// the stored recipe is kept and its ID is set on recipe.
+	SaveRecipe(ctx context.Context, recipe *models.Recipe) error
+}
+
+// ReportRepo stores weekly progress reports.
+type ReportRepo interface {
+	// ListSubscribers returns the users who have a plan whose payment was not
+	// revoked and who have not blocked the bot.
+	ListSubscribers(ctx context.Context) ([]*models.User, error)
+	// ClaimWeeklyReport stores the report unless the user already has one for
+	// that week, and reports whether it did.
+	ClaimWeeklyReport(ctx context.Context, report *models.WeeklyReport) (bool, error)
+	GetWeeklyReport(ctx context.Context, id int64) (*models.WeeklyReport, error)
+}
+
+// WaterRepo counts the water users drink, one counter per user and day.
+type WaterRepo interface {
+	// AddWater adds amount ml, or takes it away when negative, to the day's
+	// counter and returns the new total, which never drops below zero.
+	AddWater(ctx context.Context, userID int64, day time.Time, amount int) (int, error)
+	// GetWater returns the day's total, zero when nothing was logged.
+	GetWater(ctx context.Context, userID int64, day time.Time) (int, error)
+}
+
+// MeasurementRepo stores body measurements, one set per user and day.
+type MeasurementRepo interface {
+	// SaveMeasurement records the measurements for m.LoggedOn. A second set
+	// for the same day updates the first: sizes left at zero keep their earlier
+	// values, which are filled into m.
+	SaveMeasurement(ctx context.Context, m *models.Measurement) error
+	// ListMeasurements returns the user's entries logged on or after since, oldest first.
+	ListMeasurements(ctx context.Context, userID int64, since time.Time) ([]*models.Measurement, error)
+}
+
+// Store bundles every repository the bot uses. Lookups of missing records fail
+// with ErrNotFound.
+type Store interface {
+	UserRepo
+	PaymentRepo
+	PlanRepo
+	OutboxRepo
+	WeightRepo
+	ReminderRepo
+	FoodRepo
+	ChatRepo
+	ShoppingRepo
+	RecipeRepo
+	ReportRepo
+	WaterRepo
+	MeasurementRepo
+
+	// WithTx runs fn as a single unit of work and rolls everything back if fn
+	// returns an error.
+	WithTx(ctx context.Context, fn func(tx Store) error) error
+}
+
+var (
+	_ Store = (*PostgresDB)(nil)
+	_ Store = (*MemoryDB)(nil)
+)
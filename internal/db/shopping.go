@@ -0,0 +1,137 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"diet-bot/internal/models"
+
+	"github.com/jackc/pgx/v4"
+)
+
+func (db *PostgresDB) SaveShoppingList(ctx context.Context, list *models.ShoppingList) error {
+	return db.WithTx(ctx, func(tx Store) error {
+		q := tx.(*PostgresDB).q
+
+		err := q.QueryRow(ctx, `
+            INSERT INTO shopping_lists (user_id, plan_id, first_day, last_day)
+            VALUES ($1, $2, $3, $4)
+            RETURNING id, created_at
+        `, list.UserID, list.PlanID, list.FirstDay, list.LastDay).Scan(&list.ID, &list.CreatedAt)
+		if err != nil {
+			return err
+		}
+
+		for _, item := range list.Items {
+			_, err := q.Exec(ctx, `
+                INSERT INTO shopping_items (list_id, position, name, amount, unit, section, checked)
+                VALUES ($1, $2, $3, $4, $5, $6, $7)
+            `, list.ID, item.Position, item.Name, item.Amount, item.Unit, item.Section, item.Checked)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (db *PostgresDB) GetShoppingList(ctx context.Context, id int64) (*models.ShoppingList, error) {
+	var list models.ShoppingList
+	err := db.q.QueryRow(ctx, `
+        SELECT id, user_id, plan_id, first_day, last_day, created_at
+        FROM shopping_lists
+        WHERE id = $1
+    `, id).Scan(&list.ID, &list.UserID, &list.PlanID, &list.FirstDay, &list.LastDay, &list.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.q.Query(ctx, `
+        SELECT position, name, amount, unit, section, checked
+        FROM shopping_items
+        WHERE list_id = $1
+        ORDER BY position
+    `, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var item models.ShoppingItem
+		if err := rows.Scan(&item.Position, &item.Name, &item.Amount, &item.Unit, &item.Section, &item.Checked); err != nil {
+			return nil, err
+		}
+		list.Items = append(list.Items, item)
+	}
+
+	return &list, rows.Err()
+}
+
+func (db *PostgresDB) ToggleShoppingItem(ctx context.Context, listID int64, position int) error {
+	tag, err := db.q.Exec(ctx, `
+        UPDATE shopping_items SET checked = NOT checked
+        WHERE list_id = $1 AND position = $2
+    `, listID, position)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (m *MemoryDB) SaveShoppingList(ctx context.Context, list *models.ShoppingList) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored := copyShoppingList(list)
+	stored.ID = m.nextID()
+	stored.CreatedAt = time.Now()
+	m.shoppingLists = append(m.shoppingLists, stored)
+
+	list.ID = stored.ID
+	list.CreatedAt = stored.CreatedAt
+	return nil
+}
+
+func (m *MemoryDB) GetShoppingList(ctx context.Context, id int64) (*models.ShoppingList, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, stored := range m.shoppingLists {
+		if stored.ID == id {
+			return copyShoppingList(stored), nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (m *MemoryDB) ToggleShoppingItem(ctx context.Context, listID int64, position int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, stored := range m.shoppingLists {
+		if stored.ID != listID {
+			continue
+		}
+		for i := range stored.Items {
+			if stored.Items[i].Position == position {
+				stored.Items[i].Checked = !stored.Items[i].Checked
+				return nil
+			}
+		}
+	}
+	return ErrNotFound
+}
+
+func copyShoppingList(list *models.ShoppingList) *models.ShoppingList {
+	c := *list
+	c.Items = append([]models.ShoppingItem(nil), list.Items...)
+	return &c
+}
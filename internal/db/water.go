@@ -0,0 +1,62 @@
+package db
+
+import (
+	"context"
+	"diet-bot/internal/models"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+func (db *PostgresDB) AddWater(ctx context.Context, userID int64, day time.Time, amount int) (int, error) {
+	query := `
+        INSERT INTO water_logs (user_id, logged_on, amount)
+        VALUES ($1, $2, GREATEST($3::integer, 0))
+        ON CONFLICT (user_id, logged_on) DO UPDATE SET
+            amount = GREATEST(water_logs.amount + $3::integer, 0),
+            updated_at = NOW()
+        RETURNING amount
+    `
+
+	var total int
+	err := db.q.QueryRow(ctx, query, userID, day, amount).Scan(&total)
+	return total, err
+}
+
+func (db *PostgresDB) GetWater(ctx context.Context, userID int64, day time.Time) (int, error) {
+	var total int
+	err := db.q.QueryRow(ctx, `SELECT amount FROM water_logs WHERE user_id = $1 AND logged_on = $2`, userID, day).Scan(&total)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, nil
+	}
+	return total, err
+}
+
+func (m *MemoryDB) AddWater(ctx context.Context, userID int64, day time.Time, amount int) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, stored := range m.waterLogs {
+		if stored.UserID == userID && stored.LoggedOn.Equal(day) {
+			stored.Amount = max(stored.Amount+amount, 0)
+			stored.UpdatedAt = time.Now()
+			return stored.Amount, nil
+		}
+	}
+	log := &models.WaterLog{UserID: userID, LoggedOn: day, Amount: max(amount, 0), UpdatedAt: time.Now()}
+	m.waterLogs = append(m.waterLogs, log)
+	return log.Amount, nil
+}
+
+func (m *MemoryDB) GetWater(ctx context.Context, userID int64, day time.Time) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, stored := range m.waterLogs {
+		if stored.UserID == userID && stored.LoggedOn.Equal(day) {
+			return stored.Amount, nil
+		}
+	}
+	return 0, nil
+}
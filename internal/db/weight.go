@@ -0,0 +1,125 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"time"
+
+	"diet-bot/internal/models"
+
+	"github.com/jackc/pgx/v4"
+)
+
+func (db *PostgresDB) SaveWeightLog(ctx context.Context, log *models.WeightLog) error {
+	query := `
+        INSERT INTO weight_logs (user_id, weight, logged_on)
+        VALUES ($1, $2, $3)
+        ON CONFLICT (user_id, logged_on) DO UPDATE SET
+            weight = EXCLUDED.weight,
+            created_at = CURRENT_TIMESTAMP
+        RETURNING id, created_at
+    `
+
+	return db.q.QueryRow(ctx, query, log.UserID, log.Weight, log.LoggedOn).Scan(&log.ID, &log.CreatedAt)
+}
+
+func (db *PostgresDB) ListWeightLogs(ctx context.Context, userID int64, since time.Time) ([]*models.WeightLog, error) {
+	query := `
+        SELECT id, user_id, weight, logged_on, created_at
+        FROM weight_logs
+        WHERE user_id = $1 AND logged_on >= $2
+        ORDER BY logged_on
+    `
+
+	rows, err := db.q.Query(ctx, query, userID, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var logs []*models.WeightLog
+	for rows.Next() {
+		var log models.WeightLog
+		if err := rows.Scan(&log.ID, &log.UserID, &log.Weight, &log.LoggedOn, &log.CreatedAt); err != nil {
+			return nil, err
+		}
+		logs = append(logs, &log)
+	}
+
+	return logs, rows.Err()
+}
+
+func (db *PostgresDB) GetLatestWeightLog(ctx context.Context, userID int64) (*models.WeightLog, error) {
+	query := `
+        SELECT id, user_id, weight, logged_on, created_at
+        FROM weight_logs
+        WHERE user_id = $1
+        ORDER BY logged_on DESC
+        LIMIT 1
+    `
+
+	var log models.WeightLog
+	err := db.q.QueryRow(ctx, query, userID).Scan(&log.ID, &log.UserID, &log.Weight, &log.LoggedOn, &log.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &log, nil
+}
+
+func (m *MemoryDB) SaveWeightLog(ctx context.Context, log *models.WeightLog) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	for _, stored := range m.weightLogs {
+		if stored.UserID == log.UserID && stored.LoggedOn.Equal(log.LoggedOn) {
+			stored.Weight = log.Weight
+			stored.CreatedAt = now
+			log.ID = stored.ID
+			log.CreatedAt = now
+			return nil
+		}
+	}
+
+	stored := *log
+	stored.ID = m.nextID()
+	stored.CreatedAt = now
+	m.weightLogs = append(m.weightLogs, &stored)
+	sort.SliceStable(m.weightLogs, func(i, j int) bool { return m.weightLogs[i].LoggedOn.Before(m.weightLogs[j].LoggedOn) })
+
+	log.ID = stored.ID
+	log.CreatedAt = now
+	return nil
+}
+
+func (m *MemoryDB) ListWeightLogs(ctx context.Context, userID int64, since time.Time) ([]*models.WeightLog, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var logs []*models.WeightLog
+	for _, stored := range m.weightLogs {
+		if stored.UserID == userID && !stored.LoggedOn.Before(since) {
+			log := *stored
+			logs = append(logs, &log)
+		}
+	}
+	return logs, nil
+}
+
+func (m *MemoryDB) GetLatestWeightLog(ctx context.Context, userID int64) (*models.WeightLog, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := len(m.weightLogs) - 1; i >= 0; i-- {
+		if m.weightLogs[i].UserID == userID {
+			log := *m.weightLogs[i]
+			return &log, nil
+		}
+	}
+	return nil, ErrNotFound
+}
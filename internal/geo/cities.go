@@ -0,0 +1,105 @@
+// Package geo resolves a user's time zone offline from a city name or a
+// shared location, using an embedded list of cities.
+package geo
+
+import (
+	_ "embed"
+	"encoding/csv"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+//go:embed cities.csv
+var citiesCSV string
+
+// City is an entry of the embedded city list.
+type City struct {
+	Name     string
+	Aliases  []string
+	Lat, Lon float64
+	Timezone string
+}
+
+var cities = mustLoadCities(citiesCSV)
+
+func mustLoadCities(data string) []City {
+	records, err := csv.NewReader(strings.NewReader(data)).ReadAll()
+	if err != nil {
+		panic(fmt.Sprintf("geo: invalid cities.csv: %v", err))
+	}
+
+	var list []City
+	for i, rec := range records[1:] {
+		lat, errLat := strconv.ParseFloat(rec[2], 64)
+		lon, errLon := strconv.ParseFloat(rec[3], 64)
+		if errLat != nil || errLon != nil {
+			panic(fmt.Sprintf("geo: invalid coordinates on line %d of cities.csv", i+2))
+		}
+		list = append(list, City{
+			Name:     rec[0],
+			Aliases:  strings.Split(rec[1], ";"),
+			Lat:      lat,
+			Lon:      lon,
+			Timezone: rec[4],
+		})
+	}
+	return list
+}
+
+// Cities returns the embedded city list.
+func Cities() []City {
+	return cities
+}
+
+// normalize folds case, ё and the "г." prefix so that "г. Москва" matches "москва".
+func normalize(s string) string {
+	s = strings.ToLower(strings.TrimSpace(s))
+	s = strings.ReplaceAll(s, "ё", "е")
+	s = strings.TrimPrefix(s, "г.")
+	s = strings.TrimPrefix(s, "город ")
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// FindCity looks a city up by its Russian name or one of its aliases.
+func FindCity(query string) (City, bool) {
+	q := normalize(query)
+	if q == "" {
+		return City{}, false
+	}
+	for _, c := range cities {
+		if normalize(c.Name) == q {
+			return c, true
+		}
+		for _, alias := range c.Aliases {
+			if normalize(alias) == q {
+				return c, true
+			}
+		}
+	}
+	return City{}, false
+}
+
+// NearestCity returns the listed city closest to the coordinates and the
+// distance to it in kilometres.
+func NearestCity(lat, lon float64) (City, float64) {
+	best, bestDistance := cities[0], math.Inf(1)
+	for _, c := range cities {
+		if d := distanceKm(lat, lon, c.Lat, c.Lon); d < bestDistance {
+			best, bestDistance = c, d
+		}
+	}
+	return best, bestDistance
+}
+
+// distanceKm is the great-circle distance by the haversine formula.
+func distanceKm(lat1, lon1, lat2, lon2 float64) float64 {
+	const earthRadiusKm = 6371
+	rad := math.Pi / 180
+	dLat := (lat2 - lat1) * rad
+	dLon := (lon2 - lon1) * rad
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(lat1*rad)*math.Cos(lat2*rad)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadiusKm * math.Asin(math.Sqrt(a))
+}
@@ -0,0 +1,50 @@
+package geo
+
+import (
+	"testing"
+	"time"
+	_ "time/tzdata"
+)
+
+func TestEveryCityHasAValidTimezone(t *testing.T) {
+	for _, c := range Cities() {
+		if _, err := time.LoadLocation(c.Timezone); err != nil {
+			t.Errorf("%s: %v", c.Name, err)
+		}
+	}
+}
+
+func TestFindCity(t *testing.T) {
+	for query, want := range map[string]string{
+		"Москва":        "Europe/Moscow",
+		"  г. москва  ": "Europe/Moscow",
+		"питер":         "Europe/Moscow",
+		"Kiev":          "Europe/Kyiv",
+		"Кишинев":       "Europe/Chisinau",
+		"new   york":    "America/New_York",
+		"Новосибирск":   "Asia/Novosibirsk",
+	} {
+		c, ok := FindCity(query)
+		if !ok || c.Timezone != want {
+			t.Errorf("FindCity(%q) = %+v, %v; want %s", query, c, ok, want)
+		}
+	}
+	for _, query := range []string{"", "Атлантида"} {
+		if c, ok := FindCity(query); ok {
+			t.Errorf("FindCity(%q) = %+v", query, c)
+		}
+	}
+}
+
+func TestNearestCity(t *testing.T) {
+	// Akademgorodok is about 25 km from Novosibirsk
+	c, d := NearestCity(54.85, 83.10)
+	if c.Name != "Новосибирск" || d > 30 {
+		t.Fatalf("NearestCity = %s at %.0f km", c.Name, d)
+	}
+
+	// Moscow to Saint Petersburg is about 634 km
+	if d := distanceKm(55.7558, 37.6173, 59.9343, 30.3351); d < 620 || d > 650 {
+		t.Fatalf("distanceKm = %.0f", d)
+	}
+}
@@ -0,0 +1,65 @@
+package gpt
+
+import (
+	"context"
+	"diet-bot/internal/models"
+	"fmt"
+	"strings"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+const chatSystemPrompt = "Ты диетолог и отвечаешь на вопросы пользователя о его плане питания. " +
+	"Отвечай по-русски, коротко и по делу, опираясь на план и анкету ниже. " +
+	"Не ставь диагнозы и не давай советов о болезнях, лекарствах, беременности и расстройствах пищевого поведения: " +
+	"в таких случаях вежливо откажись и посоветуй обратиться к врачу. " +
+	"На вопросы не о питании, тренировках и самочувствии при похудении отвечай, что помогаешь только с питанием."
+
+// QuestionContext is what the model knows when answering a question.
+type QuestionContext struct {
+	User *models.User
+	// PlanText is the user's latest plan, empty if they have none
+	PlanText string
+	// History is the conversation so far, oldest first
+	History []*models.ChatMessage
+}
+
+// AnswerQuestion answers a follow-up question such as "чем заменить творог?"
+// with the user's plan, profile and earlier conversation as context.
+func (c *Client) AnswerQuestion(ctx context.Context, qc QuestionContext, question string) (string, error) {
+	var profile strings.Builder
+	fmt.Fprintf(&profile, "Анкета: пол %s, рост %d см, вес %g кг, цель: %s вес.",
+		qc.User.Gender, qc.User.Height, qc.User.Weight, qc.User.Goal)
+	if qc.PlanText != "" {
+		profile.WriteString("\n\nПлан питания пользователя:\n" + qc.PlanText)
+	} else {
+		profile.WriteString("\n\nПлана питания у пользователя пока нет.")
+	}
+
+	messages := []openai.ChatCompletionMessage{
+		{Role: openai.ChatMessageRoleSystem, Content: chatSystemPrompt},
+		{Role: openai.ChatMessageRoleSystem, Content: profile.String()},
+	}
+	for _, msg := range qc.History {
+		role := openai.ChatMessageRoleUser
+		if msg.Role == models.ChatRoleAssistant {
+			role = openai.ChatMessageRoleAssistant
+		}
+		messages = append(messages, openai.ChatCompletionMessage{Role: role, Content: msg.Content})
+	}
+	messages = append(messages, openai.ChatCompletionMessage{Role: openai.ChatMessageRoleUser, Content: question})
+
+	resp, err := c.client.CreateChatCompletion(ctx, openai.ChatCompletionRequest{
+		Model:       c.model,
+		Messages:    messages,
+		MaxTokens:   700,
+		Temperature: 0.5,
+	})
+	if err != nil {
+		return "", err
+	}
+	if len(resp.Choices) == 0 {
+		return "", fmt.Errorf("no response from GPT API")
+	}
+	return strings.TrimSpace(resp.Choices[0].Message.Content), nil
+}
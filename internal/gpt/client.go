@@ -3,18 +3,59 @@ package gpt
 
 import (
 	"context"
+	"diet-bot/internal/models"
+	"encoding/json"
 	"fmt"
+	"strings"
+
+	openai "github.com/sashabaranov/go-openai"
+	"github.com/sashabaranov/go-openai/jsonschema"
 )
 
+// DietPlanPromptVersion identifies the wording of the diet plan prompt. Bump it
+// whenever the prompt changes so stored plans can be traced to it.
+const DietPlanPromptVersion = "diet-plan-v3"
+
+// PlanResult is a generated plan together with how it was produced.
+type PlanResult struct {
+	Text             string
+	Data             *models.PlanData
+	Model            string
+	PromptVersion    string
+	PromptTokens     int
+	CompletionTokens int
+}
+
 type Client struct {
-	client *openai.Client
-	model  string
+	client      *openai.Client
+	model       string
+	visionModel string
 }
 
+const (
+	// defaultModel supports the structured outputs plans and meal estimates use
+	defaultModel = "gpt-4o"
+	// defaultVisionModel reads meal photos unless WithVisionModel sets another.
+	defaultVisionModel = "gpt-4o"
+)
+
 func NewClient(apiKey string) *Client {
 	return &Client{
-		client: openai.NewClient(apiKey),
-		model:  "gpt-4",
+		client:      openai.NewClient(apiKey),
+		model:       defaultModel,
+		visionModel: defaultVisionModel,
+	}
+}
+
+// NewClientWithBaseURL creates a client for an OpenAI-compatible API served at baseURL.
+func NewClientWithBaseURL(apiKey, baseURL string) *Client {
+	config := openai.DefaultConfig(apiKey)
+	config.BaseURL = baseURL
+
+	return &Client{
+		client:      openai.NewClientWithConfig(config),
+		model:       defaultModel,
+		visionModel: defaultVisionModel,
 	}
 }
 
@@ -23,54 +64,104 @@ func (c *Client) WithModel(model string) *Client {
 	return c
 }
 
-func (c *Client) GenerateDietPlan(ctx context.Context, user *models.User) (string, error) {
-	// Подготовка запроса для GPT
-	gender := user.Gender
-	height := user.Height
-	weight := user.Weight
-	goal := user.Goal
-
-	prompt := fmt.Sprintf(
-		"Создай персонализированный план питания для человека со следующими параметрами:\n"+
-			"- Пол: %s\n"+
-			"- Рост: %d см\n"+
-			"- Вес: %d кг\n"+
-			"- Цель: %s вес\n\n"+
-			"План должен включать:\n"+
-			"1. Общее количество калорий в день\n"+
-			"2. Распределение белков, жиров и углеводов\n"+
-			"3. Пример меню на 7 дней с указанием времени приема пищи\n"+
-			"4. Рекомендации по питьевому режиму\n"+
-			"5. Дополнительные рекомендации для достижения цели\n",
-		gender, height, weight, goal,
-	)
-
-	// Создание запроса к OpenAI
-	req := openai.ChatCompletionRequest{
+// WithVisionModel sets the image-capable model used for meal photos. An empty
+// name keeps the default.
+func (c *Client) WithVisionModel(model string) *Client {
+	if model != "" {
+		c.visionModel = model
+	}
+	return c
+}
+
+// GenerateDietPlan creates a structured seven-day plan for the request's
+// target, or revises the previous plan when the request has one.
+func (c *Client) GenerateDietPlan(ctx context.Context, req PlanRequest) (*PlanResult, error) {
+	resp, err := c.client.CreateChatCompletion(ctx, openai.ChatCompletionRequest{
 		Model: c.model,
 		Messages: []openai.ChatCompletionMessage{
-			{
-				Role:    openai.ChatMessageRoleSystem,
-				Content: "Ты опытный диетолог. Твоя задача создать персонализированный план питания на основе параметров пользователя.",
-			},
-			{
-				Role:    openai.ChatMessageRoleUser,
-				Content: prompt,
-			},
+			{Role: openai.ChatMessageRoleSystem, Content: systemPrompt(c.model, planSystemPrompt, planSchema)},
+			{Role: openai.ChatMessageRoleUser, Content: planPrompt(req)},
 		},
-		MaxTokens:   2500,
-		Temperature: 0.7,
+		ResponseFormat: responseFormat(c.model, "diet_plan", planSchema),
+		MaxTokens:      8000,
+		Temperature:    0.7,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(resp.Choices) == 0 {
+		return nil, fmt.Errorf("no response from GPT API")
 	}
 
-	// Вызов API OpenAI
-	resp, err := c.client.CreateChatCompletion(ctx, req)
+	var data models.PlanData
+	if err := planSchema.Unmarshal(resp.Choices[0].Message.Content, &data); err != nil {
+		return nil, fmt.Errorf("failed to parse diet plan: %w", err)
+	}
+	if len(data.Days) == 0 {
+		return nil, fmt.Errorf("diet plan has no days")
+	}
+	if req.Previous != nil && req.Previous.Data != nil {
+		data = mergeRevision(*req.Previous.Data, data, req)
+	}
+
+	// The API reports the exact model snapshot that answered
+	model := resp.Model
+	if model == "" {
+		model = c.model
+	}
+
+	return &PlanResult{
+		Text:             FormatPlan(&data),
+		Data:             &data,
+		Model:            model,
+		PromptVersion:    DietPlanPromptVersion,
+		PromptTokens:     resp.Usage.PromptTokens,
+		CompletionTokens: resp.Usage.CompletionTokens,
+	}, nil
+}
+
+// mustGenerateSchema generates the JSON schema of a response type at start-up.
+// A type the generator does not support is a programming error, so it panics.
+func mustGenerateSchema(v interface{}) *jsonschema.Definition {
+	schema, err := jsonschema.GenerateSchemaForType(v)
 	if err != nil {
-		return "", err
+		panic(fmt.Sprintf("gpt: failed to generate schema for %T: %v", v, err))
 	}
+	return schema
+}
 
-	if len(resp.Choices) == 0 {
-		return "", fmt.Errorf("no response from GPT API")
+// supportsStructuredOutputs reports whether the model accepts a json_schema
+// response format. GPT-4 and GPT-3.5 predate structured outputs.
+func supportsStructuredOutputs(model string) bool {
+	return model != "gpt-4" && !strings.HasPrefix(model, "gpt-4-") && !strings.HasPrefix(model, "gpt-3.5")
+}
+
+// responseFormat asks the model for JSON matching schema: strictly where the
+// model supports structured outputs, as a plain JSON object otherwise.
+func responseFormat(model, name string, schema *jsonschema.Definition) *openai.ChatCompletionResponseFormat {
+	if !supportsStructuredOutputs(model) {
+		return &openai.ChatCompletionResponseFormat{Type: openai.ChatCompletionResponseFormatTypeJSONObject}
+	}
+	return &openai.ChatCompletionResponseFormat{
+		Type: openai.ChatCompletionResponseFormatTypeJSONSchema,
+		JSONSchema: &openai.ChatCompletionResponseFormatJSONSchema{
+			Name:   name,
+			Schema: schema,
+			Strict: true,
+		},
 	}
+}
 
-	return resp.Choices[0].Message.Content, nil
+// systemPrompt spells the schema out for models that cannot be given it as a
+// response format.
+func systemPrompt(model, prompt string, schema *jsonschema.Definition) string {
+	if supportsStructuredOutputs(model) {
+		return prompt
+	}
+	encoded, err := json.Marshal(schema)
+	if err != nil {
+		return prompt
+	}
+	return prompt + "\n\nОтветь только JSON-объектом по этой JSON Schema:\n" + string(encoded)
 }
@@ -0,0 +1,30 @@
+package gpt
+
+import (
+	"strings"
+	"testing"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+func TestResponseFormat(t *testing.T) {
+	for _, model := range []string{"gpt-4o", "gpt-4o-mini", "gpt-4.1", "o3-mini"} {
+		format := responseFormat(model, "meal_estimate", mealSchema)
+		if format.Type != openai.ChatCompletionResponseFormatTypeJSONSchema || format.JSONSchema.Schema != mealSchema {
+			t.Errorf("%s: format %+v, want json_schema", model, format)
+		}
+		if prompt := systemPrompt(model, mealSystemPrompt, mealSchema); prompt != mealSystemPrompt {
+			t.Errorf("%s: system prompt changed: %q", model, prompt)
+		}
+	}
+
+	for _, model := range []string{"gpt-4", "gpt-4-turbo", "gpt-3.5-turbo"} {
+		format := responseFormat(model, "meal_estimate", mealSchema)
+		if format.Type != openai.ChatCompletionResponseFormatTypeJSONObject || format.JSONSchema != nil {
+			t.Errorf("%s: format %+v, want json_object", model, format)
+		}
+		if prompt := systemPrompt(model, mealSystemPrompt, mealSchema); !strings.Contains(prompt, `"items"`) {
+			t.Errorf("%s: system prompt lacks the schema: %q", model, prompt)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package gpt
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// MealItem is one food recognised in a meal description.
+type MealItem struct {
+	Name     string  `json:"name" description:"Название продукта или блюда по-русски, в именительном падеже"`
+	Grams    float64 `json:"grams" description:"Масса порции в граммах; если не указана, типичная порция"`
+	Calories float64 `json:"calories" description:"Энергетическая ценность порции, ккал"`
+	Protein  float64 `json:"protein" description:"Белки в порции, г"`
+	Fat      float64 `json:"fat" description:"Жиры в порции, г"`
+	Carbs    float64 `json:"carbs" description:"Углеводы в порции, г"`
+}
+
+// MealEstimate is the structured answer to EstimateMeal.
+type MealEstimate struct {
+	Items []MealItem `json:"items" description:"Съеденные продукты; пустой список, если в тексте нет еды"`
+}
+
+// MealEstimator estimates the food in a meal description or photo. *Client
+// implements it with chat completions.
+type MealEstimator interface {
+	EstimateMeal(ctx context.Context, text string) (*MealEstimate, error)
+	EstimateMealPhoto(ctx context.Context, photo []byte, caption string) (*MealEstimate, error)
+}
+
+// mealSchema constrains the meal estimate the model returns.
+var mealSchema = mustGenerateSchema(MealEstimate{})
+
+const mealSystemPrompt = "Ты диетолог и ведёшь дневник питания. Разбери приём пищи на отдельные продукты " +
+	"и оцени для каждой порции калорийность и БЖУ по стандартным таблицам состава продуктов. " +
+	"Если масса не указана, возьми типичную порцию. Не придумывай продукты, которых нет в приёме пищи."
+
+// EstimateMeal splits a free-text meal description such as "овсянка 60г,
+// банан" into items and estimates the energy and macronutrients of each.
+func (c *Client) EstimateMeal(ctx context.Context, text string) (*MealEstimate, error) {
+	return c.estimateMeal(ctx, c.model, openai.ChatCompletionMessage{
+		Role:    openai.ChatMessageRoleUser,
+		Content: text,
+	})
+}
+
+// EstimateMealPhoto recognises the dishes on a JPEG photo of a plate with the
+// vision model and estimates their portions. The caption, if any, is passed
+// along as a hint.
+func (c *Client) EstimateMealPhoto(ctx context.Context, photo []byte, caption string) (*MealEstimate, error) {
+	hint := "Что на фото и сколько это весит?"
+	if caption != "" {
+		hint += " Подпись пользователя: " + caption
+	}
+
+	return c.estimateMeal(ctx, c.visionModel, openai.ChatCompletionMessage{
+		Role: openai.ChatMessageRoleUser,
+		MultiContent: []openai.ChatMessagePart{
+			{Type: openai.ChatMessagePartTypeText, Text: hint},
+			{Type: openai.ChatMessagePartTypeImageURL, ImageURL: &openai.ChatMessageImageURL{
+				URL:    "data:image/jpeg;base64," + base64.StdEncoding.EncodeToString(photo),
+				Detail: openai.ImageURLDetailAuto,
+			}},
+		},
+	})
+}
+
+func (c *Client) estimateMeal(ctx context.Context, model string, meal openai.ChatCompletionMessage) (*MealEstimate, error) {
+	req := openai.ChatCompletionRequest{
+		Model: model,
+		Messages: []openai.ChatCompletionMessage{
+			{Role: openai.ChatMessageRoleSystem, Content: systemPrompt(model, mealSystemPrompt, mealSchema)},
+			meal,
+		},
+		ResponseFormat: responseFormat(model, "meal_estimate", mealSchema),
+		MaxTokens:      800,
+		Temperature:    0.2,
+	}
+
+	resp, err := c.client.CreateChatCompletion(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.Choices) == 0 {
+		return nil, fmt.Errorf("no response from GPT API")
+	}
+
+	var estimate MealEstimate
+	if err := mealSchema.Unmarshal(resp.Choices[0].Message.Content, &estimate); err != nil {
+		return nil, fmt.Errorf("failed to parse meal estimate: %w", err)
+	}
+	return &estimate, nil
+}
@@ -0,0 +1,141 @@
+package gpt
+
+import (
+	"diet-bot/internal/models"
+	"diet-bot/internal/nutrition"
+	"diet-bot/internal/safety"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// PlanRequest describes the plan to generate. Previous and Revision are set
+// when an existing plan is being adjusted.
+type PlanRequest struct {
+	User   *models.User
+	Target nutrition.Nutrients
+
+	Previous *models.DietPlan
+	Revision string // one of models.Revision*
+	Day      int    // the day a day or meal revision changes
+	Meal     int    // the meal, from 1, a meal revision changes
+}
+
+// planSchema constrains the plan the model returns.
+var planSchema = mustGenerateSchema(models.PlanData{})
+
+const planSystemPrompt = "Ты опытный диетолог. Твоя задача создать персонализированный план питания на основе параметров пользователя. " +
+	"Используй доступные в России продукты, указывай массу продуктов на одну порцию и следи, чтобы калорийность дня совпадала с целевой."
+
+// conditionNotes tell the model how to plan for conditions the bot plans
+// diets for despite them. Conditions the bot refuses never reach the prompt.
+var conditionNotes = map[string]string{
+	safety.ConditionDiabetes: "У пользователя сахарный диабет: выбирай продукты с низким гликемическим индексом, " +
+		"распредели углеводы равномерно по приёмам пищи, исключи сахар, сладкие напитки и сладости.",
+}
+
+// planPrompt asks for a new plan or, with a previous one, for its revision.
+func planPrompt(req PlanRequest) string {
+	u := req.User
+	var b strings.Builder
+	fmt.Fprintf(&b, "Параметры пользователя:\n- Пол: %s\n- Рост: %d см\n- Вес: %g кг\n- Цель: %s вес\n", u.Gender, u.Height, u.Weight, u.Goal)
+	if u.Age > 0 {
+		fmt.Fprintf(&b, "- Возраст: %d\n", u.Age)
+	}
+	b.WriteString("\n")
+	for _, condition := range u.Conditions {
+		if note, ok := conditionNotes[condition]; ok {
+			b.WriteString(note + "\n\n")
+		}
+	}
+	fmt.Fprintf(&b, "Целевая калорийность: %.0f ккал в день, белки %.0f г, жиры %.0f г, углеводы %.0f г.\n\n",
+		req.Target.Calories, req.Target.Protein, req.Target.Fat, req.Target.Carbs)
+
+	if req.Previous == nil {
+		b.WriteString("Составь меню на 7 дней: 4–5 приёмов пищи в день со временем, блюдом, калорийностью и продуктами на порцию. " +
+			"Добавь рекомендации по питьевому режиму и для достижения цели.")
+		return b.String()
+	}
+
+	if req.Previous.Data != nil {
+		previous, _ := json.Marshal(req.Previous.Data)
+		b.WriteString("Предыдущий план в JSON:\n" + string(previous) + "\n\n")
+	} else {
+		b.WriteString("Предыдущий план:\n" + req.Previous.PlanText + "\n\n")
+	}
+
+	switch req.Revision {
+	case models.RevisionDay:
+		fmt.Fprintf(&b, "Замени меню дня %d другими блюдами с той же калорийностью. Остальные дни верни без изменений.", req.Day)
+	case models.RevisionMeal:
+		dish := ""
+		if day := req.Previous.Data.FindDay(req.Day); day != nil && req.Meal <= len(day.Meals) {
+			dish = day.Meals[req.Meal-1].Dish
+		}
+		fmt.Fprintf(&b, "Замени блюдо «%s» (день %d, приём пищи %d) другим с близкой калорийностью. Всё остальное верни без изменений.", dish, req.Day, req.Meal)
+	case models.RevisionCheaper:
+		b.WriteString("Сделай план дешевле: замени дорогие продукты доступными, сохранив калорийность и БЖУ.")
+	case models.RevisionFaster:
+		b.WriteString("Сделай блюда проще: не больше 20 минут готовки на блюдо, сохранив калорийность и БЖУ.")
+	case models.RevisionAdapt:
+		b.WriteString("Калорийность изменилась по итогам недели. Пересчитай план под новую целевую калорийность и БЖУ, " +
+			"по возможности сохранив блюда и изменив порции.")
+	default:
+		b.WriteString("Составь новый вариант плана на 7 дней с другими блюдами, сохранив калорийность и БЖУ.")
+	}
+	return b.String()
+}
+
+// mergeRevision keeps everything a day or meal revision was not asked to
+// change, whatever the model returned for it.
+func mergeRevision(previous, revised models.PlanData, req PlanRequest) models.PlanData {
+	switch req.Revision {
+	case models.RevisionDay, models.RevisionMeal:
+	default:
+		return revised
+	}
+
+	day := revised.FindDay(req.Day)
+	if day == nil {
+		return previous
+	}
+	merged := previous
+	merged.Days = append([]models.PlanDay(nil), previous.Days...)
+	for i := range merged.Days {
+		if merged.Days[i].Day != req.Day {
+			continue
+		}
+		if req.Revision == models.RevisionDay {
+			merged.Days[i] = *day
+			break
+		}
+		meals := append([]models.PlanMeal(nil), merged.Days[i].Meals...)
+		if req.Meal >= 1 && req.Meal <= len(meals) && req.Meal <= len(day.Meals) {
+			meals[req.Meal-1] = day.Meals[req.Meal-1]
+		}
+		merged.Days[i].Meals = meals
+	}
+	return merged
+}
+
+// FormatPlan renders a structured plan as the message the user receives.
+func FormatPlan(data *models.PlanData) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Калорийность: %d ккал в день (Б %d / Ж %d / У %d г)", data.DailyCalories, data.Protein, data.Fat, data.Carbs)
+	if data.WaterML > 0 {
+		fmt.Fprintf(&b, "\nВода: %d мл в день", data.WaterML)
+	}
+	for _, day := range data.Days {
+		fmt.Fprintf(&b, "\n\n📅 День %d", day.Day)
+		for _, meal := range day.Meals {
+			fmt.Fprintf(&b, "\n%s %s — %s, %d ккал", meal.Time, meal.Name, meal.Dish, meal.Calories)
+		}
+	}
+	if len(data.Tips) > 0 {
+		b.WriteString("\n\nРекомендации:")
+		for _, tip := range data.Tips {
+			b.WriteString("\n• " + tip)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,72 @@
+package gpt
+
+import (
+	"diet-bot/internal/models"
+	"strings"
+	"testing"
+)
+
+func testPlanData(dish string) models.PlanData {
+	var days []models.PlanDay
+	for d := 1; d <= 3; d++ {
+		days = append(days, models.PlanDay{Day: d, Meals: []models.PlanMeal{
+			{Time: "08:00", Name: "Завтрак", Dish: dish + " утро", Calories: 400},
+			{Time: "19:00", Name: "Ужин", Dish: dish + " вечер", Calories: 600},
+		}})
+	}
+	return models.PlanData{DailyCalories: 2000, Days: days}
+}
+
+func TestMergeRevision(t *testing.T) {
+	previous, revised := testPlanData("старое"), testPlanData("новое")
+
+	day := mergeRevision(previous, revised, PlanRequest{Revision: models.RevisionDay, Day: 2})
+	if day.Days[1].Meals[0].Dish != "новое утро" || day.Days[0].Meals[0].Dish != "старое утро" || day.Days[2].Meals[1].Dish != "старое вечер" {
+		t.Fatalf("day revision: %+v", day.Days)
+	}
+
+	meal := mergeRevision(previous, revised, PlanRequest{Revision: models.RevisionMeal, Day: 3, Meal: 2})
+	if meal.Days[2].Meals[1].Dish != "новое вечер" || meal.Days[2].Meals[0].Dish != "старое утро" {
+		t.Fatalf("meal revision: %+v", meal.Days[2])
+	}
+	if previous.Days[2].Meals[1].Dish != "старое вечер" {
+		t.Fatal("merge modified the previous plan")
+	}
+
+	whole := mergeRevision(previous, revised, PlanRequest{Revision: models.RevisionCheaper})
+	if whole.Days[0].Meals[0].Dish != "новое утро" {
+		t.Fatalf("cheaper revision kept old dishes: %+v", whole.Days[0])
+	}
+
+	// A reply without the requested day leaves the plan as it was
+	missing := mergeRevision(previous, revised, PlanRequest{Revision: models.RevisionDay, Day: 9})
+	if missing.Days[0].Meals[0].Dish != "старое утро" {
+		t.Fatalf("missing day: %+v", missing.Days[0])
+	}
+}
+
+func TestFormatPlan(t *testing.T) {
+	data := testPlanData("каша")
+	data.Tips = []string{"Пейте воду."}
+	text := FormatPlan(&data)
+	for _, want := range []string{"Калорийность: 2000 ккал в день", "📅 День 3", "19:00 Ужин — каша вечер, 600 ккал", "• Пейте воду."} {
+		if !strings.Contains(text, want) {
+			t.Errorf("FormatPlan is missing %q:\n%s", want, text)
+		}
+	}
+}
+
+func TestPlanPromptConditions(t *testing.T) {
+	user := &models.User{Gender: "Женский", Height: 165, Weight: 70, Goal: "Снизить", Age: 45, Conditions: []string{"diabetes"}}
+	prompt := planPrompt(PlanRequest{User: user})
+	for _, want := range []string{"- Возраст: 45", "сахарный диабет", "гликемическим индексом"} {
+		if !strings.Contains(prompt, want) {
+			t.Errorf("prompt is missing %q:\n%s", want, prompt)
+		}
+	}
+
+	user.Age, user.Conditions = 0, nil
+	if prompt := planPrompt(PlanRequest{User: user}); strings.Contains(prompt, "Возраст") || strings.Contains(prompt, "диабет") {
+		t.Errorf("prompt without screening answers:\n%s", prompt)
+	}
+}
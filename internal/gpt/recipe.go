@@ -0,0 +1,105 @@
+package gpt
+
+import (
+	"context"
+	"diet-bot/internal/models"
+	"fmt"
+	"strings"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// RecipeRequest describes the dish to write a recipe for.
+type RecipeRequest struct {
+	Dish string
+	// Calories and Ingredients are the portion the plan expects, if known
+	Calories    int
+	Ingredients []models.Ingredient
+	// Restrictions the recipe must follow, e.g. "не дольше 20 минут"
+	Restrictions []string
+}
+
+// recipeSchema constrains the recipe the model returns.
+var recipeSchema = mustGenerateSchema(models.RecipeData{})
+
+const recipeSystemPrompt = "Ты шеф-повар и диетолог. Напиши простой домашний рецепт блюда на одну порцию " +
+	"из продуктов, доступных в России: продукты с массой в граммах, короткие понятные шаги, время приготовления, " +
+	"калорийность и БЖУ порции."
+
+func recipePrompt(req RecipeRequest) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Блюдо: %s.", req.Dish)
+	if req.Calories > 0 {
+		fmt.Fprintf(&b, "\nКалорийность порции: около %d ккал.", req.Calories)
+	}
+	if len(req.Ingredients) > 0 {
+		b.WriteString("\nПродукты по плану:")
+		for _, ing := range req.Ingredients {
+			fmt.Fprintf(&b, "\n- %s, %g %s", ing.Name, ing.Amount, ing.Unit)
+		}
+	}
+	if len(req.Restrictions) > 0 {
+		b.WriteString("\nОграничения: " + strings.Join(req.Restrictions, "; ") + ".")
+	}
+	return b.String()
+}
+
+// GenerateRecipe writes a recipe card for one portion of a plan dish.
+func (c *Client) GenerateRecipe(ctx context.Context, req RecipeRequest) (*models.Recipe, error) {
+	resp, err := c.client.CreateChatCompletion(ctx, openai.ChatCompletionRequest{
+		Model: c.model,
+		Messages: []openai.ChatCompletionMessage{
+			{Role: openai.ChatMessageRoleSystem, Content: systemPrompt(c.model, recipeSystemPrompt, recipeSchema)},
+			{Role: openai.ChatMessageRoleUser, Content: recipePrompt(req)},
+		},
+		ResponseFormat: responseFormat(c.model, "recipe", recipeSchema),
+		MaxTokens:      1500,
+		Temperature:    0.5,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.Choices) == 0 {
+		return nil, fmt.Errorf("no response from GPT API")
+	}
+
+	var data models.RecipeData
+	if err := recipeSchema.Unmarshal(resp.Choices[0].Message.Content, &data); err != nil {
+		return nil, fmt.Errorf("failed to parse recipe: %w", err)
+	}
+	if len(data.Steps) == 0 {
+		return nil, fmt.Errorf("recipe has no steps")
+	}
+
+	model := resp.Model
+	if model == "" {
+		model = c.model
+	}
+	return &models.Recipe{
+		CacheKey:         models.RecipeCacheKey(req.Dish, req.Restrictions),
+		Dish:             req.Dish,
+		Restrictions:     req.Restrictions,
+		Data:             data,
+		Model:            model,
+		PromptTokens:     resp.Usage.PromptTokens,
+		CompletionTokens: resp.Usage.CompletionTokens,
+	}, nil
+}
+
+// FormatRecipe renders a recipe as the card the user receives.
+func FormatRecipe(recipe *models.Recipe) string {
+	d := recipe.Data
+	var b strings.Builder
+	fmt.Fprintf(&b, "👨‍🍳 %s\n⏱ %d мин · %d ккал · Б %.0f / Ж %.0f / У %.0f г", recipe.Dish, d.PrepMinutes, d.Calories, d.Protein, d.Fat, d.Carbs)
+	if len(d.Ingredients) > 0 {
+		b.WriteString("\n\nПродукты:")
+		for _, ing := range d.Ingredients {
+			fmt.Fprintf(&b, "\n• %s — %g %s", ing.Name, ing.Amount, ing.Unit)
+		}
+	}
+	b.WriteString("\n\nПриготовление:")
+	for i, step := range d.Steps {
+		fmt.Fprintf(&b, "\n%d. %s", i+1, step)
+	}
+	return b.String()
+}
@@ -0,0 +1,34 @@
+package gpt
+
+import (
+	"diet-bot/internal/models"
+	"strings"
+	"testing"
+)
+
+func TestRecipePrompt(t *testing.T) {
+	prompt := recipePrompt(RecipeRequest{
+		Dish:         "Курица с гречкой",
+		Calories:     700,
+		Ingredients:  []models.Ingredient{{Name: "Гречка", Amount: 80, Unit: "г"}},
+		Restrictions: []string{"не дольше 20 минут готовки"},
+	})
+	for _, want := range []string{"Блюдо: Курица с гречкой.", "около 700 ккал", "- Гречка, 80 г", "Ограничения: не дольше 20 минут готовки."} {
+		if !strings.Contains(prompt, want) {
+			t.Errorf("prompt %q does not contain %q", prompt, want)
+		}
+	}
+}
+
+func TestRecipeCacheKey(t *testing.T) {
+	key := models.RecipeCacheKey("Курица с гречкой", []string{"дешевле", "быстрее"})
+	if got := models.RecipeCacheKey("  курица  с  гречкой", []string{"Быстрее", "дешевле", ""}); got != key {
+		t.Errorf("key depends on case, spacing or order: %s != %s", got, key)
+	}
+	if models.RecipeCacheKey("Курица с гречкой", nil) == key {
+		t.Error("restrictions do not change the key")
+	}
+	if models.RecipeCacheKey("Курица с рисом", []string{"дешевле", "быстрее"}) == key {
+		t.Error("dish does not change the key")
+	}
+}
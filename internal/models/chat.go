@@ -0,0 +1,23 @@
+package models
+
+import (
+	"time"
+)
+
+// Who wrote a chat message.
+const (
+	ChatRoleUser      = "user"
+	ChatRoleAssistant = "assistant"
+)
+
+// ChatMessage is one turn of a user's Q&A conversation with the bot.
+type ChatMessage struct {
+	ID        int64     `json:"id"`
+	UserID    int64     `json:"user_id"`
+	Role      string    `json:"role"`
+	Content   string    `json:"content"`
+	CreatedAt time.Time `json:"created_at"`
+	// ForgottenAt is set once the user asks to start over; the message then
+	// only counts towards the question quota
+	ForgottenAt *time.Time `json:"forgotten_at,omitempty"`
+}
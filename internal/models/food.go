@@ -0,0 +1,46 @@
+package models
+
+import (
+	"time"
+)
+
+// Where the nutrient values of a food log entry came from.
+const (
+	FoodSourceLLM      = "llm"
+	FoodSourceDatabase = "db"
+)
+
+// FoodLog is one item eaten on a day, e.g. "овсянка, 60 г", with its
+// estimated energy and macronutrients.
+type FoodLog struct {
+	ID        int64     `json:"id"`
+	UserID    int64     `json:"user_id"`
+	LoggedOn  time.Time `json:"logged_on"` // midnight UTC of the calendar day, as in WeightLog
+	Name      string    `json:"name"`
+	Grams     float64   `json:"grams"`
+	Calories  float64   `json:"calories"`
+	Protein   float64   `json:"protein"`
+	Fat       float64   `json:"fat"`
+	Carbs     float64   `json:"carbs"`
+	Source    string    `json:"source"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Food is an entry of the food composition database. Nutrient values are per
+// 100 g.
+type Food struct {
+	ID         int64   `json:"id"`
+	Source     string  `json:"source"` // the dataset it was imported from, e.g. "usda"
+	ExternalID string  `json:"external_id"`
+	Name       string  `json:"name"`
+	Calories   float64 `json:"calories"`
+	Protein    float64 `json:"protein"`
+	Fat        float64 `json:"fat"`
+	Carbs      float64 `json:"carbs"`
+}
+
+// FoodMatch is a search result with its similarity to the query, from 0 to 1.
+type FoodMatch struct {
+	Food
+	Score float64 `json:"score"`
+}
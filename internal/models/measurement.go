@@ -0,0 +1,32 @@
+package models
+
+import (
+	"time"
+)
+
+// Measurement is one set of body measurements in cm; sizes that were not
+// measured are 0. A user has at most one entry per day, and measuring again
+// on the same day replaces it.
+type Measurement struct {
+	ID     int64   `json:"id"`
+	UserID int64   `json:"user_id"`
+	Waist  float64 `json:"waist"`
+	Hip    float64 `json:"hip"`
+	Chest  float64 `json:"chest"`
+	Neck   float64 `json:"neck"`
+	// Weight is the user's weight when measured, in kg
+	Weight float64 `json:"weight"`
+	// BodyFat is the estimated body fat in percent, 0 when the sizes were not
+	// enough to estimate it
+	BodyFat   float64   `json:"body_fat"`
+	LoggedOn  time.Time `json:"logged_on"` // midnight UTC of the calendar day
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// LeanMass is the weight without fat, in kg, or 0 when body fat is unknown.
+func (m *Measurement) LeanMass() float64 {
+	if m.BodyFat <= 0 {
+		return 0
+	}
+	return m.Weight * (1 - m.BodyFat/100)
+}
@@ -0,0 +1,23 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Outbox topics
+const (
+	OutboxTopicCheckoutCreated = "checkout.created"
+)
+
+// OutboxEvent is a side effect recorded in the same transaction as the data
+// it describes and delivered after commit.
+type OutboxEvent struct {
+	ID          int64           `json:"id"`
+	Topic       string          `json:"topic"`
+	Payload     json.RawMessage `json:"payload"`
+	Attempts    int             `json:"attempts"`
+	LastError   string          `json:"last_error"`
+	CreatedAt   time.Time       `json:"created_at"`
+	ProcessedAt *time.Time      `json:"processed_at"`
+}
@@ -0,0 +1,56 @@
+package models
+
+// Kinds of plan revision: /regenerate offers all but RevisionAdapt. An
+// original plan has no kind.
+const (
+	RevisionPlan    = "plan"    // the whole plan again, with different dishes
+	RevisionDay     = "day"     // one day
+	RevisionMeal    = "meal"    // one meal of one day
+	RevisionCheaper = "cheaper" // cheaper ingredients
+	RevisionFaster  = "faster"  // quicker cooking
+	RevisionAdapt   = "adapt"   // a new calorie target after a weekly report
+)
+
+// PlanData is the structured form of a diet plan. Plans generated before it
+// existed have only text.
+type PlanData struct {
+	DailyCalories int       `json:"daily_calories" description:"Калорийность рациона в день, ккал"`
+	Protein       int       `json:"protein" description:"Белки в день, г"`
+	Fat           int       `json:"fat" description:"Жиры в день, г"`
+	Carbs         int       `json:"carbs" description:"Углеводы в день, г"`
+	WaterML       int       `json:"water_ml" description:"Сколько воды пить в день, мл"`
+	Days          []PlanDay `json:"days" description:"Меню по дням, начиная с дня 1"`
+	Tips          []string  `json:"tips" description:"Короткие рекомендации для достижения цели"`
+}
+
+// PlanDay is the menu of one day of the plan.
+type PlanDay struct {
+	Day   int        `json:"day" description:"Номер дня, с 1"`
+	Meals []PlanMeal `json:"meals" description:"Приёмы пищи в порядке времени"`
+}
+
+// PlanMeal is one meal of a plan day.
+type PlanMeal struct {
+	Time        string       `json:"time" description:"Время приёма пищи, ЧЧ:ММ"`
+	Name        string       `json:"name" description:"Приём пищи: Завтрак, Перекус, Обед или Ужин"`
+	Dish        string       `json:"dish" description:"Название блюда"`
+	Calories    int          `json:"calories" description:"Калорийность порции, ккал"`
+	Ingredients []Ingredient `json:"ingredients" description:"Продукты на одну порцию"`
+}
+
+// Ingredient is a product with its amount for one portion.
+type Ingredient struct {
+	Name   string  `json:"name" description:"Продукт, в именительном падеже"`
+	Amount float64 `json:"amount" description:"Количество"`
+	Unit   string  `json:"unit" description:"Единица: г, мл или шт"`
+}
+
+// FindDay returns the day numbered n, or nil.
+func (p *PlanData) FindDay(n int) *PlanDay {
+	for i := range p.Days {
+		if p.Days[i].Day == n {
+			return &p.Days[i]
+		}
+	}
+	return nil
+}
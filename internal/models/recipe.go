@@ -0,0 +1,53 @@
+package models
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Recipe is a cooking card for a dish, generated once and reused by every
+// plan with the same dish and restrictions.
+type Recipe struct {
+	ID               int64      `json:"id"`
+	CacheKey         string     `json:"cache_key"`
+	Dish             string     `json:"dish"`
+	Restrictions     []string   `json:"restrictions"`
+	Data             RecipeData `json:"data"`
+	Model            string     `json:"model"`
+	PromptTokens     int        `json:"prompt_tokens"`
+	CompletionTokens int        `json:"completion_tokens"`
+	CreatedAt        time.Time  `json:"created_at"`
+}
+
+// RecipeData is what the model writes for a recipe, for one portion.
+type RecipeData struct {
+	PrepMinutes int          `json:"prep_minutes" description:"Время приготовления вместе с подготовкой, минут"`
+	Ingredients []Ingredient `json:"ingredients" description:"Продукты на одну порцию, в граммах, миллилитрах или штуках"`
+	Steps       []string     `json:"steps" description:"Шаги приготовления по порядку, без нумерации"`
+	Calories    int          `json:"calories" description:"Калорийность порции, ккал"`
+	Protein     float64      `json:"protein" description:"Белки в порции, г"`
+	Fat         float64      `json:"fat" description:"Жиры в порции, г"`
+	Carbs       float64      `json:"carbs" description:"Углеводы в порции, г"`
+}
+
+// RecipeCacheKey identifies a recipe by its dish and restrictions, ignoring
+// case, spacing and the order of restrictions.
+func RecipeCacheKey(dish string, restrictions []string) string {
+	normalize := func(s string) string {
+		s = strings.ToLower(strings.Join(strings.Fields(s), " "))
+		return strings.ReplaceAll(s, "ё", "е")
+	}
+	parts := make([]string, 0, len(restrictions))
+	for _, r := range restrictions {
+		if r = normalize(r); r != "" {
+			parts = append(parts, r)
+		}
+	}
+	sort.Strings(parts)
+
+	sum := sha256.Sum256([]byte(normalize(dish) + "\n" + strings.Join(parts, "\n")))
+	return hex.EncodeToString(sum[:])
+}
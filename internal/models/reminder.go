@@ -0,0 +1,28 @@
+package models
+
+import (
+	"time"
+)
+
+// Reminder kinds
+const (
+	ReminderMeal    = "meal"
+	ReminderWater   = "water"
+	ReminderWeighIn = "weigh_in"
+)
+
+// Reminder is a recurring nudge. Rule holds cron expressions evaluated in
+// Timezone; NextRunAt is the next due time including jitter.
+type Reminder struct {
+	ID         int64      `json:"id"`
+	UserID     int64      `json:"user_id"`
+	TelegramID int64      `json:"telegram_id"` // owner's IDs, joined from users
+	ChatID     int64      `json:"chat_id"`
+	Kind       string     `json:"kind"`
+	Rule       string     `json:"rule"`
+	Timezone   string     `json:"timezone"`
+	Enabled    bool       `json:"enabled"`
+	NextRunAt  time.Time  `json:"next_run_at"`
+	LastSentAt *time.Time `json:"last_sent_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
@@ -0,0 +1,18 @@
+package models
+
+import (
+	"time"
+)
+
+// WeeklyReport is the weekly review of a user's progress against their plan.
+type WeeklyReport struct {
+	ID               int64     `json:"id"`
+	UserID           int64     `json:"user_id"`
+	PlanID           int64     `json:"plan_id"`
+	WeekStart        time.Time `json:"week_start"` // the Monday the report was made on, as in WeightLog.LoggedOn
+	Verdict          string    `json:"verdict"`    // one of progress.Verdict*
+	WeeklyRate       float64   `json:"weekly_rate"`
+	TargetCalories   int       `json:"target_calories"`
+	ProposedCalories int       `json:"proposed_calories"` // 0 when no change is proposed
+	CreatedAt        time.Time `json:"created_at"`
+}
@@ -0,0 +1,28 @@
+package models
+
+import (
+	"time"
+)
+
+// ShoppingList is the ingredients of days FirstDay to LastDay of a plan, with
+// what the user has already bought ticked off.
+type ShoppingList struct {
+	ID        int64          `json:"id"`
+	UserID    int64          `json:"user_id"`
+	PlanID    int64          `json:"plan_id"`
+	FirstDay  int            `json:"first_day"`
+	LastDay   int            `json:"last_day"`
+	Items     []ShoppingItem `json:"items"`
+	CreatedAt time.Time      `json:"created_at"`
+}
+
+// ShoppingItem is one product of a shopping list. Position numbers items
+// from 1 in the order they are shown.
+type ShoppingItem struct {
+	Position int     `json:"position"`
+	Name     string  `json:"name"`
+	Amount   float64 `json:"amount"`
+	Unit     string  `json:"unit"`
+	Section  string  `json:"section"`
+	Checked  bool    `json:"checked"`
+}
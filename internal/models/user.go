@@ -1,39 +1,168 @@
 package models
 
 import (
+	"sync"
 	"time"
 )
 
+// DefaultTimezone is assumed for users who have not picked a time zone.
+const DefaultTimezone = "Europe/Moscow"
+
 type User struct {
-	ID         int64     `json:"id"`
-	TelegramID int64     `json:"telegram_id"`
-	ChatID     int64     `json:"chat_id"`
-	Username   string    `json:"username"`
-	Gender     string    `json:"gender"`
-	Height     int       `json:"height"`
-	Weight     int       `json:"weight"`
-	Goal       string    `json:"goal"`
-	CreatedAt  time.Time `json:"created_at"`
-	UpdatedAt  time.Time `json:"updated_at"`
+	ID         int64      `json:"id"`
+	TelegramID int64      `json:"telegram_id"`
+	ChatID     int64      `json:"chat_id"`
+	Username   string     `json:"username"`
+	Gender     string     `json:"gender"`
+	Height     int        `json:"height"`
+	Weight     float64    `json:"weight"`
+	Goal       string     `json:"goal"`
+	Age        int        `json:"age"`        // 0 for users who signed up before it was asked
+	Conditions []string   `json:"conditions"` // medical conditions from the screening, see package safety
+	BodyFat    float64    `json:"body_fat"`   // latest estimate in percent, 0 when unknown
+	Timezone   string     `json:"timezone"`   // IANA name, e.g. Europe/Moscow
+	BlockedAt  *time.Time `json:"blocked_at"` // set while the user has the bot blocked
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+}
+
+var locations sync.Map
+
+// LoadLocation is time.LoadLocation with a cache, falling back to
+// DefaultTimezone for an empty or unknown name.
+func LoadLocation(name string) *time.Location {
+	if name == "" {
+		name = DefaultTimezone
+	}
+	if loc, ok := locations.Load(name); ok {
+		return loc.(*time.Location)
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		if name == DefaultTimezone {
+			return time.UTC
+		}
+		return LoadLocation(DefaultTimezone)
+	}
+	locations.Store(name, loc)
+	return loc
+}
+
+// Location returns the user's time zone.
+func (u *User) Location() *time.Location {
+	return LoadLocation(u.Timezone)
+}
+
+// HasCondition reports whether the user reported the medical condition.
+func (u *User) HasCondition(condition string) bool {
+	for _, c := range u.Conditions {
+		if c == condition {
+			return true
+		}
+	}
+	return false
+}
+
+// Today returns the user's current calendar day as stored in weight logs.
+func (u *User) Today() time.Time {
+	return Day(time.Now().In(u.Location()))
 }
 
 type Payment struct {
-	ID              int64     `json:"id"`
-	UserID          int64     `json:"user_id"`
-	Amount          int       `json:"amount"`
-	Currency        string    `json:"currency"`
-	StripePaymentID string    `json:"stripe_payment_id"`
-	Status          string    `json:"status"`
-	CreatedAt       time.Time `json:"created_at"`
-	UpdatedAt       time.Time `json:"updated_at"`
+	ID                    int64     `json:"id"`
+	UserID                int64     `json:"user_id"`
+	Amount                int       `json:"amount"`
+	Currency              string    `json:"currency"`
+	StripePaymentID       string    `json:"stripe_payment_id"`
+	StripePaymentIntentID string    `json:"stripe_payment_intent_id"`
+	Status                string    `json:"status"`
+	RefundedAmount        int64     `json:"refunded_amount"` // smallest currency unit, as reported by Stripe
+	CreatedAt             time.Time `json:"created_at"`
+	UpdatedAt             time.Time `json:"updated_at"`
+}
+
+const (
+	PaymentStatusPending           = "pending"
+	PaymentStatusCompleted         = "completed"
+	PaymentStatusFailed            = "failed"
+	PaymentStatusExpired           = "expired"
+	PaymentStatusPartiallyRefunded = "partially_refunded"
+	PaymentStatusRefunded          = "refunded"
+	PaymentStatusDisputed          = "disputed"
+	PaymentStatusDisputeLost       = "dispute_lost"
+)
+
+// paymentTransitions lists the statuses a payment may move to from each status.
+// Refunded and lost disputes are terminal: the purchase is revoked.
+var paymentTransitions = map[string][]string{
+	PaymentStatusPending:           {PaymentStatusCompleted, PaymentStatusFailed, PaymentStatusExpired, PaymentStatusRefunded},
+	PaymentStatusFailed:            {PaymentStatusCompleted, PaymentStatusExpired},
+	PaymentStatusExpired:           {PaymentStatusCompleted},
+	PaymentStatusCompleted:         {PaymentStatusPartiallyRefunded, PaymentStatusRefunded, PaymentStatusDisputed},
+	PaymentStatusPartiallyRefunded: {PaymentStatusPartiallyRefunded, PaymentStatusRefunded, PaymentStatusDisputed},
+	PaymentStatusDisputed:          {PaymentStatusDisputed, PaymentStatusCompleted, PaymentStatusPartiallyRefunded, PaymentStatusRefunded, PaymentStatusDisputeLost},
+}
+
+// CanTransitionPayment reports whether a payment in status from may move to status to.
+func CanTransitionPayment(from, to string) bool {
+	for _, next := range paymentTransitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// AwaitingFulfillment reports whether a confirmed payment should still produce a plan.
+// Expired sessions are included because Stripe can confirm a payment made just before expiry.
+func (p *Payment) AwaitingFulfillment() bool {
+	return p.Status == PaymentStatusPending || p.Status == PaymentStatusFailed || p.Status == PaymentStatusExpired
+}
+
+// IsRevoked reports whether the purchase was taken back by a refund or a lost dispute.
+func (p *Payment) IsRevoked() bool {
+	return p.Status == PaymentStatusRefunded || p.Status == PaymentStatusDisputeLost
 }
 
 type DietPlan struct {
-	ID        int64     `json:"id"`
-	UserID    int64     `json:"user_id"`
-	PaymentID int64     `json:"payment_id"`
-	PlanText  string    `json:"plan_text"`
-	CreatedAt time.Time `json:"created_at"`
+	ID               int64           `json:"id"`
+	UserID           int64           `json:"user_id"`
+	PaymentID        int64           `json:"payment_id"`
+	PlanText         string          `json:"plan_text"`
+	Data             *PlanData       `json:"plan_data"` // nil for plans generated as plain text
+	Profile          ProfileSnapshot `json:"profile"`
+	PromptVersion    string          `json:"prompt_version"`
+	Model            string          `json:"model"`
+	PromptTokens     int             `json:"prompt_tokens"`
+	CompletionTokens int             `json:"completion_tokens"`
+	ParentID         int64           `json:"parent_id"` // the plan a revision was made from
+	Revision         string          `json:"revision"`  // kind of revision, empty for a paid plan
+	CreatedAt        time.Time       `json:"created_at"`
+}
+
+// ProfileSnapshot is a copy of the questionnaire answers a plan was generated
+// from. Unlike User it never changes after the plan is saved.
+type ProfileSnapshot struct {
+	Gender string  `json:"gender"`
+	Height int     `json:"height"`
+	Weight float64 `json:"weight"`
+	Goal   string  `json:"goal"`
+}
+
+// NewProfileSnapshot copies the plan-relevant fields of user.
+func NewProfileSnapshot(user *User) ProfileSnapshot {
+	return ProfileSnapshot{
+		Gender: user.Gender,
+		Height: user.Height,
+		Weight: user.Weight,
+		Goal:   user.Goal,
+	}
+}
+
+// IsEmpty reports whether the snapshot is missing, as for plans saved before
+// snapshots were recorded.
+func (s ProfileSnapshot) IsEmpty() bool {
+	return s == ProfileSnapshot{}
 }
 
 type UserState struct {
@@ -0,0 +1,13 @@
+package models
+
+import (
+	"time"
+)
+
+// WaterLog counts the water a user drank on a day.
+type WaterLog struct {
+	UserID    int64     `json:"user_id"`
+	LoggedOn  time.Time `json:"logged_on"` // midnight UTC of the calendar day
+	Amount    int       `json:"amount"`    // ml
+	UpdatedAt time.Time `json:"updated_at"`
+}
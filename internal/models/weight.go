@@ -0,0 +1,20 @@
+package models
+
+import (
+	"time"
+)
+
+// WeightLog is one weigh-in. A user has at most one entry per day; logging
+// again on the same day replaces it.
+type WeightLog struct {
+	ID        int64     `json:"id"`
+	UserID    int64     `json:"user_id"`
+	Weight    float64   `json:"weight"`
+	LoggedOn  time.Time `json:"logged_on"` // midnight UTC of the calendar day
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Day returns the calendar day of t as midnight UTC, the form LoggedOn is stored in.
+func Day(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
@@ -0,0 +1,45 @@
+package nutrition
+
+import (
+	"math"
+)
+
+// Estimates outside this range, in percent, come from mistyped sizes.
+const (
+	minBodyFat = 3
+	maxBodyFat = 60
+)
+
+// NavyBodyFat estimates body fat in percent by the US Navy formula from the
+// height and circumferences in cm. Men need waist and neck, women also hips.
+// It returns false when a size is missing or the estimate is implausible.
+func NavyBodyFat(gender string, height int, waist, neck, hip float64) (float64, bool) {
+	if height <= 0 || waist <= 0 || neck <= 0 {
+		return 0, false
+	}
+
+	var density float64
+	if gender == "Женский" {
+		if hip <= 0 || waist+hip <= neck {
+			return 0, false
+		}
+		density = 1.29579 - 0.35004*math.Log10(waist+hip-neck) + 0.22100*math.Log10(float64(height))
+	} else {
+		if waist <= neck {
+			return 0, false
+		}
+		density = 1.0324 - 0.19077*math.Log10(waist-neck) + 0.15456*math.Log10(float64(height))
+	}
+
+	fat := 495/density - 450
+	if fat < minBodyFat || fat > maxBodyFat {
+		return 0, false
+	}
+	return math.Round(fat*10) / 10, true
+}
+
+// KatchMcArdle is the basal metabolic rate from lean body mass in kg. Unlike
+// BMR it does not overestimate the needs of people with a lot of body fat.
+func KatchMcArdle(leanMass float64) float64 {
+	return 370 + 21.6*leanMass
+}
@@ -0,0 +1,38 @@
+package nutrition
+
+import (
+	"testing"
+)
+
+func TestNavyBodyFat(t *testing.T) {
+	for _, tc := range []struct {
+		gender            string
+		height            int
+		waist, neck, hips float64
+		want              float64
+		ok                bool
+	}{
+		{"Мужской", 180, 85, 38, 0, 16.1, true},
+		{"Женский", 165, 70, 32, 95, 24.9, true},
+		// Women need hips, everybody needs waist and neck
+		{"Женский", 165, 70, 32, 0, 0, false},
+		{"Мужской", 180, 0, 38, 0, 0, false},
+		{"Мужской", 180, 85, 0, 0, 0, false},
+		// Neck and waist swapped
+		{"Мужской", 180, 38, 85, 0, 0, false},
+		// A waist of 39 cm would give less than 3%
+		{"Мужской", 180, 39, 38, 0, 0, false},
+	} {
+		got, ok := NavyBodyFat(tc.gender, tc.height, tc.waist, tc.neck, tc.hips)
+		if got != tc.want || ok != tc.ok {
+			t.Errorf("NavyBodyFat(%s, %d, %v, %v, %v) = %v, %v; want %v, %v",
+				tc.gender, tc.height, tc.waist, tc.neck, tc.hips, got, ok, tc.want, tc.ok)
+		}
+	}
+}
+
+func TestKatchMcArdle(t *testing.T) {
+	if got := KatchMcArdle(64); got != 1752.4 {
+		t.Fatalf("KatchMcArdle(64) = %v", got)
+	}
+}
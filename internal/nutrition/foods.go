@@ -0,0 +1,152 @@
+package nutrition
+
+import (
+	"context"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"diet-bot/internal/models"
+)
+
+// MinMatchScore is the similarity a database food needs to be trusted as the
+// food the user meant.
+const MinMatchScore = 0.5
+
+// FoodSearcher is the part of the store Lookup needs.
+type FoodSearcher interface {
+	SearchFoods(ctx context.Context, query string, limit int) ([]*models.FoodMatch, error)
+}
+
+// Lookup returns the database food best matching name, or nil when there is
+// no confident match.
+func Lookup(ctx context.Context, s FoodSearcher, name string) (*models.Food, error) {
+	matches, err := s.SearchFoods(ctx, name, 1)
+	if err != nil {
+		return nil, err
+	}
+	if len(matches) == 0 || matches[0].Score < MinMatchScore {
+		return nil, nil
+	}
+	return &matches[0].Food, nil
+}
+
+// Portion returns the nutrients in grams of food.
+func Portion(food *models.Food, grams float64) Nutrients {
+	k := grams / 100
+	return Nutrients{
+		Calories: food.Calories * k,
+		Protein:  food.Protein * k,
+		Fat:      food.Fat * k,
+		Carbs:    food.Carbs * k,
+	}
+}
+
+// MealCalorieTolerance is the share by which a plan meal's calories may differ
+// from the sum of its ingredients before CheckPlan corrects them.
+const MealCalorieTolerance = 0.15
+
+// CheckPlan sums the database calories of the ingredients of every plan meal
+// and corrects the meals that disagree with the sum by more than
+// MealCalorieTolerance. Meals with an ingredient the database does not know,
+// or one counted in pieces, are left as the model wrote them. It returns the
+// number of corrected meals.
+func CheckPlan(ctx context.Context, s FoodSearcher, data *models.PlanData) (int, error) {
+	foods := make(map[string]*models.Food)
+	lookup := func(name string) (*models.Food, error) {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if food, ok := foods[name]; ok {
+			return food, nil
+		}
+		food, err := Lookup(ctx, s, name)
+		if err != nil {
+			return nil, err
+		}
+		foods[name] = food
+		return food, nil
+	}
+
+	corrected := 0
+	for d := range data.Days {
+		for m := range data.Days[d].Meals {
+			meal := &data.Days[d].Meals[m]
+			calories, ok, err := ingredientCalories(meal.Ingredients, lookup)
+			if err != nil {
+				return corrected, err
+			}
+			if !ok || math.Abs(calories-float64(meal.Calories)) <= MealCalorieTolerance*calories {
+				continue
+			}
+			meal.Calories = int(math.Round(calories))
+			corrected++
+		}
+	}
+	return corrected, nil
+}
+
+// ingredientCalories sums the calories of ingredients weighed in grams or
+// millilitres. It fails when one cannot be weighed or is unknown.
+func ingredientCalories(ingredients []models.Ingredient, lookup func(string) (*models.Food, error)) (float64, bool, error) {
+	if len(ingredients) == 0 {
+		return 0, false, nil
+	}
+	var total float64
+	for _, ingredient := range ingredients {
+		switch strings.TrimSuffix(strings.ToLower(strings.TrimSpace(ingredient.Unit)), ".") {
+		case "г", "гр", "g", "мл", "ml":
+		default:
+			return 0, false, nil
+		}
+		food, err := lookup(ingredient.Name)
+		if err != nil || food == nil {
+			return 0, false, err
+		}
+		total += Portion(food, ingredient.Amount).Calories
+	}
+	return total, true, nil
+}
+
+var (
+	mealSeparators = regexp.MustCompile(`[,;\n+]|\s+и\s+`)
+
+	amount = `(\d+(?:[.,]\d+)?)\s*(кг|килограмм\S*|г|гр|грамм\S*|g|мл|ml|л)\.?`
+	// "творог 200 г" and "200 г творога"
+	portionAfter  = regexp.MustCompile(`^(.+?)\s*` + amount + `$`)
+	portionBefore = regexp.MustCompile(`^` + amount + `\s+(.+)$`)
+)
+
+// SplitMeal splits "овсянка 60г, банан и кофе" into its items.
+func SplitMeal(text string) []string {
+	var items []string
+	for _, part := range mealSeparators.Split(strings.ToLower(text), -1) {
+		if part = strings.TrimSpace(part); part != "" {
+			items = append(items, part)
+		}
+	}
+	return items
+}
+
+// ParsePortion reads an item with an explicit weight, such as "творог 200 г"
+// or "200 г творога". Millilitres count as grams. It fails when no weight is
+// given, since a typical portion then has to be guessed.
+func ParsePortion(item string) (name string, grams float64, ok bool) {
+	item = strings.TrimSpace(item)
+	var number, unit string
+	if m := portionAfter.FindStringSubmatch(item); m != nil {
+		name, number, unit = m[1], m[2], m[3]
+	} else if m := portionBefore.FindStringSubmatch(item); m != nil {
+		number, unit, name = m[1], m[2], m[3]
+	} else {
+		return "", 0, false
+	}
+
+	grams, err := strconv.ParseFloat(strings.Replace(number, ",", ".", 1), 64)
+	if err != nil || grams <= 0 {
+		return "", 0, false
+	}
+	if unit == "кг" || unit == "л" || strings.HasPrefix(unit, "килограмм") {
+		grams *= 1000
+	}
+	return strings.TrimSpace(name), grams, true
+}
@@ -0,0 +1,106 @@
+package nutrition
+
+import (
+	"context"
+	"math"
+	"reflect"
+	"testing"
+
+	"diet-bot/internal/models"
+)
+
+func TestSplitMeal(t *testing.T) {
+	got := SplitMeal("Овсянка 60г, банан и кофе; 2 яйца\n + хлеб")
+	want := []string{"овсянка 60г", "банан", "кофе", "2 яйца", "хлеб"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("SplitMeal = %q", got)
+	}
+}
+
+func TestParsePortion(t *testing.T) {
+	for item, want := range map[string]struct {
+		name  string
+		grams float64
+	}{
+		"творог 200 г":   {"творог", 200},
+		"овсянка 60г":    {"овсянка", 60},
+		"200 гр творога": {"творога", 200},
+		"кефир 0,5 л":    {"кефир", 500},
+		"молоко 250мл":   {"молоко", 250},
+		"курица 1.2 кг":  {"курица", 1200},
+		"рис 80 граммов": {"рис", 80},
+		"гречка 70 г.":   {"гречка", 70},
+	} {
+		name, grams, ok := ParsePortion(item)
+		if !ok || name != want.name || math.Abs(grams-want.grams) > 1e-9 {
+			t.Errorf("ParsePortion(%q) = %q, %v, %v", item, name, grams, ok)
+		}
+	}
+
+	for _, item := range []string{"банан", "2 яйца", "кофе с молоком"} {
+		if name, grams, ok := ParsePortion(item); ok {
+			t.Errorf("ParsePortion(%q) = %q, %v", item, name, grams)
+		}
+	}
+}
+
+type fakeSearcher []*models.FoodMatch
+
+func (f fakeSearcher) SearchFoods(ctx context.Context, query string, limit int) ([]*models.FoodMatch, error) {
+	return f, nil
+}
+
+func TestLookup(t *testing.T) {
+	banana := &models.FoodMatch{Food: models.Food{Name: "Бананы", Calories: 96}, Score: 0.62}
+	food, err := Lookup(context.Background(), fakeSearcher{banana}, "банан")
+	if err != nil || food == nil || food.Name != "Бананы" {
+		t.Fatalf("Lookup = %+v, %v", food, err)
+	}
+
+	weak := &models.FoodMatch{Food: models.Food{Name: "Сок банановый"}, Score: 0.3}
+	if food, err := Lookup(context.Background(), fakeSearcher{weak}, "банан"); err != nil || food != nil {
+		t.Fatalf("Lookup of a weak match = %+v, %v", food, err)
+	}
+
+	if got := Portion(&banana.Food, 150); got.Calories != 144 {
+		t.Fatalf("Portion = %+v", got)
+	}
+}
+
+type namedSearcher map[string]*models.FoodMatch
+
+func (f namedSearcher) SearchFoods(ctx context.Context, query string, limit int) ([]*models.FoodMatch, error) {
+	if match, ok := f[query]; ok {
+		return []*models.FoodMatch{match}, nil
+	}
+	return nil, nil
+}
+
+func TestCheckPlan(t *testing.T) {
+	foods := namedSearcher{
+		"овсянка": {Food: models.Food{Name: "Хлопья овсяные", Calories: 350}, Score: 1},
+		"банан":   {Food: models.Food{Name: "Бананы", Calories: 96}, Score: 1},
+		"творог":  {Food: models.Food{Name: "Творог 5%", Calories: 121}, Score: 1},
+	}
+	data := &models.PlanData{Days: []models.PlanDay{{Day: 1, Meals: []models.PlanMeal{
+		// 60 г овсянки и 100 г банана — 306 ккал
+		{Dish: "Овсянка с бананом", Calories: 500, Ingredients: []models.Ingredient{
+			{Name: "Овсянка", Amount: 60, Unit: "г"}, {Name: "Банан", Amount: 100, Unit: "г"}}},
+		{Dish: "Творог", Calories: 250, Ingredients: []models.Ingredient{{Name: "Творог", Amount: 200, Unit: "г"}}},
+		{Dish: "Творог с яйцом", Calories: 900, Ingredients: []models.Ingredient{
+			{Name: "Творог", Amount: 200, Unit: "г"}, {Name: "Яйцо", Amount: 1, Unit: "шт"}}},
+		{Dish: "Салат", Calories: 900, Ingredients: []models.Ingredient{{Name: "Руккола", Amount: 50, Unit: "г"}}},
+	}}}}
+
+	corrected, err := CheckPlan(context.Background(), foods, data)
+	if err != nil || corrected != 1 {
+		t.Fatalf("CheckPlan = %d, %v", corrected, err)
+	}
+	var calories []int
+	for _, meal := range data.Days[0].Meals {
+		calories = append(calories, meal.Calories)
+	}
+	if want := []int{306, 250, 900, 900}; !reflect.DeepEqual(calories, want) {
+		t.Fatalf("meal calories = %v, want %v", calories, want)
+	}
+}
@@ -0,0 +1,177 @@
+package nutrition
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+
+	"diet-bot/internal/models"
+)
+
+// importColumns maps header names to food fields. Besides the plain
+// "id,name,calories,protein,fat,carbs" layout it understands Open Food Facts
+// CSV/TSV dumps; other tables such as USDA FoodData Central are easiest to
+// flatten into the plain layout first. Values are per 100 g.
+var importColumns = map[string][]string{
+	"id":       {"id", "external_id", "code", "fdc_id"},
+	"name":     {"name", "name_ru", "product_name_ru", "product_name", "description"},
+	"calories": {"calories", "kcal", "energy_kcal", "energy-kcal_100g"},
+	"protein":  {"protein", "proteins", "proteins_100g"},
+	"fat":      {"fat", "fat_100g"},
+	"carbs":    {"carbs", "carbohydrates", "carbohydrates_100g"},
+}
+
+// Per 100 g no food has more energy than pure fat or more of a nutrient than
+// its own weight; rows above these limits are unit or column mix-ups.
+const (
+	maxFoodCalories = 900
+	maxFoodNutrient = 100
+)
+
+// ImportStats counts the rows of an import.
+type ImportStats struct {
+	Imported int
+	Skipped  int
+}
+
+// ImportFoods reads a food composition table and hands it to save in batches
+// of batchSize. The delimiter (comma, semicolon or tab) is detected from the
+// header. Rows without a name or calories are skipped, as are rows with values
+// that are not numbers or exceed what 100 g of food can hold; missing
+// macronutrients count as zero. Rows without an ID are keyed by name.
+func ImportFoods(r io.Reader, source string, batchSize int, save func([]*models.Food) error) (ImportStats, error) {
+	var stats ImportStats
+
+	br := bufio.NewReader(r)
+	header, err := br.ReadString('\n')
+	if err != nil && header == "" {
+		return stats, fmt.Errorf("failed to read header: %w", err)
+	}
+	delimiter := detectDelimiter(header)
+
+	cr := csv.NewReader(io.MultiReader(strings.NewReader(header), br))
+	cr.Comma = delimiter
+	cr.LazyQuotes = true
+	cr.FieldsPerRecord = -1
+	cr.ReuseRecord = true
+
+	names, err := cr.Read()
+	if err != nil {
+		return stats, fmt.Errorf("failed to parse header: %w", err)
+	}
+	index := columnIndex(names)
+	for _, required := range []string{"name", "calories"} {
+		if _, ok := index[required]; !ok {
+			return stats, fmt.Errorf("no %s column in header %q", required, strings.TrimSpace(header))
+		}
+	}
+
+	batch := make([]*models.Food, 0, batchSize)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		if err := save(batch); err != nil {
+			return err
+		}
+		stats.Imported += len(batch)
+		batch = make([]*models.Food, 0, batchSize)
+		return nil
+	}
+
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return stats, fmt.Errorf("line %d: %w", stats.Imported+stats.Skipped+len(batch)+2, err)
+		}
+
+		food, ok := parseFoodRecord(record, index)
+		if !ok {
+			stats.Skipped++
+			continue
+		}
+		food.Source = source
+		batch = append(batch, food)
+		if len(batch) == batchSize {
+			if err := flush(); err != nil {
+				return stats, err
+			}
+		}
+	}
+	return stats, flush()
+}
+
+func detectDelimiter(header string) rune {
+	best, bestCount := ',', strings.Count(header, ",")
+	for _, d := range []rune{';', '\t'} {
+		if n := strings.Count(header, string(d)); n > bestCount {
+			best, bestCount = d, n
+		}
+	}
+	return best
+}
+
+// columnIndex finds the position of each known field in the header.
+func columnIndex(header []string) map[string]int {
+	position := make(map[string]int, len(header))
+	for i, name := range header {
+		position[strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))] = i
+	}
+
+	index := make(map[string]int)
+	for field, aliases := range importColumns {
+		for _, alias := range aliases {
+			if i, ok := position[alias]; ok {
+				index[field] = i
+				break
+			}
+		}
+	}
+	return index
+}
+
+func parseFoodRecord(record []string, index map[string]int) (*models.Food, bool) {
+	field := func(name string) string {
+		i, ok := index[name]
+		if !ok || i >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[i])
+	}
+	// number reports a blank value as missing and rejects values that are
+	// not plausible per 100 g.
+	number := func(name string, limit float64) (v float64, present, ok bool) {
+		s := field(name)
+		if s == "" {
+			return 0, false, true
+		}
+		v, err := strconv.ParseFloat(strings.Replace(s, ",", ".", 1), 64)
+		if err != nil || math.IsNaN(v) || math.IsInf(v, 0) || v < 0 || v > limit {
+			return 0, true, false
+		}
+		return v, true, true
+	}
+
+	food := &models.Food{Name: field("name"), ExternalID: field("id")}
+	calories, present, ok := number("calories", maxFoodCalories)
+	if food.Name == "" || !present || !ok {
+		return nil, false
+	}
+	food.Calories = calories
+	for name, value := range map[string]*float64{"protein": &food.Protein, "fat": &food.Fat, "carbs": &food.Carbs} {
+		if *value, _, ok = number(name, maxFoodNutrient); !ok {
+			return nil, false
+		}
+	}
+	if food.ExternalID == "" {
+		food.ExternalID = strings.ToLower(food.Name)
+	}
+	return food, true
+}
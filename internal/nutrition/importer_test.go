@@ -0,0 +1,66 @@
+package nutrition
+
+import (
+	"strings"
+	"testing"
+
+	"diet-bot/internal/models"
+)
+
+func TestImportFoods(t *testing.T) {
+	csv := "\ufeffname;calories;protein;fat;carbs\n" +
+		"Творог 5%;121;17,2;5;1,8\n" +
+		"Без калорий;;1;1;1\n" +
+		";100;1;1;1\n" +
+		"Бананы;96;1,5;0,2;21\n" +
+		"В килоджоулях;3700;0;100;0\n" +
+		"Не число;NaN;1;1;1\n" +
+		"Бесконечность;100;Inf;1;1\n" +
+		"Белка больше веса;350;120;1;1\n" +
+		"Отрицательный жир;100;1;-1;1\n" +
+		"Вода;0;;;\n"
+
+	var batches [][]*models.Food
+	stats, err := ImportFoods(strings.NewReader(csv), "custom", 2, func(batch []*models.Food) error {
+		batches = append(batches, batch)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("ImportFoods: %v", err)
+	}
+	if stats.Imported != 3 || stats.Skipped != 7 || len(batches) != 2 {
+		t.Fatalf("stats = %+v, %d batches", stats, len(batches))
+	}
+
+	cheese := batches[0][0]
+	if cheese.Name != "Творог 5%" || cheese.Protein != 17.2 || cheese.Carbs != 1.8 || cheese.Source != "custom" || cheese.ExternalID != "творог 5%" {
+		t.Fatalf("unexpected food: %+v", cheese)
+	}
+	if water := batches[1][0]; water.Name != "Вода" || water.Calories != 0 {
+		t.Fatalf("unexpected food: %+v", water)
+	}
+}
+
+func TestImportOpenFoodFactsTSV(t *testing.T) {
+	tsv := "code\tproduct_name\tenergy-kcal_100g\tproteins_100g\tfat_100g\tcarbohydrates_100g\n" +
+		"4600000000017\tКефир 2,5%\t53\t3\t2.5\t4\n"
+
+	var foods []*models.Food
+	stats, err := ImportFoods(strings.NewReader(tsv), "off", 100, func(batch []*models.Food) error {
+		foods = append(foods, batch...)
+		return nil
+	})
+	if err != nil || stats.Imported != 1 {
+		t.Fatalf("ImportFoods = %+v, %v", stats, err)
+	}
+	if f := foods[0]; f.ExternalID != "4600000000017" || f.Name != "Кефир 2,5%" || f.Calories != 53 || f.Fat != 2.5 {
+		t.Fatalf("unexpected food: %+v", f)
+	}
+}
+
+func TestImportFoodsRequiresColumns(t *testing.T) {
+	_, err := ImportFoods(strings.NewReader("id,title\n1,x\n"), "custom", 10, func([]*models.Food) error { return nil })
+	if err == nil {
+		t.Fatal("expected an error for a header without name and calories")
+	}
+}
@@ -0,0 +1,143 @@
+// Package nutrition computes daily energy and macronutrient targets and sums
+// up what was eaten.
+package nutrition
+
+import (
+	"math"
+
+	"diet-bot/internal/models"
+	"diet-bot/internal/safety"
+)
+
+// Nutrients is an amount of energy (kcal) and macronutrients (g).
+type Nutrients struct {
+	Calories float64
+	Protein  float64
+	Fat      float64
+	Carbs    float64
+}
+
+// Add returns the sum of n and o.
+func (n Nutrients) Add(o Nutrients) Nutrients {
+	return Nutrients{
+		Calories: n.Calories + o.Calories,
+		Protein:  n.Protein + o.Protein,
+		Fat:      n.Fat + o.Fat,
+		Carbs:    n.Carbs + o.Carbs,
+	}
+}
+
+const (
+	// assumedAge stands in for the age of users who signed up before the
+	// questionnaire asked for it.
+	assumedAge = 30
+	// activityFactor assumes light activity, 1–3 workouts a week.
+	activityFactor = 1.375
+
+	fatPerKg = 0.9 // g of fat per kg of body weight
+
+	kcalPerGramProtein = 4
+	kcalPerGramFat     = 9
+	kcalPerGramCarbs   = 4
+)
+
+// BMR is the basal metabolic rate by the Mifflin–St Jeor equation. An age of
+// 0 is taken as assumedAge.
+func BMR(gender string, height int, weight float64, age int) float64 {
+	if age <= 0 {
+		age = assumedAge
+	}
+	bmr := 10*weight + 6.25*float64(height) - 5*float64(age)
+	if gender == "Женский" {
+		return bmr - 161
+	}
+	return bmr + 5
+}
+
+// RestingRate is the user's basal metabolic rate: from lean mass when their
+// body fat is known, by the Mifflin–St Jeor equation otherwise.
+func RestingRate(user *models.User) float64 {
+	if user.BodyFat > 0 {
+		return KatchMcArdle(user.Weight * (1 - user.BodyFat/100))
+	}
+	return BMR(user.Gender, user.Height, user.Weight, user.Age)
+}
+
+// lossDeficit is the share of maintenance calories cut to lose weight, unless
+// safety.MaxDeficit allows less.
+const lossDeficit = 0.15
+
+// Maintenance is the daily intake that keeps the user's weight.
+func Maintenance(user *models.User) float64 {
+	return RestingRate(user) * activityFactor
+}
+
+// DailyTarget is the daily intake for the user's goal: a 15% deficit to lose
+// weight, or less where safety.MaxDeficit says so, a 10% surplus to gain it.
+// Protein is 1.8 g/kg when losing weight and 1.6 g/kg otherwise, fat 0.9 g/kg,
+// and carbohydrates make up the rest.
+func DailyTarget(user *models.User) Nutrients {
+	calories := Maintenance(user)
+	proteinPerKg := 1.6
+	switch user.Goal {
+	case "Снизить":
+		calories *= 1 - math.Min(lossDeficit, safety.MaxDeficit(user))
+		proteinPerKg = 1.8
+	case "Набрать":
+		calories *= 1.10
+	}
+	calories = math.Round(calories/10) * 10
+
+	protein := math.Round(proteinPerKg * user.Weight)
+	fat := math.Round(fatPerKg * user.Weight)
+	carbs := math.Max(0, math.Round((calories-protein*kcalPerGramProtein-fat*kcalPerGramFat)/kcalPerGramCarbs))
+
+	return Nutrients{Calories: calories, Protein: protein, Fat: fat, Carbs: carbs}
+}
+
+// Total sums the nutrients of food log entries.
+func Total(logs []*models.FoodLog) Nutrients {
+	var total Nutrients
+	for _, l := range logs {
+		total = total.Add(Nutrients{Calories: l.Calories, Protein: l.Protein, Fat: l.Fat, Carbs: l.Carbs})
+	}
+	return total
+}
+
+// WithCalories changes the calories of a target, keeping protein and fat and
+// letting carbohydrates take up the difference.
+func WithCalories(target Nutrients, calories float64) Nutrients {
+	target.Calories = calories
+	target.Carbs = math.Max(0, math.Round((calories-target.Protein*kcalPerGramProtein-target.Fat*kcalPerGramFat)/kcalPerGramCarbs))
+	return target
+}
+
+// MinCalories is the lowest daily target the bot proposes: never below the
+// resting rate, nor below 1200 kcal for women and 1500 kcal for men, nor a
+// deeper cut of maintenance than safety.MaxDeficit allows.
+func MinCalories(user *models.User) float64 {
+	floor := 1500.0
+	if user.Gender == "Женский" {
+		floor = 1200
+	}
+	floor = math.Max(floor, math.Ceil(Maintenance(user)*(1-safety.MaxDeficit(user))/10)*10)
+	return math.Max(floor, math.Round(RestingRate(user)/10)*10)
+}
+
+// PlanCalorieTolerance is the share by which a generated plan may fall short
+// of MinCalories, since the model rounds its portions.
+const PlanCalorieTolerance = 0.05
+
+// PlanMinimum is the least a plan has the user eat in a day: its stated daily
+// calories or the total of its leanest day, whichever is lower.
+func PlanMinimum(data *models.PlanData) float64 {
+	lowest := float64(data.DailyCalories)
+	for _, day := range data.Days {
+		total := 0
+		for _, meal := range day.Meals {
+			total += meal.Calories
+		}
+		lowest = math.Min(lowest, float64(total))
+	}
+	return lowest
+}
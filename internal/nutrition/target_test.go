@@ -0,0 +1,120 @@
+package nutrition
+
+import (
+	"math"
+	"testing"
+
+	"diet-bot/internal/models"
+)
+
+func TestBMR(t *testing.T) {
+	// 10*80 + 6.25*180 - 5*30 + 5
+	if got := BMR("Мужской", 180, 80, 30); got != 1780 {
+		t.Fatalf("male BMR = %v", got)
+	}
+	// 10*60 + 6.25*165 - 5*30 - 161
+	if got := BMR("Женский", 165, 60, 30); math.Abs(got-1320.25) > 1e-9 {
+		t.Fatalf("female BMR = %v", got)
+	}
+	// Unknown age is taken as 30
+	if got := BMR("Мужской", 180, 80, 0); got != 1780 {
+		t.Fatalf("BMR of unknown age = %v", got)
+	}
+	if got := BMR("Мужской", 180, 80, 50); got != 1680 {
+		t.Fatalf("BMR at 50 = %v", got)
+	}
+}
+
+func TestDailyTarget(t *testing.T) {
+	user := &models.User{Gender: "Мужской", Height: 180, Weight: 80, Goal: "Поддерживать"}
+	maintain := DailyTarget(user)
+	if maintain.Calories != 2450 {
+		t.Fatalf("maintenance calories = %v", maintain.Calories)
+	}
+	if maintain.Protein != 128 || maintain.Fat != 72 {
+		t.Fatalf("maintenance macros = %+v", maintain)
+	}
+	// Macros add up to the calories within rounding
+	kcal := maintain.Protein*4 + maintain.Fat*9 + maintain.Carbs*4
+	if math.Abs(kcal-maintain.Calories) > 4 {
+		t.Fatalf("macros give %v kcal of %v", kcal, maintain.Calories)
+	}
+
+	user.Goal = "Снизить"
+	lose := DailyTarget(user)
+	if lose.Calories != 2080 || lose.Protein != 144 {
+		t.Fatalf("weight loss target = %+v", lose)
+	}
+
+	user.Goal = "Набрать"
+	if gain := DailyTarget(user); gain.Calories != 2690 {
+		t.Fatalf("weight gain calories = %v", gain.Calories)
+	}
+
+	// With body fat known, the rate comes from 64 kg of lean mass
+	user.Goal, user.BodyFat = "Снизить", 20
+	if lean := DailyTarget(user); lean.Calories != 2050 || lean.Protein != 144 {
+		t.Fatalf("lean mass target = %+v", lean)
+	}
+
+	// Near-underweight users get a 10% deficit rather than 15%: 1863.125*0.9
+	slim := &models.User{Gender: "Мужской", Height: 160, Weight: 50, Goal: "Снизить"}
+	if got := DailyTarget(slim); got.Calories != 1680 {
+		t.Fatalf("near-underweight target = %v", got.Calories)
+	}
+}
+
+func TestWithCalories(t *testing.T) {
+	target := WithCalories(Nutrients{Calories: 2080, Protein: 144, Fat: 72, Carbs: 214}, 1930)
+	// (1930 - 144*4 - 72*9) / 4
+	if target.Calories != 1930 || target.Protein != 144 || target.Fat != 72 || target.Carbs != 177 {
+		t.Fatalf("WithCalories = %+v", target)
+	}
+}
+
+func TestMinCalories(t *testing.T) {
+	for _, tc := range []struct {
+		user *models.User
+		want float64
+	}{
+		{&models.User{Gender: "Мужской", Height: 180, Weight: 80}, 1960},                                    // 20% below 2447.5
+		{&models.User{Gender: "Мужской", Height: 160, Weight: 50}, 1680},                                    // 10% below 1863.1
+		{&models.User{Gender: "Женский", Height: 165, Weight: 60}, 1460},                                    // 20% below 1815.3
+		{&models.User{Gender: "Женский", Height: 150, Weight: 45}, 1200},                                    // 20% below 1480.2
+		{&models.User{Gender: "Мужской", Height: 180, Weight: 80, BodyFat: 20}, 1930},                       // 20% below 2409.6
+		{&models.User{Gender: "Мужской", Height: 180, Weight: 110, Conditions: []string{"diabetes"}}, 2440}, // 15% below 2860
+		{&models.User{Gender: "Женский", Height: 165, Weight: 48}, 1660},                                    // underweight: maintenance 1650.3
+	} {
+		if got := MinCalories(tc.user); got != tc.want {
+			t.Errorf("MinCalories(%+v) = %v, want %v", tc.user, got, tc.want)
+		}
+	}
+}
+
+func TestTotal(t *testing.T) {
+	total := Total([]*models.FoodLog{
+		{Calories: 213, Protein: 7.4, Fat: 3.7, Carbs: 36.5},
+		{Calories: 107, Protein: 1.3, Fat: 0.4, Carbs: 27},
+	})
+	if total.Calories != 320 || math.Abs(total.Protein-8.7) > 1e-9 || math.Abs(total.Carbs-63.5) > 1e-9 {
+		t.Fatalf("Total = %+v", total)
+	}
+}
+
+func TestPlanMinimum(t *testing.T) {
+	day := func(n int, calories ...int) models.PlanDay {
+		d := models.PlanDay{Day: n}
+		for _, c := range calories {
+			d.Meals = append(d.Meals, models.PlanMeal{Calories: c})
+		}
+		return d
+	}
+	data := &models.PlanData{DailyCalories: 2000, Days: []models.PlanDay{day(1, 500, 800, 700), day(2, 400, 700, 500)}}
+	if got := PlanMinimum(data); got != 1600 {
+		t.Fatalf("PlanMinimum = %v, want the leanest day", got)
+	}
+	data.DailyCalories = 1500
+	if got := PlanMinimum(data); got != 1500 {
+		t.Fatalf("PlanMinimum = %v, want the stated daily calories", got)
+	}
+}
@@ -0,0 +1,31 @@
+package nutrition
+
+import (
+	"math"
+	"time"
+)
+
+const (
+	waterPerKg = 30 // ml of water per kg of body weight
+	minWater   = 1500
+	maxWater   = 3500
+
+	// The day's water is spread evenly from waterDayStart to waterDayEnd o'clock
+	waterDayStart = 8
+	waterDayEnd   = 21
+)
+
+// WaterTarget is the daily water intake in ml for a body weight in kg: 30 ml
+// per kg rounded to 50 ml, kept between 1.5 and 3.5 l.
+func WaterTarget(weight float64) int {
+	ml := math.Round(weight*waterPerKg/50) * 50
+	return int(math.Min(math.Max(ml, minWater), maxWater))
+}
+
+// WaterDue is how much of the target should be drunk by the time of day of
+// local, in ml.
+func WaterDue(target int, local time.Time) int {
+	hours := float64(local.Hour()) + float64(local.Minute())/60 - waterDayStart
+	share := math.Min(math.Max(hours/(waterDayEnd-waterDayStart), 0), 1)
+	return int(math.Round(float64(target) * share))
+}
@@ -0,0 +1,30 @@
+package nutrition
+
+import (
+	"testing"
+	"time"
+)
+
+func TestWaterTarget(t *testing.T) {
+	for _, c := range []struct {
+		weight float64
+		want   int
+	}{{80, 2400}, {62.4, 1850}, {45, 1500}, {140, 3500}} {
+		if got := WaterTarget(c.weight); got != c.want {
+			t.Errorf("WaterTarget(%v) = %d, want %d", c.weight, got, c.want)
+		}
+	}
+}
+
+func TestWaterDue(t *testing.T) {
+	day := time.Date(2024, 3, 10, 0, 0, 0, 0, time.UTC)
+	for _, c := range []struct {
+		clock string
+		want  int
+	}{{"07:00", 0}, {"08:00", 0}, {"14:30", 1300}, {"21:00", 2600}, {"23:30", 2600}} {
+		at, _ := time.Parse("15:04", c.clock)
+		if got := WaterDue(2600, day.Add(time.Duration(at.Hour())*time.Hour+time.Duration(at.Minute())*time.Minute)); got != c.want {
+			t.Errorf("WaterDue at %s = %d, want %d", c.clock, got, c.want)
+		}
+	}
+}
@@ -4,12 +4,14 @@ import (
 	"fmt"
 	"github.com/stripe/stripe-go/v72"
 	"strconv"
+	"time"
 
-	"github.com/stripe/stripe-go/v72/checkout/session"
+	"github.com/stripe/stripe-go/v72/client"
 	"github.com/stripe/stripe-go/v72/webhook"
 )
 
 type StripeClient struct {
+	api           *client.API
 	secretKey     string
 	publicKey     string
 	webhookSecret string
@@ -23,11 +25,21 @@ func NewStripeClient(config struct {
 	WebhookKey string
 	ProductID  string
 	PriceID    string
+	APIBase    string
 }) *StripeClient {
-	// Set the secret key for backend operations
-	stripe.Key = config.SecretKey
+	// An empty API base talks to the live Stripe API; tests point it at a local fake
+	var backends *stripe.Backends
+	if config.APIBase != "" {
+		backendConfig := &stripe.BackendConfig{URL: stripe.String(config.APIBase)}
+		backends = &stripe.Backends{
+			API:     stripe.GetBackendWithConfig(stripe.APIBackend, backendConfig),
+			Connect: stripe.GetBackendWithConfig(stripe.ConnectBackend, backendConfig),
+			Uploads: stripe.GetBackendWithConfig(stripe.UploadsBackend, backendConfig),
+		}
+	}
 
 	return &StripeClient{
+		api:           client.New(config.SecretKey, backends),
 		secretKey:     config.SecretKey,
 		publicKey:     config.PublicKey,
 		webhookSecret: config.WebhookKey,
@@ -46,11 +58,6 @@ func (s *StripeClient) GetPriceID() string {
 
 // Modified to return both session ID and URL
 func (s *StripeClient) CreateCheckoutSession(userID int64, successURL, cancelURL string) (string, string, error) {
-	// Ensure we're using the secret key for API operations
-	if stripe.Key != s.secretKey {
-		stripe.Key = s.secretKey
-	}
-
 	params := &stripe.CheckoutSessionParams{
 		PaymentMethodTypes: stripe.StringSlice([]string{
 			"card",
@@ -67,7 +74,7 @@ func (s *StripeClient) CreateCheckoutSession(userID int64, successURL, cancelURL
 		ClientReferenceID: stripe.String(strconv.FormatInt(userID, 10)),
 	}
 
-	sess, err := session.New(params)
+	sess, err := s.api.CheckoutSessions.New(params)
 	if err != nil {
 		return "", "", fmt.Errorf("failed to create checkout session: %v", err)
 	}
@@ -75,6 +82,62 @@ func (s *StripeClient) CreateCheckoutSession(userID int64, successURL, cancelURL
 	return sess.ID, sess.URL, nil
 }
 
+// GetCheckoutSession fetches the current state of a checkout session.
+func (s *StripeClient) GetCheckoutSession(sessionID string) (*stripe.CheckoutSession, error) {
+	sess, err := s.api.CheckoutSessions.Get(sessionID, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get checkout session: %v", err)
+	}
+
+	return sess, nil
+}
+
+// ListCheckoutSessions returns the checkout sessions created since the given time, newest first.
+func (s *StripeClient) ListCheckoutSessions(since time.Time) ([]*stripe.CheckoutSession, error) {
+	params := &stripe.CheckoutSessionListParams{}
+	params.Filters.AddFilter("created", "gte", strconv.FormatInt(since.Unix(), 10))
+	params.Limit = stripe.Int64(100)
+
+	var sessions []*stripe.CheckoutSession
+	iter := s.api.CheckoutSessions.List(params)
+	for iter.Next() {
+		sessions = append(sessions, iter.CheckoutSession())
+	}
+	if err := iter.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list checkout sessions: %v", err)
+	}
+
+	return sessions, nil
+}
+
+// ExpireCheckoutSession closes an open checkout session so it can no longer be paid.
+func (s *StripeClient) ExpireCheckoutSession(sessionID string) error {
+	if _, err := s.api.CheckoutSessions.Expire(sessionID, nil); err != nil {
+		return fmt.Errorf("failed to expire checkout session: %v", err)
+	}
+
+	return nil
+}
+
+// CreateRefund refunds a payment intent. An amount of zero refunds the full charge;
+// otherwise it is given in the smallest currency unit.
+func (s *StripeClient) CreateRefund(paymentIntentID string, amount int64) (*stripe.Refund, error) {
+	params := &stripe.RefundParams{
+		PaymentIntent: stripe.String(paymentIntentID),
+		Reason:        stripe.String(string(stripe.RefundReasonRequestedByCustomer)),
+	}
+	if amount > 0 {
+		params.Amount = stripe.Int64(amount)
+	}
+
+	ref, err := s.api.Refunds.New(params)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create refund: %v", err)
+	}
+
+	return ref, nil
+}
+
 func (s *StripeClient) VerifyWebhookSignature(payload []byte, sig string, webhookSecret string) (stripe.Event, error) {
 	if webhookSecret == "" {
 		return stripe.Event{}, fmt.Errorf("webhook secret is not configured")
@@ -0,0 +1,164 @@
+package payment_test
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"diet-bot/internal/payment"
+	"diet-bot/internal/payment/stripetest"
+
+	"github.com/stripe/stripe-go/v72"
+)
+
+const webhookSecret = "whsec_test"
+
+func newClient(t *testing.T) (*payment.StripeClient, *stripetest.Server) {
+	t.Helper()
+
+	fake := stripetest.NewServer(webhookSecret)
+	t.Cleanup(fake.Close)
+
+	client := payment.NewStripeClient(struct {
+		SecretKey  string
+		PublicKey  string
+		WebhookKey string
+		ProductID  string
+		PriceID    string
+		APIBase    string
+	}{
+		SecretKey:  "sk_test_fake",
+		WebhookKey: webhookSecret,
+		PriceID:    "price_test",
+		APIBase:    fake.URL,
+	})
+
+	return client, fake
+}
+
+func TestPurchaseFlow(t *testing.T) {
+	client, fake := newClient(t)
+
+	sessionID, checkoutURL, err := client.CreateCheckoutSession(42, "https://t.me/bot?start=payment_success", "https://t.me/bot?start=payment_cancel")
+	if err != nil {
+		t.Fatalf("CreateCheckoutSession: %v", err)
+	}
+	if sessionID == "" || checkoutURL == "" {
+		t.Fatalf("got session %q url %q", sessionID, checkoutURL)
+	}
+
+	sessions := fake.Sessions()
+	if len(sessions) != 1 || sessions[0].ClientReferenceID != "42" || sessions[0].PriceID != "price_test" {
+		t.Fatalf("unexpected sessions on fake: %+v", sessions)
+	}
+
+	payload, signature, err := fake.CompleteSession(sessionID)
+	if err != nil {
+		t.Fatalf("CompleteSession: %v", err)
+	}
+
+	event, err := client.VerifyWebhookSignature(payload, signature, client.GetWebhookSecret())
+	if err != nil {
+		t.Fatalf("VerifyWebhookSignature: %v", err)
+	}
+	if event.Type != "checkout.session.completed" {
+		t.Fatalf("event type = %q", event.Type)
+	}
+
+	var sess stripe.CheckoutSession
+	if err := json.Unmarshal(event.Data.Raw, &sess); err != nil {
+		t.Fatalf("unmarshal session: %v", err)
+	}
+	if sess.ID != sessionID || sess.ClientReferenceID != "42" || sess.PaymentIntent == nil {
+		t.Fatalf("unexpected session in event: %+v", sess)
+	}
+
+	fetched, err := client.GetCheckoutSession(sessionID)
+	if err != nil {
+		t.Fatalf("GetCheckoutSession: %v", err)
+	}
+	if fetched.PaymentStatus != stripe.CheckoutSessionPaymentStatusPaid {
+		t.Fatalf("payment status = %q", fetched.PaymentStatus)
+	}
+
+	ref, err := client.CreateRefund(sess.PaymentIntent.ID, 0)
+	if err != nil {
+		t.Fatalf("CreateRefund: %v", err)
+	}
+	if refunds := fake.Refunds(); len(refunds) != 1 || refunds[0].ID != ref.ID || refunds[0].Amount != fake.AmountTotal {
+		t.Fatalf("unexpected refunds: %+v", refunds)
+	}
+
+	payload, signature, err = fake.ChargeRefundedEvent(sess.PaymentIntent.ID, fake.AmountTotal)
+	if err != nil {
+		t.Fatalf("ChargeRefundedEvent: %v", err)
+	}
+	event, err = client.VerifyWebhookSignature(payload, signature, webhookSecret)
+	if err != nil {
+		t.Fatalf("VerifyWebhookSignature(refund): %v", err)
+	}
+
+	var charge stripe.Charge
+	if err := json.Unmarshal(event.Data.Raw, &charge); err != nil {
+		t.Fatalf("unmarshal charge: %v", err)
+	}
+	if !charge.Refunded || charge.PaymentIntent == nil || charge.PaymentIntent.ID != sess.PaymentIntent.ID {
+		t.Fatalf("unexpected charge in event: %+v", charge)
+	}
+}
+
+func TestReconciliationCalls(t *testing.T) {
+	client, _ := newClient(t)
+
+	openID, _, err := client.CreateCheckoutSession(1, "https://example.test/ok", "https://example.test/cancel")
+	if err != nil {
+		t.Fatalf("CreateCheckoutSession: %v", err)
+	}
+
+	sessions, err := client.ListCheckoutSessions(time.Now().Add(-time.Hour))
+	if err != nil {
+		t.Fatalf("ListCheckoutSessions: %v", err)
+	}
+	if len(sessions) != 1 || sessions[0].ID != openID {
+		t.Fatalf("listed %d sessions", len(sessions))
+	}
+
+	if err := client.ExpireCheckoutSession(openID); err != nil {
+		t.Fatalf("ExpireCheckoutSession: %v", err)
+	}
+	if err := client.ExpireCheckoutSession(openID); err == nil {
+		t.Fatal("expiring an expired session should fail")
+	}
+
+	sess, err := client.GetCheckoutSession(openID)
+	if err != nil {
+		t.Fatalf("GetCheckoutSession: %v", err)
+	}
+	if sess.Status != stripe.CheckoutSessionStatusExpired {
+		t.Fatalf("status = %q, want expired", sess.Status)
+	}
+}
+
+func TestVerifyWebhookSignatureRejectsTampering(t *testing.T) {
+	client, fake := newClient(t)
+
+	sessionID, _, err := client.CreateCheckoutSession(7, "https://example.test/ok", "https://example.test/cancel")
+	if err != nil {
+		t.Fatalf("CreateCheckoutSession: %v", err)
+	}
+	payload, signature, err := fake.CompleteSession(sessionID)
+	if err != nil {
+		t.Fatalf("CompleteSession: %v", err)
+	}
+
+	tampered := append([]byte{}, payload...)
+	tampered[len(tampered)-2] = ' '
+	if _, err := client.VerifyWebhookSignature(tampered, signature, webhookSecret); err == nil {
+		t.Fatal("tampered payload verified")
+	}
+
+	stale := stripetest.Sign(payload, webhookSecret, time.Now().Add(-time.Hour))
+	if _, err := client.VerifyWebhookSignature(payload, stale, webhookSecret); err == nil {
+		t.Fatal("signature outside the tolerance verified")
+	}
+}
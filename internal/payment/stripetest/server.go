@@ -0,0 +1,338 @@
+// Package stripetest provides an in-process stand-in for the Stripe API and its
+// webhooks, so the purchase flow can run in tests without network access.
+package stripetest
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/stripe/stripe-go/v72/webhook"
+)
+
+// Session is the fake's view of a checkout session.
+type Session struct {
+	ID                string
+	ClientReferenceID string
+	SuccessURL        string
+	CancelURL         string
+	PriceID           string
+	Status            string // open, complete or expired
+	PaymentStatus     string // unpaid or paid
+	PaymentIntentID   string
+	AmountTotal       int64
+	Currency          string
+	Created           time.Time
+}
+
+// Refund is a refund created through the fake.
+type Refund struct {
+	ID              string
+	PaymentIntentID string
+	Amount          int64
+}
+
+// Server serves the subset of the Stripe API used by internal/payment and
+// produces webhook events signed with WebhookSecret.
+type Server struct {
+	*httptest.Server
+
+	WebhookSecret string
+	// AmountTotal and Currency are used for every new session.
+	AmountTotal int64
+	Currency    string
+
+	mu       sync.Mutex
+	seq      int
+	sessions map[string]*Session
+	refunds  []*Refund
+}
+
+// NewServer starts a fake Stripe API. Close it when done.
+func NewServer(webhookSecret string) *Server {
+	s := &Server{
+		WebhookSecret: webhookSecret,
+		AmountTotal:   100000,
+		Currency:      "rub",
+		sessions:      make(map[string]*Session),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/checkout/sessions", s.handleSessions)
+	mux.HandleFunc("/v1/checkout/sessions/", s.handleSession)
+	mux.HandleFunc("/v1/refunds", s.handleRefunds)
+	s.Server = httptest.NewServer(mux)
+
+	return s
+}
+
+// Sessions returns all sessions created so far, oldest first.
+func (s *Server) Sessions() []Session {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sessions := make([]Session, 0, len(s.sessions))
+	for _, sess := range s.sessions {
+		sessions = append(sessions, *sess)
+	}
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].ID < sessions[j].ID })
+	return sessions
+}
+
+// Refunds returns all refunds created so far.
+func (s *Server) Refunds() []Refund {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	refunds := make([]Refund, len(s.refunds))
+	for i, r := range s.refunds {
+		refunds[i] = *r
+	}
+	return refunds
+}
+
+// CompleteSession marks a session as paid and returns the signed
+// checkout.session.completed event Stripe would deliver for it.
+func (s *Server) CompleteSession(sessionID string) (payload []byte, signature string, err error) {
+	s.mu.Lock()
+	sess, ok := s.sessions[sessionID]
+	if !ok {
+		s.mu.Unlock()
+		return nil, "", fmt.Errorf("unknown checkout session %s", sessionID)
+	}
+	sess.Status = "complete"
+	sess.PaymentStatus = "paid"
+	sess.PaymentIntentID = s.nextID("pi")
+	obj := sessionJSON(sess)
+	s.mu.Unlock()
+
+	return s.SignedEvent("checkout.session.completed", obj)
+}
+
+// ChargeRefundedEvent returns a signed charge.refunded event for a payment intent.
+// A refunded amount equal to the session total marks the charge fully refunded.
+func (s *Server) ChargeRefundedEvent(paymentIntentID string, amountRefunded int64) ([]byte, string, error) {
+	s.mu.Lock()
+	amount, currency := s.AmountTotal, s.Currency
+	for _, sess := range s.sessions {
+		if sess.PaymentIntentID == paymentIntentID {
+			amount, currency = sess.AmountTotal, sess.Currency
+		}
+	}
+	id := s.nextID("ch")
+	s.mu.Unlock()
+
+	return s.SignedEvent("charge.refunded", map[string]interface{}{
+		"id":              id,
+		"object":          "charge",
+		"amount":          amount,
+		"amount_refunded": amountRefunded,
+		"currency":        currency,
+		"payment_intent":  paymentIntentID,
+		"refunded":        amountRefunded >= amount,
+	})
+}
+
+// SignedEvent wraps obj in an event envelope and signs it the way Stripe does,
+// returning the body and the Stripe-Signature header value.
+func (s *Server) SignedEvent(eventType string, obj interface{}) ([]byte, string, error) {
+	s.mu.Lock()
+	id := s.nextID("evt")
+	s.mu.Unlock()
+
+	payload, err := json.Marshal(map[string]interface{}{
+		"id":          id,
+		"object":      "event",
+		"api_version": "2020-08-27",
+		"created":     time.Now().Unix(),
+		"type":        eventType,
+		"data":        map[string]interface{}{"object": obj},
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	return payload, Sign(payload, s.WebhookSecret, time.Now()), nil
+}
+
+// Sign computes a Stripe-Signature header for payload.
+func Sign(payload []byte, secret string, at time.Time) string {
+	sig := webhook.ComputeSignature(at, payload, secret)
+	return fmt.Sprintf("t=%d,v1=%s", at.Unix(), hex.EncodeToString(sig))
+}
+
+func (s *Server) handleSessions(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		if err := r.ParseForm(); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		s.mu.Lock()
+		sess := &Session{
+			ID:                s.nextID("cs_test"),
+			ClientReferenceID: r.PostForm.Get("client_reference_id"),
+			SuccessURL:        r.PostForm.Get("success_url"),
+			CancelURL:         r.PostForm.Get("cancel_url"),
+			PriceID:           r.PostForm.Get("line_items[0][price]"),
+			Status:            "open",
+			PaymentStatus:     "unpaid",
+			AmountTotal:       s.AmountTotal,
+			Currency:          s.Currency,
+			Created:           time.Now(),
+		}
+		s.sessions[sess.ID] = sess
+		obj := sessionJSON(sess)
+		s.mu.Unlock()
+
+		writeJSON(w, obj)
+
+	case http.MethodGet:
+		var since int64
+		if v := r.URL.Query().Get("created[gte]"); v != "" {
+			since, _ = strconv.ParseInt(v, 10, 64)
+		}
+
+		s.mu.Lock()
+		var data []interface{}
+		for _, sess := range s.sessions {
+			if sess.Created.Unix() >= since {
+				data = append(data, sessionJSON(sess))
+			}
+		}
+		s.mu.Unlock()
+
+		writeJSON(w, map[string]interface{}{
+			"object":   "list",
+			"url":      "/v1/checkout/sessions",
+			"has_more": false,
+			"data":     data,
+		})
+
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+func (s *Server) handleSession(w http.ResponseWriter, r *http.Request) {
+	rest := strings.TrimPrefix(r.URL.Path, "/v1/checkout/sessions/")
+	id, action, _ := strings.Cut(rest, "/")
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sess, ok := s.sessions[id]
+	if !ok {
+		writeError(w, http.StatusNotFound, "No such checkout.session: "+id)
+		return
+	}
+
+	switch {
+	case action == "" && r.Method == http.MethodGet:
+		writeJSON(w, sessionJSON(sess))
+	case action == "expire" && r.Method == http.MethodPost:
+		if sess.Status != "open" {
+			writeError(w, http.StatusBadRequest, "Only Checkout Sessions with a status of open can be expired.")
+			return
+		}
+		sess.Status = "expired"
+		writeJSON(w, sessionJSON(sess))
+	default:
+		writeError(w, http.StatusNotFound, "unknown endpoint")
+	}
+}
+
+func (s *Server) handleRefunds(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	intentID := r.PostForm.Get("payment_intent")
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var paid *Session
+	for _, sess := range s.sessions {
+		if sess.PaymentIntentID == intentID && intentID != "" {
+			paid = sess
+		}
+	}
+	if paid == nil {
+		writeError(w, http.StatusBadRequest, "No such payment_intent: "+intentID)
+		return
+	}
+
+	amount := paid.AmountTotal
+	if v := r.PostForm.Get("amount"); v != "" {
+		amount, _ = strconv.ParseInt(v, 10, 64)
+	}
+
+	ref := &Refund{ID: s.nextID("re"), PaymentIntentID: intentID, Amount: amount}
+	s.refunds = append(s.refunds, ref)
+
+	writeJSON(w, map[string]interface{}{
+		"id":             ref.ID,
+		"object":         "refund",
+		"amount":         ref.Amount,
+		"currency":       paid.Currency,
+		"payment_intent": intentID,
+		"status":         "succeeded",
+	})
+}
+
+// nextID must be called with mu held.
+func (s *Server) nextID(prefix string) string {
+	s.seq++
+	return fmt.Sprintf("%s_%06d", prefix, s.seq)
+}
+
+func sessionJSON(sess *Session) map[string]interface{} {
+	var paymentIntent interface{}
+	if sess.PaymentIntentID != "" {
+		paymentIntent = sess.PaymentIntentID
+	}
+
+	return map[string]interface{}{
+		"id":                  sess.ID,
+		"object":              "checkout.session",
+		"client_reference_id": sess.ClientReferenceID,
+		"success_url":         sess.SuccessURL,
+		"cancel_url":          sess.CancelURL,
+		"url":                 "https://checkout.stripe.test/pay/" + sess.ID,
+		"mode":                "payment",
+		"status":              sess.Status,
+		"payment_status":      sess.PaymentStatus,
+		"payment_intent":      paymentIntent,
+		"amount_total":        sess.AmountTotal,
+		"currency":            sess.Currency,
+		"expires_at":          sess.Created.Add(24 * time.Hour).Unix(),
+		"metadata":            map[string]string{},
+	}
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error": map[string]string{"type": "invalid_request_error", "message": message},
+	})
+}
@@ -0,0 +1,74 @@
+package progress
+
+import (
+	"time"
+
+	"diet-bot/internal/models"
+)
+
+// What a measurement history tracks
+const (
+	SizeWaist = "waist"
+	SizeHip   = "hip"
+	SizeChest = "chest"
+	SizeNeck  = "neck"
+	BodyFat   = "body_fat"  // percent
+	LeanMass  = "lean_mass" // kg
+)
+
+// Change is how much a value moved since an earlier entry.
+type Change struct {
+	Delta float64
+	Since time.Time
+}
+
+// BodyTrend summarises a measurement history.
+type BodyTrend struct {
+	Latest *models.Measurement
+	// Changes hold, for each value of Latest, the change since the earliest
+	// entry that has it too
+	Changes map[string]Change
+}
+
+// ComputeBodyTrend summarises measurements, which must be ordered by
+// LoggedOn. It returns false for an empty history.
+func ComputeBodyTrend(measurements []*models.Measurement) (BodyTrend, bool) {
+	if len(measurements) == 0 {
+		return BodyTrend{}, false
+	}
+
+	latest := measurements[len(measurements)-1]
+	trend := BodyTrend{Latest: latest, Changes: make(map[string]Change)}
+	for _, key := range []string{SizeWaist, SizeHip, SizeChest, SizeNeck, BodyFat, LeanMass} {
+		now := BodyValue(latest, key)
+		if now == 0 {
+			continue
+		}
+		for _, m := range measurements[:len(measurements)-1] {
+			if then := BodyValue(m, key); then != 0 {
+				trend.Changes[key] = Change{Delta: now - then, Since: m.LoggedOn}
+				break
+			}
+		}
+	}
+	return trend, true
+}
+
+// BodyValue returns one of the values of a measurement, 0 when it is unknown.
+func BodyValue(m *models.Measurement, key string) float64 {
+	switch key {
+	case SizeWaist:
+		return m.Waist
+	case SizeHip:
+		return m.Hip
+	case SizeChest:
+		return m.Chest
+	case SizeNeck:
+		return m.Neck
+	case BodyFat:
+		return m.BodyFat
+	case LeanMass:
+		return m.LeanMass()
+	}
+	return 0
+}
@@ -0,0 +1,42 @@
+package progress
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"diet-bot/internal/models"
+)
+
+func TestComputeBodyTrend(t *testing.T) {
+	if _, ok := ComputeBodyTrend(nil); ok {
+		t.Fatal("trend of an empty history")
+	}
+
+	day := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	trend, ok := ComputeBodyTrend([]*models.Measurement{
+		{Chest: 102, Weight: 82, LoggedOn: day},
+		{Waist: 90, Neck: 39, Weight: 81, BodyFat: 20, LoggedOn: day.AddDate(0, 0, 7)},
+		{Waist: 87.5, Neck: 39, Chest: 101, Weight: 80, BodyFat: 18.5, LoggedOn: day.AddDate(0, 0, 14)},
+	})
+	if !ok || trend.Latest.Waist != 87.5 {
+		t.Fatalf("ComputeBodyTrend = %+v, %v", trend, ok)
+	}
+
+	for key, want := range map[string]Change{
+		SizeChest: {Delta: -1, Since: day},
+		SizeWaist: {Delta: -2.5, Since: day.AddDate(0, 0, 7)},
+		SizeNeck:  {Delta: 0, Since: day.AddDate(0, 0, 7)},
+		BodyFat:   {Delta: -1.5, Since: day.AddDate(0, 0, 7)},
+		// 80 * 0.815 - 81 * 0.8
+		LeanMass: {Delta: 0.4, Since: day.AddDate(0, 0, 7)},
+	} {
+		got, ok := trend.Changes[key]
+		if !ok || math.Abs(got.Delta-want.Delta) > 1e-9 || !got.Since.Equal(want.Since) {
+			t.Errorf("change of %s = %+v, %v; want %+v", key, got, ok, want)
+		}
+	}
+	if _, ok := trend.Changes[SizeHip]; ok {
+		t.Error("change of a size never measured")
+	}
+}
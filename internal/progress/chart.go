@@ -0,0 +1,307 @@
+package progress
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"math"
+	"time"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+)
+
+// Chart colours, also referred to by the captions the bot sends.
+var (
+	ColorWeight  = color.RGBA{R: 120, G: 120, B: 120, A: 255}
+	ColorAverage = color.RGBA{R: 33, G: 110, B: 220, A: 255}
+	ColorGoal    = color.RGBA{R: 40, G: 160, B: 70, A: 255}
+	ColorOver    = color.RGBA{R: 220, G: 70, B: 50, A: 255}
+	ColorUnder   = color.RGBA{R: 240, G: 170, B: 40, A: 255}
+
+	colorBackground = color.RGBA{R: 255, G: 255, B: 255, A: 255}
+	colorGrid       = color.RGBA{R: 230, G: 230, B: 230, A: 255}
+	colorAxis       = color.RGBA{R: 60, G: 60, B: 60, A: 255}
+)
+
+const (
+	chartWidth  = 800
+	chartHeight = 480
+
+	marginLeft   = 60
+	marginRight  = 20
+	marginTop    = 20
+	marginBottom = 40
+)
+
+// Point is one value of a series on a given day.
+type Point struct {
+	Day   time.Time
+	Value float64
+}
+
+// Series is a line drawn on a LineChart.
+type Series struct {
+	Points  []Point
+	Color   color.RGBA
+	Width   int
+	Dashed  bool
+	Markers bool
+}
+
+// LineChart plots series against days. Labels are ASCII only because the
+// bundled bitmap font has no Cyrillic; titles belong in the caption.
+type LineChart struct {
+	Series []Series
+	Unit   string
+}
+
+// Bar is one day of a BarChart.
+type Bar struct {
+	Day   time.Time
+	Value float64
+}
+
+// BarChart plots one bar per day against a target. Bars within Tolerance of
+// the target are green, above it red and below it amber.
+type BarChart struct {
+	Bars      []Bar
+	Target    float64
+	Tolerance float64 // fraction of Target, e.g. 0.1
+	Unit      string
+}
+
+// canvas maps days and values onto the plot area of an image.
+type canvas struct {
+	img                *image.RGBA
+	fromDay, toDay     time.Time
+	minValue, maxValue float64
+}
+
+func newCanvas(fromDay, toDay time.Time, minValue, maxValue float64) *canvas {
+	img := image.NewRGBA(image.Rect(0, 0, chartWidth, chartHeight))
+	draw.Draw(img, img.Bounds(), &image.Uniform{C: colorBackground}, image.Point{}, draw.Src)
+	return &canvas{img: img, fromDay: fromDay, toDay: toDay, minValue: minValue, maxValue: maxValue}
+}
+
+func (c *canvas) x(day time.Time) float64 {
+	span := c.toDay.Sub(c.fromDay).Hours()
+	return marginLeft + day.Sub(c.fromDay).Hours()/span*float64(chartWidth-marginLeft-marginRight)
+}
+
+func (c *canvas) y(value float64) float64 {
+	return float64(chartHeight-marginBottom) - (value-c.minValue)/(c.maxValue-c.minValue)*float64(chartHeight-marginTop-marginBottom)
+}
+
+// PNG renders the chart. It fails when there is nothing to plot.
+func (lc LineChart) PNG() ([]byte, error) {
+	var points []Point
+	for _, s := range lc.Series {
+		points = append(points, s.Points...)
+	}
+	if len(points) == 0 {
+		return nil, fmt.Errorf("chart has no points")
+	}
+
+	fromDay, toDay := points[0].Day, points[0].Day
+	minValue, maxValue := points[0].Value, points[0].Value
+	for _, p := range points {
+		if p.Day.Before(fromDay) {
+			fromDay = p.Day
+		}
+		if p.Day.After(toDay) {
+			toDay = p.Day
+		}
+		minValue = math.Min(minValue, p.Value)
+		maxValue = math.Max(maxValue, p.Value)
+	}
+	// A single day or a flat line still needs a visible range
+	if !toDay.After(fromDay) {
+		fromDay, toDay = fromDay.AddDate(0, 0, -1), toDay.AddDate(0, 0, 1)
+	}
+	pad := math.Max((maxValue-minValue)*0.1, 0.5)
+	minValue, maxValue = minValue-pad, maxValue+pad
+
+	c := newCanvas(fromDay, toDay, minValue, maxValue)
+	c.drawValueAxis(lc.Unit)
+	c.drawDayAxis()
+
+	for _, s := range lc.Series {
+		width := s.Width
+		if width == 0 {
+			width = 2
+		}
+		for i := 1; i < len(s.Points); i++ {
+			a, b := s.Points[i-1], s.Points[i]
+			c.line(c.x(a.Day), c.y(a.Value), c.x(b.Day), c.y(b.Value), s.Color, width, s.Dashed)
+		}
+		if s.Markers || len(s.Points) == 1 {
+			for _, p := range s.Points {
+				c.dot(c.x(p.Day), c.y(p.Value), 3, s.Color)
+			}
+		}
+	}
+
+	return encodePNG(c.img)
+}
+
+// PNG renders the chart. It fails when there are no bars.
+func (bc BarChart) PNG() ([]byte, error) {
+	if len(bc.Bars) == 0 {
+		return nil, fmt.Errorf("chart has no bars")
+	}
+
+	fromDay, toDay := bc.Bars[0].Day, bc.Bars[0].Day
+	maxValue := bc.Target
+	for _, b := range bc.Bars {
+		if b.Day.Before(fromDay) {
+			fromDay = b.Day
+		}
+		if b.Day.After(toDay) {
+			toDay = b.Day
+		}
+		maxValue = math.Max(maxValue, b.Value)
+	}
+	if maxValue <= 0 {
+		maxValue = 1
+	}
+
+	// Half a day of room on both sides keeps the outer bars inside the plot
+	c := newCanvas(fromDay.Add(-12*time.Hour), toDay.Add(12*time.Hour), 0, maxValue*1.15)
+	c.drawValueAxis(bc.Unit)
+	c.drawDayAxis()
+
+	days := toDay.Sub(fromDay).Hours()/24 + 1
+	halfWidth := math.Max(float64(chartWidth-marginLeft-marginRight)/days*0.35, 1)
+	for _, b := range bc.Bars {
+		col := ColorGoal
+		switch {
+		case bc.Target > 0 && b.Value > bc.Target*(1+bc.Tolerance):
+			col = ColorOver
+		case bc.Target > 0 && b.Value < bc.Target*(1-bc.Tolerance):
+			col = ColorUnder
+		}
+		x := c.x(b.Day)
+		rect := image.Rect(int(x-halfWidth), int(c.y(b.Value)), int(x+halfWidth), int(c.y(0)))
+		draw.Draw(c.img, rect, &image.Uniform{C: col}, image.Point{}, draw.Src)
+	}
+
+	if bc.Target > 0 {
+		y := c.y(bc.Target)
+		c.line(marginLeft, y, chartWidth-marginRight, y, colorAxis, 2, true)
+	}
+
+	return encodePNG(c.img)
+}
+
+// drawValueAxis draws horizontal grid lines with value labels.
+func (c *canvas) drawValueAxis(unit string) {
+	step := niceStep((c.maxValue - c.minValue) / 6)
+	for v := math.Ceil(c.minValue/step) * step; v <= c.maxValue; v += step {
+		y := c.y(v)
+		c.line(marginLeft, y, chartWidth-marginRight, y, colorGrid, 1, false)
+		c.text(4, int(y)+4, formatTick(v, step))
+	}
+	c.line(marginLeft, marginTop, marginLeft, chartHeight-marginBottom, colorAxis, 1, false)
+	c.line(marginLeft, chartHeight-marginBottom, chartWidth-marginRight, chartHeight-marginBottom, colorAxis, 1, false)
+	if unit != "" {
+		c.text(4, marginTop-6, unit)
+	}
+}
+
+// drawDayAxis labels up to seven evenly spaced days.
+func (c *canvas) drawDayAxis() {
+	first := c.fromDay.Truncate(24 * time.Hour)
+	if first.Before(c.fromDay) {
+		first = first.AddDate(0, 0, 1)
+	}
+	days := int(c.toDay.Sub(first).Hours()/24) + 1
+	every := (days + 6) / 7
+	if every < 1 {
+		every = 1
+	}
+
+	for day := first; !day.After(c.toDay); day = day.AddDate(0, 0, every) {
+		x := c.x(day)
+		c.line(x, chartHeight-marginBottom, x, chartHeight-marginBottom+4, colorAxis, 1, false)
+		c.text(int(x)-17, chartHeight-marginBottom+18, day.Format("02.01"))
+	}
+}
+
+// line draws a straight segment of the given width, optionally dashed.
+func (c *canvas) line(x0, y0, x1, y1 float64, col color.RGBA, width int, dashed bool) {
+	dx, dy := x1-x0, y1-y0
+	length := math.Hypot(dx, dy)
+	steps := int(math.Ceil(length))
+	if steps == 0 {
+		steps = 1
+	}
+
+	for i := 0; i <= steps; i++ {
+		t := float64(i) / float64(steps)
+		if dashed && int(t*length/8)%2 == 1 {
+			continue
+		}
+		x, y := int(math.Round(x0+dx*t)), int(math.Round(y0+dy*t))
+		for ox := -(width - 1) / 2; ox <= width/2; ox++ {
+			for oy := -(width - 1) / 2; oy <= width/2; oy++ {
+				c.img.SetRGBA(x+ox, y+oy, col)
+			}
+		}
+	}
+}
+
+// dot draws a filled circle.
+func (c *canvas) dot(cx, cy float64, r int, col color.RGBA) {
+	x0, y0 := int(math.Round(cx)), int(math.Round(cy))
+	for x := -r; x <= r; x++ {
+		for y := -r; y <= r; y++ {
+			if x*x+y*y <= r*r {
+				c.img.SetRGBA(x0+x, y0+y, col)
+			}
+		}
+	}
+}
+
+func (c *canvas) text(x, y int, s string) {
+	d := &font.Drawer{
+		Dst:  c.img,
+		Src:  &image.Uniform{C: colorAxis},
+		Face: basicfont.Face7x13,
+		Dot:  fixed.P(x, y),
+	}
+	d.DrawString(s)
+}
+
+// niceStep rounds a raw tick interval up to 1, 2 or 5 times a power of ten.
+func niceStep(raw float64) float64 {
+	if raw <= 0 {
+		return 1
+	}
+	magnitude := math.Pow(10, math.Floor(math.Log10(raw)))
+	for _, m := range []float64{1, 2, 5, 10} {
+		if raw <= m*magnitude {
+			return m * magnitude
+		}
+	}
+	return 10 * magnitude
+}
+
+func formatTick(v, step float64) string {
+	if step < 1 {
+		return fmt.Sprintf("%.1f", v)
+	}
+	return fmt.Sprintf("%.0f", v)
+}
+
+func encodePNG(img image.Image) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,74 @@
+package progress
+
+import (
+	"bytes"
+	"image/png"
+	"testing"
+	"time"
+)
+
+func TestWeightChartPNG(t *testing.T) {
+	start := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	for name, weights := range map[string][]float64{
+		"single entry": {80},
+		"flat":         {80, 80, 80},
+		"losing":       {82, 81.6, 81.1, 81.3, 80.7, 80.2, 80.4, 79.9, 79.5, 79.6},
+	} {
+		data, err := WeightChart(weighIns(start, weights...), "Снизить").PNG()
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		img, err := png.Decode(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("%s: invalid PNG: %v", name, err)
+		}
+		if b := img.Bounds(); b.Dx() != chartWidth || b.Dy() != chartHeight {
+			t.Fatalf("%s: image is %v", name, b)
+		}
+	}
+
+	if _, err := WeightChart(nil, "Снизить").PNG(); err == nil {
+		t.Fatal("rendered a chart without points")
+	}
+}
+
+func TestBarChartColoursAdherence(t *testing.T) {
+	start := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	chart := BarChart{
+		Bars: []Bar{
+			{Day: start, Value: 2000},
+			{Day: start.AddDate(0, 0, 1), Value: 2600},
+			{Day: start.AddDate(0, 0, 2), Value: 1200},
+		},
+		Target:    2000,
+		Tolerance: 0.1,
+	}
+
+	data, err := chart.PNG()
+	if err != nil {
+		t.Fatalf("PNG: %v", err)
+	}
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("invalid PNG: %v", err)
+	}
+
+	// Sample just above the axis in the middle of each bar
+	c := newCanvas(start.Add(-12*time.Hour), start.AddDate(0, 0, 2).Add(12*time.Hour), 0, 2600*1.15)
+	for i, want := range []interface{}{ColorGoal, ColorOver, ColorUnder} {
+		x := int(c.x(start.AddDate(0, 0, i)))
+		y := int(c.y(0)) - 5
+		if got := img.At(x, y); got != want {
+			t.Errorf("bar %d colour = %v, want %v", i, got, want)
+		}
+	}
+}
+
+func TestNiceStep(t *testing.T) {
+	for raw, want := range map[float64]float64{0.3: 0.5, 0.8: 1, 1.5: 2, 3: 5, 7: 10, 130: 200} {
+		if got := niceStep(raw); got != want {
+			t.Errorf("niceStep(%v) = %v, want %v", raw, got, want)
+		}
+	}
+}
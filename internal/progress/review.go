@@ -0,0 +1,113 @@
+package progress
+
+import (
+	"math"
+)
+
+// Verdicts of a weekly review.
+const (
+	VerdictNoData   = "no_data"  // too few weigh-ins for a rate
+	VerdictOnTrack  = "on_track" // moving towards the goal at a safe pace
+	VerdictStalled  = "stalled"  // not moving towards the goal
+	VerdictTooFast  = "too_fast" // faster than is safe
+	VerdictOffPlan  = "off_plan" // stalled, but the diary shows the plan is not followed
+	VerdictDrifting = "drifting" // maintenance, but the weight moves
+)
+
+const (
+	// maxLossShare and maxGainShare are the safe weekly change as a share of
+	// body weight.
+	maxLossShare = 0.01
+	maxGainShare = 0.005
+
+	// minLossRate and minGainRate, in kg per week, are the slowest change
+	// that still counts as progress; maxDriftRate is how far maintenance may move.
+	minLossRate  = 0.2
+	minGainRate  = 0.1
+	maxDriftRate = 0.3
+
+	// calorieStep is how much a review moves the daily target at a time.
+	calorieStep = 150
+	// minDiaryDays is how many logged days a week needs for the diary to count.
+	minDiaryDays = 4
+	// diaryTolerance is how far the diary average may miss the target before
+	// a stall is blamed on the diary rather than the target.
+	diaryTolerance = 0.1
+)
+
+// ReviewInput is a week of progress against the plan.
+type ReviewInput struct {
+	Goal       string  // questionnaire goal: Снизить, Набрать or Поддерживать
+	Weight     float64 // latest weight, kg
+	WeeklyRate float64 // kg per week, see WeeklyRate
+	HasRate    bool
+
+	Target      float64 // current daily calories
+	MinCalories float64 // the target is never proposed below this
+
+	DiaryDays    int     // days with food diary entries
+	DiaryAverage float64 // mean daily calories of those days
+}
+
+// Review is the outcome of a weekly review.
+type Review struct {
+	Verdict string
+	// Calories is the proposed daily target, 0 to keep the current one
+	Calories float64
+}
+
+// Assess compares the pace of weight change with what is safe and useful for
+// the goal and proposes a new calorie target when it needs one.
+func Assess(in ReviewInput) Review {
+	if !in.HasRate {
+		return Review{Verdict: VerdictNoData}
+	}
+
+	// Positive progress is change in the direction of the goal
+	diaryCounts := in.DiaryDays >= minDiaryDays
+	switch in.Goal {
+	case "Снизить":
+		loss := -in.WeeklyRate
+		switch {
+		case loss > maxLossShare*in.Weight:
+			return in.propose(VerdictTooFast, calorieStep)
+		case loss < minLossRate:
+			if diaryCounts && in.DiaryAverage > in.Target*(1+diaryTolerance) {
+				return Review{Verdict: VerdictOffPlan}
+			}
+			return in.propose(VerdictStalled, -calorieStep)
+		}
+	case "Набрать":
+		gain := in.WeeklyRate
+		switch {
+		case gain > maxGainShare*in.Weight:
+			return in.propose(VerdictTooFast, -calorieStep)
+		case gain < minGainRate:
+			if diaryCounts && in.DiaryAverage < in.Target*(1-diaryTolerance) {
+				return Review{Verdict: VerdictOffPlan}
+			}
+			return in.propose(VerdictStalled, calorieStep)
+		}
+	default:
+		switch {
+		case in.WeeklyRate > maxDriftRate:
+			return in.propose(VerdictDrifting, -calorieStep)
+		case in.WeeklyRate < -maxDriftRate:
+			return in.propose(VerdictDrifting, calorieStep)
+		}
+	}
+	return Review{Verdict: VerdictOnTrack}
+}
+
+// propose moves the target by delta, keeping it at MinCalories or above. No
+// change is proposed when the target is already at the floor.
+func (in ReviewInput) propose(verdict string, delta float64) Review {
+	calories := math.Round((in.Target+delta)/10) * 10
+	if calories < in.MinCalories {
+		calories = math.Ceil(in.MinCalories/10) * 10
+	}
+	if calories == in.Target || (delta < 0 && calories > in.Target) {
+		return Review{Verdict: verdict}
+	}
+	return Review{Verdict: verdict, Calories: calories}
+}
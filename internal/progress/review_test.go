@@ -0,0 +1,49 @@
+package progress
+
+import (
+	"testing"
+)
+
+func TestAssess(t *testing.T) {
+	lose := ReviewInput{Goal: "Снизить", Weight: 80, HasRate: true, Target: 2080, MinCalories: 1780}
+	gain := ReviewInput{Goal: "Набрать", Weight: 60, HasRate: true, Target: 2500, MinCalories: 1500}
+	keep := ReviewInput{Goal: "Поддерживать", Weight: 70, HasRate: true, Target: 2300, MinCalories: 1500}
+
+	with := func(in ReviewInput, rate float64, diaryDays int, diaryAverage float64) ReviewInput {
+		in.WeeklyRate, in.DiaryDays, in.DiaryAverage = rate, diaryDays, diaryAverage
+		return in
+	}
+	for name, tc := range map[string]struct {
+		in   ReviewInput
+		want Review
+	}{
+		"no rate":             {ReviewInput{Goal: "Снизить", Target: 2080}, Review{Verdict: VerdictNoData}},
+		"losing safely":       {with(lose, -0.6, 0, 0), Review{Verdict: VerdictOnTrack}},
+		"losing too fast":     {with(lose, -1.2, 0, 0), Review{Verdict: VerdictTooFast, Calories: 2230}},
+		"loss stalled":        {with(lose, -0.1, 5, 2100), Review{Verdict: VerdictStalled, Calories: 1930}},
+		"loss stalled, diary": {with(lose, 0.1, 5, 2400), Review{Verdict: VerdictOffPlan}},
+		"few diary days":      {with(lose, 0.1, 2, 2400), Review{Verdict: VerdictStalled, Calories: 1930}},
+		"gaining safely":      {with(gain, 0.2, 0, 0), Review{Verdict: VerdictOnTrack}},
+		"gaining too fast":    {with(gain, 0.5, 0, 0), Review{Verdict: VerdictTooFast, Calories: 2350}},
+		"gain stalled":        {with(gain, 0, 0, 0), Review{Verdict: VerdictStalled, Calories: 2650}},
+		"gain stalled, diary": {with(gain, 0, 4, 2000), Review{Verdict: VerdictOffPlan}},
+		"maintaining":         {with(keep, 0.2, 0, 0), Review{Verdict: VerdictOnTrack}},
+		"maintenance gaining": {with(keep, 0.4, 0, 0), Review{Verdict: VerdictDrifting, Calories: 2150}},
+		"maintenance losing":  {with(keep, -0.4, 0, 0), Review{Verdict: VerdictDrifting, Calories: 2450}},
+	} {
+		if got := Assess(tc.in); got != tc.want {
+			t.Errorf("%s: Assess = %+v, want %+v", name, got, tc.want)
+		}
+	}
+}
+
+func TestAssessKeepsMinCalories(t *testing.T) {
+	in := ReviewInput{Goal: "Снизить", Weight: 80, WeeklyRate: 0, HasRate: true, Target: 1850, MinCalories: 1780}
+	if got := Assess(in); got.Calories != 1780 {
+		t.Fatalf("Assess near the floor = %+v", got)
+	}
+	in.Target = 1780
+	if got := Assess(in); got != (Review{Verdict: VerdictStalled}) {
+		t.Fatalf("Assess at the floor = %+v", got)
+	}
+}
@@ -0,0 +1,153 @@
+// Package progress turns logged weigh-ins and body measurements into trends.
+package progress
+
+import (
+	"time"
+
+	"diet-bot/internal/models"
+)
+
+const (
+	// MovingAverageDays is the window of the smoothed weight.
+	MovingAverageDays = 7
+	// RateWindowDays is how far back the weekly rate looks.
+	RateWindowDays = 28
+)
+
+// Trend summarises a weight history.
+type Trend struct {
+	Latest        float64
+	LatestOn      time.Time
+	MovingAverage float64 // mean of the entries in the MovingAverageDays ending at LatestOn
+	WeeklyRate    float64 // kg per week over RateWindowDays, negative when losing
+	HasRate       bool    // false until there are entries on two different days
+}
+
+// ComputeTrend summarises logs, which must be ordered by LoggedOn. It returns
+// false for an empty history.
+func ComputeTrend(logs []*models.WeightLog) (Trend, bool) {
+	if len(logs) == 0 {
+		return Trend{}, false
+	}
+
+	latest := logs[len(logs)-1]
+	trend := Trend{
+		Latest:        latest.Weight,
+		LatestOn:      latest.LoggedOn,
+		MovingAverage: MovingAverage(logs, latest.LoggedOn),
+	}
+	trend.WeeklyRate, trend.HasRate = WeeklyRate(logs, latest.LoggedOn)
+	return trend, true
+}
+
+// MovingAverage is the mean weight of the entries in the MovingAverageDays
+// ending at day, inclusive. It is 0 when there are none.
+func MovingAverage(logs []*models.WeightLog, day time.Time) float64 {
+	from := day.AddDate(0, 0, -(MovingAverageDays - 1))
+
+	var sum float64
+	var n int
+	for _, l := range logs {
+		if l.LoggedOn.Before(from) || l.LoggedOn.After(day) {
+			continue
+		}
+		sum += l.Weight
+		n++
+	}
+	if n == 0 {
+		return 0
+	}
+	return sum / float64(n)
+}
+
+// WeeklyRate fits a least-squares line through the entries in the
+// RateWindowDays ending at day and returns its slope in kg per week.
+func WeeklyRate(logs []*models.WeightLog, day time.Time) (float64, bool) {
+	from := day.AddDate(0, 0, -(RateWindowDays - 1))
+
+	var xs, ys []float64
+	for _, l := range logs {
+		if l.LoggedOn.Before(from) || l.LoggedOn.After(day) {
+			continue
+		}
+		xs = append(xs, l.LoggedOn.Sub(from).Hours()/24)
+		ys = append(ys, l.Weight)
+	}
+	if len(xs) < 2 {
+		return 0, false
+	}
+
+	var meanX, meanY float64
+	for i := range xs {
+		meanX += xs[i]
+		meanY += ys[i]
+	}
+	meanX /= float64(len(xs))
+	meanY /= float64(len(ys))
+
+	var cov, varX float64
+	for i := range xs {
+		cov += (xs[i] - meanX) * (ys[i] - meanY)
+		varX += (xs[i] - meanX) * (xs[i] - meanX)
+	}
+	if varX == 0 {
+		return 0, false
+	}
+
+	return cov / varX * 7, true
+}
+
+// GoalWeeklyRate is the pace the goal line assumes for each questionnaire
+// goal, in kg per week.
+func GoalWeeklyRate(goal string) float64 {
+	switch goal {
+	case "Снизить":
+		return -0.5
+	case "Набрать":
+		return 0.25
+	default:
+		return 0
+	}
+}
+
+// MovingAverageSeries is the moving average at every logged day.
+func MovingAverageSeries(logs []*models.WeightLog) []Point {
+	points := make([]Point, len(logs))
+	for i, l := range logs {
+		points[i] = Point{Day: l.LoggedOn, Value: MovingAverage(logs[:i+1], l.LoggedOn)}
+	}
+	return points
+}
+
+// WeightChart plots the logged weights, their moving average and a goal line
+// that starts at the first entry and follows GoalWeeklyRate.
+func WeightChart(logs []*models.WeightLog, goal string) LineChart {
+	weights := make([]Point, len(logs))
+	for i, l := range logs {
+		weights[i] = Point{Day: l.LoggedOn, Value: l.Weight}
+	}
+
+	chart := LineChart{
+		Unit: "kg",
+		Series: []Series{
+			{Points: weights, Color: ColorWeight, Width: 1, Markers: true},
+			{Points: MovingAverageSeries(logs), Color: ColorAverage, Width: 3},
+		},
+	}
+
+	if len(logs) > 0 {
+		first, last := logs[0], logs[len(logs)-1]
+		weeks := last.LoggedOn.Sub(first.LoggedOn).Hours() / 24 / 7
+		chart.Series = append(chart.Series, Series{
+			Points: []Point{
+				{Day: first.LoggedOn, Value: first.Weight},
+				{Day: last.LoggedOn, Value: first.Weight + GoalWeeklyRate(goal)*weeks},
+			},
+			Color:  ColorGoal,
+			Width:  2,
+			Dashed: true,
+		})
+	}
+
+	return chart
+}
@@ -0,0 +1,74 @@
+package progress
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"diet-bot/internal/models"
+)
+
+func weighIns(start time.Time, weights ...float64) []*models.WeightLog {
+	logs := make([]*models.WeightLog, len(weights))
+	for i, w := range weights {
+		logs[i] = &models.WeightLog{Weight: w, LoggedOn: start.AddDate(0, 0, i)}
+	}
+	return logs
+}
+
+func near(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
+
+func TestComputeTrendEmpty(t *testing.T) {
+	if _, ok := ComputeTrend(nil); ok {
+		t.Fatal("trend of an empty history")
+	}
+}
+
+func TestComputeTrendSingleEntry(t *testing.T) {
+	day := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	trend, ok := ComputeTrend(weighIns(day, 80))
+	if !ok || trend.Latest != 80 || !trend.LatestOn.Equal(day) || trend.MovingAverage != 80 || trend.HasRate {
+		t.Fatalf("unexpected trend: %+v", trend)
+	}
+}
+
+func TestMovingAverageUsesLastSevenDays(t *testing.T) {
+	start := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	// The first entry falls outside the window ending on day 8
+	logs := weighIns(start, 100, 80, 80, 80, 80, 79, 79, 79)
+
+	got := MovingAverage(logs, start.AddDate(0, 0, 7))
+	if want := (80*4 + 79*3) / 7.0; !near(got, want) {
+		t.Fatalf("MovingAverage = %v, want %v", got, want)
+	}
+}
+
+func TestWeeklyRate(t *testing.T) {
+	start := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	// Losing 0.1 kg a day is 0.7 kg a week
+	logs := weighIns(start, 80, 79.9, 79.8, 79.7, 79.6, 79.5, 79.4, 79.3)
+	rate, ok := WeeklyRate(logs, start.AddDate(0, 0, 7))
+	if !ok || !near(rate, -0.7) {
+		t.Fatalf("WeeklyRate = %v, %v", rate, ok)
+	}
+
+	// Gaps between weigh-ins are measured in days, not entries
+	sparse := []*models.WeightLog{
+		{Weight: 70, LoggedOn: start},
+		{Weight: 71, LoggedOn: start.AddDate(0, 0, 14)},
+	}
+	rate, ok = WeeklyRate(sparse, start.AddDate(0, 0, 14))
+	if !ok || !near(rate, 0.5) {
+		t.Fatalf("WeeklyRate of sparse logs = %v, %v", rate, ok)
+	}
+
+	// Entries older than the window are ignored
+	old := append([]*models.WeightLog{{Weight: 120, LoggedOn: start.AddDate(0, 0, -60)}}, logs...)
+	rate, ok = WeeklyRate(old, start.AddDate(0, 0, 7))
+	if !ok || !near(rate, -0.7) {
+		t.Fatalf("WeeklyRate with old entry = %v, %v", rate, ok)
+	}
+}
@@ -0,0 +1,86 @@
+// Package safety screens users for medical risks before the bot plans their
+// diet and limits how hard a plan may cut calories.
+package safety
+
+import "diet-bot/internal/models"
+
+// Conditions a user can report during screening.
+const (
+	ConditionPregnancy      = "pregnancy" // pregnancy or breastfeeding
+	ConditionDiabetes       = "diabetes"
+	ConditionEatingDisorder = "eating_disorder"
+	ConditionKidneyDisease  = "kidney_disease"
+)
+
+// Conditions lists the screening conditions in the order they are asked.
+var Conditions = []string{ConditionPregnancy, ConditionDiabetes, ConditionEatingDisorder, ConditionKidneyDisease}
+
+// MinAge is the youngest age the bot plans diets for.
+const MinAge = 18
+
+// Reasons Assess refuses a plan.
+const (
+	RefusalMinor          = "minor"
+	RefusalPregnancy      = "pregnancy"
+	RefusalEatingDisorder = "eating_disorder"
+	RefusalKidneyDisease  = "kidney_disease"
+	RefusalUnderweight    = "underweight"
+)
+
+// UnderweightBMI is the BMI below which the bot does not plan weight loss.
+const UnderweightBMI = 18.5
+
+// diabetesMaxDeficit caps the deficit for diabetics: sharp cuts risk
+// hypoglycaemia on glucose-lowering drugs.
+const diabetesMaxDeficit = 0.15
+
+// BMI is the body mass index for weight in kg and height in cm.
+func BMI(weight float64, height int) float64 {
+	if height <= 0 {
+		return 0
+	}
+	m := float64(height) / 100
+	return weight / (m * m)
+}
+
+// Assess returns why the bot must not plan a diet for the user, or "" when it
+// may. An age of 0 means the user was never asked and is not held against
+// them.
+func Assess(user *models.User) string {
+	switch {
+	case user.Age > 0 && user.Age < MinAge:
+		return RefusalMinor
+	case user.HasCondition(ConditionEatingDisorder):
+		return RefusalEatingDisorder
+	case user.HasCondition(ConditionPregnancy):
+		return RefusalPregnancy
+	case user.HasCondition(ConditionKidneyDisease):
+		return RefusalKidneyDisease
+	case user.Goal == "Снизить" && BMI(user.Weight, user.Height) < UnderweightBMI:
+		return RefusalUnderweight
+	}
+	return ""
+}
+
+// MaxDeficit is the largest share of maintenance calories a plan may cut for
+// the user. It grows with BMI, is zero for underweight users, who must not
+// eat below maintenance, and is capped for diabetics.
+func MaxDeficit(user *models.User) float64 {
+	var limit float64
+	switch bmi := BMI(user.Weight, user.Height); {
+	case bmi < UnderweightBMI:
+		return 0
+	case bmi < 20:
+		limit = 0.10
+	case bmi < 25:
+		limit = 0.20
+	case bmi < 30:
+		limit = 0.25
+	default:
+		limit = 0.30
+	}
+	if user.HasCondition(ConditionDiabetes) && limit > diabetesMaxDeficit {
+		limit = diabetesMaxDeficit
+	}
+	return limit
+}
@@ -0,0 +1,65 @@
+package safety
+
+import (
+	"math"
+	"testing"
+
+	"diet-bot/internal/models"
+)
+
+func TestBMI(t *testing.T) {
+	if got := BMI(80, 180); math.Abs(got-24.69) > 0.01 {
+		t.Fatalf("BMI(80, 180) = %v", got)
+	}
+	if got := BMI(80, 0); got != 0 {
+		t.Fatalf("BMI without height = %v", got)
+	}
+}
+
+func TestAssess(t *testing.T) {
+	adult := func(goal string, weight float64, conditions ...string) *models.User {
+		return &models.User{Gender: "Женский", Height: 165, Weight: weight, Goal: goal, Age: 30, Conditions: conditions}
+	}
+	for _, tc := range []struct {
+		name string
+		user *models.User
+		want string
+	}{
+		{"healthy adult", adult("Снизить", 70), ""},
+		{"age not asked", &models.User{Height: 180, Weight: 80, Goal: "Снизить"}, ""},
+		{"minor", &models.User{Height: 170, Weight: 60, Goal: "Снизить", Age: 16}, RefusalMinor},
+		{"adult at min age", &models.User{Height: 170, Weight: 60, Goal: "Снизить", Age: MinAge}, ""},
+		{"pregnancy", adult("Поддерживать", 60, ConditionPregnancy), RefusalPregnancy},
+		{"eating disorder", adult("Набрать", 50, ConditionEatingDisorder), RefusalEatingDisorder},
+		{"eating disorder before pregnancy", adult("Снизить", 70, ConditionPregnancy, ConditionEatingDisorder), RefusalEatingDisorder},
+		{"kidney disease", adult("Снизить", 70, ConditionKidneyDisease), RefusalKidneyDisease},
+		{"diabetes only cautions", adult("Снизить", 70, ConditionDiabetes), ""},
+		{"underweight losing", adult("Снизить", 48), RefusalUnderweight},
+		{"underweight gaining", adult("Набрать", 48), ""},
+	} {
+		if got := Assess(tc.user); got != tc.want {
+			t.Errorf("%s: Assess = %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestMaxDeficit(t *testing.T) {
+	for _, tc := range []struct {
+		weight     float64
+		conditions []string
+		want       float64
+	}{
+		{55, nil, 0},    // BMI 17.0
+		{63, nil, 0.10}, // BMI 19.4
+		{80, nil, 0.20}, // BMI 24.7
+		{90, nil, 0.25}, // BMI 27.8
+		{110, nil, 0.30},
+		{110, []string{ConditionDiabetes}, 0.15},
+		{63, []string{ConditionDiabetes}, 0.10},
+	} {
+		user := &models.User{Height: 180, Weight: tc.weight, Conditions: tc.conditions}
+		if got := MaxDeficit(user); got != tc.want {
+			t.Errorf("MaxDeficit(%v kg, %v) = %v, want %v", tc.weight, tc.conditions, got, tc.want)
+		}
+	}
+}
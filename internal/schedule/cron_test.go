@@ -0,0 +1,115 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+)
+
+func mustLoad(t *testing.T, name string) *time.Location {
+	t.Helper()
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		t.Fatalf("LoadLocation(%s): %v", name, err)
+	}
+	return loc
+}
+
+func TestParseRejectsInvalidExpressions(t *testing.T) {
+	for _, expr := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "* * * 13 *", "* * * * 8", "*/0 * * * *", "5-1 * * * *", "a * * * *"} {
+		if _, err := Parse(expr); err == nil {
+			t.Errorf("Parse(%q) succeeded", expr)
+		}
+	}
+}
+
+func TestNext(t *testing.T) {
+	utc := time.UTC
+	// Friday 2024-03-01 10:17:30 UTC
+	from := time.Date(2024, 3, 1, 10, 17, 30, 0, utc)
+
+	for expr, want := range map[string]time.Time{
+		"* * * * *":       time.Date(2024, 3, 1, 10, 18, 0, 0, utc),
+		"0 9 * * *":       time.Date(2024, 3, 2, 9, 0, 0, 0, utc),
+		"30 10 * * *":     time.Date(2024, 3, 1, 10, 30, 0, 0, utc),
+		"0 10-20/2 * * *": time.Date(2024, 3, 1, 12, 0, 0, 0, utc),
+		"0 8 * * 1":       time.Date(2024, 3, 4, 8, 0, 0, 0, utc),
+		"0 8 * * 7":       time.Date(2024, 3, 3, 8, 0, 0, 0, utc),
+		"0 0 1 * *":       time.Date(2024, 4, 1, 0, 0, 0, 0, utc),
+		"0 12 29 2 *":     time.Date(2028, 2, 29, 12, 0, 0, 0, utc),
+		// Either day field may match when both are restricted
+		"0 9 15 * 6":   time.Date(2024, 3, 2, 9, 0, 0, 0, utc),
+		"5/20 * * * *": time.Date(2024, 3, 1, 10, 25, 0, 0, utc),
+	} {
+		s, err := Parse(expr)
+		if err != nil {
+			t.Fatalf("Parse(%q): %v", expr, err)
+		}
+		if got := s.Next(from, utc); !got.Equal(want) {
+			t.Errorf("%q.Next = %v, want %v", expr, got, want)
+		}
+	}
+
+	never, _ := Parse("0 0 30 2 *")
+	if got := never.Next(from, utc); !got.IsZero() {
+		t.Errorf("impossible schedule ran at %v", got)
+	}
+}
+
+func TestNextUsesLocalWallClock(t *testing.T) {
+	moscow := mustLoad(t, "Europe/Moscow")
+	s, _ := Parse("0 9 * * *")
+
+	// 07:00 UTC is 10:00 in Moscow, so the next 09:00 there is tomorrow
+	got := s.Next(time.Date(2024, 3, 1, 7, 0, 0, 0, time.UTC), moscow)
+	if want := time.Date(2024, 3, 2, 6, 0, 0, 0, time.UTC); !got.Equal(want) {
+		t.Fatalf("Next = %v, want %v", got, want)
+	}
+
+	// Half-hour offsets keep the minute on the wall clock
+	kolkata := mustLoad(t, "Asia/Kolkata")
+	hourly, _ := Parse("0 * * * *")
+	got = hourly.Next(time.Date(2024, 3, 1, 10, 40, 0, 0, kolkata), kolkata)
+	if want := time.Date(2024, 3, 1, 11, 0, 0, 0, kolkata); !got.Equal(want) {
+		t.Fatalf("Next in Kolkata = %v, want %v", got, want)
+	}
+}
+
+func TestNextAcrossDSTGap(t *testing.T) {
+	berlin := mustLoad(t, "Europe/Berlin")
+	s, _ := Parse("30 2 * * *")
+
+	// 02:30 does not exist on 2024-03-31 in Berlin; the next run is the day after
+	got := s.Next(time.Date(2024, 3, 30, 12, 0, 0, 0, berlin), berlin)
+	if want := time.Date(2024, 4, 1, 2, 30, 0, 0, berlin); !got.Equal(want) {
+		t.Fatalf("Next = %v, want %v", got, want)
+	}
+}
+
+func TestRule(t *testing.T) {
+	rule, err := DailyAt([]string{"13:00", "08:30"}, []time.Weekday{time.Friday, time.Monday})
+	if err != nil {
+		t.Fatalf("DailyAt: %v", err)
+	}
+	if got := rule.String(); got != "0 13 * * 1,5; 30 8 * * 1,5" {
+		t.Fatalf("rule = %q", got)
+	}
+
+	parsed, err := ParseRule(rule.String())
+	if err != nil || parsed.String() != rule.String() {
+		t.Fatalf("ParseRule round trip: %v, %v", parsed, err)
+	}
+
+	// Friday 10:00 -> Friday 13:00 -> Monday 08:30
+	next := rule.Next(time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC), time.UTC)
+	if want := time.Date(2024, 3, 1, 13, 0, 0, 0, time.UTC); !next.Equal(want) {
+		t.Fatalf("Next = %v, want %v", next, want)
+	}
+	next = rule.Next(next, time.UTC)
+	if want := time.Date(2024, 3, 4, 8, 30, 0, 0, time.UTC); !next.Equal(want) {
+		t.Fatalf("Next = %v, want %v", next, want)
+	}
+
+	if _, err := DailyAt([]string{"25:00"}, nil); err == nil {
+		t.Fatal("DailyAt accepted 25:00")
+	}
+}
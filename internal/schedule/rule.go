@@ -0,0 +1,82 @@
+package schedule
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Rule is a set of schedules that fire independently, written as cron
+// expressions separated by ";". It lets one reminder run at 08:30 and 13:00,
+// which a single expression cannot express.
+type Rule []*Schedule
+
+// ParseRule parses ";"-separated cron expressions.
+func ParseRule(text string) (Rule, error) {
+	var rule Rule
+	for _, expr := range strings.Split(text, ";") {
+		if strings.TrimSpace(expr) == "" {
+			continue
+		}
+		s, err := Parse(expr)
+		if err != nil {
+			return nil, err
+		}
+		rule = append(rule, s)
+	}
+	if len(rule) == 0 {
+		return nil, fmt.Errorf("empty rule")
+	}
+	return rule, nil
+}
+
+// String returns the rule in the form ParseRule accepts.
+func (r Rule) String() string {
+	exprs := make([]string, len(r))
+	for i, s := range r {
+		exprs[i] = s.String()
+	}
+	return strings.Join(exprs, "; ")
+}
+
+// Next returns the earliest next run of any schedule in the rule.
+func (r Rule) Next(t time.Time, loc *time.Location) time.Time {
+	var next time.Time
+	for _, s := range r {
+		n := s.Next(t, loc)
+		if !n.IsZero() && (next.IsZero() || n.Before(next)) {
+			next = n
+		}
+	}
+	return next
+}
+
+// DailyAt builds a rule firing at each "HH:MM" in times on the given
+// weekdays, or every day when weekdays is empty.
+func DailyAt(times []string, weekdays []time.Weekday) (Rule, error) {
+	dow := "*"
+	if len(weekdays) > 0 {
+		days := make([]int, len(weekdays))
+		for i, d := range weekdays {
+			days[i] = int(d)
+		}
+		sort.Ints(days)
+		parts := make([]string, len(days))
+		for i, d := range days {
+			parts[i] = strconv.Itoa(d)
+		}
+		dow = strings.Join(parts, ",")
+	}
+
+	var exprs []string
+	for _, hhmm := range times {
+		at, err := time.Parse("15:04", strings.TrimSpace(hhmm))
+		if err != nil {
+			return nil, fmt.Errorf("invalid time %q", hhmm)
+		}
+		exprs = append(exprs, fmt.Sprintf("%d %d * * %s", at.Minute(), at.Hour(), dow))
+	}
+	return ParseRule(strings.Join(exprs, ";"))
+}
@@ -3,6 +3,7 @@ package server
 import (
 	"context"
 	"diet-bot/internal/bot"
+	"diet-bot/internal/calendar"
 	"diet-bot/pkg/logger"
 	"net/http"
 	"time"
@@ -19,6 +20,9 @@ func NewServer(port string, telegramBot *bot.TelegramBot, logger *logger.Logger)
 	// Register Stripe webhook handler
 	mux.HandleFunc("/webhook/stripe", telegramBot.HandleStripeWebhook)
 
+	// Calendar apps poll the signed per-user meal plan feeds
+	mux.HandleFunc(calendar.FeedPath, telegramBot.HandleCalendarFeed)
+
 	// Add health check endpoint
 	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
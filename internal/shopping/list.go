@@ -0,0 +1,105 @@
+// Package shopping turns the ingredients of a structured plan into a
+// shopping list grouped by store section.
+package shopping
+
+import (
+	"diet-bot/internal/models"
+	"math"
+	"sort"
+	"strings"
+)
+
+// Base units amounts are converted to before they are added up.
+const (
+	UnitGram  = "г"
+	UnitML    = "мл"
+	UnitPiece = "шт"
+)
+
+// unitFactors convert the units the plan may use to a base unit.
+var unitFactors = map[string]struct {
+	unit   string
+	factor float64
+}{
+	"г": {UnitGram, 1}, "гр": {UnitGram, 1}, "грамм": {UnitGram, 1}, "граммов": {UnitGram, 1},
+	"кг": {UnitGram, 1000},
+	"мл": {UnitML, 1}, "л": {UnitML, 1000},
+	"шт": {UnitPiece, 1}, "штука": {UnitPiece, 1}, "штуки": {UnitPiece, 1}, "штук": {UnitPiece, 1},
+}
+
+// normalizeUnit returns the base unit and the factor to it. Units it does not
+// know, such as "ст. л.", are kept as they are.
+func normalizeUnit(unit string) (string, float64) {
+	key := strings.TrimSuffix(strings.ToLower(strings.TrimSpace(unit)), ".")
+	if u, ok := unitFactors[key]; ok {
+		return u.unit, u.factor
+	}
+	return strings.TrimSpace(unit), 1
+}
+
+// normalizeName makes "Гречка " and "гречка" the same product.
+func normalizeName(name string) string {
+	name = strings.ToLower(strings.Join(strings.Fields(name), " "))
+	return strings.ReplaceAll(name, "ё", "е")
+}
+
+// Build adds up the ingredients of the plan days from first to last
+// inclusive and sorts them by section, then name.
+func Build(data *models.PlanData, first, last int) []models.ShoppingItem {
+	type key struct{ name, unit string }
+	index := make(map[key]int)
+	var items []models.ShoppingItem
+
+	for _, day := range data.Days {
+		if day.Day < first || day.Day > last {
+			continue
+		}
+		for _, meal := range day.Meals {
+			for _, ing := range meal.Ingredients {
+				if strings.TrimSpace(ing.Name) == "" {
+					continue
+				}
+				unit, factor := normalizeUnit(ing.Unit)
+				k := key{normalizeName(ing.Name), unit}
+				i, ok := index[k]
+				if !ok {
+					i = len(items)
+					index[k] = i
+					items = append(items, models.ShoppingItem{
+						Name:    strings.TrimSpace(ing.Name),
+						Unit:    unit,
+						Section: SectionOf(ing.Name),
+					})
+				}
+				items[i].Amount += ing.Amount * factor
+			}
+		}
+	}
+
+	for i := range items {
+		items[i].Amount = roundAmount(items[i].Amount, items[i].Unit)
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		a, b := sectionRank[items[i].Section], sectionRank[items[j].Section]
+		if a != b {
+			return a < b
+		}
+		return normalizeName(items[i].Name) < normalizeName(items[j].Name)
+	})
+	for i := range items {
+		items[i].Position = i + 1
+	}
+	return items
+}
+
+// roundAmount rounds grams and millilitres up to 10 and pieces up to whole
+// ones: nobody buys 183 g of cheese or half an egg.
+func roundAmount(amount float64, unit string) float64 {
+	switch unit {
+	case UnitGram, UnitML:
+		return math.Ceil(amount/10) * 10
+	case UnitPiece:
+		return math.Ceil(amount)
+	}
+	return math.Round(amount*10) / 10
+}
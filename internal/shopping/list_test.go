@@ -0,0 +1,66 @@
+package shopping
+
+import (
+	"diet-bot/internal/models"
+	"testing"
+)
+
+func TestBuild(t *testing.T) {
+	meal := func(ingredients ...models.Ingredient) models.PlanMeal {
+		return models.PlanMeal{Ingredients: ingredients}
+	}
+	data := &models.PlanData{Days: []models.PlanDay{
+		{Day: 1, Meals: []models.PlanMeal{
+			meal(models.Ingredient{Name: "Гречка", Amount: 80, Unit: "г"}, models.Ingredient{Name: "Молоко", Amount: 0.2, Unit: "л"}),
+			meal(models.Ingredient{Name: "Яйцо", Amount: 1.5, Unit: "шт."}, models.Ingredient{Name: "Оливковое масло", Amount: 1, Unit: "ст. л."}),
+		}},
+		{Day: 2, Meals: []models.PlanMeal{
+			meal(models.Ingredient{Name: "гречка ", Amount: 0.083, Unit: "кг"}, models.Ingredient{Name: "Молоко", Amount: 250, Unit: "мл"}),
+			meal(models.Ingredient{Name: "Банан", Amount: 2, Unit: "шт"}),
+		}},
+		{Day: 3, Meals: []models.PlanMeal{
+			meal(models.Ingredient{Name: "Треска", Amount: 200, Unit: "г"}),
+		}},
+	}}
+
+	items := Build(data, 1, 2)
+	want := []models.ShoppingItem{
+		{Position: 1, Name: "Банан", Amount: 2, Unit: UnitPiece, Section: SectionProduce},
+		{Position: 2, Name: "Молоко", Amount: 450, Unit: UnitML, Section: SectionDairy},
+		{Position: 3, Name: "Яйцо", Amount: 2, Unit: UnitPiece, Section: SectionDairy},
+		{Position: 4, Name: "Гречка", Amount: 170, Unit: UnitGram, Section: SectionGrains},
+		{Position: 5, Name: "Оливковое масло", Amount: 1, Unit: "ст. л.", Section: SectionGrocery},
+	}
+	if len(items) != len(want) {
+		t.Fatalf("Build = %+v", items)
+	}
+	for i := range want {
+		if items[i] != want[i] {
+			t.Errorf("item %d = %+v, want %+v", i, items[i], want[i])
+		}
+	}
+
+	if items := Build(data, 3, 3); len(items) != 1 || items[0].Name != "Треска" {
+		t.Fatalf("Build(3, 3) = %+v", items)
+	}
+}
+
+func TestSectionOf(t *testing.T) {
+	for name, want := range map[string]string{
+		"Куриное филе":           SectionMeat,
+		"Творог 5%":              SectionDairy,
+		"Сливочное масло":        SectionDairy,
+		"Масло сливочное":        SectionDairy,
+		"Оливковое масло":        SectionGrocery,
+		"Тунец консервированный": SectionGrocery,
+		"Овсяные хлопья":         SectionGrains,
+		"Черника":                SectionProduce,
+		"Перец болгарский":       SectionProduce,
+		"Зелёный чай":            SectionDrinks,
+		"Тофу":                   SectionOther,
+	} {
+		if got := SectionOf(name); got != want {
+			t.Errorf("SectionOf(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package shopping
+
+import (
+	"strings"
+)
+
+// Store sections, in the order a list shows them.
+const (
+	SectionProduce = "🥦 Овощи, фрукты и зелень"
+	SectionMeat    = "🥩 Мясо, птица и рыба"
+	SectionDairy   = "🥛 Молочные продукты и яйца"
+	SectionGrains  = "🌾 Крупы, макароны и хлеб"
+	SectionGrocery = "🥫 Бакалея"
+	SectionDrinks  = "🧃 Напитки"
+	SectionOther   = "🛒 Другое"
+)
+
+var sectionRank = map[string]int{
+	SectionProduce: 1, SectionMeat: 2, SectionDairy: 3, SectionGrains: 4,
+	SectionGrocery: 5, SectionDrinks: 6, SectionOther: 7,
+}
+
+// sectionStems map the start of a product's word to its section. The first
+// section with a matching word wins, so more specific stems come first.
+var sectionStems = []struct {
+	section string
+	stems   []string
+}{
+	{SectionDairy, []string{"молок", "кефир", "творог", "творож", "сыр", "йогурт", "сметан", "сливк", "сливочн", "ряженк", "простокваш", "яйц", "яйко", "яйка"}},
+	{SectionGrocery, []string{"консерв", "масло", "мед", "мёд", "соль", "сахар", "специ", "перец черн", "уксус", "соус", "орех", "миндал", "семечк", "семен", "чиа", "изюм", "курага", "чернослив", "какао", "арахис", "паста томат", "томатн", "горчиц", "майонез", "мука", "крахмал", "разрыхл", "желатин", "шоколад"}},
+	{SectionMeat, []string{"куриц", "курин", "филе", "индейк", "говя", "свин", "телят", "фарш", "печень", "мясо", "рыб", "треск", "лосос", "семг", "сёмг", "тунец", "тунц", "минта", "хек", "скумбри", "сельд", "горбуш", "кревет", "кальмар", "мидии", "форел", "судак", "ветчин", "колбас", "сосиск"}},
+	{SectionGrains, []string{"греч", "рис", "овсян", "овёс", "овес", "хлопь", "макарон", "спагетти", "паста", "киноа", "булгур", "перлов", "пшен", "кускус", "хлеб", "хлебц", "лаваш", "батон", "тортиль", "мюсли", "гранол", "крупа", "лапш", "чечевиц", "фасол", "нут", "горох"}},
+	{SectionDrinks, []string{"вода", "чай", "кофе", "сок", "морс", "компот"}},
+	{SectionProduce, []string{"помидор", "томат", "огур", "капуст", "брокк", "морков", "свекл", "свёкл", "картоф", "лук", "чеснок", "перец", "кабач", "баклаж", "тыкв", "шпинат", "салат", "руккол", "зелен", "укроп", "петруш", "кинз", "базилик", "сельдер", "спарж", "горошек", "кукуруз", "гриб", "шампин", "авокадо", "яблок", "банан", "апельсин", "мандарин", "лимон", "лайм", "груш", "киви", "ягод", "черник", "клубник", "малин", "голубик", "вишн", "виноград", "персик", "абрикос", "слив", "гранат", "ананас", "манго", "хурм", "фрукт", "овощ", "редис", "имбир"}},
+}
+
+// SectionOf guesses the store section of a product from its name.
+func SectionOf(name string) string {
+	name = strings.ToLower(name)
+	words := strings.Fields(name)
+	for _, s := range sectionStems {
+		for _, stem := range s.stems {
+			// Two-word stems such as "перец черн" match the name, the others a word
+			if strings.Contains(stem, " ") {
+				if strings.Contains(name, stem) {
+					return s.section
+				}
+				continue
+			}
+			for _, w := range words {
+				if strings.HasPrefix(strings.Trim(w, "«»\"(),."), stem) {
+					return s.section
+				}
+			}
+		}
+	}
+	return SectionOther
+}
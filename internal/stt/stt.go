@@ -0,0 +1,82 @@
+// Package stt turns voice messages into text.
+package stt
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// Providers New knows about.
+const (
+	ProviderOpenAI  = "openai"
+	ProviderWhisper = "whisper"
+	ProviderNone    = "none"
+)
+
+// Transcriber turns recorded speech into text. name is the file name of the
+// recording; providers use its extension to tell the format.
+type Transcriber interface {
+	Transcribe(ctx context.Context, audio io.Reader, name string) (string, error)
+}
+
+// New creates the transcriber the config asks for. It returns nil for
+// ProviderNone, which leaves voice messages unsupported.
+func New(cfg struct {
+	Provider string
+	BaseURL  string
+	APIKey   string
+	Model    string
+	Language string
+}) (Transcriber, error) {
+	switch cfg.Provider {
+	case "", ProviderOpenAI:
+		return NewOpenAI(cfg.APIKey, cfg.BaseURL, cfg.Model, cfg.Language), nil
+	case ProviderWhisper:
+		if cfg.BaseURL == "" {
+			return nil, fmt.Errorf("whisper provider needs a base URL")
+		}
+		return NewWhisper(cfg.BaseURL, cfg.Language), nil
+	case ProviderNone:
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("unknown speech-to-text provider %q", cfg.Provider)
+	}
+}
+
+// OpenAI transcribes through an OpenAI-compatible /audio/transcriptions
+// endpoint.
+type OpenAI struct {
+	client   *openai.Client
+	model    string
+	language string
+}
+
+// NewOpenAI creates a transcriber for the OpenAI API, or for a compatible
+// server at baseURL when it is set. An empty model means whisper-1.
+func NewOpenAI(apiKey, baseURL, model, language string) *OpenAI {
+	config := openai.DefaultConfig(apiKey)
+	if baseURL != "" {
+		config.BaseURL = baseURL
+	}
+	if model == "" {
+		model = openai.Whisper1
+	}
+	return &OpenAI{client: openai.NewClientWithConfig(config), model: model, language: language}
+}
+
+func (o *OpenAI) Transcribe(ctx context.Context, audio io.Reader, name string) (string, error) {
+	resp, err := o.client.CreateTranscription(ctx, openai.AudioRequest{
+		Model:    o.model,
+		FilePath: name,
+		Reader:   audio,
+		Language: o.language,
+		Format:   openai.AudioResponseFormatJSON,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to transcribe: %w", err)
+	}
+	return resp.Text, nil
+}
@@ -0,0 +1,93 @@
+package stt
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// fakeServer records the uploaded recording and answers with text.
+func fakeServer(t *testing.T, path, text string, got map[string]string) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != path {
+			http.NotFound(w, r)
+			return
+		}
+		f, header, err := r.FormFile("file")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		data, _ := io.ReadAll(f)
+		got["name"] = header.Filename
+		got["data"] = string(data)
+		got["model"] = r.FormValue("model")
+		got["language"] = r.FormValue("language")
+		json.NewEncoder(w).Encode(map[string]string{"text": text})
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestOpenAITranscribe(t *testing.T) {
+	got := map[string]string{}
+	srv := fakeServer(t, "/v1/audio/transcriptions", "овсянка и банан", got)
+
+	text, err := NewOpenAI("key", srv.URL+"/v1", "", "ru").Transcribe(context.Background(), strings.NewReader("OggS"), "voice.ogg")
+	if err != nil {
+		t.Fatalf("Transcribe: %v", err)
+	}
+	if text != "овсянка и банан" {
+		t.Fatalf("text = %q", text)
+	}
+	if got["name"] != "voice.ogg" || got["data"] != "OggS" || got["model"] != "whisper-1" || got["language"] != "ru" {
+		t.Fatalf("request = %v", got)
+	}
+}
+
+func TestWhisperTranscribe(t *testing.T) {
+	got := map[string]string{}
+	srv := fakeServer(t, "/inference", " гречка 200 г\n", got)
+
+	text, err := NewWhisper(srv.URL+"/", "ru").Transcribe(context.Background(), strings.NewReader("OggS"), "voice.ogg")
+	if err != nil {
+		t.Fatalf("Transcribe: %v", err)
+	}
+	if text != "гречка 200 г" {
+		t.Fatalf("text = %q", text)
+	}
+	if got["data"] != "OggS" || got["language"] != "ru" {
+		t.Fatalf("request = %v", got)
+	}
+
+	if _, err := NewWhisper(srv.URL+"/missing", "").Transcribe(context.Background(), strings.NewReader("OggS"), "voice.ogg"); err == nil {
+		t.Fatal("expected an error for a 404")
+	}
+}
+
+func TestNew(t *testing.T) {
+	type config = struct {
+		Provider string
+		BaseURL  string
+		APIKey   string
+		Model    string
+		Language string
+	}
+	if tr, err := New(config{Provider: ProviderNone}); tr != nil || err != nil {
+		t.Fatalf("none = %v, %v", tr, err)
+	}
+	if _, err := New(config{Provider: ProviderWhisper}); err == nil {
+		t.Fatal("whisper without a URL was accepted")
+	}
+	if _, err := New(config{Provider: "vosk"}); err == nil {
+		t.Fatal("unknown provider was accepted")
+	}
+	if tr, err := New(config{APIKey: "key"}); err != nil || tr == nil {
+		t.Fatalf("default = %v, %v", tr, err)
+	}
+}
@@ -0,0 +1,73 @@
+package stt
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Whisper transcribes through a self-hosted whisper.cpp server, which takes
+// the recording on POST /inference.
+type Whisper struct {
+	url      string
+	language string
+	client   *http.Client
+}
+
+// NewWhisper creates a transcriber for the whisper.cpp server at baseURL.
+func NewWhisper(baseURL, language string) *Whisper {
+	return &Whisper{
+		url:      strings.TrimSuffix(baseURL, "/") + "/inference",
+		language: language,
+		client:   &http.Client{Timeout: 2 * time.Minute},
+	}
+}
+
+func (w *Whisper) Transcribe(ctx context.Context, audio io.Reader, name string) (string, error) {
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, err := form.CreateFormFile("file", name)
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(part, audio); err != nil {
+		return "", err
+	}
+	form.WriteField("response_format", "json")
+	if w.language != "" {
+		form.WriteField("language", w.language)
+	}
+	if err := form.Close(); err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, &body)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", form.FormDataContentType())
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to transcribe: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return "", fmt.Errorf("failed to transcribe: %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+
+	var result struct {
+		Text string `json:"text"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", fmt.Errorf("failed to decode transcription: %w", err)
+	}
+	return strings.TrimSpace(result.Text), nil
+}
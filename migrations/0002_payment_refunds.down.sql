@@ -0,0 +1,2 @@
+ALTER TABLE payments DROP COLUMN IF EXISTS refunded_amount;
+ALTER TABLE payments DROP COLUMN IF EXISTS stripe_payment_intent_id;
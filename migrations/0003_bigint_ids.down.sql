@@ -0,0 +1,11 @@
+ALTER SEQUENCE diet_plans_id_seq AS INTEGER;
+ALTER TABLE diet_plans ALTER COLUMN payment_id TYPE INTEGER;
+ALTER TABLE diet_plans ALTER COLUMN user_id TYPE INTEGER;
+ALTER TABLE diet_plans ALTER COLUMN id TYPE INTEGER;
+
+ALTER SEQUENCE payments_id_seq AS INTEGER;
+ALTER TABLE payments ALTER COLUMN user_id TYPE INTEGER;
+ALTER TABLE payments ALTER COLUMN id TYPE INTEGER;
+
+ALTER SEQUENCE users_id_seq AS INTEGER;
+ALTER TABLE users ALTER COLUMN id TYPE INTEGER;
@@ -0,0 +1,12 @@
+-- Ids are int64 in Go; SERIAL and INTEGER foreign keys overflow at 2^31.
+ALTER TABLE users ALTER COLUMN id TYPE BIGINT;
+ALTER SEQUENCE users_id_seq AS BIGINT;
+
+ALTER TABLE payments ALTER COLUMN id TYPE BIGINT;
+ALTER TABLE payments ALTER COLUMN user_id TYPE BIGINT;
+ALTER SEQUENCE payments_id_seq AS BIGINT;
+
+ALTER TABLE diet_plans ALTER COLUMN id TYPE BIGINT;
+ALTER TABLE diet_plans ALTER COLUMN user_id TYPE BIGINT;
+ALTER TABLE diet_plans ALTER COLUMN payment_id TYPE BIGINT;
+ALTER SEQUENCE diet_plans_id_seq AS BIGINT;
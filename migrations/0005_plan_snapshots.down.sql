@@ -0,0 +1,5 @@
+ALTER TABLE diet_plans DROP COLUMN IF EXISTS completion_tokens;
+ALTER TABLE diet_plans DROP COLUMN IF EXISTS prompt_tokens;
+ALTER TABLE diet_plans DROP COLUMN IF EXISTS model;
+ALTER TABLE diet_plans DROP COLUMN IF EXISTS prompt_version;
+ALTER TABLE diet_plans DROP COLUMN IF EXISTS profile_snapshot;
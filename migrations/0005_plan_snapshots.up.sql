@@ -0,0 +1,7 @@
+-- Plans saved before this migration keep an empty snapshot: the profile they
+-- were generated from has been overwritten since.
+ALTER TABLE diet_plans ADD COLUMN IF NOT EXISTS profile_snapshot JSONB NOT NULL DEFAULT '{}';
+ALTER TABLE diet_plans ADD COLUMN IF NOT EXISTS prompt_version VARCHAR(50) NOT NULL DEFAULT '';
+ALTER TABLE diet_plans ADD COLUMN IF NOT EXISTS model VARCHAR(100) NOT NULL DEFAULT '';
+ALTER TABLE diet_plans ADD COLUMN IF NOT EXISTS prompt_tokens INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE diet_plans ADD COLUMN IF NOT EXISTS completion_tokens INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS weight_logs;
+
+ALTER TABLE users ALTER COLUMN weight TYPE INTEGER USING round(weight);
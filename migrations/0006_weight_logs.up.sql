@@ -0,0 +1,15 @@
+ALTER TABLE users ALTER COLUMN weight TYPE NUMERIC(5, 1);
+
+CREATE TABLE IF NOT EXISTS weight_logs (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    weight NUMERIC(5, 1) NOT NULL,
+    logged_on DATE NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (user_id, logged_on)
+);
+
+-- Seed each history with the questionnaire weight
+INSERT INTO weight_logs (user_id, weight, logged_on)
+SELECT id, weight, COALESCE(updated_at, created_at, CURRENT_TIMESTAMP)::date FROM users
+ON CONFLICT (user_id, logged_on) DO NOTHING;
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS reminders;
+
+ALTER TABLE users DROP COLUMN IF EXISTS blocked_at;
@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS food_logs (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    logged_on DATE NOT NULL,
+    name TEXT NOT NULL,
+    grams NUMERIC(7,1) NOT NULL DEFAULT 0,
+    calories NUMERIC(7,1) NOT NULL,
+    protein NUMERIC(6,1) NOT NULL,
+    fat NUMERIC(6,1) NOT NULL,
+    carbs NUMERIC(6,1) NOT NULL,
+    source VARCHAR(20) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_food_logs_user_day ON food_logs(user_id, logged_on);
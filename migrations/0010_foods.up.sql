@@ -0,0 +1,19 @@
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+-- Nutrient values are per 100 g of the edible part
+CREATE TABLE IF NOT EXISTS foods (
+    id BIGSERIAL PRIMARY KEY,
+    source VARCHAR(20) NOT NULL,
+    external_id TEXT NOT NULL,
+    name TEXT NOT NULL,
+    calories NUMERIC(7,1) NOT NULL,
+    protein NUMERIC(6,1) NOT NULL DEFAULT 0,
+    fat NUMERIC(6,1) NOT NULL DEFAULT 0,
+    carbs NUMERIC(6,1) NOT NULL DEFAULT 0,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (source, external_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_foods_name_trgm ON foods USING GIN (name gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS idx_foods_name_fts ON foods USING GIN (to_tsvector('simple', name));
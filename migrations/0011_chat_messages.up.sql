@@ -0,0 +1,13 @@
+-- Questions users ask about their plan and the answers, kept as conversation
+-- memory and for the daily question quota. /forget blanks a conversation and
+-- sets forgotten_at instead of deleting it, so its questions still count.
+CREATE TABLE IF NOT EXISTS chat_messages (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    role VARCHAR(20) NOT NULL,
+    content TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    forgotten_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_chat_messages_user ON chat_messages(user_id, created_at);
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_diet_plans_payment;
+ALTER TABLE diet_plans DROP COLUMN IF EXISTS revision;
+ALTER TABLE diet_plans DROP COLUMN IF EXISTS parent_id;
+ALTER TABLE diet_plans DROP COLUMN IF EXISTS plan_data;
@@ -0,0 +1,7 @@
+-- Structured plans and their revisions. A revision is a new row linked to the
+-- plan it was made from and paid for by the same payment.
+ALTER TABLE diet_plans ADD COLUMN IF NOT EXISTS plan_data JSONB;
+ALTER TABLE diet_plans ADD COLUMN IF NOT EXISTS parent_id BIGINT REFERENCES diet_plans(id) ON DELETE SET NULL;
+ALTER TABLE diet_plans ADD COLUMN IF NOT EXISTS revision VARCHAR(20) NOT NULL DEFAULT '';
+
+CREATE INDEX IF NOT EXISTS idx_diet_plans_payment ON diet_plans(payment_id);
@@ -0,0 +1,22 @@
+CREATE TABLE IF NOT EXISTS shopping_lists (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    plan_id BIGINT NOT NULL REFERENCES diet_plans(id) ON DELETE CASCADE,
+    first_day INTEGER NOT NULL,
+    last_day INTEGER NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Items are rows of their own so ticking one off is a single atomic update
+CREATE TABLE IF NOT EXISTS shopping_items (
+    list_id BIGINT NOT NULL REFERENCES shopping_lists(id) ON DELETE CASCADE,
+    position INTEGER NOT NULL,
+    name TEXT NOT NULL,
+    amount NUMERIC(10,1) NOT NULL,
+    unit VARCHAR(20) NOT NULL,
+    section VARCHAR(100) NOT NULL,
+    checked BOOLEAN NOT NULL DEFAULT FALSE,
+    PRIMARY KEY (list_id, position)
+);
+
+CREATE INDEX IF NOT EXISTS idx_shopping_lists_user ON shopping_lists(user_id);
@@ -0,0 +1,13 @@
+-- Recipes generated for plan dishes. The cache key is a hash of the dish and
+-- the restrictions it was cooked for, so identical requests share one row.
+CREATE TABLE IF NOT EXISTS recipes (
+    id BIGSERIAL PRIMARY KEY,
+    cache_key VARCHAR(64) NOT NULL UNIQUE,
+    dish TEXT NOT NULL,
+    restrictions TEXT[] NOT NULL DEFAULT '{}',
+    recipe_data JSONB NOT NULL,
+    model VARCHAR(100) NOT NULL DEFAULT '',
+    prompt_tokens INTEGER NOT NULL DEFAULT 0,
+    completion_tokens INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
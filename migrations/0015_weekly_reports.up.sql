@@ -0,0 +1,13 @@
+-- Weekly progress reports. One per user and week, claimed before it is sent.
+CREATE TABLE IF NOT EXISTS weekly_reports (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    plan_id BIGINT NOT NULL REFERENCES diet_plans(id) ON DELETE CASCADE,
+    week_start DATE NOT NULL,
+    verdict VARCHAR(20) NOT NULL,
+    weekly_rate NUMERIC(5,2) NOT NULL DEFAULT 0,
+    target_calories INTEGER NOT NULL,
+    proposed_calories INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (user_id, week_start)
+);
@@ -0,0 +1,8 @@
+-- Water drunk per user and day, in ml. The counter only goes up and down.
+CREATE TABLE IF NOT EXISTS water_logs (
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    logged_on DATE NOT NULL,
+    amount INTEGER NOT NULL DEFAULT 0 CHECK (amount >= 0),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, logged_on)
+);
@@ -0,0 +1,17 @@
+-- Body measurements in cm, one set per user and day, with the body fat
+-- estimated from them. users.body_fat mirrors the latest estimate.
+CREATE TABLE IF NOT EXISTS measurements (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    waist NUMERIC(5, 1) NOT NULL DEFAULT 0,
+    hip NUMERIC(5, 1) NOT NULL DEFAULT 0,
+    chest NUMERIC(5, 1) NOT NULL DEFAULT 0,
+    neck NUMERIC(5, 1) NOT NULL DEFAULT 0,
+    weight NUMERIC(5, 1) NOT NULL,
+    body_fat NUMERIC(4, 1) NOT NULL DEFAULT 0,
+    logged_on DATE NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (user_id, logged_on)
+);
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS body_fat NUMERIC(4, 1) NOT NULL DEFAULT 0;
@@ -0,0 +1,4 @@
+-- Medical screening answers from onboarding. Age 0 means the user signed up
+-- before the bot asked.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS age INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS conditions TEXT[] NOT NULL DEFAULT '{}';
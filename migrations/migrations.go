@@ -0,0 +1,9 @@
+// Package migrations embeds the numbered SQL migrations applied by db.Migrate.
+//
+// Files are named NNNN_description.up.sql and NNNN_description.down.sql.
+package migrations
+
+import "embed"
+
+//go:embed *.sql
+var FS embed.FS